@@ -0,0 +1,146 @@
+package algorand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sdkmodels "github.com/algorand/go-algorand-sdk/v2/client/v2/common/models"
+)
+
+// DefaultAccountTTL is how long account checks are cached unless configured otherwise
+const DefaultAccountTTL = time.Minute
+
+// Account health errors returned by CheckReceivable
+var (
+	ErrAccountClosed   = errors.New("account is closed or unfunded")
+	ErrAssetNotOptedIn = errors.New("account has not opted in to asset")
+	ErrAssetFrozen     = errors.New("account holding of asset is frozen")
+	ErrAccountRekeyed  = errors.New("account is rekeyed")
+)
+
+// AccountChecker caches whether accounts can receive assets
+type AccountChecker struct {
+	client *Client
+	mu     sync.Mutex
+	ttl    time.Duration
+	cache  map[accountCheckKey]cachedCheck
+}
+
+// accountCheckKey identifies a cached check
+type accountCheckKey struct {
+	address string
+	assetID uint64
+}
+
+// cachedCheck is a check result and the time it stops being served; a nil
+// err means the account can receive the asset
+type cachedCheck struct {
+	err     error
+	expires time.Time
+}
+
+// newAccountChecker creates an account checker using the client's node
+func newAccountChecker(client *Client, ttl time.Duration) *AccountChecker {
+	return &AccountChecker{
+		client: client,
+		ttl:    ttl,
+		cache:  make(map[accountCheckKey]cachedCheck),
+	}
+}
+
+// Check reports whether an address can receive an asset. It returns one of
+// the account health errors for accounts that cannot, and another error when
+// the node cannot be reached; only health results are cached.
+func (a *AccountChecker) Check(address string, assetID uint64) error {
+	key := accountCheckKey{address: address, assetID: assetID}
+
+	a.mu.Lock()
+	entry, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.err
+	}
+
+	err := a.check(address, assetID)
+	if err != nil && !isHealthError(err) {
+		return err
+	}
+
+	a.mu.Lock()
+	a.cache[key] = cachedCheck{err: err, expires: time.Now().Add(a.ttl)}
+	a.mu.Unlock()
+	return err
+}
+
+// check looks up the account and its holding of the asset
+func (a *AccountChecker) check(address string, assetID uint64) error {
+	account, err := a.client.GetAccountInfo(address)
+	if err != nil {
+		return err
+	}
+	if account.Amount == 0 {
+		return fmt.Errorf("%w: %s", ErrAccountClosed, address)
+	}
+
+	if assetID != 0 {
+		holding, err := a.client.algodClient.AccountAssetInformation(address, assetID).Do(context.Background())
+		if isNotFound(err) {
+			return fmt.Errorf("%w %d", ErrAssetNotOptedIn, assetID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get asset holding: %w", err)
+		}
+		if holding.AssetHolding.IsFrozen {
+			return fmt.Errorf("%w %d", ErrAssetFrozen, assetID)
+		}
+	}
+
+	if account.AuthAddr != "" {
+		return fmt.Errorf("%w to %s", ErrAccountRekeyed, account.AuthAddr)
+	}
+	return nil
+}
+
+// SetTTL changes how long results are cached; existing entries keep their expiry
+func (a *AccountChecker) SetTTL(ttl time.Duration) {
+	a.mu.Lock()
+	a.ttl = ttl
+	a.mu.Unlock()
+}
+
+// isHealthError reports whether err describes the account rather than a lookup failure
+func isHealthError(err error) bool {
+	return errors.Is(err, ErrAccountClosed) ||
+		errors.Is(err, ErrAssetNotOptedIn) ||
+		errors.Is(err, ErrAssetFrozen) ||
+		errors.Is(err, ErrAccountRekeyed)
+}
+
+// isNotFound reports whether a node request failed with 404
+func isNotFound(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "HTTP 404")
+}
+
+// GetAccountInfo gets account information
+func (c *Client) GetAccountInfo(address string) (sdkmodels.Account, error) {
+	accountInfo, err := c.algodClient.AccountInformation(address).Exclude("all").Do(context.Background())
+	if err != nil {
+		return sdkmodels.Account{}, fmt.Errorf("failed to get account info: %w", err)
+	}
+	return accountInfo, nil
+}
+
+// CheckReceivable reports whether an address can receive an asset, using
+// cached results where available
+func (c *Client) CheckReceivable(address string, assetID uint64) error {
+	return c.accounts.Check(address, assetID)
+}
+
+// SetAccountCacheTTL sets how long account checks are cached
+func (c *Client) SetAccountCacheTTL(ttl time.Duration) {
+	c.accounts.SetTTL(ttl)
+}
@@ -0,0 +1,109 @@
+package algorand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultAssetTTL is how long asset params are cached unless configured otherwise
+const DefaultAssetTTL = time.Hour
+
+// AssetInfo holds the display params of an asset
+type AssetInfo struct {
+	ID       uint64 `json:"asset_id"`
+	Name     string `json:"name"`
+	UnitName string `json:"unit_name"`
+	Decimals uint64 `json:"decimals"`
+	URL      string `json:"url,omitempty"`
+}
+
+// ErrAssetNotFound is returned for asset IDs that do not exist on the network
+var ErrAssetNotFound = errors.New("asset not found")
+
+// algoAsset describes the native ALGO asset, which has no on-chain params
+var algoAsset = AssetInfo{ID: 0, Name: "Algorand", UnitName: "ALGO", Decimals: 6}
+
+// AssetRegistry caches asset params fetched from the node
+type AssetRegistry struct {
+	fetch func(assetID uint64) (AssetInfo, error)
+	mu    sync.Mutex
+	ttl   time.Duration
+	cache map[uint64]cachedAsset
+}
+
+// cachedAsset is an asset entry and the time it stops being served
+type cachedAsset struct {
+	info    AssetInfo
+	expires time.Time
+}
+
+// newAssetRegistry creates a registry loading assets with fetch
+func newAssetRegistry(fetch func(assetID uint64) (AssetInfo, error), ttl time.Duration) *AssetRegistry {
+	return &AssetRegistry{
+		fetch: fetch,
+		ttl:   ttl,
+		cache: make(map[uint64]cachedAsset),
+	}
+}
+
+// Get returns an asset's params, fetching them when missing or stale
+func (r *AssetRegistry) Get(assetID uint64) (AssetInfo, error) {
+	if assetID == 0 {
+		return algoAsset, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[assetID]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.info, nil
+	}
+
+	info, err := r.fetch(assetID)
+	if err != nil {
+		return AssetInfo{}, err
+	}
+
+	r.mu.Lock()
+	r.cache[assetID] = cachedAsset{info: info, expires: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return info, nil
+}
+
+// SetTTL changes how long entries are cached; existing entries keep their expiry
+func (r *AssetRegistry) SetTTL(ttl time.Duration) {
+	r.mu.Lock()
+	r.ttl = ttl
+	r.mu.Unlock()
+}
+
+// GetAssetInfo gets information about an asset, served from the asset registry
+func (c *Client) GetAssetInfo(assetID uint64) (AssetInfo, error) {
+	return c.assets.Get(assetID)
+}
+
+// SetAssetCacheTTL sets how long asset params are cached
+func (c *Client) SetAssetCacheTTL(ttl time.Duration) {
+	c.assets.SetTTL(ttl)
+}
+
+// fetchAssetInfo loads an ASA's params from the node
+func (c *Client) fetchAssetInfo(assetID uint64) (AssetInfo, error) {
+	asset, err := c.algodClient.GetAssetByID(assetID).Do(context.Background())
+	if isNotFound(err) {
+		return AssetInfo{}, fmt.Errorf("%w: %d", ErrAssetNotFound, assetID)
+	}
+	if err != nil {
+		return AssetInfo{}, fmt.Errorf("failed to get asset info: %w", err)
+	}
+	return AssetInfo{
+		ID:       assetID,
+		Name:     asset.Params.Name,
+		UnitName: asset.Params.UnitName,
+		Decimals: asset.Params.Decimals,
+		URL:      asset.Params.Url,
+	}, nil
+}
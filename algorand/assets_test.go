@@ -0,0 +1,48 @@
+package algorand
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAssetRegistry checks asset params are cached for the TTL and that
+// failed lookups are not cached
+func TestAssetRegistry(t *testing.T) {
+	fetches := 0
+	var fail error
+	registry := newAssetRegistry(func(assetID uint64) (AssetInfo, error) {
+		fetches++
+		if fail != nil {
+			return AssetInfo{}, fail
+		}
+		return AssetInfo{ID: assetID, UnitName: "USDC", Decimals: 6}, nil
+	}, time.Hour)
+
+	if info, err := registry.Get(0); err != nil || info != algoAsset || fetches != 0 {
+		t.Fatalf("Get(0) = %+v, %v after %d fetches, want ALGO without a fetch", info, err, fetches)
+	}
+
+	fail = errors.New("node unavailable")
+	if _, err := registry.Get(31566704); err == nil {
+		t.Fatal("Get succeeded while the node was unavailable")
+	}
+	fail = nil
+	for range 3 {
+		info, err := registry.Get(31566704)
+		if err != nil || info.UnitName != "USDC" || info.Decimals != 6 {
+			t.Fatalf("Get = %+v, %v", info, err)
+		}
+	}
+	if fetches != 2 {
+		t.Fatalf("fetched %d times, want a failed fetch and one cached", fetches)
+	}
+
+	// Entries expire after the TTL in force when they were fetched
+	registry.SetTTL(-time.Second)
+	registry.Get(386192725)
+	registry.Get(386192725)
+	if fetches != 4 {
+		t.Fatalf("fetched %d times, want expired entries fetched again", fetches)
+	}
+}
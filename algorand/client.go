@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"algopay/models"
@@ -17,6 +18,10 @@ import (
 type Client struct {
 	algodClient   *algod.Client
 	indexerClient *indexer.Client
+	indexer       paymentIndexer
+	keyring       *Keyring
+	assets        *AssetRegistry
+	accounts      *AccountChecker
 }
 
 // Transaction represents a simplified transaction for our use case
@@ -44,79 +49,55 @@ func NewClient(nodeURL, indexerURL, token string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create indexer client: %w", err)
 	}
 
-	return &Client{
+	client := &Client{
 		algodClient:   algodClient,
 		indexerClient: indexerClient,
-	}, nil
-}
-
-// GetAccountInfo gets account information
-// func (c *Client) GetAccountInfo(address string) (types.Account, error) {
-// 	accountInfo, err := c.algodClient.AccountInformation(address).Do(context.Background())
-// 	if err != nil {
-// 		return types.Account{}, fmt.Errorf("failed to get account info: %w", err)
-// 	}
-// 	return accountInfo, nil
-// }
-
-// CheckPayment checks if a payment has been made to the specified address
-func (c *Client) CheckPayment(payment *models.Payment, lastCheckedRound uint64) (*Transaction, error) {
-	// Query transactions for the merchant address
-	result, err := c.indexerClient.LookupAccountTransactions(payment.MerchantAddress).
-		MinRound(lastCheckedRound + 1).
-		TxType("pay"). // For ALGO payments
-		Do(context.Background())
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to lookup transactions: %w", err)
+		indexer:       sdkIndexer{indexerClient},
 	}
+	client.assets = newAssetRegistry(client.fetchAssetInfo, DefaultAssetTTL)
+	client.accounts = newAccountChecker(client, DefaultAccountTTL)
+	return client, nil
+}
 
-	// Check ALGO payments (asset ID 0)
-	if payment.AssetID == 0 {
-		for _, txn := range result.Transactions {
-			if txn.PaymentTransaction.Receiver == payment.MerchantAddress &&
-				txn.PaymentTransaction.Amount >= payment.Amount {
-				return &Transaction{
-					ID:        txn.Id,
-					Sender:    txn.Sender,
-					Receiver:  txn.PaymentTransaction.Receiver,
-					Amount:    txn.PaymentTransaction.Amount,
-					AssetID:   0,
-					Round:     txn.ConfirmedRound,
-					Timestamp: time.Unix(int64(txn.RoundTime), 0),
-				}, nil
-			}
+// CheckPayment checks if a payment has been made to the specified address in
+// any of its accepted assets between minRound and maxRound, skipping
+// transactions already claimed by another payment. When several options were
+// paid, the earliest transaction wins.
+func (c *Client) CheckPayment(payment *models.Payment, minRound, maxRound uint64, claims *txnClaims) (*Transaction, error) {
+	var first *Transaction
+	for _, option := range payment.Options() {
+		txn, err := c.findTransfer(payment.MerchantAddress, option, minRound, maxRound, claims)
+		if err != nil {
+			return nil, err
+		}
+		if txn != nil && (first == nil || txn.Round < first.Round) {
+			first = txn
 		}
 	}
+	return first, nil
+}
 
-	// Check ASA payments if asset ID is not 0
-	if payment.AssetID != 0 {
-		asaResult, err := c.indexerClient.LookupAccountTransactions(payment.MerchantAddress).
-			MinRound(lastCheckedRound + 1).
-			TxType("axfer"). // For ASA transfers
-			AssetID(payment.AssetID).
-			Do(context.Background())
+// findTransfer looks for the earliest unclaimed transfer of at least the
+// option amount of its asset to the address
+func (c *Client) findTransfer(address string, option models.PaymentOption, minRound, maxRound uint64, claims *txnClaims) (*Transaction, error) {
+	transfers, err := c.indexer.Transfers(address, option.AssetID, minRound, maxRound)
+	if err != nil {
+		return nil, err
+	}
 
+	for i := range transfers {
+		txn := &transfers[i]
+		if txn.Receiver != address || txn.Amount < option.Amount {
+			continue
+		}
+		taken, err := claims.taken(txn.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to lookup ASA transactions: %w", err)
+			return nil, err
 		}
-
-		for _, txn := range asaResult.Transactions {
-			if txn.AssetTransferTransaction.Receiver == payment.MerchantAddress &&
-				txn.AssetTransferTransaction.Amount >= payment.Amount {
-				return &Transaction{
-					ID:        txn.Id,
-					Sender:    txn.Sender,
-					Receiver:  txn.AssetTransferTransaction.Receiver,
-					Amount:    txn.AssetTransferTransaction.Amount,
-					AssetID:   payment.AssetID,
-					Round:     txn.ConfirmedRound,
-					Timestamp: time.Unix(int64(txn.RoundTime), 0),
-				}, nil
-			}
+		if !taken {
+			return txn, nil
 		}
 	}
-
 	return nil, nil // No matching transaction found
 }
 
@@ -138,75 +119,195 @@ func (c *Client) ValidateAddress(address string) error {
 	return nil
 }
 
-// GetAssetInfo gets information about an ASA token
-// func (c *Client) GetAssetInfo(assetID uint64) (types.AssetParams, error) {
-// 	if assetID == 0 {
-// 		// Return default params for ALGO
-// 		return types.AssetParams{
-// 			Total:     10000000000000000, // Total ALGO supply
-// 			Decimals:  6,
-// 			UnitName:  "ALGO",
-// 			AssetName: "Algorand",
-// 		}, nil
-// 	}
-
-// 	assetInfo, err := c.algodClient.GetAssetByID(assetID).Do(context.Background())
-// 	if err != nil {
-// 		return types.AssetParams{}, fmt.Errorf("failed to get asset info: %w", err)
-// 	}
-// 	return assetInfo.Params, nil
-// }
-
-// StartPaymentMonitor starts monitoring for payments
-func (c *Client) StartPaymentMonitor(paymentChan chan<- *models.Payment, db PaymentDatabase) {
+// StartPaymentMonitor starts monitoring for payments. Closed invoices are
+// watched for lateGrace after they expire so late funds can be flagged. The
+// last scanned round is stored so a restart resumes from it, and transactions
+// already recorded on a payment are never matched again.
+func (c *Client) StartPaymentMonitor(paymentChan chan<- *models.Payment, db PaymentDatabase, lateGrace time.Duration) {
 	ticker := time.NewTicker(10 * time.Second) // Check every 10 seconds
 	defer ticker.Stop()
 
-	var lastCheckedRound uint64 = 0
+	// Resume after the last round scanned before a restart
+	lastCheckedRound, err := db.GetMonitorRound(paymentMonitorName)
+	if err != nil {
+		log.Printf("Error loading the payment monitor's last round: %v", err)
+	}
 
 	for {
 		select {
 		case <-ticker.C:
-			// Get current round
-			currentRound, err := c.GetLatestRound()
-			if err != nil {
-				log.Printf("Error getting latest round: %v", err)
-				continue
-			}
+			lastCheckedRound = c.scanPayments(db, lastCheckedRound, lateGrace, paymentChan)
+		}
+	}
+}
 
-			// Get pending payments
-			payments, err := db.GetPendingPayments()
-			if err != nil {
-				log.Printf("Error getting pending payments: %v", err)
-				continue
-			}
+// scanPayments checks open and recently closed payments against the rounds
+// after lastCheckedRound that the indexer has caught up to, and returns the
+// round the next pass continues after. The round only advances, and is only
+// saved, when every lookup succeeded, so failed lookups are retried over the
+// same rounds.
+func (c *Client) scanPayments(db PaymentDatabase, lastCheckedRound uint64, lateGrace time.Duration, paymentChan chan<- *models.Payment) uint64 {
+	// Rounds past the indexer's are not searchable yet
+	indexedRound, err := c.indexer.IndexedRound()
+	if err != nil {
+		log.Printf("Error getting the indexer's round: %v", err)
+		return lastCheckedRound
+	}
+	if indexedRound <= lastCheckedRound {
+		return lastCheckedRound
+	}
 
-			// Check each pending payment
-			for _, payment := range payments {
-				txn, err := c.CheckPayment(payment, lastCheckedRound)
-				if err != nil {
-					log.Printf("Error checking payment %s: %v", payment.ID, err)
-					continue
-				}
-
-				if txn != nil {
-					log.Printf("Payment found for %s: %s", payment.ID, txn.ID)
-					payment.Status = models.PaymentStatusCompleted
-					payment.TxnID = txn.ID
-					payment.UpdatedAt = time.Now()
-
-					// Send to payment channel for webhook processing
-					paymentChan <- payment
-				}
-			}
+	// Get pending payments
+	payments, err := db.GetPendingPayments()
+	if err != nil {
+		log.Printf("Error getting pending payments: %v", err)
+		return lastCheckedRound
+	}
+
+	// Check each pending payment, then expired and cancelled payments within
+	// the grace window; a transaction settles at most one payment
+	claims := &txnClaims{db: db, claimed: make(map[string]bool)}
+	ok := c.matchPayments(payments, lastCheckedRound+1, indexedRound, models.PaymentStatusCompleted, claims, paymentChan)
+
+	closed, err := db.GetLatePaymentCandidates(lateGrace)
+	if err != nil {
+		log.Printf("Error getting late payment candidates: %v", err)
+		ok = false
+	} else if !c.matchPayments(closed, lastCheckedRound+1, indexedRound, models.PaymentStatusLatePayment, claims, paymentChan) {
+		ok = false
+	}
+	if !ok {
+		return lastCheckedRound
+	}
+
+	if err := db.SetMonitorRound(paymentMonitorName, indexedRound); err != nil {
+		log.Printf("Error saving the payment monitor's last round: %v", err)
+	}
+	return indexedRound
+}
 
-			lastCheckedRound = currentRound
+// matchPayments looks for transactions settling each payment between minRound
+// and maxRound and sends matches to the payment channel with the given
+// status. It reports whether every payment could be checked.
+func (c *Client) matchPayments(payments []*models.Payment, minRound, maxRound uint64, status models.PaymentStatus, claims *txnClaims, paymentChan chan<- *models.Payment) bool {
+	ok := true
+	for _, payment := range payments {
+		txn, err := c.CheckPayment(payment, minRound, maxRound, claims)
+		if err != nil {
+			log.Printf("Error checking payment %s: %v", payment.ID, err)
+			ok = false
+			continue
 		}
+
+		if txn != nil {
+			log.Printf("Payment found for %s (%s): %s", payment.ID, status, txn.ID)
+			claims.claimed[txn.ID] = true
+			payment.Status = status
+			payment.TxnID = txn.ID
+			payment.SettledAssetID = &txn.AssetID
+			payment.PayerAddress = txn.Sender
+			payment.ReceivedAmount = txn.Amount
+			payment.Late = status == models.PaymentStatusLatePayment
+			payment.UpdatedAt = time.Now()
+
+			// Send to payment channel for webhook processing
+			paymentChan <- payment
+		}
+	}
+	return ok
+}
+
+// paymentMonitorName names the payment monitor's stored progress
+const paymentMonitorName = "payments"
+
+// txnClaims tracks which transactions already settle a payment: those matched
+// earlier in a monitor pass and those recorded on any stored payment
+type txnClaims struct {
+	db      PaymentDatabase
+	claimed map[string]bool
+}
+
+// taken reports whether a transaction already settles a payment
+func (t *txnClaims) taken(txID string) (bool, error) {
+	if taken, ok := t.claimed[txID]; ok {
+		return taken, nil
+	}
+	taken, err := t.db.PaymentTxnRecorded(txID)
+	if err != nil {
+		return false, err
 	}
+	t.claimed[txID] = taken
+	return taken, nil
 }
 
 // PaymentDatabase interface for database operations
 type PaymentDatabase interface {
 	GetPendingPayments() ([]*models.Payment, error)
+	GetLatePaymentCandidates(grace time.Duration) ([]*models.Payment, error)
 	UpdatePaymentStatus(id string, status models.PaymentStatus, txnID string) error
+	PaymentTxnRecorded(txnID string) (bool, error)
+	GetMonitorRound(name string) (uint64, error)
+	SetMonitorRound(name string, round uint64) error
+}
+
+// paymentIndexer is the part of the indexer the payment monitor reads
+type paymentIndexer interface {
+	// IndexedRound returns the last round the indexer has ingested
+	IndexedRound() (uint64, error)
+	// Transfers returns the transfers of an asset, or ALGO payments for asset
+	// 0, to an address confirmed from minRound to maxRound, in round order
+	Transfers(address string, assetID, minRound, maxRound uint64) ([]Transaction, error)
+}
+
+// sdkIndexer reads the payment monitor's transfers from an indexer
+type sdkIndexer struct {
+	client *indexer.Client
+}
+
+// IndexedRound returns the round reported by the indexer's health check
+func (i sdkIndexer) IndexedRound() (uint64, error) {
+	health, err := i.client.HealthCheck().Do(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get indexer round: %w", err)
+	}
+	return health.Round, nil
+}
+
+// Transfers looks up the address's transfers of the asset page by page
+func (i sdkIndexer) Transfers(address string, assetID, minRound, maxRound uint64) ([]Transaction, error) {
+	var transfers []Transaction
+	var nextToken string
+	for {
+		query := i.client.LookupAccountTransactions(address).
+			MinRound(minRound).
+			MaxRound(maxRound).
+			Limit(transferPageSize)
+		if assetID == 0 {
+			query.TxType("pay") // For ALGO payments
+		} else {
+			query.TxType("axfer").AssetID(assetID) // For ASA transfers
+		}
+		if nextToken != "" {
+			query.NextToken(nextToken)
+		}
+
+		result, err := query.Do(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup transactions: %w", err)
+		}
+		for _, txn := range result.Transactions {
+			if transfer, ok := toTransfer(txn); ok && transfer.AssetID == assetID {
+				transfers = append(transfers, transfer)
+			}
+		}
+
+		if result.NextToken == "" || len(result.Transactions) == 0 {
+			break
+		}
+		nextToken = result.NextToken
+	}
+
+	// The indexer lists an account's transactions newest first
+	slices.Reverse(transfers)
+	return transfers, nil
 }
@@ -0,0 +1,232 @@
+package algorand
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"algopay/models"
+)
+
+// fakeIndexer serves transfers from memory, failing the first failures
+// lookups
+type fakeIndexer struct {
+	round     uint64
+	transfers []Transaction
+	failures  int
+	lookups   [][2]uint64 // the round range of each lookup
+}
+
+func (f *fakeIndexer) IndexedRound() (uint64, error) {
+	return f.round, nil
+}
+
+func (f *fakeIndexer) Transfers(address string, assetID, minRound, maxRound uint64) ([]Transaction, error) {
+	f.lookups = append(f.lookups, [2]uint64{minRound, maxRound})
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("indexer unavailable")
+	}
+	var transfers []Transaction
+	for _, txn := range f.transfers {
+		if txn.Receiver == address && txn.AssetID == assetID && txn.Round >= minRound && txn.Round <= maxRound {
+			transfers = append(transfers, txn)
+		}
+	}
+	return transfers, nil
+}
+
+// fakePaymentDatabase holds the monitor's payments and progress in memory
+type fakePaymentDatabase struct {
+	pending  []*models.Payment
+	late     []*models.Payment
+	recorded map[string]bool
+	round    uint64
+	saves    int
+}
+
+func (f *fakePaymentDatabase) GetPendingPayments() ([]*models.Payment, error) {
+	return f.pending, nil
+}
+
+func (f *fakePaymentDatabase) GetLatePaymentCandidates(grace time.Duration) ([]*models.Payment, error) {
+	return f.late, nil
+}
+
+func (f *fakePaymentDatabase) UpdatePaymentStatus(id string, status models.PaymentStatus, txnID string) error {
+	return nil
+}
+
+func (f *fakePaymentDatabase) PaymentTxnRecorded(txnID string) (bool, error) {
+	return f.recorded[txnID], nil
+}
+
+func (f *fakePaymentDatabase) GetMonitorRound(name string) (uint64, error) {
+	return f.round, nil
+}
+
+func (f *fakePaymentDatabase) SetMonitorRound(name string, round uint64) error {
+	f.round = round
+	f.saves++
+	return nil
+}
+
+// drain returns the payments sent to the channel so far
+func drain(paymentChan chan *models.Payment) []*models.Payment {
+	var payments []*models.Payment
+	for {
+		select {
+		case payment := <-paymentChan:
+			payments = append(payments, payment)
+		default:
+			return payments
+		}
+	}
+}
+
+// TestScanPaymentsRetriesFailedRounds checks a failed lookup leaves the
+// monitor's round where it was, so the next pass searches the same rounds
+func TestScanPaymentsRetriesFailedRounds(t *testing.T) {
+	indexer := &fakeIndexer{
+		round:     120,
+		failures:  1,
+		transfers: []Transaction{{ID: "TXN-1", Sender: "PAYER", Receiver: "SHOP", Amount: 1000000, Round: 110}},
+	}
+	db := &fakePaymentDatabase{
+		round:   100,
+		pending: []*models.Payment{{ID: "pay-1", MerchantAddress: "SHOP", Amount: 1000000, Status: models.PaymentStatusPending}},
+	}
+	client := &Client{indexer: indexer}
+	paymentChan := make(chan *models.Payment, 10)
+
+	round := client.scanPayments(db, db.round, time.Hour, paymentChan)
+	if round != 100 || db.saves != 0 || len(drain(paymentChan)) != 0 {
+		t.Fatalf("after a failed lookup: round = %d, saves = %d, want 100 and no save", round, db.saves)
+	}
+
+	round = client.scanPayments(db, round, time.Hour, paymentChan)
+	if round != 120 || db.round != 120 {
+		t.Fatalf("after a successful pass: round = %d, stored %d, want 120", round, db.round)
+	}
+	matched := drain(paymentChan)
+	if len(matched) != 1 || matched[0].TxnID != "TXN-1" || matched[0].Status != models.PaymentStatusCompleted || matched[0].PayerAddress != "PAYER" {
+		t.Fatalf("matched %+v, want pay-1 completed by TXN-1", matched)
+	}
+	for _, lookup := range indexer.lookups {
+		if lookup != [2]uint64{101, 120} {
+			t.Errorf("looked up rounds %d to %d, want 101 to 120", lookup[0], lookup[1])
+		}
+	}
+}
+
+// TestScanPaymentsWaitsForIndexer checks the monitor does not move past the
+// indexer's round
+func TestScanPaymentsWaitsForIndexer(t *testing.T) {
+	indexer := &fakeIndexer{round: 90}
+	db := &fakePaymentDatabase{
+		pending: []*models.Payment{{ID: "pay-1", MerchantAddress: "SHOP", Amount: 1000000, Status: models.PaymentStatusPending}},
+	}
+	client := &Client{indexer: indexer}
+	paymentChan := make(chan *models.Payment, 10)
+
+	if round := client.scanPayments(db, 100, time.Hour, paymentChan); round != 100 || db.saves != 0 || len(indexer.lookups) != 0 {
+		t.Fatalf("with the indexer behind: round = %d, saves = %d, lookups %v", round, db.saves, indexer.lookups)
+	}
+
+	indexer.round = 105
+	if round := client.scanPayments(db, 100, time.Hour, paymentChan); round != 105 || db.round != 105 {
+		t.Fatalf("with the indexer ahead: round = %d, stored %d, want 105", round, db.round)
+	}
+	if len(indexer.lookups) != 1 || indexer.lookups[0] != [2]uint64{101, 105} {
+		t.Fatalf("lookups = %v, want rounds 101 to 105", indexer.lookups)
+	}
+}
+
+// TestScanPaymentsClaimsTransactions checks a transaction settles at most one
+// payment, never one already recorded, and that late funds are flagged
+func TestScanPaymentsClaimsTransactions(t *testing.T) {
+	usdc := uint64(31566704)
+	indexer := &fakeIndexer{
+		round: 200,
+		transfers: []Transaction{
+			{ID: "RECORDED", Sender: "PAYER", Receiver: "SHOP", Amount: 1000000, Round: 150},
+			{ID: "TXN-1", Sender: "PAYER", Receiver: "SHOP", Amount: 1000000, Round: 160},
+			{ID: "TXN-2", Sender: "PAYER", Receiver: "SHOP", Amount: 500000, Round: 170},
+			{ID: "TXN-3", Sender: "PAYER", Receiver: "SHOP", Amount: 2000000, AssetID: usdc, Round: 180},
+		},
+	}
+	db := &fakePaymentDatabase{
+		recorded: map[string]bool{"RECORDED": true},
+		pending: []*models.Payment{
+			{ID: "pay-1", MerchantAddress: "SHOP", Amount: 1000000},
+			{ID: "pay-2", MerchantAddress: "SHOP", Amount: 1000000},
+		},
+		late: []*models.Payment{
+			{ID: "pay-3", MerchantAddress: "SHOP", Amount: 1000000, PaymentOptions: []models.PaymentOption{
+				{AssetID: 0, Amount: 1000000},
+				{AssetID: usdc, Amount: 2000000},
+			}},
+		},
+	}
+	client := &Client{indexer: indexer}
+	paymentChan := make(chan *models.Payment, 10)
+
+	client.scanPayments(db, 100, time.Hour, paymentChan)
+	matched := map[string]*models.Payment{}
+	for _, payment := range drain(paymentChan) {
+		matched[payment.ID] = payment
+	}
+	if len(matched) != 2 || matched["pay-1"] == nil || matched["pay-1"].TxnID != "TXN-1" {
+		t.Fatalf("matched %v, want pay-1 settled by TXN-1 and pay-2 unpaid", matched)
+	}
+	late := matched["pay-3"]
+	if late == nil || late.TxnID != "TXN-3" || late.Status != models.PaymentStatusLatePayment || !late.Late ||
+		late.SettledAssetID == nil || *late.SettledAssetID != usdc || late.ReceivedAmount != 2000000 {
+		t.Fatalf("late payment = %+v, want it flagged late with TXN-3 in USDC", late)
+	}
+}
+
+// TestCheckPaymentOptions checks a payment is settled by the earliest
+// transfer paying any of its options in full
+func TestCheckPaymentOptions(t *testing.T) {
+	usdc := uint64(31566704)
+	payment := &models.Payment{ID: "pay-1", MerchantAddress: "SHOP", Amount: 1000000, PaymentOptions: []models.PaymentOption{
+		{AssetID: 0, Amount: 1000000},
+		{AssetID: usdc, Amount: 2000000},
+	}}
+	tests := []struct {
+		name      string
+		transfers []Transaction
+		want      string
+	}{
+		{"primary asset", []Transaction{{ID: "ALGO", Receiver: "SHOP", Amount: 1000000, Round: 110}}, "ALGO"},
+		{"second asset", []Transaction{{ID: "USDC", Receiver: "SHOP", Amount: 2000000, AssetID: usdc, Round: 110}}, "USDC"},
+		{"earliest wins", []Transaction{
+			{ID: "ALGO", Receiver: "SHOP", Amount: 1000000, Round: 120},
+			{ID: "USDC", Receiver: "SHOP", Amount: 2000000, AssetID: usdc, Round: 110},
+		}, "USDC"},
+		{"underpaid option", []Transaction{
+			{ID: "SHORT", Receiver: "SHOP", Amount: 1999999, AssetID: usdc, Round: 105},
+			{ID: "ALGO", Receiver: "SHOP", Amount: 1000000, Round: 120},
+		}, "ALGO"},
+		{"amount of another option", []Transaction{{ID: "WRONG", Receiver: "SHOP", Amount: 1000000, AssetID: usdc, Round: 110}}, ""},
+		{"other receiver", []Transaction{{ID: "OTHER", Receiver: "ELSEWHERE", Amount: 1000000, Round: 110}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &Client{indexer: &fakeIndexer{round: 200, transfers: test.transfers}}
+			claims := &txnClaims{db: &fakePaymentDatabase{}, claimed: make(map[string]bool)}
+			txn, err := client.CheckPayment(payment, 101, 200, claims)
+			if err != nil {
+				t.Fatalf("CheckPayment: %v", err)
+			}
+			var got string
+			if txn != nil {
+				got = txn.ID
+			}
+			if got != test.want {
+				t.Fatalf("matched %q, want %q", got, test.want)
+			}
+		})
+	}
+}
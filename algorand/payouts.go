@@ -0,0 +1,119 @@
+package algorand
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/algorand/go-algorand-sdk/v2/transaction"
+	"github.com/algorand/go-algorand-sdk/v2/types"
+)
+
+// Transfer is one leg of a grouped payout
+type Transfer struct {
+	To      string
+	Amount  uint64
+	AssetID uint64
+}
+
+// SignedGroup is a signed transaction group ready to be sent
+type SignedGroup struct {
+	TxIDs     []string // in the order of the transfers
+	Fees      []uint64 // network fees in microAlgos, in the order of the transfers
+	GroupID   string
+	LastValid uint64 // last round in which the group can be confirmed
+	signed    []byte
+}
+
+// ErrGroupRejected is returned when the node refuses a transaction group, so
+// it cannot be confirmed
+var ErrGroupRejected = errors.New("transaction group rejected")
+
+// MaxGroupSize is the most transactions an atomic group may hold
+const MaxGroupSize = types.MaxTxGroupSize
+
+// MinFee is the smallest network fee of a transaction, in microAlgos
+const MinFee = transaction.MinTxnFee
+
+// SignGroup builds and signs transfers from a gateway-controlled address as
+// one atomic group, so either every transfer is confirmed or none is. The
+// transaction IDs are known before the group is sent.
+func (c *Client) SignGroup(from string, transfers []Transfer, note []byte) (*SignedGroup, error) {
+	if len(transfers) == 0 || len(transfers) > MaxGroupSize {
+		return nil, fmt.Errorf("a group must hold 1 to %d transfers, got %d", MaxGroupSize, len(transfers))
+	}
+
+	params, err := c.algodClient.SuggestedParams().Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggested params: %w", err)
+	}
+
+	txns := make([]types.Transaction, len(transfers))
+	for i, transfer := range transfers {
+		if transfer.AssetID == 0 {
+			txns[i], err = transaction.MakePaymentTxn(from, transfer.To, transfer.Amount, note, "", params)
+		} else {
+			txns[i], err = transaction.MakeAssetTransferTxn(from, transfer.To, transfer.Amount, note, params, "", transfer.AssetID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to build transfer %d: %w", i+1, err)
+		}
+	}
+
+	grouped, err := transaction.AssignGroupID(txns, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to group transfers: %w", err)
+	}
+
+	group := &SignedGroup{
+		GroupID:   base64.StdEncoding.EncodeToString(grouped[0].Group[:]),
+		LastValid: uint64(grouped[0].LastValid),
+	}
+	var signed bytes.Buffer
+	for _, txn := range grouped {
+		txID, stx, err := c.keyring.SignTransaction(txn)
+		if err != nil {
+			return nil, err
+		}
+		group.TxIDs = append(group.TxIDs, txID)
+		group.Fees = append(group.Fees, uint64(txn.Fee))
+		signed.Write(stx)
+	}
+	group.signed = signed.Bytes()
+	return group, nil
+}
+
+// SendGroup submits a signed group. Errors other than ErrGroupRejected leave
+// it unknown whether the node accepted the group.
+func (c *Client) SendGroup(group *SignedGroup) error {
+	_, err := c.algodClient.SendRawTransaction(group.signed).Do(context.Background())
+	if err != nil && strings.HasPrefix(err.Error(), "HTTP 400") {
+		return fmt.Errorf("%w: %v", ErrGroupRejected, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to submit transaction group: %w", err)
+	}
+	return nil
+}
+
+// CheckConfirmation looks a transaction up in the indexer. A transaction that
+// is not found once the indexer has passed lastValid can never be confirmed,
+// which is reported as expired.
+func (c *Client) CheckConfirmation(txID string, lastValid uint64) (confirmed, expired bool, err error) {
+	_, err = c.indexerClient.LookupTransaction(txID).Do(context.Background())
+	if err == nil {
+		return true, false, nil
+	}
+	if !isNotFound(err) {
+		return false, false, fmt.Errorf("failed to look up transaction: %w", err)
+	}
+
+	health, err := c.indexerClient.HealthCheck().Do(context.Background())
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get indexer round: %w", err)
+	}
+	return false, health.Round > lastValid, nil
+}
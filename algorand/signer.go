@@ -0,0 +1,76 @@
+package algorand
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/algorand/go-algorand-sdk/v2/mnemonic"
+	"github.com/algorand/go-algorand-sdk/v2/types"
+)
+
+// ErrNoSigner is returned when the gateway holds no key for a sending address
+var ErrNoSigner = errors.New("no signing key for address")
+
+// Keyring holds the private keys of gateway-controlled accounts
+type Keyring struct {
+	keys map[string]ed25519.PrivateKey
+}
+
+// NewKeyring creates a keyring from 25-word account mnemonics
+func NewKeyring(mnemonics []string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]ed25519.PrivateKey)}
+	for i, phrase := range mnemonics {
+		sk, err := mnemonic.ToPrivateKey(phrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mnemonic #%d: %w", i+1, err)
+		}
+		account, err := crypto.AccountFromPrivateKey(sk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mnemonic #%d: %w", i+1, err)
+		}
+		keyring.keys[account.Address.String()] = sk
+	}
+	return keyring, nil
+}
+
+// Addresses returns the addresses the keyring can sign for
+func (k *Keyring) Addresses() []string {
+	if k == nil {
+		return nil
+	}
+	addresses := make([]string, 0, len(k.keys))
+	for address := range k.keys {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// CanSign reports whether the keyring holds the key for an address
+func (k *Keyring) CanSign(address string) bool {
+	if k == nil {
+		return false
+	}
+	_, ok := k.keys[address]
+	return ok
+}
+
+// SignTransaction signs a transaction with the key of its sender
+func (k *Keyring) SignTransaction(txn types.Transaction) (string, []byte, error) {
+	sender := txn.Sender.String()
+	if !k.CanSign(sender) {
+		return "", nil, fmt.Errorf("%w %s", ErrNoSigner, sender)
+	}
+	return crypto.SignTransaction(k.keys[sender], txn)
+}
+
+// SetKeyring sets the keyring used to sign outgoing transactions
+func (c *Client) SetKeyring(keyring *Keyring) {
+	c.keyring = keyring
+}
+
+// CanSign reports whether the gateway can send funds from an address
+func (c *Client) CanSign(address string) bool {
+	return c.keyring.CanSign(address)
+}
@@ -0,0 +1,117 @@
+package algorand
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdkmodels "github.com/algorand/go-algorand-sdk/v2/client/v2/common/models"
+)
+
+// TransferWindow bounds a transfer search by round, by time, or both; zero
+// values leave that side open
+type TransferWindow struct {
+	MinRound uint64
+	MaxRound uint64
+	After    time.Time
+	Before   time.Time
+}
+
+// transferPageSize is the number of transactions requested per indexer page
+const transferPageSize = 1000
+
+// InboundTransfers returns every confirmed ALGO payment and ASA transfer of a
+// non-zero amount to the address within the window, in round order
+func (c *Client) InboundTransfers(address string, window TransferWindow) ([]Transaction, error) {
+	var transfers []Transaction
+	var nextToken string
+	for {
+		query := c.indexerClient.LookupAccountTransactions(address).Limit(transferPageSize)
+		if window.MinRound != 0 {
+			query.MinRound(window.MinRound)
+		}
+		if window.MaxRound != 0 {
+			query.MaxRound(window.MaxRound)
+		}
+		if !window.After.IsZero() {
+			query.AfterTime(window.After)
+		}
+		if !window.Before.IsZero() {
+			query.BeforeTime(window.Before)
+		}
+		if nextToken != "" {
+			query.NextToken(nextToken)
+		}
+
+		result, err := query.Do(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup transactions of %s: %w", address, err)
+		}
+		for _, txn := range result.Transactions {
+			if transfer, ok := toTransfer(txn); ok && transfer.Receiver == address && transfer.Amount > 0 {
+				transfers = append(transfers, transfer)
+			}
+		}
+
+		if result.NextToken == "" || len(result.Transactions) == 0 {
+			break
+		}
+		nextToken = result.NextToken
+	}
+
+	// The indexer lists an account's transactions newest first
+	for i, j := 0, len(transfers)-1; i < j; i, j = i+1, j-1 {
+		transfers[i], transfers[j] = transfers[j], transfers[i]
+	}
+	return transfers, nil
+}
+
+// LookupTransfer looks up a confirmed transfer by transaction ID. It returns
+// nil when the indexer does not know the transaction or it is not a transfer.
+func (c *Client) LookupTransfer(txID string) (*Transaction, error) {
+	result, err := c.indexerClient.LookupTransaction(txID).Do(context.Background())
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up transaction %s: %w", txID, err)
+	}
+
+	transfer, ok := toTransfer(result.Transaction)
+	if !ok {
+		return nil, nil
+	}
+	return &transfer, nil
+}
+
+// RoundTime returns the time a round was confirmed
+func (c *Client) RoundTime(round uint64) (time.Time, error) {
+	block, err := c.indexerClient.LookupBlock(round).HeaderOnly(true).Do(context.Background())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up round %d: %w", round, err)
+	}
+	return time.Unix(int64(block.Timestamp), 0), nil
+}
+
+// toTransfer converts an indexer transaction to a Transaction if it is an
+// ALGO payment or ASA transfer
+func toTransfer(txn sdkmodels.Transaction) (Transaction, bool) {
+	transfer := Transaction{
+		ID:        txn.Id,
+		Sender:    txn.Sender,
+		Round:     txn.ConfirmedRound,
+		Timestamp: time.Unix(int64(txn.RoundTime), 0),
+	}
+	switch txn.Type {
+	case "pay":
+		transfer.Receiver = txn.PaymentTransaction.Receiver
+		transfer.Amount = txn.PaymentTransaction.Amount
+	case "axfer":
+		transfer.Receiver = txn.AssetTransferTransaction.Receiver
+		transfer.Amount = txn.AssetTransferTransaction.Amount
+		transfer.AssetID = txn.AssetTransferTransaction.AssetId
+	default:
+		return Transaction{}, false
+	}
+	return transfer, true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// createAPIKey handles API key creation for a merchant
+func (s *Server) createAPIKey(c *gin.Context) {
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := s.database.GetMerchant(req.MerchantID); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error getting merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	// Validate type and scopes
+	allowed, ok := map[models.APIKeyType][]string{
+		models.APIKeyTypePublishable: models.PublishableScopes,
+		models.APIKeyTypeSecret:      models.AllScopes,
+	}[req.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type must be publishable or secret"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = allowed
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(allowed, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope " + scope + " is not allowed for " + string(req.Type) + " keys"})
+			return
+		}
+	}
+
+	plaintext, err := generateAPIKey(req.Type)
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	key := &models.APIKey{
+		ID:         uuid.New().String(),
+		MerchantID: req.MerchantID,
+		Name:       req.Name,
+		Type:       req.Type,
+		Prefix:     plaintext[:12],
+		KeyHash:    hashAPIKey(plaintext),
+		Scopes:     req.Scopes,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := s.database.CreateAPIKey(key); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	s.audit(c, models.AuditAPIKeyCreated, models.AuditResourceAPIKey, key.ID, key.MerchantID, nil, key)
+
+	c.JSON(http.StatusCreated, models.APIKeyResponse{APIKey: key, Key: plaintext})
+}
+
+// listAPIKeys handles listing a merchant's API keys
+func (s *Server) listAPIKeys(c *gin.Context) {
+	merchantID := c.Query("merchant_id")
+	if merchantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "merchant_id is required"})
+		return
+	}
+
+	keys, err := s.database.ListAPIKeys(merchantID)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// revokeAPIKey handles API key revocation
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	err := s.database.RevokeAPIKey(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	s.audit(c, models.AuditAPIKeyRevoked, models.AuditResourceAPIKey, id, "", nil, gin.H{"revoked_at": time.Now()})
+
+	c.Status(http.StatusNoContent)
+}
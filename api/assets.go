@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"algopay/algorand"
+	"algopay/models"
+)
+
+// describeOptions fills in the asset params of each payment option and
+// converts display amounts to base units. It returns an error when an asset
+// cannot be loaded or an amount is invalid.
+func (s *Server) describeOptions(options []models.PaymentOption) *requestError {
+	for i := range options {
+		option := &options[i]
+		asset, err := s.algoClient.GetAssetInfo(option.AssetID)
+		if errors.Is(err, algorand.ErrAssetNotFound) {
+			return &requestError{
+				status:  http.StatusBadRequest,
+				message: "Asset " + strconv.FormatUint(option.AssetID, 10) + " does not exist",
+				code:    codeUnknownAsset,
+			}
+		}
+		if err != nil {
+			log.Printf("Error loading asset %d: %v", option.AssetID, err)
+			return &requestError{status: http.StatusBadGateway, message: "Failed to load asset " + strconv.FormatUint(option.AssetID, 10)}
+		}
+		option.UnitName = asset.UnitName
+		option.Decimals = asset.Decimals
+
+		if option.DisplayAmount != "" {
+			amount, err := models.ParseAmount(option.DisplayAmount, asset.Decimals)
+			if err != nil {
+				return &requestError{status: http.StatusBadRequest, message: "Invalid display_amount: " + err.Error()}
+			}
+			option.Amount = amount
+		}
+	}
+	return nil
+}
+
+// checkReceivingAccount verifies that the merchant's receiving address can
+// receive every payment option, returning an error when it cannot
+func (s *Server) checkReceivingAccount(address string, options []models.PaymentOption) *requestError {
+	if err := s.algoClient.ValidateAddress(address); err != nil {
+		return &requestError{status: http.StatusUnprocessableEntity, message: "Merchant receiving address is invalid"}
+	}
+	if !s.config.AccountChecks {
+		return nil
+	}
+
+	for _, option := range options {
+		err := s.algoClient.CheckReceivable(address, option.AssetID)
+		if errors.Is(err, algorand.ErrAccountRekeyed) && s.config.AllowRekeyedAccounts {
+			err = nil
+		}
+		if err == nil {
+			continue
+		}
+
+		asset := strconv.FormatUint(option.AssetID, 10)
+		var msg string
+		switch {
+		case errors.Is(err, algorand.ErrAccountClosed):
+			msg = "Merchant receiving address is closed or unfunded"
+		case errors.Is(err, algorand.ErrAssetNotOptedIn):
+			msg = "Merchant receiving address has not opted in to asset " + asset
+		case errors.Is(err, algorand.ErrAssetFrozen):
+			msg = "Merchant holding of asset " + asset + " is frozen"
+		case errors.Is(err, algorand.ErrAccountRekeyed):
+			msg = "Merchant receiving address is rekeyed to another signer"
+		default:
+			log.Printf("Error checking account %s: %v", address, err)
+			return &requestError{status: http.StatusBadGateway, message: "Failed to check merchant account"}
+		}
+		return &requestError{status: http.StatusUnprocessableEntity, message: msg}
+	}
+	return nil
+}
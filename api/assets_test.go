@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/algorand"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestDisplayAmounts checks amounts in whole units convert with each asset's
+// decimals and are reported alongside base units
+func TestDisplayAmounts(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	coin := algorand.AssetInfo{ID: 1001, Name: "Coin", UnitName: "COIN", Decimals: 2}
+	useFakeNode(t, s, coin)
+	merchant := newTestMerchant(t, s, func(m *models.Merchant) {
+		m.AcceptedAssets = []uint64{0, coin.ID, 2002}
+	})
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	created := createTestPayment(t, router, key, gin.H{"asset_id": coin.ID, "display_amount": "12.5"})
+	if created.Amount != 1250 || created.DisplayAmount != "12.5" || created.UnitName != "COIN" {
+		t.Fatalf("created payment = %+v", created)
+	}
+	created = createTestPayment(t, router, key, gin.H{"amount": 1500000})
+	if created.DisplayAmount != "1.5" || created.UnitName != "ALGO" {
+		t.Fatalf("created ALGO payment = %+v", created)
+	}
+	created = createTestPayment(t, router, key, gin.H{"payment_options": []gin.H{
+		{"asset_id": 0, "display_amount": "2"},
+		{"asset_id": coin.ID, "amount": 99},
+	}})
+	if options := created.PaymentOptions; options[0].Amount != 2000000 || options[1].DisplayAmount != "0.99" || options[1].Decimals != 2 {
+		t.Fatalf("created options = %+v", options)
+	}
+
+	tests := []struct {
+		name   string
+		req    gin.H
+		status int
+		code   string
+	}{
+		{"too many decimals", gin.H{"asset_id": coin.ID, "display_amount": "1.005"}, http.StatusBadRequest, ""},
+		{"not a number", gin.H{"asset_id": coin.ID, "display_amount": "1,5"}, http.StatusBadRequest, ""},
+		{"amount and display amount", gin.H{"asset_id": coin.ID, "amount": 100, "display_amount": "1"}, http.StatusBadRequest, ""},
+		{"unknown asset", gin.H{"asset_id": 2002, "amount": 100}, http.StatusBadRequest, codeUnknownAsset},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, test.req)
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, test.status, w.Body)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			decodeBody(t, w, &body)
+			if body.Code != test.code {
+				t.Errorf("code = %q, want %q", body.Code, test.code)
+			}
+		})
+	}
+
+	// Assets cannot be described while the node is unreachable
+	offline := newTestServer(t)
+	merchant = newTestMerchant(t, offline, func(m *models.Merchant) {
+		m.AcceptedAssets = []uint64{coin.ID}
+	})
+	key = newTestKey(t, offline, merchant.ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, offline.SetupRoutes(), http.MethodPost, "/api/v1/init-payment", key, gin.H{"asset_id": coin.ID, "amount": 100}); w.Code != http.StatusBadGateway {
+		t.Errorf("with the node unreachable: status = %d, want 502", w.Code)
+	}
+}
+
+// TestReceivingAccountChecks checks payments are refused when the merchant's
+// receiving address cannot receive one of their assets
+func TestReceivingAccountChecks(t *testing.T) {
+	coin := algorand.AssetInfo{ID: 1001, Name: "Coin", UnitName: "COIN", Decimals: 2}
+	healthy := &fakeAccount{amount: 1000000, frozen: map[uint64]bool{coin.ID: false}}
+	tests := []struct {
+		name         string
+		account      *fakeAccount
+		assetID      uint64
+		allowRekeyed bool
+		status       int
+	}{
+		{"healthy", healthy, coin.ID, false, http.StatusCreated},
+		{"healthy in ALGO", healthy, 0, false, http.StatusCreated},
+		{"unfunded", nil, 0, false, http.StatusUnprocessableEntity},
+		{"not opted in", &fakeAccount{amount: 1000000}, coin.ID, false, http.StatusUnprocessableEntity},
+		{"frozen", &fakeAccount{amount: 1000000, frozen: map[uint64]bool{coin.ID: true}}, coin.ID, false, http.StatusUnprocessableEntity},
+		{"rekeyed", &fakeAccount{amount: 1000000, authAddr: "SIGNER"}, 0, false, http.StatusUnprocessableEntity},
+		{"rekeyed and allowed", &fakeAccount{amount: 1000000, authAddr: "SIGNER"}, 0, true, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.config.AccountChecks = true
+			s.config.AllowRekeyedAccounts = test.allowRekeyed
+			node := useFakeNode(t, s, coin)
+			merchant := newTestMerchant(t, s, func(m *models.Merchant) {
+				m.AcceptedAssets = []uint64{0, coin.ID}
+			})
+			if test.account != nil {
+				node.setAccount(merchant.ReceivingAddress, test.account)
+			}
+			key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+			w := doRequest(t, s.SetupRoutes(), http.MethodPost, "/api/v1/init-payment", key, gin.H{"asset_id": test.assetID, "amount": 100})
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	// Lookup failures are not mistaken for unhealthy accounts
+	s := newTestServer(t)
+	s.config.AccountChecks = true
+	key := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, s.SetupRoutes(), http.MethodPost, "/api/v1/init-payment", key, gin.H{"amount": 100}); w.Code != http.StatusBadGateway {
+		t.Errorf("with the node unreachable: status = %d, want 502", w.Code)
+	}
+}
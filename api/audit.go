@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the ID that ties a request to its audit entries
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits the client-supplied request IDs that are kept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// actorKey is the context key of the models.Actor making a request
+type actorKey struct{}
+
+// withActor returns a context carrying the actor whose changes are audited
+func withActor(ctx context.Context, actor models.Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the actor carried by ctx; the zero Actor is audited as
+// the system
+func actorFrom(ctx context.Context) models.Actor {
+	actor, _ := ctx.Value(actorKey{}).(models.Actor)
+	return actor
+}
+
+// systemContext returns the context of a background job's changes
+func systemContext(job string) context.Context {
+	return withActor(context.Background(), models.SystemActor(job))
+}
+
+// store returns the database scoped to the actor carried by ctx, so the
+// changes it makes are audited as theirs
+func (s *Server) store(ctx context.Context) db.Store {
+	return s.database.As(actorFrom(ctx))
+}
+
+// assignRequestID gives every request an ID, keeping a well-formed one sent
+// by the client, and echoes it in the response. Requests start out audited
+// as public until they authenticate.
+func assignRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Header(requestIDHeader, requestID)
+		setActor(c, models.ActorPublic, "")
+		c.Next()
+	}
+}
+
+// setActor records who is making the request, keeping its request ID
+func setActor(c *gin.Context, actorType models.ActorType, id string) {
+	actor := models.Actor{Type: actorType, ID: id, RequestID: c.Writer.Header().Get(requestIDHeader)}
+	c.Request = c.Request.WithContext(withActor(c.Request.Context(), actor))
+}
+
+// audit records an admin action in the audit log. Failures are logged; the
+// action has already been made.
+func (s *Server) audit(c *gin.Context, action, resource, resourceID, merchantID string, before, after interface{}) {
+	entry, err := models.NewAuditEntry(action, resource, resourceID, merchantID, before, after)
+	if err == nil {
+		err = s.store(c.Request.Context()).AppendAuditEntry(entry)
+	}
+	if err != nil {
+		log.Printf("Error recording %s of %s %s in the audit log: %v", action, resource, resourceID, err)
+	}
+}
+
+// getPaymentAudit handles listing the audit trail of one of the merchant's payments
+func (s *Server) getPaymentAudit(c *gin.Context) {
+	after, limit, ok := auditPage(c)
+	if !ok {
+		return
+	}
+
+	payment, err := s.database.GetPayment(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment"})
+		return
+	}
+
+	s.respondAuditList(c, models.AuditFilter{
+		MerchantID: payment.MerchantID,
+		Resource:   models.AuditResourcePayment,
+		ResourceID: payment.ID,
+		After:      after,
+		Limit:      limit,
+	})
+}
+
+// adminListAudit handles listing audit entries of every merchant, optionally
+// narrowed to a merchant or resource
+func (s *Server) adminListAudit(c *gin.Context) {
+	after, limit, ok := auditPage(c)
+	if !ok {
+		return
+	}
+
+	filter := models.AuditFilter{
+		MerchantID: c.Query("merchant_id"),
+		Resource:   c.Query("resource"),
+		ResourceID: c.Query("resource_id"),
+		After:      after,
+		Limit:      limit,
+	}
+	if paymentID := c.Query("payment_id"); paymentID != "" {
+		filter.Resource = models.AuditResourcePayment
+		filter.ResourceID = paymentID
+	}
+	s.respondAuditList(c, filter)
+}
+
+// adminVerifyAudit handles checking the audit log's hash chain
+func (s *Server) adminVerifyAudit(c *gin.Context) {
+	result, err := s.database.VerifyAuditLog()
+	if err != nil {
+		log.Printf("Error verifying audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log"})
+		return
+	}
+	if !result.Valid {
+		log.Printf("Audit log verification failed at entry %d: %s", result.BrokenAt, result.Error)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// respondAuditList writes a page of audit entries
+func (s *Server) respondAuditList(c *gin.Context, filter models.AuditFilter) {
+	list, err := s.database.ListAuditEntries(filter)
+	if err != nil {
+		log.Printf("Error listing audit entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// auditPage parses the after and limit query parameters, writing an error
+// response when they are invalid
+func auditPage(c *gin.Context) (int64, int, bool) {
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after must be a non-negative integer"})
+		return 0, 0, false
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(models.DefaultPageSize)))
+	if err != nil || limit < 1 || limit > models.MaxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxPageSize)})
+		return 0, 0, false
+	}
+	return after, limit, true
+}
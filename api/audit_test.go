@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestPaymentAudit checks payment changes are recorded with who made them and
+// the request they were made in, and the log's hash chain verifies
+func TestPaymentAudit(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, gin.H{"amount": 1000000}, requestIDHeader, "order-7")
+	if w.Code != http.StatusCreated || w.Header().Get(requestIDHeader) != "order-7" {
+		t.Fatalf("create: status = %d, request ID %q", w.Code, w.Header().Get(requestIDHeader))
+	}
+	var created models.PaymentResponse
+	decodeBody(t, w, &created)
+	w = doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil, requestIDHeader, "not a valid id")
+	if requestID := w.Header().Get(requestIDHeader); w.Code != http.StatusOK || requestID == "" || requestID == "not a valid id" {
+		t.Fatalf("cancel: status = %d, request ID %q", w.Code, requestID)
+	}
+	deliverTransfer(t, s, merchant.ID, created.PaymentID, models.PaymentStatusLatePayment)
+
+	var list models.AuditEntryList
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID+"/audit", key, nil), &list)
+	if len(list.Entries) != 3 {
+		t.Fatalf("audit entries = %+v, want 3", list.Entries)
+	}
+	first, cancelled, late := list.Entries[0], list.Entries[1], list.Entries[2]
+	if first.Action != models.AuditPaymentCreated || first.ActorType != models.ActorAPIKey || first.ActorID == "" ||
+		first.RequestID != "order-7" || len(first.Before) != 0 || len(first.After) == 0 {
+		t.Errorf("creation entry = %+v", first)
+	}
+	if cancelled.Action != models.AuditPaymentCancelled || cancelled.ActorID != first.ActorID || cancelled.RequestID != w.Header().Get(requestIDHeader) ||
+		len(cancelled.Before) == 0 || cancelled.PrevHash != first.Hash {
+		t.Errorf("cancellation entry = %+v", cancelled)
+	}
+	if late.Action != models.AuditPaymentStatusChanged || late.ActorType != models.ActorSystem || late.RequestID != "" {
+		t.Errorf("late payment entry = %+v", late)
+	}
+
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID+"/audit?limit=2", key, nil), &list)
+	if len(list.Entries) != 2 || !list.HasMore {
+		t.Fatalf("first page = %d entries, has_more %v", len(list.Entries), list.HasMore)
+	}
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID+"/audit?after="+strconv.FormatInt(list.Entries[1].ID, 10), key, nil), &list)
+	if len(list.Entries) != 1 || list.Entries[0].ID != late.ID || list.HasMore {
+		t.Fatalf("second page = %+v", list)
+	}
+
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID+"/audit", other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's payment: status = %d, want 404", w.Code)
+	}
+
+	var verification models.AuditVerification
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/admin/audit/verify", testAdminKey, nil), &verification)
+	if !verification.Valid || verification.Entries != 3 || verification.LastHash != late.Hash {
+		t.Errorf("verification = %+v", verification)
+	}
+}
+
+// TestAdminAudit checks admin actions are audited as the admin and can be
+// listed across merchants
+func TestAdminAudit(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants", testAdminKey, gin.H{
+		"display_name":      "Audited Shop",
+		"receiving_address": newTestMerchant(t, s).ReceivingAddress,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create merchant: status = %d, body %s", w.Code, w.Body)
+	}
+	var merchant models.Merchant
+	decodeBody(t, w, &merchant)
+
+	var list models.AuditEntryList
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/admin/audit?merchant_id="+merchant.ID, testAdminKey, nil), &list)
+	if len(list.Entries) != 1 || list.Entries[0].Action != models.AuditMerchantCreated || list.Entries[0].ActorType != models.ActorAdmin {
+		t.Fatalf("merchant entries = %+v", list.Entries)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/admin/audit?limit=0", testAdminKey, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("limit 0: status = %d, want 400", w.Code)
+	}
+}
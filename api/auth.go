@@ -0,0 +1,126 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys set by the authentication middleware
+const (
+	contextAPIKey = "api_key"
+)
+
+// API key prefixes by key type
+var apiKeyPrefixes = map[models.APIKeyType]string{
+	models.APIKeyTypePublishable: "pk_",
+	models.APIKeyTypeSecret:      "sk_",
+}
+
+// authenticate resolves the API key on the request and rejects unauthenticated calls
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plaintext := requestAPIKey(c)
+		if plaintext == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+			return
+		}
+
+		key, err := s.database.GetAPIKeyByHash(hashAPIKey(plaintext))
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up API key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate request"})
+			return
+		}
+		if key.RevokedAt != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+			return
+		}
+
+		if err := s.database.TouchAPIKey(key.ID); err != nil {
+			log.Printf("Error updating API key last use: %v", err)
+		}
+
+		c.Set(contextAPIKey, key)
+		setActor(c, models.ActorAPIKey, key.ID)
+		c.Next()
+	}
+}
+
+// requireScope rejects requests whose API key lacks the given scope
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentAPIKey(c).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is missing scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireAdmin authenticates requests to the admin API with the configured admin key
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.config.AdminAPIKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API is disabled"})
+			return
+		}
+
+		plaintext := requestAPIKey(c)
+		if subtle.ConstantTimeCompare([]byte(plaintext), []byte(s.config.AdminAPIKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin API key"})
+			return
+		}
+		setActor(c, models.ActorAdmin, "")
+		c.Next()
+	}
+}
+
+// currentAPIKey returns the API key resolved by authenticate
+func currentAPIKey(c *gin.Context) *models.APIKey {
+	return c.MustGet(contextAPIKey).(*models.APIKey)
+}
+
+// currentMerchantID returns the merchant that owns the request's API key
+func currentMerchantID(c *gin.Context) string {
+	return currentAPIKey(c).MerchantID
+}
+
+// requestAPIKey extracts the API key from the Authorization or X-API-Key header
+func requestAPIKey(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(c.GetHeader("X-API-Key"))
+}
+
+// generateAPIKey returns a new plaintext key of the given type
+func generateAPIKey(keyType models.APIKeyType) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefixes[keyType] + hex.EncodeToString(buf), nil
+}
+
+// hashAPIKey returns the stored representation of a plaintext key
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthenticate checks requests without a valid, unrevoked key are refused
+func TestAuthenticate(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payments", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status = %d, want 401", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payments", "sk_unknown", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("with an unknown key: status = %d, want 401", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payments", "", nil, "X-API-Key", key); w.Code != http.StatusOK {
+		t.Errorf("with X-API-Key: status = %d, want 200", w.Code)
+	}
+
+	keys, err := s.database.ListAPIKeys(merchant.ID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("ListAPIKeys = %v, %v", keys, err)
+	}
+	if keys[0].LastUsedAt == nil {
+		t.Error("last use was not recorded")
+	}
+	if err := s.database.RevokeAPIKey(keys[0].ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payments", key, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("with a revoked key: status = %d, want 401", w.Code)
+	}
+}
+
+// TestPublishableKeyScopes checks publishable keys only reach a single
+// payment's status
+func TestPublishableKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	secret := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	publishable := newTestKey(t, s, merchant.ID, models.APIKeyTypePublishable)
+
+	created := createTestPayment(t, router, secret, gin.H{"amount": 1000000})
+
+	for _, path := range []string{
+		"/api/v1/check-payment/" + created.PaymentID,
+	} {
+		for name, key := range map[string]string{"publishable": publishable, "secret": secret} {
+			if w := doRequest(t, router, http.MethodGet, path, key, nil); w.Code != http.StatusOK {
+				t.Errorf("GET %s with a %s key: status = %d, want 200", path, name, w.Code)
+			}
+		}
+	}
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/balance"},
+		{http.MethodGet, "/api/v1/payments"},
+		{http.MethodGet, "/api/v1/payment/" + created.PaymentID},
+		{http.MethodGet, "/api/v1/ledger/entries"},
+		{http.MethodGet, "/api/v1/payouts"},
+		{http.MethodGet, "/api/v1/exports"},
+		{http.MethodPost, "/api/v1/exports"},
+		{http.MethodPost, "/api/v1/init-payment"},
+	} {
+		if w := doRequest(t, router, route.method, route.path, publishable, nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s with a publishable key: status = %d, want 403", route.method, route.path, w.Code)
+		}
+	}
+
+	// Keys only see their own merchant's payments
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/check-payment/"+created.PaymentID, other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's payment: status = %d, want 404", w.Code)
+	}
+}
+
+// TestCreateAPIKey checks key types and the scopes each may be granted
+func TestCreateAPIKey(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+
+	tests := []struct {
+		name   string
+		req    gin.H
+		status int
+		scopes []string
+	}{
+		{"secret defaults", gin.H{"merchant_id": merchant.ID, "type": "secret"}, http.StatusCreated, models.AllScopes},
+		{"publishable defaults", gin.H{"merchant_id": merchant.ID, "type": "publishable"}, http.StatusCreated, models.PublishableScopes},
+		{"narrow secret", gin.H{"merchant_id": merchant.ID, "type": "secret", "scopes": []string{"checkout:read"}}, http.StatusCreated, []string{"checkout:read"}},
+		{"publishable with payments:read", gin.H{"merchant_id": merchant.ID, "type": "publishable", "scopes": []string{"payments:read"}}, http.StatusBadRequest, nil},
+		{"unknown scope", gin.H{"merchant_id": merchant.ID, "type": "secret", "scopes": []string{"admin"}}, http.StatusBadRequest, nil},
+		{"unknown type", gin.H{"merchant_id": merchant.ID, "type": "root"}, http.StatusBadRequest, nil},
+		{"unknown merchant", gin.H{"merchant_id": "missing", "type": "secret"}, http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doRequest(t, router, http.MethodPost, "/api/v1/admin/api-keys", testAdminKey, test.req)
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, test.status, w.Body)
+			}
+			if test.status != http.StatusCreated {
+				return
+			}
+			var created models.APIKeyResponse
+			decodeBody(t, w, &created)
+			if !slices.Equal(created.Scopes, test.scopes) {
+				t.Errorf("scopes = %v, want %v", created.Scopes, test.scopes)
+			}
+			if prefix := apiKeyPrefixes[created.Type]; !strings.HasPrefix(created.Key, prefix) || created.Prefix != created.Key[:12] {
+				t.Errorf("key %q, prefix %q", created.Key, created.Prefix)
+			}
+			if w := doRequest(t, router, http.MethodGet, "/api/v1/check-payment/missing", created.Key, nil); w.Code != http.StatusNotFound {
+				t.Errorf("the new key was not accepted: status = %d", w.Code)
+			}
+		})
+	}
+
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/admin/api-keys", "wrong", gin.H{}); w.Code != http.StatusUnauthorized {
+		t.Errorf("with a wrong admin key: status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+)
+
+// runSubscriptionScheduler periodically records the outcome of subscription
+// invoices and issues the invoices that are due
+func (s *Server) runSubscriptionScheduler() {
+	if s.config.SubscriptionInterval <= 0 {
+		log.Printf("Subscription scheduler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.config.SubscriptionInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.processSubscriptions(systemContext("subscription_scheduler"), time.Now())
+		}
+	}
+}
+
+// processSubscriptions runs one scheduler pass. Outcomes are recorded first
+// so a subscription whose invoice just closed can be billed in the same pass.
+func (s *Server) processSubscriptions(ctx context.Context, now time.Time) {
+	closed, err := s.database.GetSubscriptionsWithClosedInvoices()
+	if err != nil {
+		log.Printf("Error loading subscription invoices: %v", err)
+		return
+	}
+	for _, sub := range closed {
+		payment, err := s.database.GetPayment(sub.MerchantID, sub.OpenPaymentID)
+		if err != nil {
+			log.Printf("Error loading invoice %s of subscription %s: %v", sub.OpenPaymentID, sub.ID, err)
+			continue
+		}
+		s.recordInvoiceOutcome(ctx, sub, payment)
+	}
+
+	due, err := s.database.GetDueSubscriptions(now)
+	if err != nil {
+		log.Printf("Error loading due subscriptions: %v", err)
+		return
+	}
+	for _, sub := range due {
+		s.issueSubscriptionInvoice(ctx, sub)
+	}
+}
+
+// issueSubscriptionInvoice creates the next invoice of a due subscription: the
+// first invoice of a new period for active subscriptions and a dunning retry
+// for past due ones. Failures are logged and retried on the next pass.
+func (s *Server) issueSubscriptionInvoice(ctx context.Context, sub *models.Subscription) {
+	merchant, err := s.database.GetMerchant(sub.MerchantID)
+	if err != nil {
+		log.Printf("Error loading merchant for subscription %s: %v", sub.ID, err)
+		return
+	}
+
+	invoice, reqErr := s.createSubscriptionInvoice(ctx, merchant, sub)
+	if reqErr != nil {
+		log.Printf("Error invoicing subscription %s: %s", sub.ID, reqErr.message)
+		return
+	}
+
+	fromStatus := sub.Status
+	advanceSubscription(sub, invoice.ID)
+	if err := s.database.SaveSubscriptionState(sub, fromStatus, ""); err != nil {
+		log.Printf("Error recording invoice %s of subscription %s: %v", invoice.ID, sub.ID, err)
+		if _, err := s.store(ctx).CancelPayment(merchant.ID, invoice.ID); err != nil {
+			log.Printf("Error cancelling unrecorded invoice %s: %v", invoice.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Issued invoice %s for period %d of subscription %s (attempt %d)", invoice.ID, sub.Period, sub.ID, sub.Attempt)
+	s.notifySubscription(sub, models.EventSubscriptionInvoiceCreated, invoice.ID)
+}
+
+// createSubscriptionInvoice creates a payment for one billing period of a
+// subscription; the invoice stays payable for the subscription's grace period
+func (s *Server) createSubscriptionInvoice(ctx context.Context, merchant *models.Merchant, sub *models.Subscription) (*models.Payment, *requestError) {
+	req := &models.PaymentRequest{
+		Amount:           sub.Amount,
+		AssetID:          sub.AssetID,
+		CallbackURL:      sub.CallbackURL,
+		Metadata:         sub.Metadata,
+		ExpiresInSeconds: sub.GracePeriodSeconds,
+		SubscriptionID:   sub.ID,
+	}
+	return s.createPayment(ctx, merchant, req)
+}
+
+// advanceSubscription records a newly issued invoice on a subscription. An
+// active subscription moves to its next period; a past due one counts another
+// attempt at the current period.
+func advanceSubscription(sub *models.Subscription, paymentID string) {
+	if sub.Status == models.SubscriptionStatusActive {
+		sub.Period++
+		sub.Attempt = 1
+		sub.NextBillingAt = sub.BillingDate(sub.Period)
+	} else {
+		sub.Attempt++
+	}
+	sub.OpenPaymentID = paymentID
+	sub.NextRetryAt = nil
+}
+
+// recordInvoiceOutcome updates a subscription from the state of its open invoice
+func (s *Server) recordInvoiceOutcome(ctx context.Context, sub *models.Subscription, invoice *models.Payment) {
+	switch invoice.Status {
+	case models.PaymentStatusPending:
+		return
+	case models.PaymentStatusCompleted:
+		s.markSubscriptionPaid(ctx, sub, invoice)
+	default:
+		s.markSubscriptionUnpaid(sub, invoice)
+	}
+}
+
+// settleSubscriptionInvoice records a completed invoice on its subscription.
+// Besides the open invoice, a late payment of an earlier attempt settles a
+// past due period.
+func (s *Server) settleSubscriptionInvoice(ctx context.Context, invoice *models.Payment) {
+	sub, err := s.database.GetSubscription(invoice.MerchantID, invoice.SubscriptionID)
+	if err != nil {
+		log.Printf("Error loading subscription %s for invoice %s: %v", invoice.SubscriptionID, invoice.ID, err)
+		return
+	}
+
+	if sub.OpenPaymentID != invoice.ID && sub.Status != models.SubscriptionStatusPastDue {
+		log.Printf("Invoice %s completed after its period of subscription %s was closed", invoice.ID, sub.ID)
+		return
+	}
+	s.markSubscriptionPaid(ctx, sub, invoice)
+}
+
+// markSubscriptionPaid returns a subscription to active after an invoice is
+// paid, cancelling any other invoice still open for the period
+func (s *Server) markSubscriptionPaid(ctx context.Context, sub *models.Subscription, invoice *models.Payment) {
+	fromStatus, openPaymentID := sub.Status, sub.OpenPaymentID
+	now := time.Now()
+	sub.Status = models.SubscriptionStatusActive
+	sub.OpenPaymentID = ""
+	sub.NextRetryAt = nil
+	sub.LastPaidAt = &now
+
+	if !s.saveSubscriptionOutcome(sub, fromStatus, openPaymentID) {
+		return
+	}
+
+	if openPaymentID != "" && openPaymentID != invoice.ID {
+		s.cancelSubscriptionInvoice(ctx, sub, openPaymentID)
+	}
+	s.notifySubscription(sub, models.EventSubscriptionPaid, invoice.ID)
+}
+
+// markSubscriptionUnpaid moves a subscription whose invoice closed unpaid to
+// past due, or cancels it once its dunning retries are used up
+func (s *Server) markSubscriptionUnpaid(sub *models.Subscription, invoice *models.Payment) {
+	fromStatus, openPaymentID := sub.Status, sub.OpenPaymentID
+	now := time.Now()
+	sub.OpenPaymentID = ""
+
+	event := models.EventSubscriptionPastDue
+	if sub.Attempt <= sub.DunningRetries {
+		retryAt := now.Add(time.Duration(sub.DunningIntervalSeconds) * time.Second)
+		sub.Status = models.SubscriptionStatusPastDue
+		sub.NextRetryAt = &retryAt
+	} else {
+		event = models.EventSubscriptionCancelled
+		sub.Status = models.SubscriptionStatusCancelled
+		sub.NextRetryAt = nil
+		sub.CancelledAt = &now
+	}
+
+	if !s.saveSubscriptionOutcome(sub, fromStatus, openPaymentID) {
+		return
+	}
+
+	log.Printf("Invoice %s of subscription %s closed %s; subscription is %s", invoice.ID, sub.ID, invoice.Status, sub.Status)
+	s.notifySubscription(sub, event, invoice.ID)
+}
+
+// saveSubscriptionOutcome stores a subscription's new billing state. A
+// concurrent update means another path recorded the outcome first, so it is
+// not logged as an error.
+func (s *Server) saveSubscriptionOutcome(sub *models.Subscription, fromStatus models.SubscriptionStatus, fromOpenPaymentID string) bool {
+	err := s.database.SaveSubscriptionState(sub, fromStatus, fromOpenPaymentID)
+	if errors.Is(err, db.ErrSubscriptionChanged) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error updating subscription %s: %v", sub.ID, err)
+		return false
+	}
+	return true
+}
+
+// cancelSubscriptionInvoice cancels an invoice that is no longer needed
+func (s *Server) cancelSubscriptionInvoice(ctx context.Context, sub *models.Subscription, paymentID string) {
+	payment, err := s.store(ctx).CancelPayment(sub.MerchantID, paymentID)
+	if errors.Is(err, db.ErrPaymentNotPending) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling invoice %s of subscription %s: %v", paymentID, sub.ID, err)
+		return
+	}
+	s.notify(payment, models.EventPaymentCancelled)
+}
+
+// notifySubscription sends a subscription event to the subscription's
+// callback URL, or the merchant's webhook URL when it has none
+func (s *Server) notifySubscription(sub *models.Subscription, event, paymentID string) {
+	payload := models.SubscriptionWebhookPayload{
+		Event:             event,
+		SubscriptionID:    sub.ID,
+		Status:            sub.Status,
+		Plan:              sub.Plan,
+		CustomerReference: sub.CustomerReference,
+		PaymentID:         paymentID,
+		Period:            sub.Period,
+		Attempt:           sub.Attempt,
+		Amount:            sub.Amount,
+		AssetID:           sub.AssetID,
+		NextBillingAt:     sub.NextBillingAt,
+		NextRetryAt:       sub.NextRetryAt,
+		Metadata:          sub.Metadata,
+		Timestamp:         time.Now(),
+	}
+	go s.postWebhook(sub.MerchantID, sub.CallbackURL, "subscription "+sub.ID, payload)
+}
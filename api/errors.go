@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// requestError is a client-facing failure and the status and optional error
+// code it is reported with
+type requestError struct {
+	status  int
+	message string
+	code    string
+}
+
+// Error returns the client-facing message
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// respond writes the error as a JSON response
+func (e *requestError) respond(c *gin.Context) {
+	body := gin.H{"error": e.message}
+	if e.code != "" {
+		body["code"] = e.code
+	}
+	c.JSON(e.status, body)
+}
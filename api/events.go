@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventStreamKeepalive is how often an idle event stream sends a comment so
+// proxies do not close the connection
+const eventStreamKeepalive = 15 * time.Second
+
+// eventHub fans payment events out to event stream subscribers
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan models.WebhookPayload]struct{}
+}
+
+// newEventHub creates an empty event hub
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[string]map[chan models.WebhookPayload]struct{})}
+}
+
+// subscribe registers a subscriber for a payment's events and returns its
+// channel and a function that removes it
+func (h *eventHub) subscribe(paymentID string) (<-chan models.WebhookPayload, func()) {
+	ch := make(chan models.WebhookPayload, 16)
+
+	h.mu.Lock()
+	if h.subscribers[paymentID] == nil {
+		h.subscribers[paymentID] = make(map[chan models.WebhookPayload]struct{})
+	}
+	h.subscribers[paymentID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[paymentID], ch)
+		if len(h.subscribers[paymentID]) == 0 {
+			delete(h.subscribers, paymentID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// publish delivers an event to the payment's subscribers, dropping it for
+// subscribers that are not keeping up
+func (h *eventHub) publish(payload models.WebhookPayload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[payload.PaymentID] {
+		select {
+		case ch <- payload:
+		default:
+			log.Printf("Dropping %s event for slow subscriber of payment %s", payload.Event, payload.PaymentID)
+		}
+	}
+}
+
+// streamPaymentEvents streams a payment's events as server-sent events. The
+// stream opens with a payment.status event describing the current state.
+func (s *Server) streamPaymentEvents(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	// Subscribe before loading so no event between the two is missed
+	events, unsubscribe := s.events.subscribe(paymentID)
+	defer unsubscribe()
+
+	payment, err := s.database.GetPayment(currentMerchantID(c), paymentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	initial := webhookPayload(payment, models.EventPaymentStatus)
+	initial.Splits = s.splitReport(payment)
+	c.SSEvent(initial.Event, initial)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(eventStreamKeepalive)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			c.SSEvent(event.Event, event)
+			return true
+		case <-keepalive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestStreamPaymentEvents checks the event stream opens with the payment's
+// status and then relays its events
+func TestStreamPaymentEvents(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	secret := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	publishable := newTestKey(t, s, merchant.ID, models.APIKeyTypePublishable)
+
+	created := createTestPayment(t, router, secret, gin.H{"amount": 1000000, "expires_in_seconds": 600})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/payment/"+created.PaymentID+"/events", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+publishable)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, ct)
+	}
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if event, ok := strings.CutPrefix(scanner.Text(), "event:"); ok {
+				events <- event
+			}
+		}
+	}()
+	next := func() string {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event was streamed")
+			return ""
+		}
+	}
+
+	// The stream subscribes before sending the current status, so later
+	// changes are not missed
+	if event := next(); event != models.EventPaymentStatus {
+		t.Fatalf("first event = %q, want %s", event, models.EventPaymentStatus)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/extend", secret, gin.H{"expires_in_seconds": 3600}); w.Code != http.StatusOK {
+		t.Fatalf("extend: status = %d", w.Code)
+	}
+	if event := next(); event != models.EventPaymentExtended {
+		t.Fatalf("event = %q, want %s", event, models.EventPaymentExtended)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", secret, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	if event := next(); event != models.EventPaymentCancelled {
+		t.Fatalf("event = %q, want %s", event, models.EventPaymentCancelled)
+	}
+
+	// Streams are scoped to the key's merchant
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypePublishable)
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID+"/events", other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's stream: status = %d, want 404", w.Code)
+	}
+}
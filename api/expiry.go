@@ -0,0 +1,100 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// extendPayment handles pushing back the expiry of a pending payment
+func (s *Server) extendPayment(c *gin.Context) {
+	var req models.ExtendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", currentMerchantID(c), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
+	}
+
+	expiresIn, msg := s.expiryWithinBounds(merchant, req.ExpiresInSeconds)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	payment, err := s.database.GetPayment(merchant.ID, c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment"})
+		return
+	}
+
+	expiresAt := time.Now().Add(expiresIn)
+	if !expiresAt.After(payment.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New expiry must be later than the current expiry"})
+		return
+	}
+
+	payment, err = s.store(c.Request.Context()).ExtendPayment(merchant.ID, payment.ID, expiresAt)
+	if errors.Is(err, db.ErrPaymentNotPending) {
+		status := string(payment.Status)
+		if payment.Status == models.PaymentStatusPending {
+			status = "expired"
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment is " + status + " and cannot be extended"})
+		return
+	}
+	if errors.Is(err, db.ErrPaymentVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was updated concurrently, retry the request"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error extending payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extend payment"})
+		return
+	}
+
+	s.notify(payment, models.EventPaymentExtended)
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// expiryWithinBounds converts a requested expires_in_seconds to a duration,
+// returning a client-facing error message if it is outside the merchant's bounds
+func (s *Server) expiryWithinBounds(merchant *models.Merchant, seconds int) (time.Duration, string) {
+	minSeconds, maxSeconds := s.expiryBounds(merchant)
+	if seconds < minSeconds || seconds > maxSeconds {
+		return 0, "expires_in_seconds must be between " + strconv.Itoa(minSeconds) + " and " + strconv.Itoa(maxSeconds)
+	}
+	return time.Duration(seconds) * time.Second, ""
+}
+
+// expiryBounds returns the merchant's payment expiry bounds in seconds,
+// falling back to the server defaults
+func (s *Server) expiryBounds(merchant *models.Merchant) (int, int) {
+	minSeconds, maxSeconds := merchant.MinExpirySeconds, merchant.MaxExpirySeconds
+	if minSeconds == 0 {
+		minSeconds = s.config.PaymentMinExpiry
+	}
+	if maxSeconds == 0 {
+		maxSeconds = s.config.PaymentMaxExpiry
+	}
+	return minSeconds, maxSeconds
+}
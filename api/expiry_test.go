@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestPaymentExpiry checks requested expiries stay within the server's and
+// the merchant's bounds
+func TestPaymentExpiry(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	key := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	bounded := newTestKey(t, s, newTestMerchant(t, s, func(m *models.Merchant) {
+		m.MinExpirySeconds = 300
+		m.MaxExpirySeconds = 600
+	}).ID, models.APIKeyTypeSecret)
+
+	tests := []struct {
+		name    string
+		key     string
+		seconds int
+		ok      bool
+	}{
+		{"default bounds", key, 120, true},
+		{"below the default minimum", key, s.config.PaymentMinExpiry - 1, false},
+		{"above the default maximum", key, s.config.PaymentMaxExpiry + 1, false},
+		{"negative", key, -60, false},
+		{"merchant bounds", bounded, 600, true},
+		{"below the merchant minimum", bounded, 120, false},
+		{"above the merchant maximum", bounded, 900, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := time.Now()
+			w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", test.key, gin.H{"amount": 1000000, "expires_in_seconds": test.seconds})
+			if !test.ok {
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("status = %d, want 400", w.Code)
+				}
+				return
+			}
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var created models.PaymentResponse
+			decodeBody(t, w, &created)
+			expiresAt, err := time.Parse(time.RFC3339, created.ExpiresAt)
+			want := before.Add(time.Duration(test.seconds) * time.Second).Truncate(time.Second)
+			if err != nil || expiresAt.Before(want) || expiresAt.After(want.Add(5*time.Second)) {
+				t.Fatalf("expires_at = %s, want about %s", created.ExpiresAt, want)
+			}
+		})
+	}
+
+	// Without a request the merchant's default timeout applies
+	created := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+	expiresAt, _ := time.Parse(time.RFC3339, created.ExpiresAt)
+	if want := time.Now().Add(time.Duration(s.config.PaymentTimeout) * time.Minute); expiresAt.Sub(want).Abs() > 5*time.Second {
+		t.Errorf("default expires_at = %s, want about %s", expiresAt, want)
+	}
+}
+
+// TestExtendPayment checks pending payments can only have their expiry moved
+// later
+func TestExtendPayment(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	created := createTestPayment(t, router, key, gin.H{"amount": 1000000, "expires_in_seconds": 600})
+	path := "/api/v1/payment/" + created.PaymentID + "/extend"
+
+	w := doRequest(t, router, http.MethodPost, path, key, gin.H{"expires_in_seconds": 3600})
+	if w.Code != http.StatusOK {
+		t.Fatalf("extend: status = %d, body %s", w.Code, w.Body)
+	}
+	var payment models.Payment
+	decodeBody(t, w, &payment)
+	if until := time.Until(payment.ExpiresAt); until < 3590*time.Second || until > 3600*time.Second {
+		t.Fatalf("extended expiry is %s away, want an hour", until)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		req    gin.H
+		status int
+	}{
+		{"earlier expiry", path, gin.H{"expires_in_seconds": 1200}, http.StatusBadRequest},
+		{"outside the bounds", path, gin.H{"expires_in_seconds": s.config.PaymentMaxExpiry + 1}, http.StatusBadRequest},
+		{"missing expiry", path, gin.H{}, http.StatusBadRequest},
+		{"unknown payment", "/api/v1/payment/missing/extend", gin.H{"expires_in_seconds": 7200}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := doRequest(t, router, http.MethodPost, test.path, key, test.req); w.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodPost, path, key, gin.H{"expires_in_seconds": 7200}); w.Code != http.StatusConflict {
+		t.Errorf("extending a cancelled payment: status = %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"algopay/export"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportPollInterval is how often the export runner looks for queued jobs
+// and expired files when it is not woken by a new job
+const exportPollInterval = 30 * time.Second
+
+// createExport handles queueing an export of the calling merchant's records
+func (s *Server) createExport(c *gin.Context) {
+	s.queueExport(c, currentMerchantID(c))
+}
+
+// adminCreateExport handles queueing an export of one merchant's records, or
+// of every merchant's when merchant_id is empty
+func (s *Server) adminCreateExport(c *gin.Context) {
+	s.queueExport(c, "")
+}
+
+// queueExport validates an export request and queues the job. A non-empty
+// merchantID overrides the merchant the request asks for.
+func (s *Server) queueExport(c *gin.Context, merchantID string) {
+	var req models.ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := req.Range()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if merchantID == "" {
+		merchantID = req.MerchantID
+	}
+
+	job := &models.ExportJob{
+		ID:         uuid.New().String(),
+		MerchantID: merchantID,
+		Dataset:    req.Dataset,
+		Format:     req.Format,
+		From:       from,
+		To:         to,
+		Status:     models.ExportPending,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.database.CreateExportJob(job); err != nil {
+		log.Printf("Error creating export job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+	s.audit(c, models.AuditExportCreated, models.AuditResourceExport, job.ID, job.MerchantID, nil, job)
+
+	select {
+	case s.exportWake <- struct{}{}:
+	default:
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// listExports handles listing the calling merchant's recent exports
+func (s *Server) listExports(c *gin.Context) {
+	s.respondExportList(c, currentMerchantID(c))
+}
+
+// adminListExports handles listing recent exports, optionally of one merchant
+func (s *Server) adminListExports(c *gin.Context) {
+	s.respondExportList(c, c.Query("merchant_id"))
+}
+
+// respondExportList writes the most recent export jobs of a merchant
+func (s *Server) respondExportList(c *gin.Context, merchantID string) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(models.DefaultPageSize)))
+	if err != nil || limit < 1 || limit > models.MaxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxPageSize)})
+		return
+	}
+
+	jobs, err := s.database.ListExportJobs(merchantID, limit)
+	if err != nil {
+		log.Printf("Error listing export jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list exports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": jobs})
+}
+
+// getExport handles retrieving one of the calling merchant's exports
+func (s *Server) getExport(c *gin.Context) {
+	if job := s.findExport(c, currentMerchantID(c)); job != nil {
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// adminGetExport handles retrieving any export
+func (s *Server) adminGetExport(c *gin.Context) {
+	if job := s.findExport(c, ""); job != nil {
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// downloadExport handles downloading the file of one of the calling
+// merchant's exports
+func (s *Server) downloadExport(c *gin.Context) {
+	if job := s.findExport(c, currentMerchantID(c)); job != nil {
+		s.serveExport(c, job)
+	}
+}
+
+// adminDownloadExport handles downloading the file of any export
+func (s *Server) adminDownloadExport(c *gin.Context) {
+	if job := s.findExport(c, ""); job != nil {
+		s.serveExport(c, job)
+	}
+}
+
+// findExport loads the export job named in the path, responding and
+// returning nil when it does not exist or, when merchantID is set, belongs to
+// another merchant
+func (s *Server) findExport(c *gin.Context, merchantID string) *models.ExportJob {
+	job, err := s.database.GetExportJob(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && merchantID != "" && job.MerchantID != merchantID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error getting export job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export"})
+		return nil
+	}
+	return job
+}
+
+// serveExport writes a completed export's file as an attachment
+func (s *Server) serveExport(c *gin.Context, job *models.ExportJob) {
+	switch job.Status {
+	case models.ExportCompleted:
+	case models.ExportExpired:
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired", "code": "export_expired"})
+		return
+	case models.ExportFailed:
+		c.JSON(http.StatusConflict, gin.H{"error": "Export failed: " + job.Error, "code": "export_failed"})
+		return
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "code": "export_not_ready"})
+		return
+	}
+
+	path := s.exportPath(job)
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Error opening export %s: %v", job.ID, err)
+		c.JSON(http.StatusGone, gin.H{"error": "Export file is no longer available", "code": "export_expired"})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(job.Format))
+	c.FileAttachment(path, export.FileName(job.ID, exportOptions(job)))
+}
+
+// exportPath returns where a job's file is stored
+func (s *Server) exportPath(job *models.ExportJob) string {
+	return filepath.Join(s.config.ExportDir, job.ID+"."+string(job.Format))
+}
+
+// exportOptions returns what a job exports
+func exportOptions(job *models.ExportJob) export.Options {
+	return export.Options{
+		Dataset: job.Dataset,
+		Format:  job.Format,
+		Filter:  models.ExportFilter{MerchantID: job.MerchantID, From: job.From, To: job.To},
+	}
+}
+
+// runExports runs queued export jobs one at a time and deletes expired
+// files. Jobs interrupted by a restart are queued again.
+func (s *Server) runExports() {
+	if err := os.MkdirAll(s.config.ExportDir, 0o750); err != nil {
+		log.Printf("Exports disabled: failed to create %s: %v", s.config.ExportDir, err)
+		return
+	}
+	if err := s.database.RequeueExportJobs(); err != nil {
+		log.Printf("Error requeueing export jobs: %v", err)
+	}
+
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processExports()
+
+		select {
+		case <-ticker.C:
+		case <-s.exportWake:
+		}
+	}
+}
+
+// processExports deletes expired export files, then runs every queued job
+func (s *Server) processExports() {
+	s.expireExports()
+
+	for {
+		job, err := s.database.ClaimExportJob()
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming export job: %v", err)
+			return
+		}
+		s.runExport(job)
+	}
+}
+
+// runExport writes a job's file and records the outcome. The file is written
+// under a temporary name so a download never sees a partial export.
+func (s *Server) runExport(job *models.ExportJob) {
+	rows, size, err := s.writeExport(job)
+	now := time.Now()
+	job.CompletedAt = &now
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID, err)
+		job.Status = models.ExportFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.ExportCompleted
+		job.Rows = rows
+		job.Size = size
+		if s.config.ExportTTL > 0 {
+			expiresAt := now.Add(time.Duration(s.config.ExportTTL) * time.Hour)
+			job.ExpiresAt = &expiresAt
+		}
+	}
+
+	if err := s.database.UpdateExportJob(job); err != nil {
+		log.Printf("Error saving export job %s: %v", job.ID, err)
+	}
+}
+
+// writeExport writes a job's file and returns its row count and size
+func (s *Server) writeExport(job *models.ExportJob) (int64, int64, error) {
+	file, err := os.CreateTemp(s.config.ExportDir, job.ID+"-*.tmp")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(file.Name())
+
+	rows, err := export.Write(s.database, exportOptions(job), file)
+	if err != nil {
+		file.Close()
+		return 0, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return 0, 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Rename(file.Name(), s.exportPath(job)); err != nil {
+		return 0, 0, err
+	}
+	return rows, info.Size(), nil
+}
+
+// expireExports deletes the files of exports past their expiry
+func (s *Server) expireExports() {
+	jobs, err := s.database.GetExpiredExportJobs(time.Now())
+	if err != nil {
+		log.Printf("Error loading expired exports: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := os.Remove(s.exportPath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error deleting export %s: %v", job.ID, err)
+			continue
+		}
+		job.Status = models.ExportExpired
+		if err := s.database.UpdateExportJob(job); err != nil {
+			log.Printf("Error saving export job %s: %v", job.ID, err)
+		}
+	}
+}
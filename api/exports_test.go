@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestExports queues a payments export, runs it and downloads the file
+func TestExports(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	first := createTestPayment(t, router, key, gin.H{"amount": 1000000, "order_reference": "order-1"})
+	second := createTestPayment(t, router, key, gin.H{"amount": 2000000, "order_reference": "order-2"})
+	otherKey := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	createTestPayment(t, router, otherKey, gin.H{"amount": 3000000})
+
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/exports", key, gin.H{"dataset": "customers"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown dataset: status = %d, want 400", w.Code)
+	}
+	w := doRequest(t, router, http.MethodPost, "/api/v1/exports", key, gin.H{"dataset": "payments"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST /exports: status = %d, body %s", w.Code, w.Body)
+	}
+	var job models.ExportJob
+	decodeBody(t, w, &job)
+	if job.Status != models.ExportPending || job.Format != models.ExportCSV {
+		t.Fatalf("job = %+v", job)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/exports/"+job.ID+"/download", key, nil); w.Code != http.StatusConflict {
+		t.Fatalf("download before the export ran: status = %d, want 409", w.Code)
+	}
+
+	s.processExports()
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/exports/"+job.ID, key, nil), &job)
+	if job.Status != models.ExportCompleted || job.Rows != 2 || job.Size == 0 || job.ExpiresAt == nil {
+		t.Fatalf("job after running = %+v", job)
+	}
+
+	w = doRequest(t, router, http.MethodGet, "/api/v1/exports/"+job.ID+"/download", key, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "payments-"+job.ID+".csv") {
+		t.Fatalf("download: status = %d, headers %v", w.Code, w.Header())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "id" {
+		t.Fatalf("CSV has %d records, want a header and 2 rows", len(records))
+	}
+	ids := map[string]bool{records[1][0]: true, records[2][0]: true}
+	if !ids[first.PaymentID] || !ids[second.PaymentID] {
+		t.Fatalf("exported payments %v, want %s and %s", ids, first.PaymentID, second.PaymentID)
+	}
+
+	// Other merchants cannot see the export
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/exports/"+job.ID, otherKey, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("another merchant's export: status = %d, want 404", w.Code)
+	}
+	var list struct {
+		Exports []models.ExportJob `json:"exports"`
+	}
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/exports", otherKey, nil), &list)
+	if len(list.Exports) != 0 {
+		t.Fatalf("another merchant lists %d exports", len(list.Exports))
+	}
+
+	// Expired files are deleted and no longer downloadable
+	past := time.Now().Add(-time.Minute)
+	job.ExpiresAt = &past
+	if err := s.database.UpdateExportJob(&job); err != nil {
+		t.Fatalf("UpdateExportJob: %v", err)
+	}
+	s.expireExports()
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/exports/"+job.ID+"/download", key, nil); w.Code != http.StatusGone {
+		t.Fatalf("download of an expired export: status = %d, want 410", w.Code)
+	}
+}
+
+// TestExportScopes checks exports need the secret-only exports scopes
+func TestExportScopes(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/exports"},
+		{http.MethodGet, "/api/v1/exports"},
+		{http.MethodGet, "/api/v1/exports/missing"},
+		{http.MethodGet, "/api/v1/exports/missing/download"},
+	}
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret, models.ScopePaymentsRead, models.ScopePaymentsWrite)
+	for _, route := range routes {
+		if w := doRequest(t, router, route.method, route.path, key, nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s with payment scopes: status = %d, want 403", route.method, route.path, w.Code)
+		}
+	}
+
+	key = newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret, models.ScopeExportsRead)
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/exports", key, gin.H{"dataset": "payments"}); w.Code != http.StatusForbidden {
+		t.Errorf("POST /exports with exports:read: status = %d, want 403", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/exports", key, nil); w.Code != http.StatusOK {
+		t.Errorf("GET /exports with exports:read: status = %d, want 200", w.Code)
+	}
+	key = newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret, models.ScopeExportsWrite)
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/exports", key, gin.H{"dataset": "payments"}); w.Code != http.StatusAccepted {
+		t.Errorf("POST /exports with exports:write: status = %d, want 202", w.Code)
+	}
+}
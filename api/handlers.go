@@ -1,17 +1,24 @@
 package api
 
 import (
-	"bytes"
+	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"algopay/algorand"
 	"algopay/config"
 	"algopay/db"
 	"algopay/models"
+	"algopay/pricing"
+	"algopay/reconcile"
+	"algopay/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -20,42 +27,71 @@ import (
 
 // Server holds the API server dependencies
 type Server struct {
-	database    *db.Database
+	database    db.Store
 	algoClient  *algorand.Client
 	config      *config.Config
+	webhooks    *webhook.Client
+	prices      pricing.Source
+	events      *eventHub
+	reconciler  *reconcile.Reconciler
 	paymentChan chan *models.Payment
+	exportWake  chan struct{}
 }
 
 // NewServer creates a new API server
-func NewServer(database *db.Database, algoClient *algorand.Client, config *config.Config) *Server {
+func NewServer(database db.Store, algoClient *algorand.Client, prices pricing.Source, config *config.Config) *Server {
 	server := &Server{
 		database:    database,
 		algoClient:  algoClient,
 		config:      config,
+		webhooks:    newWebhookClient(config),
+		prices:      prices,
+		events:      newEventHub(),
+		reconciler:  reconcile.New(database, algoClient),
 		paymentChan: make(chan *models.Payment, 100),
+		exportWake:  make(chan struct{}, 1),
 	}
 
 	// Start webhook processor
 	go server.processWebhooks()
 
 	// Start payment monitor
-	go algoClient.StartPaymentMonitor(server.paymentChan, database)
+	lateGrace := time.Duration(config.LatePaymentGrace) * time.Minute
+	go algoClient.StartPaymentMonitor(server.paymentChan, database, lateGrace)
 
 	// Start cleanup routine
 	go server.cleanupExpiredPayments()
 
+	// Start subscription scheduler
+	go server.runSubscriptionScheduler()
+
+	// Start split payout processor
+	go server.runSplitPayouts()
+
+	// Start merchant payout processor
+	go server.runPayouts()
+
+	// Start scheduled reconciliation
+	go server.runReconciliation()
+
+	// Start export runner
+	go server.runExports()
+
 	return server
 }
 
 // SetupRoutes sets up the API routes
 func (s *Server) SetupRoutes() *gin.Engine {
 	router := gin.Default()
+	router.SetHTMLTemplate(pageTemplates)
+	router.Use(assignRequestID())
 
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Idempotency-Key, X-Request-ID")
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -66,13 +102,82 @@ func (s *Server) SetupRoutes() *gin.Engine {
 	})
 
 	// API routes
-	api := router.Group("/api/v1")
+	api := router.Group("/api/v1", s.authenticate())
 	{
-		api.POST("/init-payment", s.initPayment)
-		api.GET("/check-payment/:id", s.checkPayment)
-		api.GET("/payment/:id", s.getPayment)
+		api.POST("/init-payment", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.initPayment)
+		api.GET("/check-payment/:id", requireScope(models.ScopeCheckoutRead), s.checkPayment)
+		api.GET("/payment/:id", requireScope(models.ScopePaymentsRead), s.getPayment)
+		api.GET("/payment/:id/events", requireScope(models.ScopeCheckoutRead), s.streamPaymentEvents)
+		api.GET("/payment/:id/audit", requireScope(models.ScopePaymentsRead), s.getPaymentAudit)
+		api.GET("/payments", requireScope(models.ScopePaymentsRead), s.listPayments)
+		api.POST("/payment/:id/cancel", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.cancelPayment)
+		api.POST("/payment/:id/extend", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.extendPayment)
+		api.POST("/payment/:id/accept", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.acceptLatePayment)
+		api.POST("/payment/:id/refund", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.refundLatePayment)
+		api.GET("/payment/:id/splits", requireScope(models.ScopePaymentsRead), s.getPaymentSplits)
+		api.POST("/payment/:id/splits/retry", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.retrySplitPayouts)
+
+		api.POST("/subscriptions", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.createSubscription)
+		api.GET("/subscriptions", requireScope(models.ScopePaymentsRead), s.listSubscriptions)
+		api.GET("/subscriptions/:id", requireScope(models.ScopePaymentsRead), s.getSubscription)
+		api.POST("/subscriptions/:id/cancel", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.cancelSubscription)
+
+		api.POST("/payment-links", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.createPaymentLink)
+		api.GET("/payment-links", requireScope(models.ScopePaymentsRead), s.listPaymentLinks)
+		api.GET("/payment-links/:id", requireScope(models.ScopePaymentsRead), s.getPaymentLink)
+		api.PUT("/payment-links/:id", requireScope(models.ScopePaymentsWrite), s.updatePaymentLink)
+		api.POST("/payment-links/:id/payments", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.createLinkPayment)
+
+		api.POST("/invoices", requireScope(models.ScopePaymentsWrite), s.idempotent(), s.createInvoice)
+		api.GET("/invoices", requireScope(models.ScopePaymentsRead), s.listInvoices)
+		api.GET("/invoices/:id", requireScope(models.ScopePaymentsRead), s.getInvoice)
+		api.GET("/invoices/:id/html", requireScope(models.ScopePaymentsRead), s.getInvoiceHTML)
+		api.GET("/invoices/:id/pdf", requireScope(models.ScopePaymentsRead), s.getInvoicePDF)
+
+		api.GET("/balance", requireScope(models.ScopePayoutsRead), s.getBalance)
+		api.GET("/ledger/entries", requireScope(models.ScopePayoutsRead), s.listLedgerEntries)
+		api.POST("/payouts", requireScope(models.ScopePayoutsWrite), s.idempotent(), s.createPayout)
+		api.GET("/payouts", requireScope(models.ScopePayoutsRead), s.listPayouts)
+		api.GET("/payouts/:id", requireScope(models.ScopePayoutsRead), s.getPayout)
+
+		api.POST("/exports", requireScope(models.ScopeExportsWrite), s.idempotent(), s.createExport)
+		api.GET("/exports", requireScope(models.ScopeExportsRead), s.listExports)
+		api.GET("/exports/:id", requireScope(models.ScopeExportsRead), s.getExport)
+		api.GET("/exports/:id/download", requireScope(models.ScopeExportsRead), s.downloadExport)
 	}
 
+	// Admin routes
+	admin := router.Group("/api/v1/admin", s.requireAdmin())
+	{
+		admin.POST("/api-keys", s.createAPIKey)
+		admin.GET("/api-keys", s.listAPIKeys)
+		admin.DELETE("/api-keys/:id", s.revokeAPIKey)
+
+		admin.GET("/payments", s.adminListPayments)
+
+		admin.POST("/merchants", s.createMerchant)
+		admin.GET("/merchants", s.listMerchants)
+		admin.GET("/merchants/:id", s.getMerchant)
+		admin.PUT("/merchants/:id", s.updateMerchant)
+		admin.POST("/merchants/:id/webhook-secret", s.rotateWebhookSecret)
+
+		admin.POST("/reconciliations", s.createReconciliation)
+		admin.GET("/reconciliations", s.listReconciliations)
+		admin.GET("/reconciliations/:id", s.getReconciliation)
+
+		admin.POST("/exports", s.adminCreateExport)
+		admin.GET("/exports", s.adminListExports)
+		admin.GET("/exports/:id", s.adminGetExport)
+		admin.GET("/exports/:id/download", s.adminDownloadExport)
+
+		admin.GET("/audit", s.adminListAudit)
+		admin.GET("/audit/verify", s.adminVerifyAudit)
+	}
+
+	// Public payment link pages
+	router.GET("/l/:slug", s.visitPaymentLink)
+	router.POST("/l/:slug", s.payPaymentLink)
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -88,40 +193,26 @@ func (s *Server) initPayment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	// When api keys are there uncomment below piece to verify the address
-	
-	// Validate merchant address
-	// if err := s.algoClient.ValidateAddress(req.MerchantAddress); err != nil {
-	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid merchant address"})
-	// 	return
-	// }
-
-	// Validate amount
-	if req.Amount == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
-		return
-	}
 
-	// Create payment record
-	payment := &models.Payment{
-		ID:              uuid.New().String(),
-		MerchantAddress: req.MerchantAddress,
-		Amount:          req.Amount,
-		AssetID:         req.AssetID,
-		CallbackURL:     req.CallbackURL,
-		Status:          models.PaymentStatusPending,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-		ExpiresAt:       time.Now().Add(time.Duration(s.config.PaymentTimeout) * time.Minute),
+	// Load the merchant owning the API key
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", currentMerchantID(c), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
 	}
 
-	// Save to database
-	if err := s.database.CreatePayment(payment); err != nil {
-		log.Printf("Error creating payment: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+	payment, reqErr := s.createPayment(c.Request.Context(), merchant, &req)
+	if reqErr != nil {
+		reqErr.respond(c)
 		return
 	}
 
+	c.JSON(http.StatusCreated, paymentResponse(payment))
+}
+
+// paymentResponse describes a newly created payment, including its QR code
+func paymentResponse(payment *models.Payment) models.PaymentResponse {
 	// Generate QR code
 	qrData := map[string]interface{}{
 		"payment_id": payment.ID,
@@ -129,6 +220,9 @@ func (s *Server) initPayment(c *gin.Context) {
 		"amount":     payment.Amount,
 		"asset_id":   payment.AssetID,
 	}
+	if len(payment.PaymentOptions) > 1 {
+		qrData["payment_options"] = payment.PaymentOptions
+	}
 	qrJSON, _ := json.Marshal(qrData)
 	qrCode, err := qrcode.Encode(string(qrJSON), qrcode.Medium, 256)
 	if err != nil {
@@ -140,6 +234,17 @@ func (s *Server) initPayment(c *gin.Context) {
 		MerchantAddress: payment.MerchantAddress,
 		Amount:          payment.Amount,
 		AssetID:         payment.AssetID,
+		DisplayAmount:   payment.DisplayAmount,
+		UnitName:        payment.UnitName,
+		PaymentOptions:  payment.PaymentOptions,
+		FiatAmount:      payment.FiatAmount,
+		FiatCurrency:    payment.FiatCurrency,
+		ExchangeRate:    payment.ExchangeRate,
+		RateSource:      payment.RateSource,
+		RateTimestamp:   payment.RateTimestamp,
+		OrderReference:  payment.OrderReference,
+		Metadata:        payment.Metadata,
+		Splits:          payment.Splits,
 		ExpiresAt:       payment.ExpiresAt.Format(time.RFC3339),
 		Status:          string(payment.Status),
 	}
@@ -147,8 +252,141 @@ func (s *Server) initPayment(c *gin.Context) {
 	if err == nil {
 		response.QRCode = base64.StdEncoding.EncodeToString(qrCode)
 	}
+	return response
+}
+
+// createPayment validates a payment request for a merchant, prices it and
+// saves the resulting pending payment. It is shared by the API, payment links
+// and the subscription scheduler.
+func (s *Server) createPayment(ctx context.Context, merchant *models.Merchant, req *models.PaymentRequest) (*models.Payment, *requestError) {
+	now := time.Now()
+	payment := &models.Payment{
+		ID:              uuid.New().String(),
+		MerchantID:      merchant.ID,
+		MerchantAddress: merchant.ReceivingAddress,
+		SubscriptionID:  req.SubscriptionID,
+		PaymentLinkID:   req.PaymentLinkID,
+		InvoiceID:       req.InvoiceID,
+		OrderReference:  req.OrderReference,
+		Metadata:        req.Metadata,
+		Status:          models.PaymentStatusPending,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	// Validate the accepted assets
+	options, msg := requestedOptions(req)
+	if msg != "" {
+		return nil, &requestError{status: http.StatusBadRequest, message: msg}
+	}
+	for _, option := range options {
+		if !merchant.AcceptsAsset(option.AssetID) {
+			return nil, &requestError{
+				status:  http.StatusBadRequest,
+				message: "Asset " + strconv.FormatUint(option.AssetID, 10) + " is not accepted by this merchant",
+				code:    codeAssetNotAccepted,
+			}
+		}
+	}
+	payment.PaymentOptions = options
+
+	// Validate merchant-supplied references
+	if err := validateOrderReference(req.OrderReference); err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	if err := validateMetadata(req.Metadata, s.config.MetadataMaxBytes); err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	// Fall back to the merchant's webhook URL, validating explicit callback
+	// URLs against the outbound webhook policy
+	callbackURL := merchant.WebhookURL
+	if req.CallbackURL != "" {
+		if err := s.webhooks.ValidateURL(req.CallbackURL); err != nil {
+			return nil, &requestError{status: http.StatusBadRequest, message: "Invalid callback URL: " + err.Error()}
+		}
+		callbackURL = req.CallbackURL
+	}
+
+	timeout := time.Duration(merchant.DefaultTimeout) * time.Minute
+	if timeout == 0 {
+		timeout = time.Duration(s.config.PaymentTimeout) * time.Minute
+	}
+	if req.ExpiresInSeconds != 0 {
+		expiresIn, msg := s.expiryWithinBounds(merchant, req.ExpiresInSeconds)
+		if msg != "" {
+			return nil, &requestError{status: http.StatusBadRequest, message: msg}
+		}
+		timeout = expiresIn
+	}
+
+	// Load asset params and convert amounts given in whole units
+	if reqErr := s.describeOptions(payment.PaymentOptions); reqErr != nil {
+		return nil, reqErr
+	}
+
+	// Make sure the merchant can receive every option
+	if reqErr := s.checkReceivingAccount(merchant.ReceivingAddress, payment.PaymentOptions); reqErr != nil {
+		return nil, reqErr
+	}
+
+	// Convert fiat-denominated requests at the current rate
+	if req.FiatAmount != "" || req.FiatCurrency != "" {
+		if reqErr := s.priceFiatPayment(ctx, req, payment); reqErr != nil {
+			return nil, reqErr
+		}
+	}
+
+	// Validate amounts
+	for i := range payment.PaymentOptions {
+		option := &payment.PaymentOptions[i]
+		if option.Amount == 0 {
+			return nil, &requestError{status: http.StatusBadRequest, message: "Amount must be greater than 0"}
+		}
+		option.DisplayAmount = models.FormatAmount(option.Amount, option.Decimals)
+	}
+
+	// Enforce the merchant's per-asset amount limits
+	if reqErr := s.checkAssetLimits(merchant, payment.PaymentOptions); reqErr != nil {
+		return nil, reqErr
+	}
 
-	c.JSON(http.StatusCreated, response)
+	// Check split rules against the final amounts
+	if req.Splits != nil {
+		if reqErr := s.checkSplits(merchant, req.Splits, payment.PaymentOptions); reqErr != nil {
+			return nil, reqErr
+		}
+		payment.Splits = req.Splits
+	}
+
+	// The first option is the payment's primary asset
+	primary := payment.PaymentOptions[0]
+	payment.AssetID = primary.AssetID
+	payment.Amount = primary.Amount
+	payment.DisplayAmount = primary.DisplayAmount
+	payment.UnitName = primary.UnitName
+	payment.ExchangeRate = primary.ExchangeRate
+
+	payment.CallbackURL = callbackURL
+	payment.ExpiresAt = now.Add(timeout)
+
+	// Save to database, checking the daily volume and link payment caps as
+	// the payment is added
+	caps := dailyVolumeCaps(merchant, payment.PaymentOptions)
+	caps.LinkMaxPayments = req.LinkMaxPayments
+	err := s.store(ctx).CreatePayment(payment, caps)
+	var capErr *db.DailyVolumeError
+	if errors.As(err, &capErr) {
+		return nil, dailyVolumeExceeded(capErr, payment.PaymentOptions)
+	}
+	if errors.Is(err, db.ErrPaymentLinkExhausted) {
+		return nil, &requestError{status: http.StatusGone, message: "Payment link has reached its payment limit", code: codeLinkExhausted}
+	}
+	if err != nil {
+		log.Printf("Error creating payment: %v", err)
+		return nil, &requestError{status: http.StatusInternalServerError, message: "Failed to create payment"}
+	}
+	return payment, nil
 }
 
 // checkPayment handles payment status checking
@@ -159,7 +397,7 @@ func (s *Server) checkPayment(c *gin.Context) {
 		return
 	}
 
-	payment, err := s.database.GetPayment(paymentID)
+	payment, err := s.database.GetPayment(currentMerchantID(c), paymentID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
@@ -184,7 +422,7 @@ func (s *Server) getPayment(c *gin.Context) {
 		return
 	}
 
-	payment, err := s.database.GetPayment(paymentID)
+	payment, err := s.database.GetPayment(currentMerchantID(c), paymentID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
@@ -193,55 +431,197 @@ func (s *Server) getPayment(c *gin.Context) {
 	c.JSON(http.StatusOK, payment)
 }
 
+// cancelPayment handles cancelling a pending payment
+func (s *Server) cancelPayment(c *gin.Context) {
+	payment, err := s.store(c.Request.Context()).CancelPayment(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if errors.Is(err, db.ErrPaymentNotPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment is " + string(payment.Status) + " and cannot be cancelled"})
+		return
+	}
+	if errors.Is(err, db.ErrPaymentVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was updated concurrently, retry the request"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel payment"})
+		return
+	}
+
+	s.notify(payment, models.EventPaymentCancelled)
+
+	c.JSON(http.StatusOK, payment)
+}
+
 // processWebhooks processes webhook notifications
 func (s *Server) processWebhooks() {
+	ctx := systemContext("payment_monitor")
 	for payment := range s.paymentChan {
-		// Update payment status in database
-		if err := s.database.UpdatePaymentStatus(payment.ID, payment.Status, payment.TxnID); err != nil {
+		// Record the matched transaction in the database
+		err := s.store(ctx).RecordPaymentMatch(payment)
+		if errors.Is(err, db.ErrPaymentStatusChanged) {
+			payment, err = s.rematchPayment(ctx, payment)
+		}
+		if err != nil {
 			log.Printf("Error updating payment status: %v", err)
 			continue
 		}
 
-		// Send webhook if callback URL is provided
-		if payment.CallbackURL != "" {
-			go s.sendWebhook(payment)
+		if payment.Status == models.PaymentStatusLatePayment {
+			s.handleLatePayment(ctx, payment)
+			continue
 		}
+
+		s.paymentCompleted(ctx, payment)
 	}
 }
 
-// sendWebhook sends a webhook notification
-func (s *Server) sendWebhook(payment *models.Payment) {
-	webhook := models.WebhookPayload{
+// rematchPayment records a match against the payment's current state after
+// another writer changed it since the monitor read it. A payment expired or
+// cancelled in the meantime records the transfer as a late payment; one that
+// has already settled keeps its state and the match is dropped.
+func (s *Server) rematchPayment(ctx context.Context, match *models.Payment) (*models.Payment, error) {
+	payment, err := s.database.GetPayment(match.MerchantID, match.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := match.Status
+	if !payment.Status.CanTransitionTo(status) {
+		status = models.PaymentStatusLatePayment
+	}
+	if err := models.CheckTransition(payment.Status, status); err != nil {
+		return nil, fmt.Errorf("dropping match %s for payment %s: %w", match.TxnID, payment.ID, err)
+	}
+
+	payment.Status = status
+	payment.TxnID = match.TxnID
+	payment.SettledAssetID = match.SettledAssetID
+	payment.PayerAddress = match.PayerAddress
+	payment.ReceivedAmount = match.ReceivedAmount
+	payment.Late = status == models.PaymentStatusLatePayment
+	if err := s.store(ctx).RecordPaymentMatch(payment); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// paymentCompleted notifies the merchant of a completed payment and settles
+// whatever it pays for: a subscription invoice or split payouts. Payouts are
+// recorded first so the completion event reports them.
+func (s *Server) paymentCompleted(ctx context.Context, payment *models.Payment) {
+	s.recordEntries(paymentReceivedEntry(payment))
+	payouts := s.createSplitPayouts(payment)
+	s.notify(payment, models.EventPaymentCompleted)
+	if payment.SubscriptionID != "" {
+		s.settleSubscriptionInvoice(ctx, payment)
+	}
+	if len(payouts) > 0 {
+		s.sendSplitPayouts(payment, payouts)
+	}
+}
+
+// notify publishes a payment event to stream subscribers and sends it to the
+// payment's callback URL when one is set
+func (s *Server) notify(payment *models.Payment, event string) {
+	payload := webhookPayload(payment, event)
+	payload.Splits = s.splitReport(payment)
+	s.events.publish(payload)
+
+	if payment.CallbackURL != "" {
+		go s.sendWebhook(payment, payload)
+	}
+}
+
+// webhookPayload builds the event payload describing a payment
+func webhookPayload(payment *models.Payment, event string) models.WebhookPayload {
+	return models.WebhookPayload{
+		Event:           event,
 		PaymentID:       payment.ID,
 		Status:          payment.Status,
 		MerchantAddress: payment.MerchantAddress,
+		SubscriptionID:  payment.SubscriptionID,
+		PaymentLinkID:   payment.PaymentLinkID,
+		InvoiceID:       payment.InvoiceID,
 		Amount:          payment.Amount,
 		AssetID:         payment.AssetID,
+		DisplayAmount:   payment.DisplayAmount,
+		UnitName:        payment.UnitName,
+		PaymentOptions:  payment.Options(),
 		TxnID:           payment.TxnID,
+		SettledAssetID:  payment.SettledAssetID,
+		Late:            payment.Late,
+		RefundTxnID:     payment.RefundTxnID,
+		FiatAmount:      payment.FiatAmount,
+		FiatCurrency:    payment.FiatCurrency,
+		ExchangeRate:    payment.ExchangeRate,
+		OrderReference:  payment.OrderReference,
+		Metadata:        payment.Metadata,
+		ExpiresAt:       payment.ExpiresAt,
 		Timestamp:       time.Now(),
 	}
+}
+
+// sendWebhook sends a payment event to the payment's callback URL
+func (s *Server) sendWebhook(payment *models.Payment, webhook models.WebhookPayload) {
+	s.postWebhook(payment.MerchantID, payment.CallbackURL, "payment "+payment.ID, webhook)
+}
 
-	jsonData, err := json.Marshal(webhook)
+// postWebhook sends a webhook notification, signed with the merchant's webhook
+// secret when one is configured. An empty url sends to the merchant's webhook
+// URL; subject names what the event is about in logs.
+func (s *Server) postWebhook(merchantID, url, subject string, payload interface{}) {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		log.Printf("Error marshaling webhook data: %v", err)
 		return
 	}
 
+	// Sign with the merchant's webhook secret when one is configured
+	var secret string
+	merchant, err := s.database.GetMerchant(merchantID)
+	if err == nil {
+		secret = merchant.WebhookSecret
+		if url == "" {
+			url = merchant.WebhookURL
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error loading merchant for webhook for %s: %v", subject, err)
+		return
+	}
+	if url == "" {
+		return
+	}
+
 	// Send HTTP POST request
-	resp, err := http.Post(payment.CallbackURL, "application/json", bytes.NewBuffer(jsonData))
+	statusCode, err := s.webhooks.Post(url, jsonData, secret)
 	if err != nil {
-		log.Printf("Error sending webhook to %s: %v", payment.CallbackURL, err)
+		log.Printf("Error sending webhook to %s: %v", url, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Printf("Webhook sent successfully for payment %s", payment.ID)
+	if statusCode >= 200 && statusCode < 300 {
+		log.Printf("Webhook sent successfully for %s", subject)
 	} else {
-		log.Printf("Webhook failed for payment %s, status: %d", payment.ID, resp.StatusCode)
+		log.Printf("Webhook failed for %s, status: %d", subject, statusCode)
 	}
 }
 
+// newWebhookClient builds the outbound webhook client from configuration
+func newWebhookClient(cfg *config.Config) *webhook.Client {
+	return webhook.NewClient(webhook.Policy{
+		AllowedSchemes:   cfg.WebhookAllowedSchemes,
+		AllowPrivateIPs:  cfg.WebhookAllowPrivateIPs,
+		Timeout:          time.Duration(cfg.WebhookTimeout) * time.Second,
+		MaxResponseBytes: cfg.WebhookMaxResponseBytes,
+		MaxRedirects:     cfg.WebhookMaxRedirects,
+	})
+}
+
 // cleanupExpiredPayments runs a cleanup routine for expired payments
 func (s *Server) cleanupExpiredPayments() {
 	ticker := time.NewTicker(5 * time.Minute) // Run every 5 minutes
@@ -250,9 +630,12 @@ func (s *Server) cleanupExpiredPayments() {
 	for {
 		select {
 		case <-ticker.C:
-			if err := s.database.ExpireOldPayments(); err != nil {
+			if err := s.store(systemContext("payment_expiry")).ExpireOldPayments(); err != nil {
 				log.Printf("Error expiring old payments: %v", err)
 			}
+			if err := s.database.DeleteExpiredIdempotencyKeys(); err != nil {
+				log.Printf("Error deleting expired idempotency keys: %v", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestCancelPayment checks only a merchant's pending payments can be cancelled
+func TestCancelPayment(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	created := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d, body %s", w.Code, w.Body)
+	}
+	var cancelled models.Payment
+	decodeBody(t, w, &cancelled)
+	if cancelled.Status != models.PaymentStatusCancelled {
+		t.Fatalf("status = %s, want cancelled", cancelled.Status)
+	}
+
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil); w.Code != http.StatusConflict {
+		t.Errorf("cancelling twice: status = %d, want 409", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/missing/cancel", key, nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown payment: status = %d, want 404", w.Code)
+	}
+
+	// Merchants cannot cancel each other's payments
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	created = createTestPayment(t, router, key, gin.H{"amount": 1000000})
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's payment: status = %d, want 404", w.Code)
+	}
+	payment, err := s.database.GetPayment(merchant.ID, created.PaymentID)
+	if err != nil || payment.Status != models.PaymentStatusPending {
+		t.Errorf("payment after another merchant's cancel = %+v, %v", payment, err)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestIdempotentPaymentCreation checks retried payment creations replay the
+// first response
+func TestIdempotentPaymentCreation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	req := gin.H{"amount": 1000000, "order_reference": "order-1"}
+
+	first := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, req, "Idempotency-Key", "retry-1")
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: status = %d, headers %v", first.Code, first.Header())
+	}
+	retry := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, req, "Idempotency-Key", "retry-1")
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry: status = %d, replayed %q, body %s", retry.Code, retry.Header().Get("Idempotent-Replayed"), retry.Body)
+	}
+
+	list, err := s.database.ListPayments(models.PaymentFilter{MerchantID: merchant.ID, Limit: 10})
+	if err != nil || len(list.Payments) != 1 {
+		t.Fatalf("ListPayments = %+v, %v, want one payment", list, err)
+	}
+
+	req["amount"] = 2000000
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, req, "Idempotency-Key", "retry-1"); w.Code != http.StatusConflict {
+		t.Fatalf("reuse with another body: status = %d, want 409", w.Code)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, req, "Idempotency-Key", strings.Repeat("k", 256)); w.Code != http.StatusBadRequest {
+		t.Fatalf("long key: status = %d, want 400", w.Code)
+	}
+
+	// Keys are scoped to the merchant
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", other, req, "Idempotency-Key", "retry-1")
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("another merchant's key: status = %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+// TestIdempotencyReleasesFailedRequests checks keys of requests that fail
+// with a server error or panic can be retried
+func TestIdempotencyReleasesFailedRequests(t *testing.T) {
+	s := newTestServer(t)
+	merchant := newTestMerchant(t, s)
+
+	var calls int
+	outcomes := []func(c *gin.Context){
+		func(c *gin.Context) { panic("handler bug") },
+		func(c *gin.Context) { c.JSON(http.StatusInternalServerError, gin.H{"error": "try again"}) },
+		func(c *gin.Context) { c.JSON(http.StatusCreated, gin.H{"call": calls}) },
+	}
+	router := gin.New()
+	router.Use(gin.RecoveryWithWriter(io.Discard), func(c *gin.Context) {
+		c.Set(contextAPIKey, &models.APIKey{MerchantID: merchant.ID})
+		c.Next()
+	})
+	router.POST("/work", s.idempotent(), func(c *gin.Context) {
+		calls++
+		outcomes[calls-1](c)
+	})
+
+	for i, want := range []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusCreated, http.StatusCreated} {
+		w := doRequest(t, router, http.MethodPost, "/work", "", gin.H{}, "Idempotency-Key", "work-1")
+		if w.Code != want {
+			t.Fatalf("attempt %d: status = %d, want %d, body %s", i+1, w.Code, want, w.Body)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("handler ran %d times, want 3 with the last attempt replayed", calls)
+	}
+}
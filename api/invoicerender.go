@@ -0,0 +1,367 @@
+package api
+
+import (
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"algopay/models"
+	"algopay/pdf"
+)
+
+// defaultBrandColor is used when the merchant has no branding color
+const defaultBrandColor = "#1a73e8"
+
+// invoicePage renders an invoice for printing or sending to the customer
+const invoicePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+header { display: flex; justify-content: space-between; border-top: 6px solid {{.Color}}; padding-top: 1rem; }
+header img { max-height: 3rem; display: block; margin-bottom: .5rem; }
+h1 { margin: 0; font-size: 1.75rem; }
+table { width: 100%; border-collapse: collapse; margin: 1.5rem 0; }
+th, td { padding: .4rem; text-align: left; }
+thead th { border-bottom: 2px solid #222; }
+tbody td { border-bottom: 1px solid #ddd; }
+.num { text-align: right; white-space: nowrap; }
+.totals td { border: 0; }
+.total td { font-weight: 700; border-top: 2px solid #222; }
+.address { font-family: monospace; word-break: break-all; background: #f4f4f4; padding: .5rem; }
+.status { text-transform: uppercase; font-weight: 700; }
+.notes { white-space: pre-wrap; }
+footer { margin-top: 2rem; font-size: .85rem; color: #666; }
+</style>
+</head>
+<body>
+<header>
+<div>
+{{if .Branding.LogoURL}}<img src="{{.Branding.LogoURL}}" alt="">{{end}}
+<strong>{{.MerchantName}}</strong>
+</div>
+<div class="num">
+<h1>Invoice</h1>
+{{.Number}}<br>
+Issued {{.IssuedAt}}<br>
+<span class="status">{{.Status}}</span>
+</div>
+</header>
+{{if or .CustomerName .CustomerEmail .CustomerAddress}}<p><strong>Bill to</strong>{{if .CustomerName}}<br>{{.CustomerName}}{{end}}{{if .CustomerEmail}}<br>{{.CustomerEmail}}{{end}}{{range .CustomerAddress}}<br>{{.}}{{end}}</p>{{end}}
+<table>
+<thead><tr><th>Description</th><th class="num">Quantity</th><th class="num">Unit price</th><th class="num">Amount</th></tr></thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.UnitPrice}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</tbody>
+<tbody class="totals">
+{{range .Totals}}<tr{{if .Total}} class="total"{{end}}><td colspan="3" class="num">{{.Label}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if .Payable}}<p>Pay {{.Total}} to:</p>
+<p class="address">{{.Address}}</p>
+{{if .QRCode}}<p><img src="{{.QRCode}}" alt="Payment QR code" width="200" height="200"></p>{{end}}
+<p>Payment ID: {{.PaymentID}}<br>Due by {{.DueAt}}</p>
+{{else if .TxnID}}<p>Paid in transaction {{.TxnID}}</p>{{end}}
+{{if .Notes}}<p class="notes">{{.Notes}}</p>{{end}}
+{{if .Branding.SupportEmail}}<footer>Questions? <a href="mailto:{{.Branding.SupportEmail}}">{{.Branding.SupportEmail}}</a></footer>{{end}}
+</body>
+</html>
+`
+
+// invoiceView is an invoice with its amounts formatted for rendering
+type invoiceView struct {
+	MerchantName    string
+	Branding        models.Branding
+	Color           string
+	Number          string
+	IssuedAt        string
+	Status          string
+	CustomerName    string
+	CustomerEmail   string
+	CustomerAddress []string
+	Lines           []invoiceViewLine
+	Totals          []invoiceViewTotal
+	Total           string
+	Payable         bool
+	Address         string
+	PaymentID       string
+	DueAt           string
+	TxnID           string
+	QRCode          template.URL
+	Notes           string
+}
+
+// invoiceViewLine is a formatted line item
+type invoiceViewLine struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	Amount      string
+}
+
+// invoiceViewTotal is a formatted row of the totals block
+type invoiceViewTotal struct {
+	Label  string
+	Amount string
+	Total  bool
+}
+
+// newInvoiceView formats an invoice and its payment for rendering, with the
+// payment QR code when withQRCode is set and the invoice is still payable
+func (s *Server) newInvoiceView(invoice *models.Invoice, payment *models.Payment, withQRCode bool) *invoiceView {
+	amount := func(units uint64) string {
+		return formatInvoiceAmount(units, invoice.Decimals) + " " + invoice.UnitName
+	}
+
+	view := &invoiceView{
+		Color:         defaultBrandColor,
+		Number:        invoice.Number,
+		IssuedAt:      invoice.CreatedAt.UTC().Format("2006-01-02"),
+		Status:        invoiceStatusLabel(payment.Status),
+		CustomerName:  invoice.CustomerName,
+		CustomerEmail: invoice.CustomerEmail,
+		Total:         amount(invoice.Total),
+		Payable:       payment.Status == models.PaymentStatusPending,
+		Address:       payment.MerchantAddress,
+		PaymentID:     payment.ID,
+		DueAt:         payment.ExpiresAt.UTC().Format(time.RFC1123),
+		TxnID:         payment.TxnID,
+		Notes:         invoice.Notes,
+	}
+	if invoice.CustomerAddress != "" {
+		view.CustomerAddress = strings.Split(invoice.CustomerAddress, "\n")
+	}
+
+	merchant, err := s.database.GetMerchant(invoice.MerchantID)
+	if err != nil {
+		log.Printf("Error loading merchant for invoice %s: %v", invoice.ID, err)
+	} else {
+		view.MerchantName = merchant.DisplayName
+		view.Branding = merchant.Branding
+		if merchant.Branding.PrimaryColor != "" {
+			view.Color = merchant.Branding.PrimaryColor
+		}
+	}
+
+	for _, item := range invoice.LineItems {
+		view.Lines = append(view.Lines, invoiceViewLine{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   amount(item.UnitPrice),
+			Amount:      amount(item.Amount),
+		})
+	}
+
+	view.Totals = append(view.Totals, invoiceViewTotal{Label: "Subtotal", Amount: amount(invoice.Subtotal)})
+	for _, discount := range invoice.Discounts {
+		view.Totals = append(view.Totals, invoiceViewTotal{Label: adjustmentLabel(discount), Amount: "-" + amount(discount.Amount)})
+	}
+	for _, tax := range invoice.TaxLines {
+		view.Totals = append(view.Totals, invoiceViewTotal{Label: adjustmentLabel(tax), Amount: amount(tax.Amount)})
+	}
+	view.Totals = append(view.Totals, invoiceViewTotal{Label: "Total", Amount: view.Total, Total: true})
+
+	if withQRCode && view.Payable {
+		if response := paymentResponse(payment); response.QRCode != "" {
+			// The QR code is a PNG generated by the gateway, not user input
+			view.QRCode = template.URL("data:image/png;base64," + response.QRCode)
+		}
+	}
+	return view
+}
+
+// renderInvoicePDF lays out an invoice view as an A4 PDF, continuing the
+// line items onto further pages as needed
+func renderInvoicePDF(view *invoiceView) []byte {
+	const (
+		left       = 50.0
+		right      = pdf.PageWidth - 50
+		quantityX  = 330.0
+		unitPriceX = 440.0
+		bottom     = 70.0
+	)
+	brand := parseHexColor(view.Color)
+	grey := pdf.Color{R: 0.4, G: 0.4, B: 0.4}
+
+	doc := pdf.New("Invoice " + view.Number)
+	page := doc.AddPage()
+	page.FillRect(0, pdf.PageHeight-8, pdf.PageWidth, 8, brand)
+	page.Text(left, 780, 16, true, pdf.Black, view.MerchantName)
+	page.TextRight(right, 780, 20, true, pdf.Black, "INVOICE")
+	page.TextRight(right, 762, 10, false, pdf.Black, view.Number)
+	page.TextRight(right, 748, 10, false, pdf.Black, "Issued "+view.IssuedAt)
+	page.TextRight(right, 734, 10, true, brand, strings.ToUpper(view.Status))
+
+	y := 734.0
+	if view.CustomerName != "" || view.CustomerEmail != "" || len(view.CustomerAddress) > 0 {
+		y = 700
+		page.Text(left, y, 10, true, pdf.Black, "Bill to")
+		for _, line := range append([]string{view.CustomerName, view.CustomerEmail}, view.CustomerAddress...) {
+			if line == "" {
+				continue
+			}
+			y -= 13
+			page.Text(left, y, 10, false, pdf.Black, line)
+		}
+	}
+
+	header := func(y float64) {
+		page.Text(left, y, 9, true, pdf.Black, "Description")
+		page.TextRight(quantityX, y, 9, true, pdf.Black, "Quantity")
+		page.TextRight(unitPriceX, y, 9, true, pdf.Black, "Unit price")
+		page.TextRight(right, y, 9, true, pdf.Black, "Amount")
+		page.Line(left, y-5, right, y-5, 1, pdf.Black)
+	}
+	// newPage continues on a fresh page when fewer than height points remain
+	newPage := func(height float64) {
+		if y-height >= bottom {
+			return
+		}
+		page = doc.AddPage()
+		page.TextRight(right, 800, 9, false, grey, view.Number+" (continued)")
+		y = 780
+		header(y)
+		y -= 8
+	}
+
+	y -= 36
+	header(y)
+	y -= 8
+	for _, line := range view.Lines {
+		description := wrapText(line.Description, quantityX-left-70, 9, false)
+		newPage(float64(len(description))*12 + 8)
+		y -= 14
+		page.TextRight(quantityX, y, 9, false, pdf.Black, line.Quantity)
+		page.TextRight(unitPriceX, y, 9, false, pdf.Black, line.UnitPrice)
+		page.TextRight(right, y, 9, false, pdf.Black, line.Amount)
+		for i, text := range description {
+			if i > 0 {
+				y -= 12
+			}
+			page.Text(left, y, 9, false, pdf.Black, text)
+		}
+		y -= 6
+		page.Line(left, y, right, y, 0.5, pdf.Color{R: 0.85, G: 0.85, B: 0.85})
+	}
+
+	newPage(float64(len(view.Totals))*16 + 8)
+	y -= 8
+	for _, total := range view.Totals {
+		y -= 16
+		if total.Total {
+			page.Line(unitPriceX-100, y+12, right, y+12, 1, pdf.Black)
+		}
+		page.TextRight(unitPriceX, y, 10, total.Total, pdf.Black, total.Label)
+		page.TextRight(right, y, 10, total.Total, pdf.Black, total.Amount)
+	}
+
+	if view.Payable {
+		newPage(80)
+		y -= 36
+		page.Text(left, y, 10, true, pdf.Black, "Pay "+view.Total+" to:")
+		y -= 15
+		page.Text(left, y, 9, false, pdf.Black, view.Address)
+		y -= 15
+		page.Text(left, y, 9, false, pdf.Black, "Payment ID: "+view.PaymentID)
+		y -= 13
+		page.Text(left, y, 9, false, pdf.Black, "Due by "+view.DueAt)
+	} else if view.TxnID != "" {
+		newPage(40)
+		y -= 36
+		page.Text(left, y, 9, false, pdf.Black, "Paid in transaction "+view.TxnID)
+	}
+
+	if view.Notes != "" {
+		y -= 12
+		for _, paragraph := range strings.Split(view.Notes, "\n") {
+			for _, text := range wrapText(paragraph, right-left, 9, false) {
+				newPage(12)
+				y -= 12
+				page.Text(left, y, 9, false, grey, text)
+			}
+		}
+	}
+
+	if view.Branding.SupportEmail != "" {
+		page.Text(left, 40, 8, false, grey, "Questions? "+view.Branding.SupportEmail)
+	}
+	return doc.Bytes()
+}
+
+// formatInvoiceAmount renders base units in whole units, keeping at least two
+// decimal places for assets that have them so amounts line up
+func formatInvoiceAmount(amount, decimals uint64) string {
+	formatted := models.FormatAmount(amount, decimals)
+	if decimals < 2 {
+		return formatted
+	}
+	whole, fraction, _ := strings.Cut(formatted, ".")
+	if len(fraction) < 2 {
+		fraction += strings.Repeat("0", 2-len(fraction))
+	}
+	return whole + "." + fraction
+}
+
+// adjustmentLabel describes a discount or tax line, with its rate if it has one
+func adjustmentLabel(adj models.InvoiceAdjustment) string {
+	if adj.Rate == "" {
+		return adj.Description
+	}
+	return adj.Description + " (" + adj.Rate + "%)"
+}
+
+// invoiceStatusLabel describes an invoice by the status of its payment
+func invoiceStatusLabel(status models.PaymentStatus) string {
+	switch status {
+	case models.PaymentStatusPending:
+		return "due"
+	case models.PaymentStatusCompleted:
+		return "paid"
+	default:
+		return strings.ReplaceAll(string(status), "_", " ")
+	}
+}
+
+// wrapText breaks text into lines no wider than width points
+func wrapText(text string, width, size float64, bold bool) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && pdf.TextWidth(candidate, size, bold) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseHexColor converts a #rgb or #rrggbb color to a PDF color, falling back
+// to the default brand color
+func parseHexColor(hex string) pdf.Color {
+	digits := strings.TrimPrefix(hex, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) != 6 {
+		value, _ = strconv.ParseUint(defaultBrandColor[1:], 16, 32)
+	}
+	return pdf.Color{
+		R: float64(value>>16&0xff) / 255,
+		G: float64(value>>8&0xff) / 255,
+		B: float64(value&0xff) / 255,
+	}
+}
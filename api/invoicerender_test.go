@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+	"algopay/pdf"
+)
+
+// pageCount matches the page count in a document's page tree
+var pageCount = regexp.MustCompile(`/Type /Pages /Kids \[[^]]*\] /Count (\d+)`)
+
+// TestRenderInvoicePDF renders an invoice from a merchant with a non-ASCII
+// name across several pages
+func TestRenderInvoicePDF(t *testing.T) {
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "algopay.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer database.Close()
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	created := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	merchant := &models.Merchant{
+		ID:                "m1",
+		DisplayName:       `Café Zürich (Intl) \ Co`,
+		ReceivingAddress:  "ADDR",
+		AcceptedAssets:    []uint64{0},
+		LatePaymentAction: "manual",
+		Branding:          models.Branding{PrimaryColor: "#c0392b", SupportEmail: "help@example.com"},
+		CreatedAt:         created,
+		UpdatedAt:         created,
+	}
+	if err := database.CreateMerchant(merchant); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+
+	invoice := &models.Invoice{
+		ID:              "inv-1",
+		MerchantID:      "m1",
+		Number:          "INV-0001",
+		UnitName:        "USDC",
+		Decimals:        6,
+		CustomerName:    "Jürgen Groß",
+		CustomerAddress: "Königstraße 1\n70173 Stuttgart",
+		Discounts:       []models.InvoiceAdjustment{{Description: "Loyalty (returning)", Rate: "10", Amount: 1000000}},
+		Subtotal:        150000000,
+		Total:           149000000,
+		Notes:           "Thank you (really)!",
+		CreatedAt:       created,
+	}
+	for i := 1; i <= 60; i++ {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{
+			Description: fmt.Sprintf("Widget (size %d)", i),
+			Quantity:    "1",
+			UnitPrice:   2500000,
+			Amount:      2500000,
+		})
+	}
+	payment := &models.Payment{
+		ID:              "pay-1",
+		MerchantAddress: "ADDR",
+		Status:          models.PaymentStatusPending,
+		ExpiresAt:       created.Add(24 * time.Hour),
+	}
+
+	server := &Server{database: database}
+	data := renderInvoicePDF(server.newInvoiceView(invoice, payment, false))
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("output is not a complete PDF document")
+	}
+	start := bytes.LastIndex(data, []byte("startxref\n"))
+	xref, err := strconv.Atoi(string(bytes.TrimSuffix(data[start+len("startxref\n"):], []byte("\n%%EOF\n"))))
+	if err != nil || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref does not point at the xref table: %v", err)
+	}
+
+	for _, want := range []string{
+		"/Title (Invoice INV-0001)",
+		"(Caf\xe9 Z\xfcrich \\(Intl\\) \\\\ Co) Tj",
+		"(J\xfcrgen Gro\xdf) Tj",
+		"(K\xf6nigstra\xdfe 1) Tj",
+		`(Widget \(size 60\)) Tj`,
+		`(INV-0001 \(continued\)) Tj`,
+		`(Loyalty \(returning\) \(10%\)) Tj`,
+		"(-1.00 USDC) Tj",
+		"(149.00 USDC) Tj",
+		"(Pay 149.00 USDC to:) Tj",
+		`(Thank you \(really\)!) Tj`,
+		"(Questions? help@example.com) Tj",
+		"0.753 0.224 0.169 rg",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("invoice PDF does not contain %q", want)
+		}
+	}
+	if count := pageCount.FindSubmatch(data); count == nil || string(count[1]) == "1" {
+		t.Error("60 line items do not continue onto another page")
+	}
+}
+
+// TestFormatInvoiceAmount checks amounts keep two decimal places when the
+// asset has them
+func TestFormatInvoiceAmount(t *testing.T) {
+	tests := []struct {
+		amount, decimals uint64
+		want             string
+	}{
+		{1500000, 6, "1.50"},
+		{1234567, 6, "1.234567"},
+		{100, 6, "0.0001"},
+		{0, 6, "0.00"},
+		{42, 0, "42"},
+		{42, 1, "4.2"},
+		{2500, 2, "25.00"},
+	}
+	for _, test := range tests {
+		if got := formatInvoiceAmount(test.amount, test.decimals); got != test.want {
+			t.Errorf("formatInvoiceAmount(%d, %d) = %q, want %q", test.amount, test.decimals, got, test.want)
+		}
+	}
+}
+
+// TestParseHexColor checks branding colors and the fallback
+func TestParseHexColor(t *testing.T) {
+	brand := pdf.Color{R: 0x1a / 255.0, G: 0x73 / 255.0, B: 0xe8 / 255.0}
+	tests := map[string]pdf.Color{
+		"#ffffff":   {R: 1, G: 1, B: 1},
+		"#000":      {},
+		"#f00":      {R: 1},
+		"00ff00":    {G: 1},
+		"":          brand,
+		"#12345":    brand,
+		"#gggggg":   brand,
+		"#1234567":  brand,
+		"#ffffffff": brand,
+	}
+	for hex, want := range tests {
+		if got := parseHexColor(hex); got != want {
+			t.Errorf("parseHexColor(%q) = %v, want %v", hex, got, want)
+		}
+	}
+}
+
+// TestWrapText checks text wraps at word boundaries within the width
+func TestWrapText(t *testing.T) {
+	text := "Consulting services (March) for the Zürich office"
+	lines := wrapText(text, 100, 9, false)
+	if len(lines) < 2 {
+		t.Fatalf("wrapText returned %q, want several lines", lines)
+	}
+	for _, line := range lines {
+		if width := pdf.TextWidth(line, 9, false); width > 100 {
+			t.Errorf("line %q is %v points wide", line, width)
+		}
+	}
+	if got := wrapText("", 100, 9, false); len(got) != 1 || got[0] != "" {
+		t.Errorf("wrapText of empty text = %q", got)
+	}
+	if got := wrapText("Supercalifragilisticexpialidocious", 20, 9, false); len(got) != 1 {
+		t.Errorf("a single long word wrapped to %q", got)
+	}
+}
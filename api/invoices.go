@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Invoice customer field limits
+const (
+	maxCustomerNameLength    = 200
+	maxCustomerAddressLength = 500
+	maxInvoiceNotesLength    = 2000
+)
+
+// createInvoice handles invoice creation. The invoice's computed total is
+// charged through the regular payment path; the invoice takes its number only
+// once the payment exists, so failed requests never use one up.
+func (s *Server) createInvoice(c *gin.Context) {
+	var req models.InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateInvoiceCustomer(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", currentMerchantID(c), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
+	}
+
+	invoice := &models.Invoice{
+		ID:              uuid.New().String(),
+		MerchantID:      merchant.ID,
+		AssetID:         req.AssetID,
+		CustomerName:    req.CustomerName,
+		CustomerEmail:   req.CustomerEmail,
+		CustomerAddress: req.CustomerAddress,
+		Notes:           req.Notes,
+		LineItems:       req.LineItems,
+		Discounts:       req.Discounts,
+		TaxLines:        req.TaxLines,
+		Metadata:        req.Metadata,
+		CreatedAt:       time.Now(),
+	}
+	if invoice.Discounts == nil {
+		invoice.Discounts = []models.InvoiceAdjustment{}
+	}
+	if invoice.TaxLines == nil {
+		invoice.TaxLines = []models.InvoiceAdjustment{}
+	}
+	if err := invoice.ComputeTotals(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, reqErr := s.createPayment(c.Request.Context(), merchant, &models.PaymentRequest{
+		Amount:           invoice.Total,
+		AssetID:          invoice.AssetID,
+		CallbackURL:      req.CallbackURL,
+		OrderReference:   req.OrderReference,
+		Metadata:         req.Metadata,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		InvoiceID:        invoice.ID,
+	})
+	if reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+	invoice.PaymentID = payment.ID
+	invoice.UnitName = payment.UnitName
+	invoice.Decimals = payment.PaymentOptions[0].Decimals
+	invoice.Status = payment.Status
+	invoice.ExpiresAt = payment.ExpiresAt
+
+	if err := s.database.CreateInvoice(invoice); err != nil {
+		log.Printf("Error creating invoice: %v", err)
+		if _, err := s.store(c.Request.Context()).CancelPayment(merchant.ID, payment.ID); err != nil {
+			log.Printf("Error cancelling payment %s of unsaved invoice: %v", payment.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invoice"})
+		return
+	}
+
+	response := paymentResponse(payment)
+	c.JSON(http.StatusCreated, models.InvoiceResponse{Invoice: invoice, Payment: &response})
+}
+
+// listInvoices handles listing the merchant's invoices, optionally by payment status
+func (s *Server) listInvoices(c *gin.Context) {
+	status := models.PaymentStatus(c.Query("status"))
+	invoices, err := s.database.ListInvoices(currentMerchantID(c), status)
+	if err != nil {
+		log.Printf("Error listing invoices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invoices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invoices": invoices})
+}
+
+// getInvoice handles invoice retrieval with its payment
+func (s *Server) getInvoice(c *gin.Context) {
+	invoice, payment, ok := s.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	response := paymentResponse(payment)
+	c.JSON(http.StatusOK, models.InvoiceResponse{Invoice: invoice, Payment: &response})
+}
+
+// getInvoiceHTML handles rendering an invoice as an HTML page
+func (s *Server) getInvoiceHTML(c *gin.Context) {
+	invoice, payment, ok := s.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	c.HTML(http.StatusOK, "invoice", s.newInvoiceView(invoice, payment, true))
+}
+
+// getInvoicePDF handles rendering an invoice as a PDF document
+func (s *Server) getInvoicePDF(c *gin.Context) {
+	invoice, payment, ok := s.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	document := renderInvoicePDF(s.newInvoiceView(invoice, payment, false))
+	c.Header("Content-Disposition", `inline; filename="`+invoice.Number+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", document)
+}
+
+// loadInvoice loads the merchant's invoice named in the request and its
+// payment, writing an error response if it cannot
+func (s *Server) loadInvoice(c *gin.Context) (*models.Invoice, *models.Payment, bool) {
+	invoice, err := s.database.GetInvoice(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("Error getting invoice: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invoice"})
+		return nil, nil, false
+	}
+
+	payment, err := s.database.GetPayment(invoice.MerchantID, invoice.PaymentID)
+	if err != nil {
+		log.Printf("Error getting payment %s of invoice %s: %v", invoice.PaymentID, invoice.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invoice"})
+		return nil, nil, false
+	}
+	return invoice, payment, true
+}
+
+// validateInvoiceCustomer checks the customer and notes fields of an invoice
+// request, returning an error message if one is invalid
+func validateInvoiceCustomer(req *models.InvoiceRequest) string {
+	if len(req.CustomerName) > maxCustomerNameLength {
+		return "customer_name must be at most " + strconv.Itoa(maxCustomerNameLength) + " characters"
+	}
+	if req.CustomerEmail != "" {
+		if address, err := mail.ParseAddress(req.CustomerEmail); err != nil || address.Address != req.CustomerEmail {
+			return "customer_email must be a plain email address"
+		}
+	}
+	if len(req.CustomerAddress) > maxCustomerAddressLength {
+		return "customer_address must be at most " + strconv.Itoa(maxCustomerAddressLength) + " characters"
+	}
+	if len(req.Notes) > maxInvoiceNotesLength {
+		return "notes must be at most " + strconv.Itoa(maxInvoiceNotesLength) + " characters"
+	}
+	return ""
+}
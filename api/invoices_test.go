@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestInvoices checks invoices are numbered per merchant and charged for their
+// computed total through a payment
+func TestInvoices(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/invoices", key, gin.H{
+		"customer_name":  "Ada Lovelace",
+		"customer_email": "ada@example.com",
+		"line_items": []gin.H{
+			{"description": "Consulting", "quantity": "2.5", "unit_price": 1000000},
+			{"description": "Travel", "unit_price": 500000},
+		},
+		"discounts":       []gin.H{{"description": "Loyalty", "rate": "10"}},
+		"tax_lines":       []gin.H{{"description": "VAT", "rate": "20"}},
+		"order_reference": "ORDER-7",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	var created models.InvoiceResponse
+	decodeBody(t, w, &created)
+	invoice := created.Invoice
+	// 2.5 × 1 + 0.5 = 3; less 10% = 2.7; plus 20% VAT on 2.7 = 3.24
+	if invoice.Number != "INV-000001" || invoice.Subtotal != 3000000 || invoice.DiscountTotal != 300000 ||
+		invoice.TaxTotal != 540000 || invoice.Total != 3240000 || invoice.Status != models.PaymentStatusPending {
+		t.Fatalf("invoice = %+v", invoice)
+	}
+	payment, err := s.database.GetPayment(merchant.ID, invoice.PaymentID)
+	if err != nil || created.Payment == nil || payment.Amount != invoice.Total || payment.InvoiceID != invoice.ID || payment.OrderReference != "ORDER-7" {
+		t.Fatalf("invoice payment = %+v, %v", payment, err)
+	}
+
+	support := gin.H{"line_items": []gin.H{{"description": "Support", "unit_price": 100}}}
+	var next models.Invoice
+	decodeBody(t, doRequest(t, router, http.MethodPost, "/api/v1/invoices", key, support), &next)
+	if next.Number != "INV-000002" {
+		t.Errorf("second invoice number = %q, want INV-000002", next.Number)
+	}
+	otherKey := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	decodeBody(t, doRequest(t, router, http.MethodPost, "/api/v1/invoices", otherKey, support), &next)
+	if next.Number != "INV-000001" {
+		t.Errorf("another merchant's first invoice number = %q, want INV-000001", next.Number)
+	}
+
+	// Invoices follow the status of their payment
+	deliverTransfer(t, s, merchant.ID, invoice.PaymentID, models.PaymentStatusCompleted)
+	var list struct {
+		Invoices []models.Invoice `json:"invoices"`
+	}
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/invoices?status=completed", key, nil), &list)
+	if len(list.Invoices) != 1 || list.Invoices[0].ID != invoice.ID {
+		t.Fatalf("completed invoices = %+v", list.Invoices)
+	}
+
+	w = doRequest(t, router, http.MethodGet, "/api/v1/invoices/"+invoice.ID+"/html", key, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "INV-000001") || !strings.Contains(w.Body.String(), "Ada Lovelace") {
+		t.Fatalf("HTML invoice: status = %d", w.Code)
+	}
+	w = doRequest(t, router, http.MethodGet, "/api/v1/invoices/"+invoice.ID+"/pdf", key, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("PDF invoice: status = %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/invoices/"+invoice.ID, otherKey, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's invoice: status = %d, want 404", w.Code)
+	}
+}
+
+// TestInvoiceValidation checks invalid invoices are rejected without using up
+// an invoice number
+func TestInvoiceValidation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	key := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+
+	item := []gin.H{{"description": "Widget", "unit_price": 1000000}}
+	tests := []struct {
+		name string
+		req  gin.H
+	}{
+		{"no line items", gin.H{"line_items": []gin.H{}}},
+		{"malformed quantity", gin.H{"line_items": []gin.H{{"description": "Widget", "quantity": "1,5", "unit_price": 1}}}},
+		{"discount above the subtotal", gin.H{"line_items": item, "discounts": []gin.H{{"description": "Too much", "amount": 1000001}}}},
+		{"malformed email", gin.H{"line_items": item, "customer_email": "Ada <ada@example.com>"}},
+		{"long customer name", gin.H{"line_items": item, "customer_name": strings.Repeat("a", maxCustomerNameLength+1)}},
+		{"asset not accepted", gin.H{"line_items": item, "asset_id": 31566704}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := doRequest(t, router, http.MethodPost, "/api/v1/invoices", key, test.req); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	var created models.InvoiceResponse
+	decodeBody(t, doRequest(t, router, http.MethodPost, "/api/v1/invoices", key, gin.H{"line_items": item}), &created)
+	if created.Invoice == nil || created.Number != "INV-000001" {
+		t.Fatalf("first valid invoice = %+v, want INV-000001", created.Invoice)
+	}
+}
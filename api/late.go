@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"algopay/algorand"
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleLatePayment notifies the merchant of a late payment and applies the
+// merchant's configured late payment action
+func (s *Server) handleLatePayment(ctx context.Context, payment *models.Payment) {
+	s.notify(payment, models.EventPaymentLatePayment)
+
+	merchant, err := s.database.GetMerchant(payment.MerchantID)
+	if err != nil {
+		log.Printf("Error loading merchant for late payment %s: %v", payment.ID, err)
+		return
+	}
+
+	switch merchant.LatePaymentAction {
+	case models.LatePaymentActionAccept:
+		if _, err := s.acceptPayment(ctx, payment); err != nil {
+			log.Printf("Error accepting late payment %s: %v", payment.ID, err)
+		}
+	case models.LatePaymentActionRefund:
+		if !s.algoClient.CanSign(payment.MerchantAddress) {
+			log.Printf("Late payment %s left for manual review: no signing key for %s", payment.ID, payment.MerchantAddress)
+			return
+		}
+		go func() {
+			if _, err := s.refundPayment(ctx, payment); err != nil {
+				log.Printf("Error refunding late payment %s: %v", payment.ID, err)
+			}
+		}()
+	}
+}
+
+// acceptLatePayment handles accepting a late payment as completed
+func (s *Server) acceptLatePayment(c *gin.Context) {
+	payment, ok := s.loadLatePayment(c)
+	if !ok {
+		return
+	}
+
+	payment, err := s.acceptPayment(c.Request.Context(), payment)
+	if errors.Is(err, db.ErrPaymentVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was updated concurrently, retry the request"})
+		return
+	}
+	if errors.Is(err, db.ErrPaymentStatusChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment is " + string(payment.Status) + " and cannot be accepted"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error accepting late payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// refundLatePayment handles refunding a late payment to its payer, either by
+// sending the refund from a gateway-controlled address or by recording a
+// refund the merchant made themselves
+func (s *Server) refundLatePayment(c *gin.Context) {
+	var req models.RefundRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	payment, ok := s.loadLatePayment(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	if req.TxnID != "" {
+		payment, err = s.store(c.Request.Context()).ResolveLatePayment(payment.MerchantID, payment.ID,
+			models.PaymentStatusLatePayment, models.PaymentStatusRefunded, req.TxnID)
+		if err == nil {
+			s.recordEntries(paymentReceivedEntry(payment), refundEntry(payment))
+			s.notify(payment, models.EventPaymentRefunded)
+		}
+	} else {
+		if !s.algoClient.CanSign(payment.MerchantAddress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The gateway cannot send from the merchant address; refund manually and supply txn_id"})
+			return
+		}
+		payment, err = s.refundPayment(c.Request.Context(), payment)
+	}
+	if errors.Is(err, db.ErrPaymentVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was updated concurrently, retry the request"})
+		return
+	}
+	if errors.Is(err, db.ErrPaymentStatusChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment is " + string(payment.Status) + " and cannot be refunded"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error refunding late payment: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refund payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// loadLatePayment loads the payment named in the request and writes an error
+// response unless it is awaiting a late payment decision
+func (s *Server) loadLatePayment(c *gin.Context) (*models.Payment, bool) {
+	payment, err := s.database.GetPayment(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error getting payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment"})
+		return nil, false
+	}
+	if payment.Status != models.PaymentStatusLatePayment {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment is " + string(payment.Status) + ", not a late payment"})
+		return nil, false
+	}
+	return payment, true
+}
+
+// acceptPayment marks a late payment as completed and notifies the merchant
+func (s *Server) acceptPayment(ctx context.Context, payment *models.Payment) (*models.Payment, error) {
+	accepted, err := s.store(ctx).ResolveLatePayment(payment.MerchantID, payment.ID,
+		models.PaymentStatusLatePayment, models.PaymentStatusCompleted, "")
+	if err != nil {
+		return accepted, err
+	}
+
+	s.paymentCompleted(ctx, accepted)
+	return accepted, nil
+}
+
+// refundPayment returns a late payment's received funds to the payer. Like
+// payouts, the refund is signed and recorded on the payment, holding it in the
+// refunding status, before it is sent, so an interrupted send is resolved by
+// confirmation rather than by refunding twice. Only a refund the node rejects
+// returns the payment to late_payment.
+func (s *Server) refundPayment(ctx context.Context, payment *models.Payment) (*models.Payment, error) {
+	transfers := []algorand.Transfer{{To: payment.PayerAddress, Amount: payment.ReceivedAmount, AssetID: payment.PaidAssetID()}}
+	group, err := s.algoClient.SignGroup(payment.MerchantAddress, transfers, []byte("algopay refund "+payment.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	store := s.store(ctx)
+	refunding, err := store.SubmitRefund(payment.MerchantID, payment.ID, group.TxIDs[0], group.Fees[0], group.LastValid)
+	if err != nil {
+		return refunding, err
+	}
+
+	err = s.algoClient.SendGroup(group)
+	if errors.Is(err, algorand.ErrGroupRejected) {
+		if _, revertErr := store.ResolveLatePayment(payment.MerchantID, payment.ID,
+			models.PaymentStatusRefunding, models.PaymentStatusLatePayment, ""); revertErr != nil {
+			log.Printf("Error reverting refund of payment %s: %v", payment.ID, revertErr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		// The refund may have reached the network; confirmation decides
+		log.Printf("Error sending refund of payment %s: %v", payment.ID, err)
+		return refunding, nil
+	}
+
+	log.Printf("Sent refund of late payment %s in transaction %s", payment.ID, refunding.RefundTxnID)
+	return refunding, nil
+}
+
+// confirmRefunds checks every refund awaiting confirmation
+func (s *Server) confirmRefunds() {
+	payments, err := s.database.GetRefundingPayments()
+	if err != nil {
+		log.Printf("Error loading refunding payments: %v", err)
+		return
+	}
+	for _, payment := range payments {
+		s.confirmRefund(systemContext("refunds"), payment)
+	}
+}
+
+// confirmRefund checks whether a payment's refund was confirmed, moving the
+// payment to refunded and recording the refund and its network fee in the
+// ledger when it was. A refund that expired unconfirmed returns the payment
+// to late_payment.
+func (s *Server) confirmRefund(ctx context.Context, payment *models.Payment) {
+	confirmed, expired, err := s.algoClient.CheckConfirmation(payment.RefundTxnID, payment.RefundLastValid)
+	if err != nil {
+		log.Printf("Error confirming refund of payment %s: %v", payment.ID, err)
+		return
+	}
+
+	store := s.store(ctx)
+	if expired {
+		log.Printf("Refund of payment %s expired before it was confirmed", payment.ID)
+		_, err := store.ResolveLatePayment(payment.MerchantID, payment.ID,
+			models.PaymentStatusRefunding, models.PaymentStatusLatePayment, "")
+		if err != nil && !errors.Is(err, db.ErrPaymentStatusChanged) {
+			log.Printf("Error reverting refund of payment %s: %v", payment.ID, err)
+		}
+		return
+	}
+	if !confirmed {
+		return
+	}
+
+	refunded, err := store.ResolveLatePayment(payment.MerchantID, payment.ID,
+		models.PaymentStatusRefunding, models.PaymentStatusRefunded, payment.RefundTxnID)
+	if err != nil {
+		if !errors.Is(err, db.ErrPaymentStatusChanged) {
+			log.Printf("Error saving refund of payment %s: %v", payment.ID, err)
+		}
+		return
+	}
+
+	s.recordEntries(paymentReceivedEntry(refunded), refundEntry(refunded),
+		networkFeeEntry(refunded.MerchantID, refunded.RefundTxnID, "Fee for refund of payment "+refunded.ID, refunded.RefundFee))
+	log.Printf("Refund of late payment %s confirmed in transaction %s", refunded.ID, refunded.RefundTxnID)
+	s.notify(refunded, models.EventPaymentRefunded)
+}
+
+// refundEntry records a late payment's received funds being returned to the
+// payer from the receiving address
+func refundEntry(payment *models.Payment) *models.JournalEntry {
+	received := paymentReceivedEntry(payment)
+	if received == nil {
+		return nil
+	}
+	return models.NewTransferEntry(payment.MerchantID, received.AssetID, models.EntryRefund,
+		payment.ID, "Refund of payment "+payment.ID, models.LedgerRefunds, models.LedgerReceiving, received.Lines[0].Debit)
+}
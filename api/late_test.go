@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// deliverTransfer hands the server a transfer paying a payment in full, as the
+// payment monitor does, and returns the updated payment. Transfers to closed
+// payments are delivered with the late_payment status.
+func deliverTransfer(t *testing.T, s *Server, merchantID, paymentID string, status models.PaymentStatus) *models.Payment {
+	t.Helper()
+	match, err := s.database.GetPayment(merchantID, paymentID)
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	settled := uint64(0)
+	match.Status = status
+	match.Late = status == models.PaymentStatusLatePayment
+	match.TxnID = "TXN-" + paymentID
+	match.SettledAssetID = &settled
+	match.PayerAddress = crypto.GenerateAccount().Address.String()
+	match.ReceivedAmount = match.Amount
+
+	s.paymentChan = make(chan *models.Payment, 1)
+	s.paymentChan <- match
+	close(s.paymentChan)
+	s.processWebhooks()
+
+	payment, err := s.database.GetPayment(merchantID, paymentID)
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	return payment
+}
+
+// TestLatePayments checks late payments wait for the merchant to accept or
+// refund them
+func TestLatePayments(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	latePayment := func() string {
+		created := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+		if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil); w.Code != http.StatusOK {
+			t.Fatalf("cancel: status = %d", w.Code)
+		}
+		payment := deliverTransfer(t, s, merchant.ID, created.PaymentID, models.PaymentStatusLatePayment)
+		if payment.Status != models.PaymentStatusLatePayment || !payment.Late || payment.TxnID == "" {
+			t.Fatalf("late payment = %+v", payment)
+		}
+		return created.PaymentID
+	}
+
+	// Accepting completes the payment
+	accepted := latePayment()
+	w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+accepted+"/accept", key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("accept: status = %d, body %s", w.Code, w.Body)
+	}
+	var payment models.Payment
+	decodeBody(t, w, &payment)
+	if payment.Status != models.PaymentStatusCompleted || !payment.Late {
+		t.Fatalf("accepted payment = %+v", payment)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+accepted+"/accept", key, nil); w.Code != http.StatusConflict {
+		t.Errorf("accepting twice: status = %d, want 409", w.Code)
+	}
+
+	// The gateway cannot sign for the merchant, so refunds are made by hand
+	// and recorded with their transaction
+	refunded := latePayment()
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+refunded+"/refund", key, nil); w.Code != http.StatusConflict {
+		t.Errorf("refund without a signing key: status = %d, want 409", w.Code)
+	}
+	w = doRequest(t, router, http.MethodPost, "/api/v1/payment/"+refunded+"/refund", key, gin.H{"txn_id": "REFUND-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("manual refund: status = %d, body %s", w.Code, w.Body)
+	}
+	decodeBody(t, w, &payment)
+	if payment.Status != models.PaymentStatusRefunded || payment.RefundTxnID != "REFUND-1" {
+		t.Fatalf("refunded payment = %+v", payment)
+	}
+
+	// Payments that were not paid late cannot be resolved
+	pending := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+	for _, action := range []string{"accept", "refund"} {
+		if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+pending.PaymentID+"/"+action, key, gin.H{"txn_id": "X"}); w.Code != http.StatusConflict {
+			t.Errorf("%s of a pending payment: status = %d, want 409", action, w.Code)
+		}
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/missing/accept", key, nil); w.Code != http.StatusNotFound {
+		t.Errorf("accept of an unknown payment: status = %d, want 404", w.Code)
+	}
+}
+
+// TestLatePaymentAction checks merchants accepting late payments have them
+// completed without review
+func TestLatePaymentAction(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s, func(m *models.Merchant) {
+		m.LatePaymentAction = models.LatePaymentActionAccept
+	})
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	created := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	payment := deliverTransfer(t, s, merchant.ID, created.PaymentID, models.PaymentStatusLatePayment)
+	if payment.Status != models.PaymentStatusCompleted || !payment.Late {
+		t.Fatalf("payment = %+v, want a completed late payment", payment)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordEntries posts journal entries, skipping nil ones and those already
+// posted. Ledger failures are logged rather than returned: the funds have
+// already moved on chain, and reconciliation finds what is missing.
+func (s *Server) recordEntries(entries ...*models.JournalEntry) {
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		err := s.database.PostJournalEntry(entry)
+		if err != nil && !errors.Is(err, db.ErrJournalEntryExists) {
+			log.Printf("Error posting %s journal entry for %s: %v", entry.Kind, entry.Reference, err)
+		}
+	}
+}
+
+// paymentReceivedEntry records the funds a payment brought into the
+// receiving address, including any overpayment
+func paymentReceivedEntry(payment *models.Payment) *models.JournalEntry {
+	amount := payment.ReceivedAmount
+	if amount == 0 {
+		amount = settledAmount(payment)
+	}
+	if amount == 0 {
+		return nil
+	}
+	return models.NewTransferEntry(payment.MerchantID, payment.PaidAssetID(), models.EntryPaymentReceived,
+		payment.ID, "Payment "+payment.ID, models.LedgerReceiving, models.LedgerPayments, amount)
+}
+
+// networkFeeEntry records the ALGO fee the receiving address paid for the
+// transaction or group named by reference, or returns nil when there was none
+func networkFeeEntry(merchantID, reference, description string, fee uint64) *models.JournalEntry {
+	if fee == 0 {
+		return nil
+	}
+	return models.NewTransferEntry(merchantID, 0, models.EntryNetworkFee,
+		reference, description, models.LedgerNetworkFees, models.LedgerReceiving, fee)
+}
+
+// getBalance handles retrieving the calling merchant's balance in each asset
+func (s *Server) getBalance(c *gin.Context) {
+	accounts, err := s.database.GetAccountBalances(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error getting account balances: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balances": models.BalancesFrom(accounts), "accounts": accounts})
+}
+
+// listLedgerEntries handles listing the calling merchant's journal entries
+func (s *Server) listLedgerEntries(c *gin.Context) {
+	var assetID *uint64
+	if value := c.Query("asset_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "asset_id must be a non-negative integer"})
+			return
+		}
+		assetID = &id
+	}
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after must be a non-negative integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(models.DefaultPageSize)))
+	if err != nil || limit < 1 || limit > models.MaxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxPageSize)})
+		return
+	}
+
+	list, err := s.database.ListJournalEntries(currentMerchantID(c), assetID, after, limit)
+	if err != nil {
+		log.Printf("Error listing journal entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list ledger entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
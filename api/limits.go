@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+)
+
+// Error codes returned with asset and amount validation failures
+const (
+	codeUnknownAsset        = "unknown_asset"
+	codeAssetNotAccepted    = "asset_not_accepted"
+	codeAmountBelowMinimum  = "amount_below_minimum"
+	codeAmountAboveMaximum  = "amount_above_maximum"
+	codeDailyVolumeExceeded = "daily_volume_exceeded"
+)
+
+// checkAssetLimits enforces the merchant's per-asset amount limits on every
+// payment option, returning an error when an option is outside them. Daily
+// volume caps are checked as the payment is stored; see dailyVolumeCaps.
+func (s *Server) checkAssetLimits(merchant *models.Merchant, options []models.PaymentOption) *requestError {
+	for _, option := range options {
+		limit := merchant.LimitFor(option.AssetID)
+		if limit == nil {
+			continue
+		}
+		asset := strconv.FormatUint(option.AssetID, 10)
+
+		if limit.MinAmount > 0 && option.Amount < limit.MinAmount {
+			return &requestError{
+				status:  http.StatusBadRequest,
+				message: "Amount is below the minimum of " + models.FormatAmount(limit.MinAmount, option.Decimals) + " for asset " + asset,
+				code:    codeAmountBelowMinimum,
+			}
+		}
+		if limit.MaxAmount > 0 && option.Amount > limit.MaxAmount {
+			return &requestError{
+				status:  http.StatusBadRequest,
+				message: "Amount is above the maximum of " + models.FormatAmount(limit.MaxAmount, option.Decimals) + " for asset " + asset,
+				code:    codeAmountAboveMaximum,
+			}
+		}
+	}
+	return nil
+}
+
+// dailyVolumeCaps returns the merchant's daily volume caps on the assets of
+// the payment options, counted from the start of the UTC day, for the store
+// to check in the transaction that adds the payment
+func dailyVolumeCaps(merchant *models.Merchant, options []models.PaymentOption) models.PaymentCaps {
+	now := time.Now().UTC()
+	caps := models.PaymentCaps{DayStart: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+	for _, option := range options {
+		if limit := merchant.LimitFor(option.AssetID); limit != nil && limit.DailyVolumeCap > 0 {
+			if caps.DailyVolume == nil {
+				caps.DailyVolume = make(map[uint64]uint64)
+			}
+			caps.DailyVolume[option.AssetID] = limit.DailyVolumeCap
+		}
+	}
+	return caps
+}
+
+// dailyVolumeExceeded describes a payment refused by a daily volume cap
+func dailyVolumeExceeded(capErr *db.DailyVolumeError, options []models.PaymentOption) *requestError {
+	var decimals uint64
+	for _, option := range options {
+		if option.AssetID == capErr.AssetID {
+			decimals = option.Decimals
+		}
+	}
+	return &requestError{
+		status:  http.StatusUnprocessableEntity,
+		message: "Payment would exceed the daily volume cap of " + models.FormatAmount(capErr.Cap, decimals) + " for asset " + strconv.FormatUint(capErr.AssetID, 10),
+		code:    codeDailyVolumeExceeded,
+	}
+}
+
+// validateAssetLimits returns a client-facing error message for invalid
+// merchant asset limits
+func validateAssetLimits(req *models.MerchantRequest) string {
+	seen := make(map[uint64]bool)
+	for _, limit := range req.AssetLimits {
+		asset := strconv.FormatUint(limit.AssetID, 10)
+		if seen[limit.AssetID] {
+			return "Asset " + asset + " has more than one limit"
+		}
+		seen[limit.AssetID] = true
+
+		if len(req.AcceptedAssets) > 0 && !(&models.Merchant{AcceptedAssets: req.AcceptedAssets}).AcceptsAsset(limit.AssetID) {
+			return "Asset " + asset + " has limits but is not accepted"
+		}
+		if limit.MaxAmount > 0 && limit.MinAmount > limit.MaxAmount {
+			return "Minimum amount for asset " + asset + " exceeds its maximum"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// TestAssetLimits checks payments outside a merchant's amount limits or
+// beyond its daily volume cap are refused with their error codes
+func TestAssetLimits(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s, func(m *models.Merchant) {
+		m.AssetLimits = []models.AssetLimit{{AssetID: 0, MinAmount: 100000, MaxAmount: 5000000, DailyVolumeCap: 6000000}}
+	})
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	create := func(amount uint64) (int, string) {
+		t.Helper()
+		w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, gin.H{"amount": amount})
+		var body struct {
+			PaymentID string `json:"payment_id"`
+			Code      string `json:"code"`
+		}
+		decodeBody(t, w, &body)
+		if w.Code == http.StatusCreated {
+			return w.Code, body.PaymentID
+		}
+		return w.Code, body.Code
+	}
+
+	if status, code := create(99999); status != http.StatusBadRequest || code != codeAmountBelowMinimum {
+		t.Errorf("below the minimum: %d %s", status, code)
+	}
+	if status, code := create(5000001); status != http.StatusBadRequest || code != codeAmountAboveMaximum {
+		t.Errorf("above the maximum: %d %s", status, code)
+	}
+
+	// Pending payments count toward the cap until they are cancelled
+	status, first := create(4000000)
+	if status != http.StatusCreated {
+		t.Fatalf("first payment: status = %d", status)
+	}
+	if status, code := create(2000001); status != http.StatusUnprocessableEntity || code != codeDailyVolumeExceeded {
+		t.Errorf("beyond the daily cap: %d %s", status, code)
+	}
+	if status, _ := create(2000000); status != http.StatusCreated {
+		t.Errorf("up to the daily cap: status = %d", status)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+first+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	if status, _ := create(4000000); status != http.StatusCreated {
+		t.Errorf("after cancelling: status = %d", status)
+	}
+
+	// Other merchants have their own volume
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	createTestPayment(t, router, other, gin.H{"amount": 10000000})
+}
+
+// TestAssetLimitValidation checks merchants cannot be given inconsistent
+// limits
+func TestAssetLimitValidation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+
+	tests := []struct {
+		name     string
+		accepted []uint64
+		limits   []gin.H
+		status   int
+	}{
+		{"valid", []uint64{0}, []gin.H{{"asset_id": 0, "min_amount": 1, "max_amount": 10}}, http.StatusCreated},
+		{"repeated asset", []uint64{0}, []gin.H{{"asset_id": 0, "max_amount": 10}, {"asset_id": 0, "min_amount": 1}}, http.StatusBadRequest},
+		{"asset not accepted", []uint64{0}, []gin.H{{"asset_id": 31566704, "max_amount": 10}}, http.StatusBadRequest},
+		{"minimum above maximum", []uint64{0}, []gin.H{{"asset_id": 0, "min_amount": 11, "max_amount": 10}}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants", testAdminKey, gin.H{
+				"display_name":      "Limited Shop",
+				"receiving_address": crypto.GenerateAccount().Address.String(),
+				"accepted_assets":   test.accepted,
+				"asset_limits":      test.limits,
+			})
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+}
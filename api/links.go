@@ -0,0 +1,449 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Payment link limits
+const (
+	maxLinkTitleLength       = 128
+	maxLinkDescriptionLength = 1000
+)
+
+// Error codes returned when a payment link cannot be used
+const (
+	codeLinkInactive   = "link_inactive"
+	codeLinkNotStarted = "link_not_started"
+	codeLinkExpired    = "link_expired"
+	codeLinkExhausted  = "link_exhausted"
+)
+
+// slugPattern restricts payment link slugs to URL-safe lowercase names
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,63}$`)
+
+// createPaymentLink handles payment link creation
+func (s *Server) createPaymentLink(c *gin.Context) {
+	var req models.PaymentLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", currentMerchantID(c), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
+	}
+
+	link := &models.PaymentLink{
+		ID:         uuid.New().String(),
+		MerchantID: merchant.ID,
+		CreatedAt:  time.Now(),
+	}
+	if reqErr := s.applyPaymentLinkRequest(merchant, link, &req); reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+	if link.Slug == "" {
+		slug, err := generateSlug()
+		if err != nil {
+			log.Printf("Error generating payment link slug: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment link"})
+			return
+		}
+		link.Slug = slug
+	}
+
+	err = s.database.CreatePaymentLink(link)
+	if errors.Is(err, db.ErrSlugTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug " + link.Slug + " is already taken"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating payment link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment link"})
+		return
+	}
+	link.Stats = &models.PaymentLinkStats{}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// listPaymentLinks handles listing the merchant's payment links with their stats
+func (s *Server) listPaymentLinks(c *gin.Context) {
+	links, err := s.database.ListPaymentLinks(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error listing payment links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payment links"})
+		return
+	}
+
+	ids := make([]string, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+	stats, err := s.database.GetPaymentLinkStats(ids...)
+	if err != nil {
+		log.Printf("Error counting payment link payments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payment links"})
+		return
+	}
+	for _, link := range links {
+		link.Stats = stats[link.ID]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment_links": links})
+}
+
+// getPaymentLink handles payment link retrieval with its stats
+func (s *Server) getPaymentLink(c *gin.Context) {
+	link, ok := s.loadPaymentLink(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// updatePaymentLink handles replacing a payment link's settings
+func (s *Server) updatePaymentLink(c *gin.Context) {
+	var req models.PaymentLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link, ok := s.loadPaymentLink(c)
+	if !ok {
+		return
+	}
+	merchant, err := s.database.GetMerchant(link.MerchantID)
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", link.MerchantID, err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
+	}
+
+	if reqErr := s.applyPaymentLinkRequest(merchant, link, &req); reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+
+	err = s.database.UpdatePaymentLink(link)
+	if errors.Is(err, db.ErrSlugTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug " + link.Slug + " is already taken"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating payment link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, link)
+}
+
+// createLinkPayment handles creating a payment from one of the merchant's links
+func (s *Server) createLinkPayment(c *gin.Context) {
+	var req models.LinkPaymentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	link, ok := s.loadPaymentLink(c)
+	if !ok {
+		return
+	}
+
+	payment, reqErr := s.payWithLink(c.Request.Context(), link, &req)
+	if reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, paymentResponse(payment))
+}
+
+// visitPaymentLink handles the public link URL. It only describes the link,
+// so previews and crawlers fetching it create nothing: browsers get a hosted
+// page whose form posts back to pay, other clients the link as JSON.
+func (s *Server) visitPaymentLink(c *gin.Context) {
+	html := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+	link, ok := s.loadPublicLink(c, html)
+	if !ok {
+		return
+	}
+	reqErr := linkUnavailable(link, time.Now())
+	if !html {
+		if reqErr != nil {
+			reqErr.respond(c)
+			return
+		}
+		c.JSON(http.StatusOK, link.Public())
+		return
+	}
+	s.respondLinkPage(c, html, link, nil, reqErr)
+}
+
+// payPaymentLink handles paying through the public link URL, creating a
+// fresh payment. Custom amount links take amount or display_amount from the
+// form or JSON body.
+func (s *Server) payPaymentLink(c *gin.Context) {
+	html := c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+	link, ok := s.loadPublicLink(c, html)
+	if !ok {
+		return
+	}
+
+	var req models.LinkPaymentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			s.respondLinkPage(c, html, link, nil, &requestError{status: http.StatusBadRequest, message: "Invalid amount"})
+			return
+		}
+	}
+
+	payment, reqErr := s.payWithLink(c.Request.Context(), link, &req)
+	s.respondLinkPage(c, html, link, payment, reqErr)
+}
+
+// loadPublicLink loads the payment link named by the slug in the request,
+// writing a not found response if there is none
+func (s *Server) loadPublicLink(c *gin.Context, html bool) (*models.PaymentLink, bool) {
+	link, err := s.database.GetPaymentLinkBySlug(c.Param("slug"))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting payment link: %v", err)
+		}
+		s.respondLinkPage(c, html, nil, nil, &requestError{status: http.StatusNotFound, message: "Payment link not found"})
+		return nil, false
+	}
+	return link, true
+}
+
+// loadPaymentLink loads the merchant's payment link named in the request with
+// its stats, writing an error response if it cannot
+func (s *Server) loadPaymentLink(c *gin.Context) (*models.PaymentLink, bool) {
+	link, err := s.database.GetPaymentLink(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment link not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error getting payment link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment link"})
+		return nil, false
+	}
+
+	stats, err := s.database.GetPaymentLinkStats(link.ID)
+	if err != nil {
+		log.Printf("Error counting payment link payments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment link"})
+		return nil, false
+	}
+	link.Stats = stats[link.ID]
+	return link, true
+}
+
+// payWithLink creates a payment from a link through the regular payment path,
+// after checking that the link is usable and resolving the amount. The link's
+// max_payments is checked as the payment is stored.
+func (s *Server) payWithLink(ctx context.Context, link *models.PaymentLink, req *models.LinkPaymentRequest) (*models.Payment, *requestError) {
+	if reqErr := linkUnavailable(link, time.Now()); reqErr != nil {
+		return nil, reqErr
+	}
+
+	amount := link.Amount
+	if link.AmountType == models.PaymentLinkAmountFixed {
+		if req.Amount != 0 || req.DisplayAmount != "" {
+			return nil, &requestError{status: http.StatusBadRequest, message: "This payment link has a fixed amount"}
+		}
+	} else {
+		var reqErr *requestError
+		if amount, reqErr = s.customLinkAmount(link, req); reqErr != nil {
+			return nil, reqErr
+		}
+	}
+
+	merchant, err := s.database.GetMerchant(link.MerchantID)
+	if err != nil {
+		log.Printf("Error loading merchant %s for payment link %s: %v", link.MerchantID, link.ID, err)
+		return nil, &requestError{status: http.StatusInternalServerError, message: "Failed to create payment"}
+	}
+
+	return s.createPayment(ctx, merchant, &models.PaymentRequest{
+		Amount:           amount,
+		AssetID:          link.AssetID,
+		CallbackURL:      link.CallbackURL,
+		OrderReference:   link.OrderReference,
+		Metadata:         link.Metadata,
+		ExpiresInSeconds: link.ExpiresInSeconds,
+		PaymentLinkID:    link.ID,
+		LinkMaxPayments:  link.MaxPayments,
+	})
+}
+
+// linkUnavailable returns the error of a link that is switched off or outside
+// its active window at now
+func linkUnavailable(link *models.PaymentLink, now time.Time) *requestError {
+	switch {
+	case !link.Active:
+		return &requestError{status: http.StatusGone, message: "Payment link is inactive", code: codeLinkInactive}
+	case link.ActiveFrom != nil && now.Before(*link.ActiveFrom):
+		return &requestError{status: http.StatusForbidden, message: "Payment link is not active yet", code: codeLinkNotStarted}
+	case link.ActiveUntil != nil && !now.Before(*link.ActiveUntil):
+		return &requestError{status: http.StatusGone, message: "Payment link has expired", code: codeLinkExpired}
+	}
+	return nil
+}
+
+// customLinkAmount resolves the customer's amount for a custom amount link in
+// base units and checks it against the link's bounds
+func (s *Server) customLinkAmount(link *models.PaymentLink, req *models.LinkPaymentRequest) (uint64, *requestError) {
+	if req.Amount != 0 && req.DisplayAmount != "" {
+		return 0, &requestError{status: http.StatusBadRequest, message: "Use either amount or display_amount"}
+	}
+	if req.Amount == 0 && req.DisplayAmount == "" {
+		return 0, &requestError{status: http.StatusBadRequest, message: "amount or display_amount is required"}
+	}
+
+	options := []models.PaymentOption{{AssetID: link.AssetID, Amount: req.Amount, DisplayAmount: req.DisplayAmount}}
+	if reqErr := s.describeOptions(options); reqErr != nil {
+		return 0, reqErr
+	}
+	option := options[0]
+
+	if link.MinAmount > 0 && option.Amount < link.MinAmount {
+		return 0, &requestError{
+			status:  http.StatusBadRequest,
+			message: "Amount must be at least " + models.FormatAmount(link.MinAmount, option.Decimals),
+			code:    codeAmountBelowMinimum,
+		}
+	}
+	if link.MaxAmount > 0 && option.Amount > link.MaxAmount {
+		return 0, &requestError{
+			status:  http.StatusBadRequest,
+			message: "Amount must be at most " + models.FormatAmount(link.MaxAmount, option.Decimals),
+			code:    codeAmountAboveMaximum,
+		}
+	}
+	return option.Amount, nil
+}
+
+// applyPaymentLinkRequest validates a payment link request and copies its
+// settings onto link
+func (s *Server) applyPaymentLinkRequest(merchant *models.Merchant, link *models.PaymentLink, req *models.PaymentLinkRequest) *requestError {
+	badRequest := func(msg string) *requestError {
+		return &requestError{status: http.StatusBadRequest, message: msg}
+	}
+
+	if req.Slug != "" && !slugPattern.MatchString(req.Slug) {
+		return badRequest("slug must be 3-64 characters of lowercase letters, digits and '-', starting with a letter or digit")
+	}
+	if len(req.Title) > maxLinkTitleLength {
+		return badRequest("title must be at most " + strconv.Itoa(maxLinkTitleLength) + " characters")
+	}
+	if len(req.Description) > maxLinkDescriptionLength {
+		return badRequest("description must be at most " + strconv.Itoa(maxLinkDescriptionLength) + " characters")
+	}
+
+	switch req.AmountType {
+	case models.PaymentLinkAmountFixed:
+		if req.Amount == 0 {
+			return badRequest("Fixed amount links require an amount greater than 0")
+		}
+		if req.MinAmount != 0 || req.MaxAmount != 0 {
+			return badRequest("min_amount and max_amount only apply to custom amount links")
+		}
+	case models.PaymentLinkAmountCustom:
+		if req.Amount != 0 {
+			return badRequest("Custom amount links take the amount from the customer; use min_amount and max_amount to bound it")
+		}
+		if req.MaxAmount > 0 && req.MinAmount > req.MaxAmount {
+			return badRequest("min_amount must not exceed max_amount")
+		}
+	default:
+		return badRequest("amount_type must be fixed or custom")
+	}
+
+	if !merchant.AcceptsAsset(req.AssetID) {
+		return &requestError{
+			status:  http.StatusBadRequest,
+			message: "Asset " + strconv.FormatUint(req.AssetID, 10) + " is not accepted by this merchant",
+			code:    codeAssetNotAccepted,
+		}
+	}
+	if req.MaxPayments < 0 {
+		return badRequest("max_payments must not be negative")
+	}
+	if req.ActiveFrom != nil && req.ActiveUntil != nil && !req.ActiveFrom.Before(*req.ActiveUntil) {
+		return badRequest("active_from must be before active_until")
+	}
+	if req.ExpiresInSeconds != 0 {
+		if _, msg := s.expiryWithinBounds(merchant, req.ExpiresInSeconds); msg != "" {
+			return badRequest(msg)
+		}
+	}
+	if req.CallbackURL != "" {
+		if err := s.webhooks.ValidateURL(req.CallbackURL); err != nil {
+			return badRequest("Invalid callback URL: " + err.Error())
+		}
+	}
+	if err := validateOrderReference(req.OrderReference); err != nil {
+		return badRequest(err.Error())
+	}
+	if err := validateMetadata(req.Metadata, s.config.MetadataMaxBytes); err != nil {
+		return badRequest(err.Error())
+	}
+
+	if req.Slug != "" {
+		link.Slug = req.Slug
+	}
+	link.Title = req.Title
+	link.Description = req.Description
+	link.AmountType = req.AmountType
+	link.Amount = req.Amount
+	link.MinAmount = req.MinAmount
+	link.MaxAmount = req.MaxAmount
+	link.AssetID = req.AssetID
+	link.MaxPayments = req.MaxPayments
+	link.Active = req.Active == nil || *req.Active
+	link.ActiveFrom = req.ActiveFrom
+	link.ActiveUntil = req.ActiveUntil
+	link.ExpiresInSeconds = req.ExpiresInSeconds
+	link.CallbackURL = req.CallbackURL
+	link.OrderReference = req.OrderReference
+	link.Metadata = req.Metadata
+	link.UpdatedAt = time.Now()
+	return nil
+}
+
+// generateSlug creates a random payment link slug
+func generateSlug() (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestLink creates a payment link through the API
+func createTestLink(t *testing.T, router http.Handler, key string, req gin.H) models.PaymentLink {
+	t.Helper()
+	w := doRequest(t, router, http.MethodPost, "/api/v1/payment-links", key, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create link: status = %d, body %s", w.Code, w.Body)
+	}
+	var link models.PaymentLink
+	decodeBody(t, w, &link)
+	return link
+}
+
+// payLink pays a link through its public URL and returns the status and the
+// error code or the created payment's ID
+func payLink(t *testing.T, router http.Handler, slug string, req gin.H) (int, string) {
+	t.Helper()
+	w := doRequest(t, router, http.MethodPost, "/l/"+slug, "", req)
+	var body struct {
+		PaymentID string `json:"payment_id"`
+		Code      string `json:"code"`
+	}
+	decodeBody(t, w, &body)
+	if w.Code == http.StatusCreated {
+		return w.Code, body.PaymentID
+	}
+	return w.Code, body.Code
+}
+
+// TestPaymentLinks checks fixed links create a fresh payment per use up to
+// their limit and count what they collected
+func TestPaymentLinks(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	link := createTestLink(t, router, key, gin.H{
+		"slug": "coffee", "title": "Coffee", "amount_type": "fixed", "amount": 1000000,
+		"max_payments": 2, "order_reference": "COFFEE", "metadata": gin.H{"sku": "cf-1"},
+	})
+	if !link.Active || link.Stats == nil || link.Stats.Payments != 0 {
+		t.Fatalf("new link = %+v", link)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment-links", key, gin.H{"slug": "coffee", "title": "Tea", "amount_type": "fixed", "amount": 1}); w.Code != http.StatusConflict {
+		t.Errorf("taken slug: status = %d, want 409", w.Code)
+	}
+
+	// The public URL describes the link without creating anything
+	w := doRequest(t, router, http.MethodGet, "/l/coffee", "", nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), merchant.ID) || strings.Contains(w.Body.String(), "COFFEE") {
+		t.Fatalf("GET /l/coffee: status = %d, body %s", w.Code, w.Body)
+	}
+
+	status, first := payLink(t, router, "coffee", nil)
+	if status != http.StatusCreated {
+		t.Fatalf("first payment: status = %d", status)
+	}
+	payment, err := s.database.GetPayment(merchant.ID, first)
+	if err != nil || payment.PaymentLinkID != link.ID || payment.Amount != 1000000 || payment.OrderReference != "COFFEE" || payment.Metadata["sku"] != "cf-1" {
+		t.Fatalf("link payment = %+v, %v", payment, err)
+	}
+	if status, code := payLink(t, router, "coffee", gin.H{"amount": 5}); status != http.StatusBadRequest {
+		t.Errorf("amount for a fixed link: %d %s", status, code)
+	}
+	w = doRequest(t, router, http.MethodPost, "/api/v1/payment-links/"+link.ID+"/payments", key, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("second payment: status = %d, body %s", w.Code, w.Body)
+	}
+	var second models.PaymentResponse
+	decodeBody(t, w, &second)
+
+	// Pending and completed payments count toward max_payments
+	if status, code := payLink(t, router, "coffee", nil); status != http.StatusGone || code != codeLinkExhausted {
+		t.Errorf("beyond max_payments: %d %s", status, code)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+second.PaymentID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	if status, _ := payLink(t, router, "coffee", nil); status != http.StatusCreated {
+		t.Errorf("after cancelling a payment: status = %d", status)
+	}
+
+	deliverTransfer(t, s, merchant.ID, first, models.PaymentStatusCompleted)
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment-links/"+link.ID, key, nil), &link)
+	if stats := link.Stats; stats.Payments != 3 || stats.Pending != 1 || stats.Completed != 1 || stats.AmountCollected != 1000000 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payment-links/"+link.ID, other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's link: status = %d, want 404", w.Code)
+	}
+	if status, _ := payLink(t, router, "missing", nil); status != http.StatusNotFound {
+		t.Errorf("unknown slug: status = %d, want 404", status)
+	}
+}
+
+// TestCustomAmountLinks checks customers choose the amount of custom links
+// within their bounds
+func TestCustomAmountLinks(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	createTestLink(t, router, key, gin.H{"slug": "tips", "title": "Tips", "amount_type": "custom", "min_amount": 100000, "max_amount": 2000000})
+
+	status, id := payLink(t, router, "tips", gin.H{"display_amount": "0.5"})
+	if status != http.StatusCreated {
+		t.Fatalf("display amount: status = %d", status)
+	}
+	if payment, err := s.database.GetPayment(merchant.ID, id); err != nil || payment.Amount != 500000 {
+		t.Fatalf("custom payment = %+v, %v", payment, err)
+	}
+
+	tests := []struct {
+		name string
+		req  gin.H
+		code string
+	}{
+		{"no amount", nil, ""},
+		{"both amounts", gin.H{"amount": 200000, "display_amount": "0.2"}, ""},
+		{"below the minimum", gin.H{"amount": 99999}, codeAmountBelowMinimum},
+		{"above the maximum", gin.H{"display_amount": "2.000001"}, codeAmountAboveMaximum},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status, code := payLink(t, router, "tips", test.req); status != http.StatusBadRequest || code != test.code {
+				t.Fatalf("%d %q, want 400 %q", status, code, test.code)
+			}
+		})
+	}
+
+	// Browsers get a hosted page and pay through its form
+	req := httptest.NewRequest(http.MethodGet, "/l/tips", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), "Tips") {
+		t.Fatalf("hosted page: status = %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	req = httptest.NewRequest(http.MethodPost, "/l/tips", strings.NewReader(url.Values{"display_amount": {"1.25"}}.Encode()))
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "1.25") {
+		t.Fatalf("form payment: status = %d", w.Code)
+	}
+}
+
+// TestPaymentLinkAvailability checks links only create payments while active
+// and within their window
+func TestPaymentLinkAvailability(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	key := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+
+	fixed := func(slug string, changes gin.H) gin.H {
+		req := gin.H{"slug": slug, "title": "Ticket", "amount_type": "fixed", "amount": 1000000}
+		for k, v := range changes {
+			req[k] = v
+		}
+		return req
+	}
+	link := createTestLink(t, router, key, fixed("ticket", nil))
+	createTestLink(t, router, key, fixed("early", gin.H{"active_from": time.Now().Add(time.Hour)}))
+	createTestLink(t, router, key, fixed("late", gin.H{"active_until": time.Now().Add(-time.Hour)}))
+
+	if w := doRequest(t, router, http.MethodPut, "/api/v1/payment-links/"+link.ID, key, fixed("ticket", gin.H{"active": false})); w.Code != http.StatusOK {
+		t.Fatalf("deactivate: status = %d, body %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		slug   string
+		status int
+		code   string
+	}{
+		{"ticket", http.StatusGone, codeLinkInactive},
+		{"early", http.StatusForbidden, codeLinkNotStarted},
+		{"late", http.StatusGone, codeLinkExpired},
+	}
+	for _, test := range tests {
+		if status, code := payLink(t, router, test.slug, nil); status != test.status || code != test.code {
+			t.Errorf("pay %s: %d %q, want %d %q", test.slug, status, code, test.status, test.code)
+		}
+		if w := doRequest(t, router, http.MethodGet, "/l/"+test.slug, "", nil); w.Code != test.status {
+			t.Errorf("visit %s: status = %d, want %d", test.slug, w.Code, test.status)
+		}
+	}
+
+	for name, req := range map[string]gin.H{
+		"bad slug":            fixed("No Spaces", nil),
+		"fixed without price": fixed("free", gin.H{"amount": 0}),
+		"custom with amount":  fixed("custom", gin.H{"amount_type": "custom"}),
+		"unknown type":        fixed("other", gin.H{"amount_type": "tiered"}),
+		"reversed window":     fixed("window", gin.H{"active_from": time.Now().Add(time.Hour), "active_until": time.Now()}),
+		"asset not accepted":  fixed("asa", gin.H{"asset_id": 31566704}),
+		"negative limit":      fixed("limit", gin.H{"max_payments": -1}),
+	} {
+		if w := doRequest(t, router, http.MethodPost, "/api/v1/payment-links", key, req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listPayments handles listing the calling merchant's payments
+func (s *Server) listPayments(c *gin.Context) {
+	filter, err := parsePaymentFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.MerchantID = currentMerchantID(c)
+
+	s.respondPaymentList(c, filter)
+}
+
+// adminListPayments handles listing payments across merchants
+func (s *Server) adminListPayments(c *gin.Context) {
+	filter, err := parsePaymentFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.MerchantID = c.Query("merchant_id")
+
+	s.respondPaymentList(c, filter)
+}
+
+// respondPaymentList runs a payment list query and writes the page
+func (s *Server) respondPaymentList(c *gin.Context, filter models.PaymentFilter) {
+	list, err := s.database.ListPayments(filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing payments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// parsePaymentFilter reads list filters, sorting and pagination from the query string
+func parsePaymentFilter(c *gin.Context) (models.PaymentFilter, error) {
+	filter := models.PaymentFilter{
+		MerchantAddress: c.Query("merchant_address"),
+		TxnID:           c.Query("txn_id"),
+		OrderReference:  c.Query("order_reference"),
+		SubscriptionID:  c.Query("subscription_id"),
+		PaymentLinkID:   c.Query("payment_link_id"),
+		InvoiceID:       c.Query("invoice_id"),
+		SortBy:          c.DefaultQuery("sort", models.SortByCreatedAt),
+		Cursor:          c.Query("cursor"),
+		Limit:           models.DefaultPageSize,
+		Descending:      true,
+	}
+
+	if status := c.Query("status"); status != "" {
+		for _, value := range strings.Split(status, ",") {
+			filter.Statuses = append(filter.Statuses, models.PaymentStatus(strings.TrimSpace(value)))
+		}
+	}
+
+	if metadata := c.QueryMap("metadata"); len(metadata) > 0 {
+		for key := range metadata {
+			if !metadataKeyPattern.MatchString(key) {
+				return filter, fmt.Errorf("invalid metadata key %q", key)
+			}
+		}
+		filter.Metadata = metadata
+	}
+
+	if value := c.Query("asset_id"); value != "" {
+		assetID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("asset_id must be a non-negative integer")
+		}
+		filter.AssetID = &assetID
+	}
+
+	for param, target := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"updated_after":  &filter.UpdatedAfter,
+		"updated_before": &filter.UpdatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+		}
+		*target = &t
+	}
+
+	switch filter.SortBy {
+	case models.SortByCreatedAt, models.SortByUpdatedAt, models.SortByExpiresAt, models.SortByAmount:
+	default:
+		return filter, fmt.Errorf("sort must be one of created_at, updated_at, expires_at, amount")
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > models.MaxPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", models.MaxPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listPage fetches one page of the merchant's payments
+func listPage(t *testing.T, router http.Handler, key string, query url.Values) models.PaymentList {
+	t.Helper()
+	w := doRequest(t, router, http.MethodGet, "/api/v1/payments?"+query.Encode(), key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /payments?%s: status = %d, body %s", query.Encode(), w.Code, w.Body)
+	}
+	var list models.PaymentList
+	decodeBody(t, w, &list)
+	return list
+}
+
+// TestListPayments pages through payments and filters them, on a server
+// whose local zone is behind UTC
+func TestListPayments(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("PST", -8*60*60)
+	defer func() { time.Local = local }()
+
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	createTestPayment(t, router, other, gin.H{"amount": 9000000})
+
+	start := time.Now().Add(-time.Minute)
+	var ids []string
+	for i := 1; i <= 5; i++ {
+		created := createTestPayment(t, router, key, gin.H{
+			"amount":          i * 1000000,
+			"order_reference": "order-" + string(rune('0'+i)),
+			"metadata":        gin.H{"parity": []string{"even", "odd"}[i%2]},
+		})
+		ids = append(ids, created.PaymentID)
+	}
+	if _, err := s.database.CancelPayment(merchant.ID, ids[0]); err != nil {
+		t.Fatalf("CancelPayment: %v", err)
+	}
+
+	// Walk every page, newest first
+	var seen []string
+	query := url.Values{"limit": {"2"}}
+	for page := 0; ; page++ {
+		list := listPage(t, router, key, query)
+		for _, payment := range list.Payments {
+			seen = append(seen, payment.ID)
+		}
+		if !list.HasMore {
+			break
+		}
+		if page > 3 || list.NextCursor == "" {
+			t.Fatalf("page %d has more without a usable cursor", page)
+		}
+		query.Set("cursor", list.NextCursor)
+	}
+	if len(seen) != 5 || seen[0] != ids[4] || seen[4] != ids[0] {
+		t.Fatalf("listed %v, want %v newest first", seen, ids)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{"created after", url.Values{"created_after": {start.UTC().Format(time.RFC3339)}}, ids},
+		{"created after in another zone", url.Values{"created_after": {start.In(time.FixedZone("", 5*60*60)).Format(time.RFC3339)}}, ids},
+		{"created before", url.Values{"created_before": {start.UTC().Format(time.RFC3339)}}, nil},
+		{"updated before", url.Values{"updated_before": {time.Now().Add(time.Minute).UTC().Format(time.RFC3339)}}, ids},
+		{"status", url.Values{"status": {"cancelled"}}, ids[:1]},
+		{"statuses", url.Values{"status": {"pending, cancelled"}}, ids},
+		{"order reference", url.Values{"order_reference": {"order-3"}}, ids[2:3]},
+		{"metadata", url.Values{"metadata[parity]": {"even"}}, []string{ids[1], ids[3]}},
+		{"asset", url.Values{"asset_id": {"0"}}, ids},
+		{"other asset", url.Values{"asset_id": {"31566704"}}, nil},
+		{"amount ascending", url.Values{"sort": {"amount"}, "order": {"asc"}, "limit": {"2"}}, ids[:2]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			list := listPage(t, router, key, test.query)
+			got := map[string]bool{}
+			for _, payment := range list.Payments {
+				got[payment.ID] = true
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("listed %d payments, want %d", len(got), len(test.want))
+			}
+			for _, id := range test.want {
+				if !got[id] {
+					t.Fatalf("payment %s is missing", id)
+				}
+			}
+		})
+	}
+}
+
+// TestListPaymentsRejectsBadParameters checks invalid list parameters fail
+// with 400
+func TestListPaymentsRejectsBadParameters(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	key := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+
+	for _, query := range []string{
+		"sort=fee",
+		"order=up",
+		"limit=0",
+		"limit=101",
+		"asset_id=-1",
+		"created_after=yesterday",
+		"cursor=not-a-cursor",
+		"metadata[bad%20key]=x",
+	} {
+		if w := doRequest(t, router, http.MethodGet, "/api/v1/payments?"+query, key, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// hexColorPattern matches #RGB and #RRGGBB colors
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// createMerchant handles merchant creation
+func (s *Server) createMerchant(c *gin.Context) {
+	var req models.MerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := s.validateMerchantRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create merchant"})
+		return
+	}
+	merchant := &models.Merchant{
+		ID:            uuid.New().String(),
+		WebhookSecret: secret,
+		CreatedAt:     time.Now(),
+	}
+	applyMerchantRequest(merchant, &req)
+
+	if err := s.database.CreateMerchant(merchant); err != nil {
+		log.Printf("Error creating merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create merchant"})
+		return
+	}
+	s.audit(c, models.AuditMerchantCreated, models.AuditResourceMerchant, merchant.ID, merchant.ID, nil, merchant)
+
+	c.JSON(http.StatusCreated, models.MerchantSecretResponse{Merchant: merchant, WebhookSecret: secret})
+}
+
+// listMerchants handles listing all merchants
+func (s *Server) listMerchants(c *gin.Context) {
+	merchants, err := s.database.ListMerchants()
+	if err != nil {
+		log.Printf("Error listing merchants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list merchants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"merchants": merchants})
+}
+
+// getMerchant handles merchant retrieval
+func (s *Server) getMerchant(c *gin.Context) {
+	merchant, err := s.database.GetMerchant(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, merchant)
+}
+
+// updateMerchant handles replacing a merchant's settings
+func (s *Server) updateMerchant(c *gin.Context) {
+	var req models.MerchantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchant"})
+		return
+	}
+
+	if msg := s.validateMerchantRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	before := *merchant
+	applyMerchantRequest(merchant, &req)
+
+	if err := s.database.UpdateMerchant(merchant); err != nil {
+		log.Printf("Error updating merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update merchant"})
+		return
+	}
+	s.audit(c, models.AuditMerchantUpdated, models.AuditResourceMerchant, merchant.ID, merchant.ID, &before, merchant)
+
+	c.JSON(http.StatusOK, merchant)
+}
+
+// rotateWebhookSecret handles replacing a merchant's webhook secret with a
+// new one, which is only returned in this response
+func (s *Server) rotateWebhookSecret(c *gin.Context) {
+	merchant, err := s.database.GetMerchant(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Merchant not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get merchant"})
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+	merchant.WebhookSecret = secret
+	merchant.UpdatedAt = time.Now()
+
+	if err := s.database.UpdateMerchant(merchant); err != nil {
+		log.Printf("Error updating merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+	s.audit(c, models.AuditMerchantSecretRotated, models.AuditResourceMerchant, merchant.ID, merchant.ID, nil, gin.H{"rotated_at": merchant.UpdatedAt})
+
+	c.JSON(http.StatusOK, models.MerchantSecretResponse{Merchant: merchant, WebhookSecret: secret})
+}
+
+// validateMerchantRequest returns a client-facing error message for an invalid request
+func (s *Server) validateMerchantRequest(req *models.MerchantRequest) string {
+	if err := s.algoClient.ValidateAddress(req.ReceivingAddress); err != nil {
+		return "Invalid receiving address"
+	}
+	if req.PayoutAddress != "" {
+		if err := s.algoClient.ValidateAddress(req.PayoutAddress); err != nil {
+			return "Invalid payout address"
+		}
+	}
+	if req.DefaultTimeout < 0 {
+		return "Default timeout must not be negative"
+	}
+	if msg := validateAssetLimits(req); msg != "" {
+		return msg
+	}
+	if req.MinExpirySeconds < 0 || req.MaxExpirySeconds < 0 {
+		return "Expiry bounds must not be negative"
+	}
+	if req.MinExpirySeconds > 0 && req.MaxExpirySeconds > 0 && req.MinExpirySeconds > req.MaxExpirySeconds {
+		return "Minimum expiry must not exceed maximum expiry"
+	}
+	if req.WebhookURL != "" {
+		if err := s.webhooks.ValidateURL(req.WebhookURL); err != nil {
+			return "Invalid webhook URL: " + err.Error()
+		}
+	}
+	switch req.LatePaymentAction {
+	case "", models.LatePaymentActionManual, models.LatePaymentActionAccept, models.LatePaymentActionRefund:
+	default:
+		return "Late payment action must be manual, accept or refund"
+	}
+	if req.Branding.PrimaryColor != "" && !hexColorPattern.MatchString(req.Branding.PrimaryColor) {
+		return "Primary color must be a hex color such as #1a73e8"
+	}
+	return ""
+}
+
+// applyMerchantRequest copies request fields onto a merchant
+func applyMerchantRequest(merchant *models.Merchant, req *models.MerchantRequest) {
+	merchant.DisplayName = req.DisplayName
+	merchant.ReceivingAddress = req.ReceivingAddress
+	merchant.PayoutAddress = req.PayoutAddress
+	merchant.AcceptedAssets = req.AcceptedAssets
+	merchant.AssetLimits = req.AssetLimits
+	merchant.DefaultTimeout = req.DefaultTimeout
+	merchant.MinExpirySeconds = req.MinExpirySeconds
+	merchant.MaxExpirySeconds = req.MaxExpirySeconds
+	merchant.WebhookURL = req.WebhookURL
+	merchant.LatePaymentAction = req.LatePaymentAction
+	if merchant.LatePaymentAction == "" {
+		merchant.LatePaymentAction = models.LatePaymentActionManual
+	}
+	merchant.Branding = req.Branding
+	merchant.UpdatedAt = time.Now()
+}
+
+// generateWebhookSecret returns a new secret for signing a merchant's webhooks
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
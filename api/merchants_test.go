@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// TestMerchantWebhookSecret checks the webhook secret is only returned when
+// the merchant is created and when the secret is rotated
+func TestMerchantWebhookSecret(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	req := gin.H{
+		"display_name":      "Coffee Shop",
+		"receiving_address": crypto.GenerateAccount().Address.String(),
+		"webhook_url":       "https://93.184.216.34/webhook",
+	}
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants", testAdminKey, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	var created models.MerchantSecretResponse
+	decodeBody(t, w, &created)
+	if !strings.HasPrefix(created.WebhookSecret, "whsec_") || created.LatePaymentAction != models.LatePaymentActionManual {
+		t.Fatalf("created = %+v", created)
+	}
+	secret := created.WebhookSecret
+
+	// Reads and updates never return it, and updates keep it
+	req["display_name"] = "Coffee House"
+	for _, w := range []interface{ String() string }{
+		doRequest(t, router, http.MethodGet, "/api/v1/admin/merchants/"+created.ID, testAdminKey, nil).Body,
+		doRequest(t, router, http.MethodGet, "/api/v1/admin/merchants", testAdminKey, nil).Body,
+		doRequest(t, router, http.MethodPut, "/api/v1/admin/merchants/"+created.ID, testAdminKey, req).Body,
+	} {
+		if body := w.String(); strings.Contains(body, "webhook_secret") || strings.Contains(body, secret) {
+			t.Errorf("response %s carries the webhook secret", body)
+		}
+	}
+	merchant, err := s.database.GetMerchant(created.ID)
+	if err != nil || merchant.WebhookSecret != secret || merchant.DisplayName != "Coffee House" {
+		t.Fatalf("stored merchant = %+v, %v", merchant, err)
+	}
+
+	w = doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants/"+created.ID+"/webhook-secret", testAdminKey, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate: status = %d, body %s", w.Code, w.Body)
+	}
+	var rotated models.MerchantSecretResponse
+	decodeBody(t, w, &rotated)
+	if rotated.WebhookSecret == secret || !strings.HasPrefix(rotated.WebhookSecret, "whsec_") {
+		t.Fatalf("rotated secret = %q", rotated.WebhookSecret)
+	}
+	if merchant, err := s.database.GetMerchant(created.ID); err != nil || merchant.WebhookSecret != rotated.WebhookSecret {
+		t.Fatalf("stored secret after rotation = %+v, %v", merchant, err)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants/missing/webhook-secret", testAdminKey, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("rotate of an unknown merchant: status = %d, want 404", w.Code)
+	}
+
+	// Neither secret reaches the audit log
+	entries, err := s.database.ListAuditEntries(models.AuditFilter{ResourceID: created.ID, Limit: 10})
+	if err != nil || len(entries.Entries) != 3 {
+		t.Fatalf("audit entries = %+v, %v", entries, err)
+	}
+	for _, entry := range entries.Entries {
+		for _, value := range []string{string(entry.Before), string(entry.After)} {
+			if strings.Contains(value, secret) || strings.Contains(value, rotated.WebhookSecret) {
+				t.Errorf("%s audit entry carries a webhook secret", entry.Action)
+			}
+		}
+	}
+}
+
+// TestMerchantValidation checks invalid merchant settings are refused
+func TestMerchantValidation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	address := crypto.GenerateAccount().Address.String()
+
+	tests := map[string]gin.H{
+		"missing name":         {"receiving_address": address},
+		"bad address":          {"display_name": "Shop", "receiving_address": "not-an-address"},
+		"bad payout address":   {"display_name": "Shop", "receiving_address": address, "payout_address": "nope"},
+		"negative timeout":     {"display_name": "Shop", "receiving_address": address, "default_timeout": -1},
+		"inverted expiry":      {"display_name": "Shop", "receiving_address": address, "min_expiry_seconds": 600, "max_expiry_seconds": 60},
+		"http webhook":         {"display_name": "Shop", "receiving_address": address, "webhook_url": "http://93.184.216.34/hook"},
+		"late payment action":  {"display_name": "Shop", "receiving_address": address, "late_payment_action": "ignore"},
+		"primary color":        {"display_name": "Shop", "receiving_address": address, "branding": gin.H{"primary_color": "blue"}},
+		"unaccepted limit":     {"display_name": "Shop", "receiving_address": address, "accepted_assets": []int{0}, "asset_limits": []gin.H{{"asset_id": 5, "max_amount": 10}}},
+		"min above max amount": {"display_name": "Shop", "receiving_address": address, "asset_limits": []gin.H{{"asset_id": 0, "min_amount": 10, "max_amount": 5}}},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			if w := doRequest(t, router, http.MethodPost, "/api/v1/admin/merchants", testAdminKey, req); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/admin/merchants/missing", testAdminKey, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown merchant: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageTemplates are the hosted pages served to customers and the invoice page
+var pageTemplates = parsePageTemplates()
+
+// parsePageTemplates parses every page template into one set
+func parsePageTemplates() *template.Template {
+	templates := template.Must(template.New("payment_link").Parse(paymentLinkPage))
+	template.Must(templates.New("invoice").Parse(invoicePage))
+	return templates
+}
+
+// paymentLinkPage renders a payment link: a form that posts back to pay,
+// asking custom amount links for the amount, the created payment, or the
+// reason the link cannot be used
+const paymentLinkPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Link}}{{.Link.Title}}{{else}}Payment link{{end}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 28rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+header { border-bottom: 4px solid {{.Color}}; padding-bottom: .75rem; margin-bottom: 1rem; }
+header img { max-height: 3rem; display: block; margin-bottom: .5rem; }
+.amount { font-size: 1.75rem; font-weight: 600; }
+.address { font-family: monospace; word-break: break-all; background: #f4f4f4; padding: .5rem; }
+.error { color: #b00020; }
+button { background: {{.Color}}; color: #fff; border: 0; padding: .6rem 1.2rem; font-size: 1rem; }
+input { font-size: 1rem; padding: .5rem; width: 10rem; }
+footer { margin-top: 2rem; font-size: .85rem; color: #666; }
+</style>
+</head>
+<body>
+<header>
+{{if .Branding.LogoURL}}<img src="{{.Branding.LogoURL}}" alt="">{{end}}
+<strong>{{.MerchantName}}</strong>
+</header>
+{{if .Link}}<h1>{{.Link.Title}}</h1>
+{{if .Link.Description}}<p>{{.Link.Description}}</p>{{end}}{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Payment}}<p class="amount">{{.Payment.DisplayAmount}} {{.Payment.UnitName}}</p>
+{{if .QRCode}}<p><img src="{{.QRCode}}" alt="Payment QR code" width="256" height="256"></p>{{end}}
+<p>Send exactly this amount to:</p>
+<p class="address">{{.Payment.MerchantAddress}}</p>
+<p>Payment ID: {{.Payment.PaymentID}}<br>Expires: {{.Payment.ExpiresAt}}</p>
+{{else if .ShowForm}}<form method="post">
+{{if .Custom}}<label>Amount{{if .UnitName}} ({{.UnitName}}){{end}}<br>
+<input name="display_amount" inputmode="decimal" required{{if .MinAmount}} placeholder="at least {{.MinAmount}}"{{end}}></label>
+{{else}}<p class="amount">{{.Amount}} {{.UnitName}}</p>
+{{end}}<button type="submit">Pay</button>
+{{if .MaxAmount}}<p>Up to {{.MaxAmount}} {{.UnitName}}</p>{{end}}
+</form>{{end}}
+{{if .Branding.SupportEmail}}<footer>Questions? <a href="mailto:{{.Branding.SupportEmail}}">{{.Branding.SupportEmail}}</a></footer>{{end}}
+</body>
+</html>
+`
+
+// linkPageData is the data rendered by paymentLinkPage
+type linkPageData struct {
+	MerchantName string
+	Branding     models.Branding
+	Color        string
+	Link         *models.PaymentLink
+	UnitName     string
+	Amount       string // of fixed amount links
+	MinAmount    string
+	MaxAmount    string
+	ShowForm     bool
+	Custom       bool // the form asks for the amount
+	Payment      *models.PaymentResponse
+	QRCode       template.URL
+	Error        string
+}
+
+// respondLinkPage answers a payment link visit with the created payment, the
+// payment form or an error, as a hosted page or as JSON
+func (s *Server) respondLinkPage(c *gin.Context, html bool, link *models.PaymentLink, payment *models.Payment, reqErr *requestError) {
+	if !html {
+		if reqErr != nil {
+			reqErr.respond(c)
+			return
+		}
+		c.JSON(http.StatusCreated, paymentResponse(payment))
+		return
+	}
+
+	status := http.StatusOK
+	data := linkPageData{Link: link, Color: defaultBrandColor}
+	if reqErr != nil {
+		status = reqErr.status
+		data.Error = reqErr.message
+	}
+
+	if link != nil {
+		// Custom amount links ask again after an invalid amount
+		data.ShowForm = payment == nil && (reqErr == nil || reqErr.status == http.StatusBadRequest)
+		data.Custom = link.AmountType == models.PaymentLinkAmountCustom
+
+		merchant, err := s.database.GetMerchant(link.MerchantID)
+		if err != nil {
+			log.Printf("Error loading merchant for payment link %s: %v", link.ID, err)
+		} else {
+			data.MerchantName = merchant.DisplayName
+			data.Branding = merchant.Branding
+			if merchant.Branding.PrimaryColor != "" {
+				data.Color = merchant.Branding.PrimaryColor
+			}
+		}
+
+		if asset, err := s.algoClient.GetAssetInfo(link.AssetID); err == nil {
+			data.UnitName = asset.UnitName
+			if link.AmountType == models.PaymentLinkAmountFixed {
+				data.Amount = models.FormatAmount(link.Amount, asset.Decimals)
+			}
+			if link.MinAmount > 0 {
+				data.MinAmount = models.FormatAmount(link.MinAmount, asset.Decimals)
+			}
+			if link.MaxAmount > 0 {
+				data.MaxAmount = models.FormatAmount(link.MaxAmount, asset.Decimals)
+			}
+		}
+	}
+
+	if payment != nil {
+		response := paymentResponse(payment)
+		data.Payment = &response
+		if response.QRCode != "" {
+			// The QR code is a PNG generated by the gateway, not user input
+			data.QRCode = template.URL("data:image/png;base64," + response.QRCode)
+		}
+	}
+
+	c.HTML(status, "payment_link", data)
+}
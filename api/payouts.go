@@ -0,0 +1,332 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/algorand"
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// createPayout handles paying out part of the merchant's available balance to
+// its payout address. The funds are set aside in the ledger before the
+// transfer is sent, so concurrent payouts cannot spend them twice.
+func (s *Server) createPayout(c *gin.Context) {
+	var req models.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payout"})
+		return
+	}
+	if reqErr := s.checkPayout(merchant, req.AssetID); reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+
+	// ALGO payouts leave enough behind for their own network fee
+	var reserve uint64
+	if req.AssetID == 0 {
+		reserve = algorand.MinFee
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		available, err := s.availableBalance(merchant.ID, req.AssetID)
+		if err != nil {
+			log.Printf("Error getting balance of merchant %s: %v", merchant.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payout"})
+			return
+		}
+		if available > int64(reserve) {
+			amount = uint64(available) - reserve
+		}
+	}
+	if amount == 0 {
+		insufficientBalance(req.AssetID).respond(c)
+		return
+	}
+
+	now := time.Now()
+	payout := &models.Payout{
+		ID:          uuid.New().String(),
+		MerchantID:  merchant.ID,
+		AssetID:     req.AssetID,
+		Amount:      amount,
+		Source:      merchant.ReceivingAddress,
+		Destination: merchant.PayoutAddress,
+		Status:      models.PayoutPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	entry := models.NewTransferEntry(merchant.ID, payout.AssetID, models.EntryPayoutRequested,
+		payout.ID, "Payout "+payout.ID, models.LedgerPayoutsPending, models.LedgerReceiving, payout.Amount)
+
+	err = s.database.CreatePayout(payout, entry, reserve)
+	if errors.Is(err, db.ErrInsufficientBalance) {
+		insufficientBalance(req.AssetID).respond(c)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating payout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payout"})
+		return
+	}
+
+	s.sendPayout(payout)
+	c.JSON(http.StatusCreated, payout)
+}
+
+// checkPayout checks that the gateway can pay a merchant out in an asset
+func (s *Server) checkPayout(merchant *models.Merchant, assetID uint64) *requestError {
+	if merchant.PayoutAddress == "" {
+		return &requestError{status: http.StatusConflict, message: "Merchant has no payout address"}
+	}
+	if !s.algoClient.CanSign(merchant.ReceivingAddress) {
+		return &requestError{
+			status:  http.StatusUnprocessableEntity,
+			message: "Payouts require the receiving address to be in SIGNER_MNEMONICS",
+		}
+	}
+	if s.config.AccountChecks {
+		if err := s.algoClient.CheckReceivable(merchant.PayoutAddress, assetID); err != nil {
+			return &requestError{
+				status:  http.StatusUnprocessableEntity,
+				message: "Payout address cannot receive asset " + strconv.FormatUint(assetID, 10) + ": " + err.Error(),
+			}
+		}
+	}
+	return nil
+}
+
+// insufficientBalance reports a payout the available balance cannot cover
+func insufficientBalance(assetID uint64) *requestError {
+	return &requestError{
+		status:  http.StatusConflict,
+		message: "Insufficient available balance in asset " + strconv.FormatUint(assetID, 10),
+		code:    "insufficient_balance",
+	}
+}
+
+// availableBalance returns what a merchant may pay out in an asset
+func (s *Server) availableBalance(merchantID string, assetID uint64) (int64, error) {
+	accounts, err := s.database.GetAccountBalances(merchantID)
+	if err != nil {
+		return 0, err
+	}
+	for _, balance := range models.BalancesFrom(accounts) {
+		if balance.AssetID == assetID {
+			return balance.Available, nil
+		}
+	}
+	return 0, nil
+}
+
+// listPayouts handles listing the calling merchant's payouts
+func (s *Server) listPayouts(c *gin.Context) {
+	status := models.PayoutStatus(c.Query("status"))
+	payouts, err := s.database.ListPayouts(currentMerchantID(c), status)
+	if err != nil {
+		log.Printf("Error listing payouts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list payouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payouts": payouts})
+}
+
+// getPayout handles payout retrieval
+func (s *Server) getPayout(c *gin.Context) {
+	payout, err := s.database.GetPayout(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting payout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payout)
+}
+
+// sendPayout submits a pending payout. Like split payouts, the payout is
+// claimed with its transaction ID before it is sent, so an interrupted send is
+// resolved by confirmation rather than by sending it twice.
+func (s *Server) sendPayout(payout *models.Payout) {
+	transfers := []algorand.Transfer{{To: payout.Destination, Amount: payout.Amount, AssetID: payout.AssetID}}
+	group, err := s.algoClient.SignGroup(payout.Source, transfers, []byte("algopay payout "+payout.ID))
+	if err != nil {
+		s.failPayout(payout, models.PayoutPending, err, true)
+		return
+	}
+
+	payout.Status = models.PayoutSubmitted
+	payout.TxnID = group.TxIDs[0]
+	payout.Fee = group.Fees[0]
+	payout.LastValid = group.LastValid
+	payout.Attempts++
+	payout.Error = ""
+	err = s.database.UpdatePayout(models.PayoutPending, payout)
+	if errors.Is(err, db.ErrPayoutChanged) {
+		// Another pass claimed the payout first
+		return
+	}
+	if err != nil {
+		log.Printf("Error claiming payout %s: %v", payout.ID, err)
+		return
+	}
+
+	err = s.algoClient.SendGroup(group)
+	if errors.Is(err, algorand.ErrGroupRejected) {
+		s.failPayout(payout, models.PayoutSubmitted, err, false)
+		return
+	}
+	if err != nil {
+		// The transfer may have reached the network; confirmation decides
+		log.Printf("Error sending payout %s: %v", payout.ID, err)
+		return
+	}
+	log.Printf("Sent payout %s in transaction %s", payout.ID, payout.TxnID)
+}
+
+// failPayout records a failed attempt to send a payout, returning it to
+// pending for another attempt. Once attempts run out the payout fails and its
+// funds become available again.
+func (s *Server) failPayout(payout *models.Payout, from models.PayoutStatus, cause error, countAttempt bool) {
+	log.Printf("Error sending payout %s: %v", payout.ID, cause)
+
+	if countAttempt {
+		payout.Attempts++
+	}
+	payout.Status = models.PayoutPending
+	payout.TxnID = ""
+	payout.Fee = 0
+	payout.LastValid = 0
+	payout.Error = cause.Error()
+
+	var entries []*models.JournalEntry
+	if payout.Attempts >= s.config.PayoutMaxAttempts {
+		payout.Status = models.PayoutFailed
+		entries = append(entries, models.NewTransferEntry(payout.MerchantID, payout.AssetID, models.EntryPayoutReversed,
+			payout.ID, "Failed payout "+payout.ID, models.LedgerReceiving, models.LedgerPayoutsPending, payout.Amount))
+	}
+
+	if err := s.database.UpdatePayout(from, payout, entries...); err != nil {
+		if !errors.Is(err, db.ErrPayoutChanged) {
+			log.Printf("Error saving payout %s: %v", payout.ID, err)
+		}
+		return
+	}
+	if payout.Status == models.PayoutFailed {
+		s.notifyPayout(payout, models.EventPayoutFailed)
+	}
+}
+
+// runPayouts periodically confirms submitted payouts and refunds and retries
+// pending payouts
+func (s *Server) runPayouts() {
+	if s.config.PayoutInterval <= 0 {
+		log.Printf("Payout processor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.config.PayoutInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.confirmRefunds()
+			s.processPayouts()
+		}
+	}
+}
+
+// processPayouts runs one payout pass. Submitted payouts are checked first so
+// expired ones can be resent in the same pass.
+func (s *Server) processPayouts() {
+	submitted, err := s.database.GetPayoutsByStatus(models.PayoutSubmitted)
+	if err != nil {
+		log.Printf("Error loading submitted payouts: %v", err)
+		return
+	}
+	for _, payout := range submitted {
+		s.confirmPayout(payout)
+	}
+
+	pending, err := s.database.GetPayoutsByStatus(models.PayoutPending)
+	if err != nil {
+		log.Printf("Error loading pending payouts: %v", err)
+		return
+	}
+	for _, payout := range pending {
+		s.sendPayout(payout)
+	}
+}
+
+// confirmPayout checks whether a submitted payout was confirmed, recording the
+// payout and its network fee in the ledger when it was. A payout that expired
+// unconfirmed goes back to pending.
+func (s *Server) confirmPayout(payout *models.Payout) {
+	confirmed, expired, err := s.algoClient.CheckConfirmation(payout.TxnID, payout.LastValid)
+	if err != nil {
+		log.Printf("Error confirming payout %s: %v", payout.ID, err)
+		return
+	}
+	if expired {
+		s.failPayout(payout, models.PayoutSubmitted, errors.New("transaction expired before it was confirmed"), false)
+		return
+	}
+	if !confirmed {
+		return
+	}
+
+	payout.Status = models.PayoutConfirmed
+	entries := []*models.JournalEntry{
+		models.NewTransferEntry(payout.MerchantID, payout.AssetID, models.EntryPayoutPaid,
+			payout.ID, "Payout "+payout.ID, models.LedgerPayouts, models.LedgerPayoutsPending, payout.Amount),
+	}
+	if fee := networkFeeEntry(payout.MerchantID, payout.TxnID, "Fee for payout "+payout.ID, payout.Fee); fee != nil {
+		entries = append(entries, fee)
+	}
+	if err := s.database.UpdatePayout(models.PayoutSubmitted, payout, entries...); err != nil {
+		if !errors.Is(err, db.ErrPayoutChanged) {
+			log.Printf("Error saving payout %s: %v", payout.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Payout %s confirmed", payout.ID)
+	s.notifyPayout(payout, models.EventPayoutPaid)
+}
+
+// notifyPayout sends a payout event to the merchant's webhook URL
+func (s *Server) notifyPayout(payout *models.Payout, event string) {
+	payload := models.PayoutWebhookPayload{
+		Event:       event,
+		PayoutID:    payout.ID,
+		Status:      payout.Status,
+		AssetID:     payout.AssetID,
+		Amount:      payout.Amount,
+		Destination: payout.Destination,
+		TxnID:       payout.TxnID,
+		Error:       payout.Error,
+		Timestamp:   time.Now(),
+	}
+	go s.postWebhook(payout.MerchantID, "", "payout "+payout.ID, payload)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/algorand"
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// newPayoutMerchant stores a merchant whose receiving address the server can
+// sign for and credits it with received ALGO
+func newPayoutMerchant(t *testing.T, s *Server, received uint64) *models.Merchant {
+	t.Helper()
+	merchant := newSigningMerchant(t, s, func(m *models.Merchant) {
+		m.PayoutAddress = crypto.GenerateAccount().Address.String()
+	})
+	s.recordEntries(paymentReceivedEntry(&models.Payment{
+		ID:         "pay-1",
+		MerchantID: merchant.ID,
+		Amount:     received,
+		Status:     models.PaymentStatusCompleted,
+	}))
+	return merchant
+}
+
+// balanceOf returns the merchant's ALGO balance as served by the API
+func balanceOf(t *testing.T, router http.Handler, key string) models.Balance {
+	t.Helper()
+	w := doRequest(t, router, http.MethodGet, "/api/v1/balance", key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /balance: status = %d, body %s", w.Code, w.Body)
+	}
+	var body struct {
+		Balances []models.Balance `json:"balances"`
+	}
+	decodeBody(t, w, &body)
+	if len(body.Balances) != 1 || body.Balances[0].AssetID != 0 {
+		t.Fatalf("balances = %+v, want one in ALGO", body.Balances)
+	}
+	return body.Balances[0]
+}
+
+// TestPayouts checks payouts set their funds aside and cannot exceed the
+// available balance
+func TestPayouts(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newPayoutMerchant(t, s, 5000000)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	s.recordEntries(networkFeeEntry(merchant.ID, "txn-1", "Refund fee", 1000))
+	if balance := balanceOf(t, router, key); balance.Available != 4999000 || balance.Received != 5000000 || balance.NetworkFees != 1000 {
+		t.Fatalf("balance = %+v", balance)
+	}
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"asset_id": 0, "amount": 6000000})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("payout above the balance: status = %d, want 409", w.Code)
+	}
+
+	// The node is unreachable, so the payout stays pending for a retry with
+	// its funds set aside
+	w = doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"asset_id": 0, "amount": 1000000})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("payout: status = %d, body %s", w.Code, w.Body)
+	}
+	var payout models.Payout
+	decodeBody(t, w, &payout)
+	if payout.Status != models.PayoutPending || payout.Amount != 1000000 || payout.Destination != merchant.PayoutAddress {
+		t.Fatalf("payout = %+v", payout)
+	}
+	if balance := balanceOf(t, router, key); balance.Available != 3999000 || balance.PendingPayouts != 1000000 {
+		t.Fatalf("balance after the payout = %+v", balance)
+	}
+
+	// Sweeping leaves the ALGO fee of the payout behind
+	w = doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"asset_id": 0})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("sweep: status = %d, body %s", w.Code, w.Body)
+	}
+	decodeBody(t, w, &payout)
+	if payout.Amount != 3999000-algorand.MinFee {
+		t.Fatalf("swept %d, want %d", payout.Amount, 3999000-algorand.MinFee)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"asset_id": 0}); w.Code != http.StatusConflict {
+		t.Fatalf("sweep of an empty balance: status = %d, want 409", w.Code)
+	}
+
+	w = doRequest(t, router, http.MethodGet, "/api/v1/payouts/"+payout.ID, key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET payout: status = %d", w.Code)
+	}
+	var list struct {
+		Payouts []models.Payout `json:"payouts"`
+	}
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payouts", key, nil), &list)
+	if len(list.Payouts) != 2 {
+		t.Fatalf("listed %d payouts, want 2", len(list.Payouts))
+	}
+
+	var entries models.JournalEntryList
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/ledger/entries?limit=2", key, nil), &entries)
+	if len(entries.Entries) != 2 || !entries.HasMore || entries.Entries[0].Kind != models.EntryPaymentReceived {
+		t.Fatalf("ledger entries = %+v", entries)
+	}
+}
+
+// TestPayoutChecks checks payouts need a payout address, a signing key and
+// the payouts scopes
+func TestPayoutChecks(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newPayoutMerchant(t, s, 5000000)
+
+	// Without a payout address
+	noPayoutAddress := newTestMerchant(t, s)
+	key := newTestKey(t, s, noPayoutAddress.ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"amount": 1000}); w.Code != http.StatusConflict {
+		t.Errorf("without a payout address: status = %d, want 409", w.Code)
+	}
+
+	// Without a signing key for the receiving address
+	unsigned := newTestMerchant(t, s, func(m *models.Merchant) {
+		m.PayoutAddress = crypto.GenerateAccount().Address.String()
+	})
+	key = newTestKey(t, s, unsigned.ID, models.APIKeyTypeSecret)
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payouts", key, gin.H{"amount": 1000}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("without a signing key: status = %d, want 422", w.Code)
+	}
+
+	// Payment scopes do not reach the merchant's funds
+	key = newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret, models.ScopePaymentsRead, models.ScopePaymentsWrite)
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/balance"},
+		{http.MethodGet, "/api/v1/ledger/entries"},
+		{http.MethodGet, "/api/v1/payouts"},
+		{http.MethodGet, "/api/v1/payouts/missing"},
+		{http.MethodPost, "/api/v1/payouts"},
+	} {
+		if w := doRequest(t, router, route.method, route.path, key, nil); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s without payouts scopes: status = %d, want 403", route.method, route.path, w.Code)
+		}
+	}
+	key = newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret, models.ScopePayoutsRead)
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/balance", key, nil); w.Code != http.StatusOK {
+		t.Errorf("GET /balance with payouts:read: status = %d, want 200", w.Code)
+	}
+}
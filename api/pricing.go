@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/models"
+	"algopay/pricing"
+)
+
+// priceFiatPayment converts a fiat-denominated request to base units of each
+// payment option and locks the quotes on the payment. It returns an error
+// when the request cannot be priced.
+func (s *Server) priceFiatPayment(ctx context.Context, req *models.PaymentRequest, payment *models.Payment) *requestError {
+	if s.prices == nil {
+		return &requestError{status: http.StatusBadRequest, message: "Fiat pricing is not enabled"}
+	}
+	for _, option := range payment.PaymentOptions {
+		if option.Amount != 0 || option.DisplayAmount != "" {
+			return &requestError{status: http.StatusBadRequest, message: "Specify either amount or fiat_amount, not both"}
+		}
+	}
+
+	currency, err := pricing.NormalizeCurrency(req.FiatCurrency)
+	if err != nil {
+		return &requestError{status: http.StatusBadRequest, message: "fiat_currency must be a three-letter currency code"}
+	}
+	if _, err := pricing.ParseDecimal(req.FiatAmount); err != nil {
+		return &requestError{status: http.StatusBadRequest, message: "fiat_amount must be a positive decimal string such as \"12.50\""}
+	}
+
+	var quotedAt time.Time
+	for i := range payment.PaymentOptions {
+		option := &payment.PaymentOptions[i]
+		quote, reqErr := s.quoteOption(ctx, option.AssetID, currency)
+		if reqErr != nil {
+			return reqErr
+		}
+
+		amount, err := pricing.ToBaseUnits(req.FiatAmount, quote, option.Decimals)
+		if err != nil || amount == 0 {
+			return &requestError{status: http.StatusBadRequest, message: "fiat_amount cannot be converted to a payable amount"}
+		}
+		option.Amount = amount
+		option.ExchangeRate = quote.Rate
+
+		// The payment records its oldest quote
+		if quotedAt.IsZero() || quote.Timestamp.Before(quotedAt) {
+			quotedAt = quote.Timestamp
+		}
+	}
+
+	payment.FiatAmount = req.FiatAmount
+	payment.FiatCurrency = currency
+	payment.RateSource = s.prices.Name()
+	payment.RateTimestamp = &quotedAt
+	return nil
+}
+
+// quoteOption fetches a fresh rate for an asset, returning an error when none
+// is available
+func (s *Server) quoteOption(ctx context.Context, assetID uint64, currency string) (*pricing.Quote, *requestError) {
+	quote, err := s.prices.Quote(ctx, assetID, currency)
+	if errors.Is(err, pricing.ErrRateUnavailable) {
+		return nil, &requestError{status: http.StatusBadRequest, message: "No exchange rate for asset " + strconv.FormatUint(assetID, 10) + " in " + currency}
+	}
+	if err != nil {
+		log.Printf("Error fetching exchange rate: %v", err)
+		return nil, &requestError{status: http.StatusBadGateway, message: "Price source unavailable"}
+	}
+
+	// Fixed rates keep their timestamp on the payment but are not held to the
+	// maximum age
+	maxAge := time.Duration(s.config.PriceMaxAge) * time.Second
+	if maxAge > 0 && !quote.Fixed && time.Since(quote.Timestamp) > maxAge {
+		log.Printf("Refusing stale %s rate for asset %d in %s from %s", quote.Source, assetID, currency, quote.Timestamp)
+		return nil, &requestError{status: http.StatusBadGateway, message: "Exchange rate is stale"}
+	}
+	return quote, nil
+}
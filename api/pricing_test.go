@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"algopay/config"
+	"algopay/pricing"
+)
+
+// TestQuoteOptionMaxAge checks PRICE_MAX_AGE refuses old http rates but not
+// a static price file's updated_at
+func TestQuoteOptionMaxAge(t *testing.T) {
+	staticSource := func(t *testing.T, updatedAt time.Time) *pricing.StaticSource {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "prices.json")
+		contents := `{"updated_at": "` + updatedAt.Format(time.RFC3339) + `", "rates": {"0": {"USD": "0.18"}}}`
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("write price file: %v", err)
+		}
+		source, err := pricing.NewStaticSource(path)
+		if err != nil {
+			t.Fatalf("NewStaticSource: %v", err)
+		}
+		return source
+	}
+	httpSource := func(t *testing.T, updatedAt time.Time) pricing.Source {
+		t.Helper()
+		stub := httptest.NewServer(pricing.StubHandler(staticSource(t, updatedAt)))
+		t.Cleanup(stub.Close)
+		source, err := pricing.NewHTTPSource(stub.URL, 5*time.Second)
+		if err != nil {
+			t.Fatalf("NewHTTPSource: %v", err)
+		}
+		return source
+	}
+
+	old := time.Now().Add(-time.Hour)
+	fresh := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name   string
+		source func(*testing.T, time.Time) pricing.Source
+		quoted time.Time
+		maxAge int
+		stale  bool
+	}{
+		{"static old", func(t *testing.T, at time.Time) pricing.Source { return staticSource(t, at) }, old, 300, false},
+		{"static fresh", func(t *testing.T, at time.Time) pricing.Source { return staticSource(t, at) }, fresh, 300, false},
+		{"http old", httpSource, old, 300, true},
+		{"http fresh", httpSource, fresh, 300, false},
+		{"http old without max age", httpSource, old, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &Server{
+				config: &config.Config{PriceMaxAge: test.maxAge},
+				prices: test.source(t, test.quoted),
+			}
+			quote, reqErr := server.quoteOption(context.Background(), 0, "USD")
+			if test.stale {
+				if reqErr == nil || reqErr.status != http.StatusBadGateway {
+					t.Fatalf("quoteOption = %+v, %+v, want a stale rate error", quote, reqErr)
+				}
+				return
+			}
+			if reqErr != nil {
+				t.Fatalf("quoteOption: %s", reqErr.message)
+			}
+			if quote.Rate != "0.18" || !quote.Timestamp.Equal(test.quoted.Truncate(time.Second)) {
+				t.Fatalf("quote = %+v", quote)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reconcileLag keeps scheduled runs clear of transfers the payment monitor
+// may not have matched yet
+const reconcileLag = 5 * time.Minute
+
+// createReconciliation handles running reconciliation over a window and
+// storing its report
+func (s *Server) createReconciliation(c *gin.Context) {
+	var window models.ReconciliationWindow
+	if err := c.ShouldBindJSON(&window); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := window.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := s.reconciler.Run(window)
+	if err != nil {
+		log.Printf("Error running reconciliation: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to run reconciliation: " + err.Error()})
+		return
+	}
+	if err := s.database.CreateReconciliationReport(report); err != nil {
+		log.Printf("Error storing reconciliation report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store reconciliation report"})
+		return
+	}
+	s.audit(c, models.AuditReconciliationStarted, models.AuditResourceReconciliation, report.ID, window.MerchantID, nil, window)
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// listReconciliations handles listing recent reconciliation reports
+func (s *Server) listReconciliations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(models.DefaultPageSize)))
+	if err != nil || limit < 1 || limit > models.MaxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(models.MaxPageSize)})
+		return
+	}
+
+	reports, err := s.database.ListReconciliationReports(limit)
+	if err != nil {
+		log.Printf("Error listing reconciliation reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list reconciliation reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// getReconciliation handles reconciliation report retrieval
+func (s *Server) getReconciliation(c *gin.Context) {
+	report, err := s.database.GetReconciliationReport(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reconciliation report not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting reconciliation report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reconciliation report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// runReconciliation periodically reconciles the most recent ReconcileWindow
+// seconds and stores the report
+func (s *Server) runReconciliation() {
+	if s.config.ReconcileInterval <= 0 {
+		log.Printf("Scheduled reconciliation disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.config.ReconcileInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			before := time.Now().Add(-reconcileLag)
+			after := before.Add(-time.Duration(s.config.ReconcileWindow) * time.Second)
+			s.reconcile(models.ReconciliationWindow{After: &after, Before: &before})
+		}
+	}
+}
+
+// reconcile runs and stores one scheduled reconciliation, logging what it found
+func (s *Server) reconcile(window models.ReconciliationWindow) {
+	report, err := s.reconciler.Run(window)
+	if err != nil {
+		log.Printf("Error running reconciliation: %v", err)
+		return
+	}
+	if err := s.database.CreateReconciliationReport(report); err != nil {
+		log.Printf("Error storing reconciliation report %s: %v", report.ID, err)
+	}
+
+	log.Printf("Reconciliation %s: %d transfers, %d payments, %d matched, %d discrepancies",
+		report.ID, report.TransfersChecked, report.PaymentsChecked, report.Matched, len(report.Discrepancies))
+	for _, discrepancy := range report.Discrepancies {
+		log.Printf("Reconciliation %s: %s in transaction %s", report.ID, discrepancy.Kind, discrepancy.TxnID)
+	}
+}
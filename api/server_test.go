@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"algopay/algorand"
+	"algopay/config"
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// testAdminKey authenticates the admin API of test servers
+const testAdminKey = "test-admin-key"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestServer returns a server on a fresh SQLite database without its
+// background workers. Its Algorand client points at an unreachable node, so
+// tests stick to ALGO payments and leave account checks off.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "algopay.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	algoClient, err := algorand.NewClient("http://127.0.0.1:1", "http://127.0.0.1:1", "")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	cfg := config.LoadConfig()
+	cfg.AdminAPIKey = testAdminKey
+	cfg.AccountChecks = false
+	cfg.ExportDir = t.TempDir()
+	return &Server{
+		database:    database,
+		algoClient:  algoClient,
+		config:      cfg,
+		webhooks:    newWebhookClient(cfg),
+		events:      newEventHub(),
+		paymentChan: make(chan *models.Payment, 100),
+		exportWake:  make(chan struct{}, 1),
+	}
+}
+
+// newTestMerchant stores a merchant accepting ALGO with a fresh receiving
+// address, after applying the given changes
+func newTestMerchant(t *testing.T, s *Server, changes ...func(*models.Merchant)) *models.Merchant {
+	t.Helper()
+	now := time.Now()
+	merchant := &models.Merchant{
+		ID:                uuid.New().String(),
+		DisplayName:       "Test Shop",
+		ReceivingAddress:  crypto.GenerateAccount().Address.String(),
+		AcceptedAssets:    []uint64{0},
+		LatePaymentAction: "manual",
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	for _, change := range changes {
+		change(merchant)
+	}
+	if err := s.database.CreateMerchant(merchant); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+	return merchant
+}
+
+// newTestKey stores an API key for the merchant and returns its plaintext;
+// without scopes the key gets every scope its type allows
+func newTestKey(t *testing.T, s *Server, merchantID string, keyType models.APIKeyType, scopes ...string) string {
+	t.Helper()
+	if len(scopes) == 0 {
+		scopes = models.AllScopes
+		if keyType == models.APIKeyTypePublishable {
+			scopes = models.PublishableScopes
+		}
+	}
+	plaintext, err := generateAPIKey(keyType)
+	if err != nil {
+		t.Fatalf("generateAPIKey: %v", err)
+	}
+	err = s.database.CreateAPIKey(&models.APIKey{
+		ID:         uuid.New().String(),
+		MerchantID: merchantID,
+		Type:       keyType,
+		Prefix:     plaintext[:12],
+		KeyHash:    hashAPIKey(plaintext),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return plaintext
+}
+
+// doRequest sends a request through the server's routes with the given key
+// and headers; a non-nil body is sent as JSON
+func doRequest(t *testing.T, router http.Handler, method, path, key string, body any, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// decodeBody decodes a JSON response into v
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", recorder.Body.String(), err)
+	}
+}
+
+// createTestPayment creates a payment through init-payment
+func createTestPayment(t *testing.T, router http.Handler, key string, req gin.H) models.PaymentResponse {
+	t.Helper()
+	w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("init-payment: status = %d, body %s", w.Code, w.Body)
+	}
+	var created models.PaymentResponse
+	decodeBody(t, w, &created)
+	return created
+}
+
+// fakeNode serves the algod endpoints payment creation uses: asset params and
+// the health of receiving accounts
+type fakeNode struct {
+	mu       sync.Mutex
+	assets   map[uint64]algorand.AssetInfo
+	accounts map[string]*fakeAccount
+}
+
+// fakeAccount is an account known to a fakeNode
+type fakeAccount struct {
+	amount   uint64
+	authAddr string
+	frozen   map[uint64]bool // asset holdings and whether each is frozen
+}
+
+// useFakeNode points the server's Algorand client at a fake node knowing the
+// given assets
+func useFakeNode(t *testing.T, s *Server, assets ...algorand.AssetInfo) *fakeNode {
+	t.Helper()
+	node := &fakeNode{assets: make(map[uint64]algorand.AssetInfo), accounts: make(map[string]*fakeAccount)}
+	for _, asset := range assets {
+		node.assets[asset.ID] = asset
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		node.mu.Lock()
+		asset, ok := node.assets[id]
+		node.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"message":"asset does not exist"}`, http.StatusNotFound)
+			return
+		}
+		writeNodeJSON(w, gin.H{"index": id, "params": gin.H{
+			"creator": crypto.GenerateAccount().Address.String(), "total": 1000000000,
+			"decimals": asset.Decimals, "unit-name": asset.UnitName, "name": asset.Name,
+		}})
+	})
+	mux.HandleFunc("GET /v2/accounts/{address}", func(w http.ResponseWriter, r *http.Request) {
+		account, ok := node.account(r.PathValue("address"))
+		if !ok {
+			writeNodeJSON(w, gin.H{"address": r.PathValue("address"), "amount": 0})
+			return
+		}
+		writeNodeJSON(w, gin.H{"address": r.PathValue("address"), "amount": account.amount, "auth-addr": account.authAddr})
+	})
+	mux.HandleFunc("GET /v2/accounts/{address}/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		account, ok := node.account(r.PathValue("address"))
+		frozen, optedIn := account.frozen[id]
+		if !ok || !optedIn {
+			http.Error(w, `{"message":"account asset info not found"}`, http.StatusNotFound)
+			return
+		}
+		writeNodeJSON(w, gin.H{"round": 1, "asset-holding": gin.H{"asset-id": id, "amount": 0, "is-frozen": frozen}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	algoClient, err := algorand.NewClient(server.URL, "http://127.0.0.1:1", "")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	s.algoClient = algoClient
+	return node
+}
+
+// setAccount records an account's balance, signer and asset holdings
+func (n *fakeNode) setAccount(address string, account *fakeAccount) {
+	n.mu.Lock()
+	n.accounts[address] = account
+	n.mu.Unlock()
+}
+
+// account returns a copy of a known account
+func (n *fakeNode) account(address string) (fakeAccount, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	account, ok := n.accounts[address]
+	if !ok {
+		return fakeAccount{}, false
+	}
+	return *account, true
+}
+
+// writeNodeJSON writes a node response
+func writeNodeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,443 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/algorand"
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// checkSplits validates a payment's split rules against its options. Payouts
+// are sent from the receiving address, so the gateway must hold its key.
+func (s *Server) checkSplits(merchant *models.Merchant, rules *models.SplitRules, options []models.PaymentOption) *requestError {
+	badRequest := func(msg string) *requestError {
+		return &requestError{status: http.StatusBadRequest, message: msg}
+	}
+
+	if err := rules.Validate(); err != nil {
+		return badRequest(err.Error())
+	}
+	if rules.HasFixedAmounts() && len(options) > 1 {
+		return badRequest("Fixed split amounts require a single payment option; use rates instead")
+	}
+	for _, option := range options {
+		if _, _, err := rules.Allocate(option.Amount); err != nil {
+			return badRequest(err.Error())
+		}
+	}
+
+	for i, recipient := range rules.Recipients {
+		position := strconv.Itoa(i + 1)
+		if err := s.algoClient.ValidateAddress(recipient.Address); err != nil {
+			return badRequest("Split recipient " + position + " has an invalid address")
+		}
+		if recipient.Address == merchant.ReceivingAddress {
+			return badRequest("Split recipient " + position + " is the receiving address")
+		}
+		if !s.config.AccountChecks {
+			continue
+		}
+		for _, option := range options {
+			if err := s.algoClient.CheckReceivable(recipient.Address, option.AssetID); err != nil {
+				return &requestError{
+					status:  http.StatusUnprocessableEntity,
+					message: "Split recipient " + position + " cannot receive asset " + strconv.FormatUint(option.AssetID, 10) + ": " + err.Error(),
+				}
+			}
+		}
+	}
+
+	if !s.algoClient.CanSign(merchant.ReceivingAddress) {
+		return &requestError{
+			status:  http.StatusUnprocessableEntity,
+			message: "Split payments require the receiving address to be in SIGNER_MNEMONICS",
+		}
+	}
+	return nil
+}
+
+// createSplitPayouts records the payouts of a payment that has just completed,
+// returning them for sending. Payments without splits have none.
+func (s *Server) createSplitPayouts(payment *models.Payment) []*models.SplitPayout {
+	if payment.Splits == nil {
+		return nil
+	}
+
+	assetID := payment.PaidAssetID()
+	_, shares, err := payment.Splits.Allocate(settledAmount(payment))
+	if err != nil {
+		log.Printf("Error allocating splits of payment %s: %v", payment.ID, err)
+		return nil
+	}
+
+	now := time.Now()
+	var payouts []*models.SplitPayout
+	for i, share := range shares {
+		if share == 0 {
+			continue
+		}
+		recipient := payment.Splits.Recipients[i]
+		payouts = append(payouts, &models.SplitPayout{
+			ID:         uuid.New().String(),
+			PaymentID:  payment.ID,
+			MerchantID: payment.MerchantID,
+			Position:   i,
+			Address:    recipient.Address,
+			Label:      recipient.Label,
+			AssetID:    assetID,
+			Amount:     share,
+			Status:     models.SplitPayoutPending,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+	}
+	if len(payouts) == 0 {
+		return nil
+	}
+
+	var reserved uint64
+	for _, payout := range payouts {
+		reserved += payout.Amount
+	}
+	entry := models.NewTransferEntry(payment.MerchantID, assetID, models.EntrySplitsReserved, payment.ID,
+		"Split payouts of payment "+payment.ID, models.LedgerSplitPayoutsPending, models.LedgerReceiving, reserved)
+
+	if err := s.database.CreateSplitPayouts(payouts, entry); err != nil {
+		log.Printf("Error recording split payouts of payment %s: %v", payment.ID, err)
+		return nil
+	}
+	// Reload in case the payouts were already recorded
+	payouts, err = s.database.GetSplitPayouts(payment.ID)
+	if err != nil {
+		log.Printf("Error loading split payouts of payment %s: %v", payment.ID, err)
+		return nil
+	}
+	return payouts
+}
+
+// sendSplitPayouts submits a payment's pending payouts as one atomic group.
+// The payouts are claimed with their transaction IDs before the group is
+// sent, so an interrupted send is resolved by confirmation, never by sending
+// the payouts twice.
+func (s *Server) sendSplitPayouts(payment *models.Payment, payouts []*models.SplitPayout) {
+	var pending []*models.SplitPayout
+	var transfers []algorand.Transfer
+	for _, payout := range payouts {
+		if payout.Status == models.SplitPayoutPending {
+			pending = append(pending, payout)
+			transfers = append(transfers, algorand.Transfer{To: payout.Address, Amount: payout.Amount, AssetID: payout.AssetID})
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	group, err := s.algoClient.SignGroup(payment.MerchantAddress, transfers, []byte("algopay split "+payment.ID))
+	if err != nil {
+		s.failSplitPayouts(payment, models.SplitPayoutPending, pending, err, true)
+		return
+	}
+
+	for i, payout := range pending {
+		payout.Status = models.SplitPayoutSubmitted
+		payout.TxnID = group.TxIDs[i]
+		payout.GroupID = group.GroupID
+		payout.Fee = group.Fees[i]
+		payout.LastValid = group.LastValid
+		payout.Attempts++
+		payout.Error = ""
+	}
+	err = s.database.UpdateSplitPayouts(models.SplitPayoutPending, pending)
+	if errors.Is(err, db.ErrSplitPayoutsChanged) {
+		// Another pass claimed the payouts first
+		return
+	}
+	if err != nil {
+		log.Printf("Error claiming split payouts of payment %s: %v", payment.ID, err)
+		return
+	}
+
+	err = s.algoClient.SendGroup(group)
+	if errors.Is(err, algorand.ErrGroupRejected) {
+		s.failSplitPayouts(payment, models.SplitPayoutSubmitted, pending, err, false)
+		return
+	}
+	if err != nil {
+		// The group may have reached the network; confirmation decides
+		log.Printf("Error sending split payouts of payment %s: %v", payment.ID, err)
+		return
+	}
+	log.Printf("Sent split payouts of payment %s in group %s", payment.ID, group.GroupID)
+}
+
+// failSplitPayouts records a failed attempt to send payouts, returning them to
+// pending for another attempt or marking them failed once attempts run out
+func (s *Server) failSplitPayouts(payment *models.Payment, from models.SplitPayoutStatus, payouts []*models.SplitPayout, cause error, countAttempt bool) {
+	log.Printf("Error sending split payouts of payment %s: %v", payment.ID, cause)
+
+	failed := false
+	for _, payout := range payouts {
+		if countAttempt {
+			payout.Attempts++
+		}
+		payout.Status = models.SplitPayoutPending
+		if payout.Attempts >= s.config.SplitPayoutMaxAttempts {
+			payout.Status = models.SplitPayoutFailed
+			failed = true
+		}
+		payout.TxnID = ""
+		payout.GroupID = ""
+		payout.Fee = 0
+		payout.LastValid = 0
+		payout.Error = cause.Error()
+	}
+
+	if err := s.database.UpdateSplitPayouts(from, payouts); err != nil {
+		if !errors.Is(err, db.ErrSplitPayoutsChanged) {
+			log.Printf("Error saving split payouts of payment %s: %v", payment.ID, err)
+		}
+		return
+	}
+	if failed {
+		s.notify(payment, models.EventPaymentSplitsFailed)
+	}
+}
+
+// runSplitPayouts periodically confirms submitted payouts and retries pending ones
+func (s *Server) runSplitPayouts() {
+	if s.config.SplitPayoutInterval <= 0 {
+		log.Printf("Split payout processor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(s.config.SplitPayoutInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.processSplitPayouts()
+		}
+	}
+}
+
+// processSplitPayouts runs one payout pass. Submitted groups are checked first
+// so expired ones can be resent in the same pass.
+func (s *Server) processSplitPayouts() {
+	submitted, err := s.database.GetPaymentsWithSplitPayouts(models.SplitPayoutSubmitted)
+	if err != nil {
+		log.Printf("Error loading submitted split payouts: %v", err)
+		return
+	}
+	for _, paymentID := range submitted {
+		s.confirmSplitPayouts(paymentID)
+	}
+
+	pending, err := s.database.GetPaymentsWithSplitPayouts(models.SplitPayoutPending)
+	if err != nil {
+		log.Printf("Error loading pending split payouts: %v", err)
+		return
+	}
+	for _, paymentID := range pending {
+		payment, payouts, err := s.loadSplitPayouts(paymentID)
+		if err != nil {
+			log.Printf("Error loading split payouts of payment %s: %v", paymentID, err)
+			continue
+		}
+		s.sendSplitPayouts(payment, payouts)
+	}
+}
+
+// confirmSplitPayouts checks whether a payment's submitted group was
+// confirmed. A group that expired unconfirmed goes back to pending.
+func (s *Server) confirmSplitPayouts(paymentID string) {
+	payment, payouts, err := s.loadSplitPayouts(paymentID)
+	if err != nil {
+		log.Printf("Error loading split payouts of payment %s: %v", paymentID, err)
+		return
+	}
+
+	var submitted []*models.SplitPayout
+	for _, payout := range payouts {
+		if payout.Status == models.SplitPayoutSubmitted {
+			submitted = append(submitted, payout)
+		}
+	}
+	if len(submitted) == 0 {
+		return
+	}
+
+	// The group is atomic, so its first transaction speaks for all of them
+	confirmed, expired, err := s.algoClient.CheckConfirmation(submitted[0].TxnID, submitted[0].LastValid)
+	if err != nil {
+		log.Printf("Error confirming split payouts of payment %s: %v", paymentID, err)
+		return
+	}
+	if expired {
+		s.failSplitPayouts(payment, models.SplitPayoutSubmitted, submitted,
+			errors.New("transaction group expired before it was confirmed"), false)
+		return
+	}
+	if !confirmed {
+		return
+	}
+
+	var paid, fees uint64
+	for _, payout := range submitted {
+		payout.Status = models.SplitPayoutConfirmed
+		paid += payout.Amount
+		fees += payout.Fee
+	}
+	groupID := submitted[0].GroupID
+	entries := []*models.JournalEntry{
+		models.NewTransferEntry(payment.MerchantID, submitted[0].AssetID, models.EntrySplitsPaid, groupID,
+			"Split payouts of payment "+paymentID, models.LedgerSplitPayouts, models.LedgerSplitPayoutsPending, paid),
+	}
+	if fee := networkFeeEntry(payment.MerchantID, groupID, "Fees for split payouts of payment "+paymentID, fees); fee != nil {
+		entries = append(entries, fee)
+	}
+	if err := s.database.UpdateSplitPayouts(models.SplitPayoutSubmitted, submitted, entries...); err != nil {
+		if !errors.Is(err, db.ErrSplitPayoutsChanged) {
+			log.Printf("Error saving split payouts of payment %s: %v", paymentID, err)
+		}
+		return
+	}
+
+	log.Printf("Split payouts of payment %s confirmed", paymentID)
+	s.notify(payment, models.EventPaymentSplitsPaid)
+}
+
+// loadSplitPayouts loads a payment and its payouts
+func (s *Server) loadSplitPayouts(paymentID string) (*models.Payment, []*models.SplitPayout, error) {
+	payouts, err := s.database.GetSplitPayouts(paymentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, nil, sql.ErrNoRows
+	}
+	payment, err := s.database.GetPayment(payouts[0].MerchantID, paymentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payment, payouts, nil
+}
+
+// splitReport describes how a payment was split, or returns nil before its
+// payouts exist
+func (s *Server) splitReport(payment *models.Payment) *models.SplitReport {
+	if payment.Splits == nil {
+		return nil
+	}
+	payouts, err := s.database.GetSplitPayouts(payment.ID)
+	if err != nil {
+		log.Printf("Error loading split payouts of payment %s: %v", payment.ID, err)
+		return nil
+	}
+	if len(payouts) == 0 {
+		return nil
+	}
+
+	report := &models.SplitReport{Payouts: make([]models.SplitPayout, len(payouts))}
+	report.Fee, _, _ = payment.Splits.Allocate(settledAmount(payment))
+	for i, payout := range payouts {
+		report.Payouts[i] = *payout
+	}
+	return report
+}
+
+// getPaymentSplits handles retrieving a payment's split rules and payouts
+func (s *Server) getPaymentSplits(c *gin.Context) {
+	payment, ok := s.loadSplitPayment(c)
+	if !ok {
+		return
+	}
+
+	report := s.splitReport(payment)
+	if report == nil {
+		report = &models.SplitReport{Payouts: []models.SplitPayout{}}
+	}
+	c.JSON(http.StatusOK, gin.H{"payment_id": payment.ID, "rules": payment.Splits, "fee": report.Fee, "payouts": report.Payouts})
+}
+
+// retrySplitPayouts handles resending payouts that were marked failed
+func (s *Server) retrySplitPayouts(c *gin.Context) {
+	payment, ok := s.loadSplitPayment(c)
+	if !ok {
+		return
+	}
+
+	payouts, err := s.database.GetSplitPayouts(payment.ID)
+	if err != nil {
+		log.Printf("Error loading split payouts of payment %s: %v", payment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry split payouts"})
+		return
+	}
+	var failed []*models.SplitPayout
+	for _, payout := range payouts {
+		if payout.Status == models.SplitPayoutFailed {
+			payout.Status = models.SplitPayoutPending
+			payout.Attempts = 0
+			failed = append(failed, payout)
+		}
+	}
+	if len(failed) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment has no failed split payouts"})
+		return
+	}
+
+	err = s.database.UpdateSplitPayouts(models.SplitPayoutFailed, failed)
+	if errors.Is(err, db.ErrSplitPayoutsChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Split payouts changed; try again"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving split payouts of payment %s: %v", payment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry split payouts"})
+		return
+	}
+
+	s.sendSplitPayouts(payment, payouts)
+	c.JSON(http.StatusOK, gin.H{"payment_id": payment.ID, "rules": payment.Splits, "payouts": payouts})
+}
+
+// loadSplitPayment loads the merchant's payment named in the request and
+// writes an error response unless it has split rules
+func (s *Server) loadSplitPayment(c *gin.Context) (*models.Payment, bool) {
+	payment, err := s.database.GetPayment(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error getting payment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment"})
+		return nil, false
+	}
+	if payment.Splits == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment has no splits"})
+		return nil, false
+	}
+	return payment, true
+}
+
+// settledAmount returns the amount of the option that settled a payment,
+// which is what its splits divide; overpayments stay with the merchant
+func settledAmount(payment *models.Payment) uint64 {
+	assetID := payment.PaidAssetID()
+	for _, option := range payment.Options() {
+		if option.AssetID == assetID {
+			return option.Amount
+		}
+	}
+	return payment.Amount
+}
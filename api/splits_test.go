@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"algopay/algorand"
+	"algopay/models"
+
+	"github.com/algorand/go-algorand-sdk/v2/crypto"
+	"github.com/algorand/go-algorand-sdk/v2/mnemonic"
+	"github.com/gin-gonic/gin"
+)
+
+// newSigningMerchant stores a merchant whose receiving address the server
+// holds the key for
+func newSigningMerchant(t *testing.T, s *Server, changes ...func(*models.Merchant)) *models.Merchant {
+	t.Helper()
+	account := crypto.GenerateAccount()
+	phrase, err := mnemonic.FromPrivateKey(account.PrivateKey)
+	if err != nil {
+		t.Fatalf("FromPrivateKey: %v", err)
+	}
+	keyring, err := algorand.NewKeyring([]string{phrase})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	s.algoClient.SetKeyring(keyring)
+
+	return newTestMerchant(t, s, append([]func(*models.Merchant){func(m *models.Merchant) {
+		m.ReceivingAddress = account.Address.String()
+	}}, changes...)...)
+}
+
+// splitsOf returns a payment's split payouts as served by the API
+func splitsOf(t *testing.T, router http.Handler, key, paymentID string) (uint64, []models.SplitPayout) {
+	t.Helper()
+	w := doRequest(t, router, http.MethodGet, "/api/v1/payment/"+paymentID+"/splits", key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET splits: status = %d, body %s", w.Code, w.Body)
+	}
+	var body struct {
+		Fee     uint64               `json:"fee"`
+		Payouts []models.SplitPayout `json:"payouts"`
+	}
+	decodeBody(t, w, &body)
+	return body.Fee, body.Payouts
+}
+
+// TestSplitPayments checks completed payments are divided between the
+// platform fee and their recipients, and failed payouts can be retried
+func TestSplitPayments(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newSigningMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	partner := crypto.GenerateAccount().Address.String()
+	courier := crypto.GenerateAccount().Address.String()
+
+	created := createTestPayment(t, router, key, gin.H{
+		"amount": 1000000,
+		"splits": gin.H{
+			"fee_rate": "2.5",
+			"recipients": []gin.H{
+				{"address": partner, "label": "partner", "rate": "33.3"},
+				{"address": courier, "amount": 100000},
+			},
+		},
+	})
+	if _, payouts := splitsOf(t, router, key, created.PaymentID); len(payouts) != 0 {
+		t.Fatalf("payouts before completion = %+v", payouts)
+	}
+
+	// The node is unreachable, so sending fails and the payouts wait for
+	// another attempt
+	deliverTransfer(t, s, merchant.ID, created.PaymentID, models.PaymentStatusCompleted)
+	fee, payouts := splitsOf(t, router, key, created.PaymentID)
+	// 2.5% of 1 ALGO is 25000; 33.3% of the remaining 975000 rounds down
+	if fee != 25000 || len(payouts) != 2 {
+		t.Fatalf("fee = %d, payouts = %+v", fee, payouts)
+	}
+	if p := payouts[0]; p.Address != partner || p.Label != "partner" || p.Amount != 324675 || p.Status != models.SplitPayoutPending || p.Attempts != 1 || p.Error == "" {
+		t.Errorf("partner payout = %+v", p)
+	}
+	if p := payouts[1]; p.Address != courier || p.Amount != 100000 || p.Position != 1 {
+		t.Errorf("courier payout = %+v", p)
+	}
+
+	s.config.SplitPayoutMaxAttempts = 2
+	s.processSplitPayouts()
+	if _, payouts := splitsOf(t, router, key, created.PaymentID); payouts[0].Status != models.SplitPayoutFailed || payouts[1].Status != models.SplitPayoutFailed {
+		t.Fatalf("payouts after the last attempt = %+v", payouts)
+	}
+
+	// Retrying starts the attempts over and sends the payouts straight away
+	w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/splits/retry", key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("retry: status = %d, body %s", w.Code, w.Body)
+	}
+	if _, payouts := splitsOf(t, router, key, created.PaymentID); payouts[0].Status != models.SplitPayoutPending || payouts[0].Attempts != 1 {
+		t.Fatalf("payouts after retry = %+v", payouts)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+created.PaymentID+"/splits/retry", key, nil); w.Code != http.StatusConflict {
+		t.Errorf("retry without failed payouts: status = %d, want 409", w.Code)
+	}
+
+	plain := createTestPayment(t, router, key, gin.H{"amount": 1000000})
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/payment/"+plain.PaymentID+"/splits", key, nil); w.Code != http.StatusNotFound {
+		t.Errorf("payment without splits: status = %d, want 404", w.Code)
+	}
+}
+
+// TestSplitValidation checks split rules are refused when they cannot be paid
+// out of the payment
+func TestSplitValidation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newSigningMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	partner := crypto.GenerateAccount().Address.String()
+
+	recipient := func(fields gin.H) gin.H {
+		r := gin.H{"address": partner, "rate": "10"}
+		for k, v := range fields {
+			r[k] = v
+		}
+		return r
+	}
+	tests := []struct {
+		name   string
+		splits gin.H
+	}{
+		{"no recipients", gin.H{"recipients": []gin.H{}}},
+		{"rate and amount", gin.H{"recipients": []gin.H{recipient(gin.H{"amount": 1})}}},
+		{"rates above 100%", gin.H{"recipients": []gin.H{recipient(gin.H{"rate": "60"}), recipient(gin.H{"rate": "40.01"})}}},
+		{"malformed rate", gin.H{"recipients": []gin.H{recipient(gin.H{"rate": "10%"})}}},
+		{"both fees", gin.H{"fee_rate": "1", "fee_amount": 1, "recipients": []gin.H{recipient(nil)}}},
+		{"shares above the amount", gin.H{"fee_amount": 500000, "recipients": []gin.H{{"address": partner, "amount": 500001}}}},
+		{"invalid address", gin.H{"recipients": []gin.H{recipient(gin.H{"address": "not-an-address"})}}},
+		{"receiving address", gin.H{"recipients": []gin.H{recipient(gin.H{"address": merchant.ReceivingAddress})}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, gin.H{"amount": 1000000, "splits": test.splits})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	// Payouts are signed by the receiving address
+	unsigned := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", unsigned, gin.H{"amount": 1000000, "splits": gin.H{"recipients": []gin.H{recipient(nil)}}})
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("receiving address without a key: status = %d, want 422", w.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Subscription limits
+const (
+	maxPlanLength      = 128
+	maxIntervalCount   = 365
+	maxDunningRetries  = 10
+	minDunningInterval = 60
+)
+
+// createSubscription handles subscription creation. A subscription whose
+// anchor date has arrived is invoiced immediately, so an invoice that cannot
+// be created fails the request.
+func (s *Server) createSubscription(c *gin.Context) {
+	var req models.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	merchant, err := s.database.GetMerchant(currentMerchantID(c))
+	if err != nil {
+		log.Printf("Error loading merchant %s: %v", currentMerchantID(c), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Merchant account not found"})
+		return
+	}
+
+	sub, reqErr := s.newSubscription(merchant, &req)
+	if reqErr != nil {
+		reqErr.respond(c)
+		return
+	}
+
+	var invoice *models.Payment
+	if !sub.NextBillingAt.After(time.Now()) {
+		invoice, reqErr = s.createSubscriptionInvoice(c.Request.Context(), merchant, sub)
+		if reqErr != nil {
+			reqErr.respond(c)
+			return
+		}
+		advanceSubscription(sub, invoice.ID)
+	}
+
+	if err := s.database.CreateSubscription(sub); err != nil {
+		log.Printf("Error creating subscription: %v", err)
+		if invoice != nil {
+			if _, err := s.store(c.Request.Context()).CancelPayment(merchant.ID, invoice.ID); err != nil {
+				log.Printf("Error cancelling invoice %s of unsaved subscription: %v", invoice.ID, err)
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	if invoice != nil {
+		s.notifySubscription(sub, models.EventSubscriptionInvoiceCreated, invoice.ID)
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+// listSubscriptions handles listing the merchant's subscriptions
+func (s *Server) listSubscriptions(c *gin.Context) {
+	status := models.SubscriptionStatus(c.Query("status"))
+	subs, err := s.database.ListSubscriptions(currentMerchantID(c), status)
+	if err != nil {
+		log.Printf("Error listing subscriptions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// getSubscription handles subscription retrieval
+func (s *Server) getSubscription(c *gin.Context) {
+	sub, ok := s.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// cancelSubscription handles cancelling a subscription. Its open invoice, if
+// any, is cancelled with it.
+func (s *Server) cancelSubscription(c *gin.Context) {
+	sub, ok := s.loadSubscription(c)
+	if !ok {
+		return
+	}
+	if sub.Status == models.SubscriptionStatusCancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Subscription is already cancelled"})
+		return
+	}
+
+	fromStatus, openPaymentID := sub.Status, sub.OpenPaymentID
+	now := time.Now()
+	sub.Status = models.SubscriptionStatusCancelled
+	sub.CancelledAt = &now
+	sub.OpenPaymentID = ""
+	sub.NextRetryAt = nil
+
+	err := s.database.SaveSubscriptionState(sub, fromStatus, openPaymentID)
+	if errors.Is(err, db.ErrSubscriptionChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Subscription changed while it was being cancelled; retry the request"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+		return
+	}
+
+	if openPaymentID != "" {
+		s.cancelSubscriptionInvoice(c.Request.Context(), sub, openPaymentID)
+	}
+	s.notifySubscription(sub, models.EventSubscriptionCancelled, "")
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// loadSubscription loads the merchant's subscription named in the request,
+// writing an error response if it cannot
+func (s *Server) loadSubscription(c *gin.Context) (*models.Subscription, bool) {
+	sub, err := s.database.GetSubscription(currentMerchantID(c), c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error getting subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get subscription"})
+		return nil, false
+	}
+	return sub, true
+}
+
+// newSubscription validates a subscription request and builds the
+// subscription, applying the server defaults
+func (s *Server) newSubscription(merchant *models.Merchant, req *models.SubscriptionRequest) (*models.Subscription, *requestError) {
+	now := time.Now()
+	sub := &models.Subscription{
+		ID:                     uuid.New().String(),
+		MerchantID:             merchant.ID,
+		Plan:                   req.Plan,
+		CustomerReference:      req.CustomerReference,
+		Amount:                 req.Amount,
+		AssetID:                req.AssetID,
+		IntervalUnit:           req.IntervalUnit,
+		IntervalCount:          req.IntervalCount,
+		AnchorDate:             now,
+		GracePeriodSeconds:     req.GracePeriodSeconds,
+		DunningRetries:         s.config.SubscriptionDunningRetries,
+		DunningIntervalSeconds: req.DunningIntervalSeconds,
+		CallbackURL:            req.CallbackURL,
+		Metadata:               req.Metadata,
+		Status:                 models.SubscriptionStatusActive,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+	}
+	badRequest := func(msg string) *requestError {
+		return &requestError{status: http.StatusBadRequest, message: msg}
+	}
+
+	if len(req.Plan) > maxPlanLength {
+		return nil, badRequest("plan must be at most " + strconv.Itoa(maxPlanLength) + " characters")
+	}
+	if err := validateOrderReference(req.CustomerReference); err != nil {
+		return nil, badRequest("customer_reference must be at most " + strconv.Itoa(maxOrderReferenceLength) + " characters")
+	}
+	if !merchant.AcceptsAsset(req.AssetID) {
+		return nil, &requestError{
+			status:  http.StatusBadRequest,
+			message: "Asset " + strconv.FormatUint(req.AssetID, 10) + " is not accepted by this merchant",
+			code:    codeAssetNotAccepted,
+		}
+	}
+
+	switch req.IntervalUnit {
+	case models.IntervalDay, models.IntervalWeek, models.IntervalMonth, models.IntervalYear:
+	default:
+		return nil, badRequest("interval_unit must be one of day, week, month or year")
+	}
+	if sub.IntervalCount == 0 {
+		sub.IntervalCount = 1
+	}
+	if sub.IntervalCount < 1 || sub.IntervalCount > maxIntervalCount {
+		return nil, badRequest("interval_count must be between 1 and " + strconv.Itoa(maxIntervalCount))
+	}
+
+	if req.AnchorDate != nil {
+		if req.AnchorDate.Before(now.Add(-time.Minute)) {
+			return nil, badRequest("anchor_date must not be in the past")
+		}
+		sub.AnchorDate = *req.AnchorDate
+	}
+	sub.NextBillingAt = sub.AnchorDate
+
+	// Each invoice stays payable for the grace period, so it must be a valid payment expiry
+	if sub.GracePeriodSeconds == 0 {
+		sub.GracePeriodSeconds = s.config.SubscriptionGracePeriod
+	}
+	minSeconds, maxSeconds := s.expiryBounds(merchant)
+	if sub.GracePeriodSeconds < minSeconds || sub.GracePeriodSeconds > maxSeconds {
+		return nil, badRequest("grace_period_seconds must be between " + strconv.Itoa(minSeconds) + " and " + strconv.Itoa(maxSeconds))
+	}
+
+	if req.DunningRetries != nil {
+		sub.DunningRetries = *req.DunningRetries
+	}
+	if sub.DunningRetries < 0 || sub.DunningRetries > maxDunningRetries {
+		return nil, badRequest("dunning_retries must be between 0 and " + strconv.Itoa(maxDunningRetries))
+	}
+	if sub.DunningIntervalSeconds == 0 {
+		sub.DunningIntervalSeconds = s.config.SubscriptionDunningInterval
+	}
+	if sub.DunningIntervalSeconds < minDunningInterval {
+		return nil, badRequest("dunning_interval_seconds must be at least " + strconv.Itoa(minDunningInterval))
+	}
+
+	if req.CallbackURL != "" {
+		if err := s.webhooks.ValidateURL(req.CallbackURL); err != nil {
+			return nil, badRequest("Invalid callback URL: " + err.Error())
+		}
+	}
+	if err := validateMetadata(req.Metadata, s.config.MetadataMaxBytes); err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSubscriptionState loads a subscription through the API
+func getSubscriptionState(t *testing.T, router http.Handler, key, id string) models.Subscription {
+	t.Helper()
+	w := doRequest(t, router, http.MethodGet, "/api/v1/subscriptions/"+id, key, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET subscription: status = %d", w.Code)
+	}
+	var sub models.Subscription
+	decodeBody(t, w, &sub)
+	return sub
+}
+
+// TestSubscriptionBilling checks a subscription is invoiced each period,
+// retried while past due and returned to active once paid
+func TestSubscriptionBilling(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+	ctx := context.Background()
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions", key, gin.H{
+		"plan": "pro", "amount": 1000000, "interval_unit": "month",
+		"dunning_retries": 1, "dunning_interval_seconds": 3600,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	var sub models.Subscription
+	decodeBody(t, w, &sub)
+	if sub.Status != models.SubscriptionStatusActive || sub.Period != 1 || sub.Attempt != 1 || sub.OpenPaymentID == "" ||
+		!sub.NextBillingAt.Equal(sub.BillingDate(1)) {
+		t.Fatalf("new subscription = %+v, want its first period invoiced", sub)
+	}
+	invoice, err := s.database.GetPayment(merchant.ID, sub.OpenPaymentID)
+	if err != nil || invoice.SubscriptionID != sub.ID || invoice.Amount != 1000000 || invoice.Status != models.PaymentStatusPending {
+		t.Fatalf("first invoice = %+v, %v", invoice, err)
+	}
+
+	// An unpaid invoice moves the subscription to past due and is retried
+	// after the dunning interval
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+invoice.ID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel invoice: status = %d", w.Code)
+	}
+	s.processSubscriptions(ctx, time.Now())
+	sub = getSubscriptionState(t, router, key, sub.ID)
+	if sub.Status != models.SubscriptionStatusPastDue || sub.OpenPaymentID != "" || sub.NextRetryAt == nil {
+		t.Fatalf("after an unpaid invoice: %+v", sub)
+	}
+	s.processSubscriptions(ctx, time.Now())
+	if retry := getSubscriptionState(t, router, key, sub.ID); retry.OpenPaymentID != "" {
+		t.Fatalf("retried before the dunning interval: %+v", retry)
+	}
+	s.processSubscriptions(ctx, sub.NextRetryAt.Add(time.Second))
+	sub = getSubscriptionState(t, router, key, sub.ID)
+	if sub.Status != models.SubscriptionStatusPastDue || sub.Period != 1 || sub.Attempt != 2 || sub.OpenPaymentID == "" {
+		t.Fatalf("after the retry: %+v", sub)
+	}
+
+	// Paying the retry settles the period
+	deliverTransfer(t, s, merchant.ID, sub.OpenPaymentID, models.PaymentStatusCompleted)
+	sub = getSubscriptionState(t, router, key, sub.ID)
+	if sub.Status != models.SubscriptionStatusActive || sub.OpenPaymentID != "" || sub.LastPaidAt == nil {
+		t.Fatalf("after payment: %+v", sub)
+	}
+
+	// The next period is invoiced once its billing date arrives
+	s.processSubscriptions(ctx, time.Now())
+	if sub := getSubscriptionState(t, router, key, sub.ID); sub.Period != 1 {
+		t.Fatalf("invoiced before the billing date: %+v", sub)
+	}
+	s.processSubscriptions(ctx, sub.NextBillingAt.Add(time.Second))
+	sub = getSubscriptionState(t, router, key, sub.ID)
+	if sub.Period != 2 || sub.Attempt != 1 || sub.OpenPaymentID == "" || !sub.NextBillingAt.Equal(sub.BillingDate(2)) {
+		t.Fatalf("second period: %+v", sub)
+	}
+
+	// Cancelling the subscription cancels its open invoice
+	openInvoice := sub.OpenPaymentID
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions/"+sub.ID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status = %d", w.Code)
+	}
+	if payment, err := s.database.GetPayment(merchant.ID, openInvoice); err != nil || payment.Status != models.PaymentStatusCancelled {
+		t.Fatalf("open invoice after cancelling = %+v, %v", payment, err)
+	}
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions/"+sub.ID+"/cancel", key, nil); w.Code != http.StatusConflict {
+		t.Errorf("cancelling twice: status = %d, want 409", w.Code)
+	}
+}
+
+// TestSubscriptionDunningExhausted checks a subscription is cancelled once its
+// retries are used up
+func TestSubscriptionDunningExhausted(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions", key, gin.H{
+		"plan": "basic", "amount": 1000000, "interval_unit": "week", "dunning_retries": 0,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body %s", w.Code, w.Body)
+	}
+	var sub models.Subscription
+	decodeBody(t, w, &sub)
+
+	if w := doRequest(t, router, http.MethodPost, "/api/v1/payment/"+sub.OpenPaymentID+"/cancel", key, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel invoice: status = %d", w.Code)
+	}
+	s.processSubscriptions(context.Background(), time.Now())
+	sub = getSubscriptionState(t, router, key, sub.ID)
+	if sub.Status != models.SubscriptionStatusCancelled || sub.CancelledAt == nil || sub.NextRetryAt != nil {
+		t.Fatalf("after the last attempt: %+v", sub)
+	}
+}
+
+// TestSubscriptionValidation checks subscription requests and their scoping
+func TestSubscriptionValidation(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	valid := func(changes gin.H) gin.H {
+		req := gin.H{"plan": "pro", "amount": 1000000, "interval_unit": "month"}
+		for k, v := range changes {
+			req[k] = v
+		}
+		return req
+	}
+	tests := []struct {
+		name string
+		req  gin.H
+	}{
+		{"missing plan", gin.H{"amount": 1000000, "interval_unit": "month"}},
+		{"unknown interval", valid(gin.H{"interval_unit": "fortnight"})},
+		{"interval count too large", valid(gin.H{"interval_count": maxIntervalCount + 1})},
+		{"anchor in the past", valid(gin.H{"anchor_date": time.Now().Add(-time.Hour)})},
+		{"grace period outside the expiry bounds", valid(gin.H{"grace_period_seconds": s.config.PaymentMaxExpiry + 1})},
+		{"too many retries", valid(gin.H{"dunning_retries": maxDunningRetries + 1})},
+		{"short dunning interval", valid(gin.H{"dunning_interval_seconds": minDunningInterval - 1})},
+		{"asset not accepted", valid(gin.H{"asset_id": 31566704})},
+		{"private callback", valid(gin.H{"callback_url": "http://127.0.0.1/hook"})},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions", key, test.req); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	// A future anchor date is not invoiced until it arrives
+	anchor := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	w := doRequest(t, router, http.MethodPost, "/api/v1/subscriptions", key, valid(gin.H{"anchor_date": anchor}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create with an anchor date: status = %d, body %s", w.Code, w.Body)
+	}
+	var sub models.Subscription
+	decodeBody(t, w, &sub)
+	if sub.Period != 0 || sub.OpenPaymentID != "" || !sub.NextBillingAt.Equal(anchor) {
+		t.Fatalf("subscription anchored later = %+v", sub)
+	}
+
+	var list struct {
+		Subscriptions []models.Subscription `json:"subscriptions"`
+	}
+	other := newTestKey(t, s, newTestMerchant(t, s).ID, models.APIKeyTypeSecret)
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/subscriptions", other, nil), &list)
+	if len(list.Subscriptions) != 0 {
+		t.Errorf("another merchant listed %d subscriptions", len(list.Subscriptions))
+	}
+	if w := doRequest(t, router, http.MethodGet, "/api/v1/subscriptions/"+sub.ID, other, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another merchant's subscription: status = %d, want 404", w.Code)
+	}
+}
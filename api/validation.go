@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"algopay/models"
+)
+
+// Metadata limits
+const (
+	maxMetadataKeys         = 50
+	maxOrderReferenceLength = 128
+)
+
+// metadataKeyPattern restricts metadata keys so they can be used in filters
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,40}$`)
+
+// validateMetadata checks the key count, key format and encoded size of payment metadata
+func validateMetadata(metadata map[string]interface{}, maxBytes int) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata may have at most %d keys", maxMetadataKeys)
+	}
+	for key := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("metadata key %q must be 1-40 characters of letters, digits, '_', '.' or '-'", key)
+		}
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("metadata must be a JSON object")
+	}
+	if len(data) > maxBytes {
+		return fmt.Errorf("metadata must be at most %d bytes when encoded", maxBytes)
+	}
+	return nil
+}
+
+// validateOrderReference checks the length of an order reference
+func validateOrderReference(orderReference string) error {
+	if len(orderReference) > maxOrderReferenceLength {
+		return fmt.Errorf("order_reference must be at most %d characters", maxOrderReferenceLength)
+	}
+	return nil
+}
+
+// requestedOptions returns the payment options of a request, returning a
+// client-facing error message if they are invalid. A request without
+// payment_options has a single option made of its asset_id and amount.
+func requestedOptions(req *models.PaymentRequest) ([]models.PaymentOption, string) {
+	if len(req.PaymentOptions) == 0 {
+		option := models.PaymentOption{AssetID: req.AssetID, Amount: req.Amount, DisplayAmount: req.DisplayAmount}
+		if option.Amount != 0 && option.DisplayAmount != "" {
+			return nil, "Use either amount or display_amount"
+		}
+		return []models.PaymentOption{option}, ""
+	}
+	if req.Amount != 0 || req.DisplayAmount != "" || req.AssetID != 0 {
+		return nil, "Use either payment_options or asset_id and amount"
+	}
+	if len(req.PaymentOptions) > models.MaxPaymentOptions {
+		return nil, fmt.Sprintf("At most %d payment options are allowed", models.MaxPaymentOptions)
+	}
+
+	options := make([]models.PaymentOption, 0, len(req.PaymentOptions))
+	seen := make(map[uint64]bool)
+	for _, option := range req.PaymentOptions {
+		if seen[option.AssetID] {
+			return nil, fmt.Sprintf("Asset %d appears in more than one payment option", option.AssetID)
+		}
+		seen[option.AssetID] = true
+		if option.Amount != 0 && option.DisplayAmount != "" {
+			return nil, fmt.Sprintf("Payment option for asset %d has both amount and display_amount", option.AssetID)
+		}
+		// Asset params and rates are only ever set by the gateway
+		options = append(options, models.PaymentOption{AssetID: option.AssetID, Amount: option.Amount, DisplayAmount: option.DisplayAmount})
+	}
+	return options, ""
+}
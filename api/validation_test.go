@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"algopay/algorand"
+	"algopay/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestPaymentReferences checks metadata and order references are stored with
+// the payment and validated on creation
+func TestPaymentReferences(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	merchant := newTestMerchant(t, s)
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	metadata := gin.H{"customer_id": "cus_123", "cart.items": float64(3), "gift": true}
+	created := createTestPayment(t, router, key, gin.H{"amount": 1000000, "order_reference": "ORD-42", "metadata": metadata})
+	if created.OrderReference != "ORD-42" || created.Metadata["customer_id"] != "cus_123" {
+		t.Fatalf("created payment = %+v", created)
+	}
+
+	var payment models.Payment
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID, key, nil), &payment)
+	if payment.OrderReference != "ORD-42" || len(payment.Metadata) != len(metadata) {
+		t.Fatalf("stored payment = %+v", payment)
+	}
+	for k, v := range metadata {
+		if payment.Metadata[k] != v {
+			t.Errorf("metadata[%s] = %v, want %v", k, payment.Metadata[k], v)
+		}
+	}
+
+	manyKeys := gin.H{}
+	for i := 0; i <= maxMetadataKeys; i++ {
+		manyKeys[fmt.Sprintf("key%d", i)] = i
+	}
+	tests := []struct {
+		name string
+		req  gin.H
+	}{
+		{"long order reference", gin.H{"order_reference": strings.Repeat("a", maxOrderReferenceLength+1)}},
+		{"too many keys", gin.H{"metadata": manyKeys}},
+		{"key with spaces", gin.H{"metadata": gin.H{"customer id": "x"}}},
+		{"empty key", gin.H{"metadata": gin.H{"": "x"}}},
+		{"long key", gin.H{"metadata": gin.H{strings.Repeat("k", 41): "x"}}},
+		{"too large", gin.H{"metadata": gin.H{"notes": strings.Repeat("x", s.config.MetadataMaxBytes)}}},
+		{"not an object", gin.H{"metadata": []string{"x"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.req["amount"] = 1000000
+			if w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, test.req); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// TestPaymentOptions checks payments accepting several assets list each
+// accepted option, with the first as the primary asset
+func TestPaymentOptions(t *testing.T) {
+	s := newTestServer(t)
+	router := s.SetupRoutes()
+	usdc := algorand.AssetInfo{ID: 31566704, Name: "USDC", UnitName: "USDC", Decimals: 6}
+	useFakeNode(t, s, usdc)
+	merchant := newTestMerchant(t, s, func(m *models.Merchant) {
+		m.AcceptedAssets = []uint64{0, usdc.ID}
+	})
+	key := newTestKey(t, s, merchant.ID, models.APIKeyTypeSecret)
+
+	created := createTestPayment(t, router, key, gin.H{"payment_options": []gin.H{
+		{"asset_id": usdc.ID, "amount": 2500000},
+		{"asset_id": 0, "amount": 10000000},
+	}})
+	if created.AssetID != usdc.ID || created.Amount != 2500000 || len(created.PaymentOptions) != 2 ||
+		created.PaymentOptions[1].AssetID != 0 || created.PaymentOptions[1].Amount != 10000000 {
+		t.Fatalf("created payment = %+v", created)
+	}
+
+	var payment models.Payment
+	decodeBody(t, doRequest(t, router, http.MethodGet, "/api/v1/payment/"+created.PaymentID, key, nil), &payment)
+	if len(payment.PaymentOptions) != 2 || payment.PaymentOptions[0].AssetID != usdc.ID || payment.SettledAssetID != nil {
+		t.Fatalf("stored payment = %+v", payment)
+	}
+
+	tooMany := make([]gin.H, models.MaxPaymentOptions+1)
+	for i := range tooMany {
+		tooMany[i] = gin.H{"asset_id": i, "amount": 1}
+	}
+	tests := []struct {
+		name string
+		req  gin.H
+		code string
+	}{
+		{"repeated asset", gin.H{"payment_options": []gin.H{{"asset_id": 0, "amount": 1}, {"asset_id": 0, "amount": 2}}}, ""},
+		{"options with an amount", gin.H{"amount": 1, "payment_options": []gin.H{{"asset_id": 0, "amount": 1}}}, ""},
+		{"too many options", gin.H{"payment_options": tooMany}, ""},
+		{"zero amount", gin.H{"payment_options": []gin.H{{"asset_id": 0, "amount": 1}, {"asset_id": usdc.ID}}}, ""},
+		{"asset not accepted", gin.H{"payment_options": []gin.H{{"asset_id": 0, "amount": 1}, {"asset_id": 386192725, "amount": 1}}}, codeAssetNotAccepted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := doRequest(t, router, http.MethodPost, "/api/v1/init-payment", key, test.req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body %s", w.Code, w.Body)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			decodeBody(t, w, &body)
+			if body.Code != test.code {
+				t.Errorf("code = %q, want %q", body.Code, test.code)
+			}
+		})
+	}
+}
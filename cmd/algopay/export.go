@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"algopay/config"
+	"algopay/export"
+	"algopay/models"
+)
+
+// runExport implements `algopay export`, which streams a dataset to a file
+// or standard output without going through the job queue. It exits 0 on
+// success and 1 on failure.
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	var (
+		envFile    = flags.String("env", ".env", "Path to environment file")
+		dataset    = flags.String("dataset", "", "Dataset to export: payments, transactions, refunds, fees or audit")
+		format     = flags.String("format", "csv", "Output format: csv, jsonl or parquet")
+		merchantID = flags.String("merchant", "", "Only export this merchant's records")
+		from       = flags.String("from", "", "Start of the range, as a date or RFC 3339 time")
+		to         = flags.String("to", "", "End of the range, as a date (inclusive) or RFC 3339 time (exclusive)")
+		month      = flags.String("month", "", "Export one calendar month, as YYYY-MM, instead of -from and -to")
+		output     = flags.String("o", "-", "Output file, or - for standard output")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	req := models.ExportRequest{
+		Dataset: models.ExportDataset(*dataset),
+		Format:  models.ExportFormat(*format),
+		From:    *from,
+		To:      *to,
+	}
+	if err := req.Validate(); err != nil {
+		log.Printf("Invalid export: %v", err)
+		return 1
+	}
+	filter := models.ExportFilter{MerchantID: *merchantID}
+	if *month != "" {
+		if *from != "" || *to != "" {
+			log.Printf("Invalid export: -month cannot be combined with -from or -to")
+			return 1
+		}
+		start, err := time.Parse("2006-01", *month)
+		if err != nil {
+			log.Printf("Invalid -month: %q is not YYYY-MM", *month)
+			return 1
+		}
+		end := start.AddDate(0, 1, 0)
+		filter.From, filter.To = &start, &end
+	} else {
+		var err error
+		if filter.From, filter.To, err = req.Range(); err != nil {
+			log.Printf("Invalid export: %v", err)
+			return 1
+		}
+	}
+
+	loadEnvFile(*envFile)
+	cfg := config.LoadConfig()
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer database.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Printf("Failed to create %s: %v", *output, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	opts := export.Options{Dataset: req.Dataset, Format: req.Format, Filter: filter}
+	rows, err := export.Write(database, opts, w)
+	if err != nil {
+		log.Printf("Export failed after %d rows: %v", rows, err)
+		return 1
+	}
+	if file, ok := w.(*os.File); ok && file != os.Stdout {
+		if err := file.Close(); err != nil {
+			log.Printf("Failed to write %s: %v", *output, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d %s rows to %s\n", rows, req.Dataset, *output)
+	}
+	return 0
+}
@@ -5,16 +5,28 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
-	"algopay/algorand"
 	"algopay/api"
 	"algopay/config"
-	"algopay/db"
-
-	"github.com/joho/godotenv"
+	"algopay/pricing"
 )
 
+// commands maps subcommand names to their entry points, which return the
+// process exit code; without a subcommand the server runs
+var commands = map[string]func(args []string) int{
+	"export":    runExport,
+	"migrate":   runMigrate,
+	"reconcile": runReconcile,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	// Parse command line flags
 	var (
 		envFile = flag.String("env", ".env", "Path to environment file")
@@ -23,11 +35,7 @@ func main() {
 	flag.Parse()
 
 	// Load environment file if it exists
-	if _, err := os.Stat(*envFile); err == nil {
-		if err := godotenv.Load(*envFile); err != nil {
-			log.Printf("Warning: Error loading %s file: %v", *envFile, err)
-		}
-	}
+	loadEnvFile(*envFile)
 
 	// Load configuration
 	cfg := config.LoadConfig()
@@ -38,20 +46,26 @@ func main() {
 	}
 
 	// Initialize database
-	database, err := db.NewDatabase(cfg.DatabasePath)
+	database, err := openDatabase(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.Close()
 
-	// Initialize Algorand client
-	algoClient, err := algorand.NewClient(cfg.AlgoNodeURL, cfg.AlgoIndexerURL, cfg.AlgoToken)
+	// Initialize Algorand client with the signing keys for refunds and payouts
+	algoClient, err := newAlgorandClient(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize Algorand client: %v", err)
 	}
 
+	// Initialize the fiat price source
+	prices, err := pricing.NewSource(cfg.PriceSource, cfg.PriceFile, cfg.PriceURL, 10*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to initialize price source: %v", err)
+	}
+
 	// Create API server
-	server := api.NewServer(database, algoClient, cfg)
+	server := api.NewServer(database, algoClient, prices, cfg)
 
 	// Setup routes
 	router := server.SetupRoutes()
@@ -67,11 +81,50 @@ func main() {
 	fmt.Printf("   POST /api/v1/init-payment     - Initialize new payment\n")
 	fmt.Printf("   GET  /api/v1/check-payment/:id - Check payment status\n")
 	fmt.Printf("   GET  /api/v1/payment/:id       - Get payment details\n")
+	fmt.Printf("   GET  /api/v1/payment/:id/events - Stream payment events\n")
+	fmt.Printf("   GET  /api/v1/payments          - List payments\n")
+	fmt.Printf("   POST /api/v1/payment/:id/cancel - Cancel payment\n")
+	fmt.Printf("   POST /api/v1/payment/:id/extend - Extend payment expiry\n")
+	fmt.Printf("   POST /api/v1/payment/:id/accept - Accept late payment\n")
+	fmt.Printf("   POST /api/v1/payment/:id/refund - Refund late payment\n")
+	fmt.Printf("   GET  /api/v1/payment/:id/splits - Get split payouts\n")
+	fmt.Printf("   POST /api/v1/subscriptions     - Create subscription\n")
+	fmt.Printf("   GET  /api/v1/subscriptions     - List subscriptions\n")
+	fmt.Printf("   GET  /api/v1/subscriptions/:id - Get subscription\n")
+	fmt.Printf("   POST /api/v1/subscriptions/:id/cancel - Cancel subscription\n")
+	fmt.Printf("   POST /api/v1/payment-links     - Create payment link\n")
+	fmt.Printf("   GET  /api/v1/payment-links     - List payment links\n")
+	fmt.Printf("   PUT  /api/v1/payment-links/:id - Update payment link\n")
+	fmt.Printf("   POST /api/v1/payment-links/:id/payments - Pay with link\n")
+	fmt.Printf("   POST /api/v1/invoices          - Create invoice\n")
+	fmt.Printf("   GET  /api/v1/invoices          - List invoices\n")
+	fmt.Printf("   GET  /api/v1/invoices/:id      - Get invoice\n")
+	fmt.Printf("   GET  /api/v1/invoices/:id/pdf  - Download invoice PDF\n")
+	fmt.Printf("   GET  /api/v1/balance           - Get merchant balance\n")
+	fmt.Printf("   GET  /api/v1/ledger/entries    - List ledger entries\n")
+	fmt.Printf("   POST /api/v1/payouts           - Request payout\n")
+	fmt.Printf("   GET  /api/v1/payouts           - List payouts\n")
+	fmt.Printf("   POST /api/v1/exports           - Start export\n")
+	fmt.Printf("   GET  /api/v1/exports           - List exports\n")
+	fmt.Printf("   GET  /api/v1/exports/:id/download - Download export\n")
+	fmt.Printf("   GET  /l/:slug                  - Public payment link page\n")
 	fmt.Printf("   GET  /health                   - Health check\n")
+	if cfg.AdminAPIKey != "" {
+		fmt.Printf("\n🔐 Admin Endpoints:\n")
+		fmt.Printf("   POST   /api/v1/admin/merchants    - Create merchant\n")
+		fmt.Printf("   GET    /api/v1/admin/merchants    - List merchants\n")
+		fmt.Printf("   PUT    /api/v1/admin/merchants/:id - Update merchant\n")
+		fmt.Printf("   POST   /api/v1/admin/reconciliations - Run reconciliation\n")
+		fmt.Printf("   GET    /api/v1/admin/reconciliations - List reconciliation reports\n")
+		fmt.Printf("   POST   /api/v1/admin/exports      - Start export\n")
+		fmt.Printf("   POST   /api/v1/admin/api-keys     - Create API key\n")
+		fmt.Printf("   GET    /api/v1/admin/api-keys     - List merchant API keys\n")
+		fmt.Printf("   DELETE /api/v1/admin/api-keys/:id - Revoke API key\n")
+	}
 	fmt.Printf("\n🌟 Server running on http://localhost:%s\n", cfg.Port)
 
 	// Start server
 	if err := router.Run(":" + cfg.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
-}
\ No newline at end of file
+}
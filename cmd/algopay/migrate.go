@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"algopay/config"
+	"algopay/db"
+)
+
+// runMigrate implements `algopay migrate`, which applies pending schema
+// migrations, prints their SQL without applying them, or lists the applied
+// ones. It exits 0 on success and 1 on failure, including when an applied
+// migration has drifted from this build's copy.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var (
+		envFile = flags.String("env", ".env", "Path to environment file")
+		dryRun  = flags.Bool("dry-run", false, "Print the SQL of pending migrations without applying them")
+		status  = flags.Bool("status", false, "List applied and pending migrations")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if *dryRun && *status {
+		log.Printf("-dry-run cannot be combined with -status")
+		return 1
+	}
+
+	loadEnvFile(*envFile)
+	cfg := config.LoadConfig()
+
+	database, err := db.Open(cfg.DatabaseURL, cfg.DatabasePath)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer database.Close()
+
+	switch {
+	case *status:
+		return printMigrationStatus(database)
+	case *dryRun:
+		pending, err := database.PendingMigrations()
+		if err != nil {
+			log.Printf("Failed to check migrations: %v", err)
+			return 1
+		}
+		if len(pending) == 0 {
+			fmt.Fprintln(os.Stderr, "Schema is up to date")
+			return 0
+		}
+		for _, migration := range pending {
+			fmt.Printf("-- %04d_%s.sql (sha256 %s)\n%s\n", migration.Version, migration.Name, migration.Checksum, migration.SQL)
+		}
+		return 0
+	}
+
+	applied, err := database.Migrate()
+	for _, migration := range applied {
+		fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		log.Printf("Migration failed: %v", err)
+		return 1
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date")
+	}
+	return 0
+}
+
+// printMigrationStatus lists every migration this build knows with when it
+// was applied, and fails on drift
+func printMigrationStatus(database *db.Database) int {
+	migrations, err := database.Migrations()
+	if err != nil {
+		log.Printf("Failed to load migrations: %v", err)
+		return 1
+	}
+	applied, err := database.AppliedMigrations()
+	if err != nil {
+		log.Printf("Failed to read schema_version: %v", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for i, migration := range migrations {
+		state := "pending"
+		if i < len(applied) {
+			state = applied[i].AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", migration.Version, migration.Name, state)
+	}
+	w.Flush()
+
+	if _, err := database.PendingMigrations(); err != nil {
+		log.Printf("Schema check failed: %v", err)
+		return 1
+	}
+	return 0
+}
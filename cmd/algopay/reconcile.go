@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"algopay/config"
+	"algopay/models"
+	"algopay/reconcile"
+)
+
+// runReconcile implements `algopay reconcile`, which compares stored payments
+// with the chain over a round range or time window. It exits 0 when
+// everything matches, 2 when discrepancies were found and 1 on failure.
+func runReconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	var (
+		envFile    = flags.String("env", ".env", "Path to environment file")
+		merchantID = flags.String("merchant", "", "Only reconcile this merchant")
+		minRound   = flags.Uint64("from-round", 0, "First round to reconcile")
+		maxRound   = flags.Uint64("to-round", 0, "Last round to reconcile")
+		since      = flags.String("since", "", "Start of the time window, as RFC 3339 or a duration ago such as 24h")
+		until      = flags.String("until", "", "End of the time window, as RFC 3339 or a duration ago")
+		asJSON     = flags.Bool("json", false, "Print the report as JSON")
+		save       = flags.Bool("save", false, "Store the report in the database")
+	)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	window := models.ReconciliationWindow{MerchantID: *merchantID, MinRound: *minRound, MaxRound: *maxRound}
+	var err error
+	if window.After, err = parseWindowTime(*since); err != nil {
+		log.Printf("Invalid -since: %v", err)
+		return 1
+	}
+	if window.Before, err = parseWindowTime(*until); err != nil {
+		log.Printf("Invalid -until: %v", err)
+		return 1
+	}
+	if err := window.Validate(); err != nil {
+		log.Printf("Invalid window: %v", err)
+		return 1
+	}
+
+	loadEnvFile(*envFile)
+	cfg := config.LoadConfig()
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer database.Close()
+
+	algoClient, err := newAlgorandClient(cfg)
+	if err != nil {
+		log.Printf("Failed to initialize Algorand client: %v", err)
+		return 1
+	}
+
+	report, err := reconcile.New(database, algoClient).Run(window)
+	if err != nil {
+		log.Printf("Reconciliation failed: %v", err)
+		return 1
+	}
+	if *save {
+		if err := database.CreateReconciliationReport(report); err != nil {
+			log.Printf("Failed to store reconciliation report: %v", err)
+			return 1
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Printf("Failed to write report: %v", err)
+			return 1
+		}
+	} else {
+		printReconciliationReport(report)
+	}
+
+	if len(report.Discrepancies) > 0 {
+		return 2
+	}
+	return 0
+}
+
+// parseWindowTime parses an RFC 3339 time or a duration before now; an empty
+// value leaves the bound open
+func parseWindowTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		t := time.Now().Add(-ago)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// printReconciliationReport writes a report as text
+func printReconciliationReport(report *models.ReconciliationReport) {
+	fmt.Printf("Reconciliation %s\n", report.ID)
+	fmt.Printf("Addresses: %d  Transfers: %d  Payments: %d  Matched: %d\n",
+		report.Addresses, report.TransfersChecked, report.PaymentsChecked, report.Matched)
+	fmt.Printf("Discrepancies: %d\n", len(report.Discrepancies))
+	if len(report.Discrepancies) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nKIND\tTXN\tPAYMENTS\tMERCHANT\tASSET\tAMOUNT\tEXPECTED\tACTUAL")
+	for _, d := range report.Discrepancies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", d.Kind, d.TxnID, strings.Join(d.PaymentIDs, ","),
+			d.MerchantID, d.AssetID, d.Amount, d.Expected, d.Actual)
+	}
+	w.Flush()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"algopay/algorand"
+	"algopay/config"
+	"algopay/db"
+
+	"github.com/joho/godotenv"
+)
+
+// loadEnvFile loads environment variables from a file if it exists
+func loadEnvFile(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if err := godotenv.Load(path); err != nil {
+		log.Printf("Warning: Error loading %s file: %v", path, err)
+	}
+}
+
+// newAlgorandClient creates the Algorand client described by the configuration
+func newAlgorandClient(cfg *config.Config) (*algorand.Client, error) {
+	algoClient, err := algorand.NewClient(cfg.AlgoNodeURL, cfg.AlgoIndexerURL, cfg.AlgoToken)
+	if err != nil {
+		return nil, err
+	}
+
+	algoClient.SetAssetCacheTTL(time.Duration(cfg.AssetCacheTTL) * time.Second)
+	algoClient.SetAccountCacheTTL(time.Duration(cfg.AccountCacheTTL) * time.Second)
+
+	keyring, err := algorand.NewKeyring(cfg.SignerMnemonics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signer mnemonics: %w", err)
+	}
+	algoClient.SetKeyring(keyring)
+	return algoClient, nil
+}
+
+// openDatabase opens the configured database and brings its schema up to
+// date. With AUTO_MIGRATE off, pending migrations are an error instead, so
+// nothing runs against an outdated schema.
+func openDatabase(cfg *config.Config) (*db.Database, error) {
+	database, err := db.Open(cfg.DatabaseURL, cfg.DatabasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AutoMigrate {
+		applied, err := database.Migrate()
+		for _, migration := range applied {
+			log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+		return database, nil
+	}
+
+	pending, err := database.PendingMigrations()
+	if err == nil && len(pending) > 0 {
+		err = fmt.Errorf("%d pending migrations; run `algopay migrate` or set AUTO_MIGRATE=true", len(pending))
+	}
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
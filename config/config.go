@@ -3,33 +3,145 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds application configuration
 type Config struct {
 	Port           string
 	DatabasePath   string
+	DatabaseURL    string
+	AutoMigrate    bool // apply pending schema migrations at startup
 	AlgoNodeURL    string
 	AlgoIndexerURL string
 	AlgoToken      string
 	PaymentTimeout int // in minutes
+
+	// Bounds for per-payment expires_in_seconds, in seconds; merchants may override them
+	PaymentMinExpiry int
+	PaymentMaxExpiry int
+
+	// MetadataMaxBytes bounds the JSON-encoded size of payment metadata
+	MetadataMaxBytes int
+
+	// IdempotencyTTL is how long Idempotency-Key responses are kept, in hours
+	IdempotencyTTL int
+
+	// AdminAPIKey authenticates the admin API; admin routes are disabled when empty
+	AdminAPIKey string
+
+	// LatePaymentGrace is how long expired and cancelled payments are still
+	// watched for late transfers, in minutes
+	LatePaymentGrace int
+
+	// SignerMnemonics are account mnemonics the gateway may send refunds and
+	// split payouts from
+	SignerMnemonics []string
+
+	// AssetCacheTTL is how long asset params are cached, in seconds
+	AssetCacheTTL int
+
+	// Merchant account checks at invoice creation
+	AccountChecks        bool
+	AccountCacheTTL      int // in seconds
+	AllowRekeyedAccounts bool
+
+	// Fiat pricing: PriceSource is "static", "http" or empty to disable fiat invoices
+	PriceSource string
+	PriceFile   string
+	PriceURL    string
+	PriceMaxAge int // seconds an http quote may be old before it is refused
+
+	// Subscription billing: the scheduler runs every SubscriptionInterval
+	// seconds; the rest are defaults for new subscriptions
+	SubscriptionInterval        int
+	SubscriptionGracePeriod     int // seconds an invoice stays payable
+	SubscriptionDunningRetries  int // invoices reissued after the first goes unpaid
+	SubscriptionDunningInterval int // seconds between an unpaid invoice and its retry
+
+	// Split payouts: pending and submitted payouts are processed every
+	// SplitPayoutInterval seconds and abandoned after SplitPayoutMaxAttempts
+	// failed submissions
+	SplitPayoutInterval    int
+	SplitPayoutMaxAttempts int
+
+	// Merchant payouts: processed every PayoutInterval seconds and failed,
+	// releasing their funds, after PayoutMaxAttempts failed submissions
+	PayoutInterval    int
+	PayoutMaxAttempts int
+
+	// Scheduled reconciliation: every ReconcileInterval seconds, the last
+	// ReconcileWindow seconds of transfers are compared with stored payments
+	ReconcileInterval int
+	ReconcileWindow   int
+
+	// Exports: files are written to ExportDir and deleted ExportTTL hours
+	// after they complete
+	ExportDir string
+	ExportTTL int
+
+	// Outbound webhook policy
+	WebhookAllowedSchemes   []string
+	WebhookAllowPrivateIPs  bool
+	WebhookTimeout          int   // in seconds
+	WebhookMaxResponseBytes int64 // response bytes read before the body is discarded
+	WebhookMaxRedirects     int
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
-	timeoutStr := getEnv("PAYMENT_TIMEOUT", "30")
-	timeout, err := strconv.Atoi(timeoutStr)
-	if err != nil {
-		timeout = 30 // default 30 minutes
-	}
-	// Hardcoded testnet configs 
+	// Hardcoded testnet configs
 	return &Config{
 		Port:           getEnv("PORT", "8080"),
 		DatabasePath:   getEnv("DATABASE_PATH", "./algopay.db"),
+		DatabaseURL:    getEnv("DATABASE_URL", ""),
+		AutoMigrate:    getEnvBool("AUTO_MIGRATE", true),
 		AlgoNodeURL:    getEnv("ALGO_NODE_URL", "https://testnet-api.algonode.cloud"),
 		AlgoIndexerURL: getEnv("ALGO_INDEXER_URL", "https://testnet-idx.algonode.cloud"),
 		AlgoToken:      getEnv("ALGO_TOKEN", ""),
-		PaymentTimeout: timeout,
+		PaymentTimeout: getEnvInt("PAYMENT_TIMEOUT", 30),
+
+		PaymentMinExpiry: getEnvInt("PAYMENT_MIN_EXPIRY", 60),
+		PaymentMaxExpiry: getEnvInt("PAYMENT_MAX_EXPIRY", 24*60*60),
+
+		MetadataMaxBytes: getEnvInt("METADATA_MAX_BYTES", 4096),
+
+		IdempotencyTTL: getEnvInt("IDEMPOTENCY_TTL", 24),
+
+		AdminAPIKey: getEnv("ADMIN_API_KEY", ""),
+
+		LatePaymentGrace: getEnvInt("LATE_PAYMENT_GRACE", 60),
+		SignerMnemonics:  getEnvList("SIGNER_MNEMONICS", nil),
+
+		AssetCacheTTL: getEnvInt("ASSET_CACHE_TTL", 3600),
+
+		AccountChecks:        getEnvBool("ACCOUNT_CHECKS", true),
+		AccountCacheTTL:      getEnvInt("ACCOUNT_CACHE_TTL", 60),
+		AllowRekeyedAccounts: getEnvBool("ALLOW_REKEYED_ACCOUNTS", false),
+
+		PriceSource: getEnv("PRICE_SOURCE", ""),
+		PriceFile:   getEnv("PRICE_FILE", "./prices.json"),
+		PriceURL:    getEnv("PRICE_URL", ""),
+		PriceMaxAge: getEnvInt("PRICE_MAX_AGE", 300),
+
+		SubscriptionInterval:        getEnvInt("SUBSCRIPTION_INTERVAL", 60),
+		SubscriptionGracePeriod:     getEnvInt("SUBSCRIPTION_GRACE_PERIOD", 24*60*60),
+		SubscriptionDunningRetries:  getEnvInt("SUBSCRIPTION_DUNNING_RETRIES", 3),
+		SubscriptionDunningInterval: getEnvInt("SUBSCRIPTION_DUNNING_INTERVAL", 24*60*60),
+		SplitPayoutInterval:         getEnvInt("SPLIT_PAYOUT_INTERVAL", 30),
+		SplitPayoutMaxAttempts:      getEnvInt("SPLIT_PAYOUT_MAX_ATTEMPTS", 5),
+		PayoutInterval:              getEnvInt("PAYOUT_INTERVAL", 30),
+		PayoutMaxAttempts:           getEnvInt("PAYOUT_MAX_ATTEMPTS", 5),
+		ReconcileInterval:           getEnvInt("RECONCILE_INTERVAL", 0),
+		ReconcileWindow:             getEnvInt("RECONCILE_WINDOW", 48*60*60),
+		ExportDir:                   getEnv("EXPORT_DIR", "./exports"),
+		ExportTTL:                   getEnvInt("EXPORT_TTL", 72),
+
+		WebhookAllowedSchemes:   getEnvList("WEBHOOK_ALLOWED_SCHEMES", []string{"https"}),
+		WebhookAllowPrivateIPs:  getEnvBool("WEBHOOK_ALLOW_PRIVATE_IPS", false),
+		WebhookTimeout:          getEnvInt("WEBHOOK_TIMEOUT", 10),
+		WebhookMaxResponseBytes: int64(getEnvInt("WEBHOOK_MAX_RESPONSE_BYTES", 64*1024)),
+		WebhookMaxRedirects:     getEnvInt("WEBHOOK_MAX_REDIRECTS", 3),
 	}
 }
 
@@ -40,3 +152,37 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool gets a boolean environment variable or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList gets a comma-separated environment variable or returns a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"algopay/models"
+)
+
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = `id, merchant_id, name, type, prefix, key_hash, scopes, created_at, last_used_at, revoked_at`
+
+// CreateAPIKey stores a new hashed API key
+func (d *Database) CreateAPIKey(key *models.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return fmt.Errorf("failed to encode scopes: %w", err)
+	}
+
+	query := `
+	INSERT INTO api_keys (id, merchant_id, name, type, prefix, key_hash, scopes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = d.db.Exec(query,
+		key.ID,
+		key.MerchantID,
+		key.Name,
+		key.Type,
+		key.Prefix,
+		key.KeyHash,
+		string(scopes),
+		key.CreatedAt,
+	)
+	return err
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its plaintext value
+func (d *Database) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ?`
+	return scanAPIKey(d.db.QueryRow(query, keyHash))
+}
+
+// ListAPIKeys retrieves all API keys belonging to a merchant
+func (d *Database) ListAPIKeys(merchantID string) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE merchant_id = ? ORDER BY created_at`
+	rows, err := d.db.Query(query, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records that an API key was just used
+func (d *Database) TouchAPIKey(id string) error {
+	_, err := d.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, time.Now(), id)
+	return err
+}
+
+// RevokeAPIKey revokes an API key; revoking an already revoked key is a no-op
+func (d *Database) RevokeAPIKey(id string) error {
+	result, err := d.db.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&key.ID,
+		&key.MerchantID,
+		&key.Name,
+		&key.Type,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.CreatedAt,
+		&lastUsedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode scopes: %w", err)
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
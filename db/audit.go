@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"algopay/models"
+)
+
+// auditEntryColumns is the column list scanned by scanAuditEntry
+const auditEntryColumns = `id, action, resource, resource_id, merchant_id, actor_type, actor_id, request_id, before_value, after_value, created_at, prev_hash, hash`
+
+// As returns a store that records its changes in the audit log as made by
+// actor. It shares the receiver's connection.
+func (d *Database) As(actor models.Actor) Store {
+	scoped := *d
+	scoped.actor = actor
+	return &scoped
+}
+
+// AppendAuditEntry appends an entry recording a change made outside the
+// payment methods, such as an admin action, attributed to the store's actor
+func (d *Database) AppendAuditEntry(entry *models.AuditEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.appendAuditEntry(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// auditPayment appends an entry recording a payment change within the
+// transaction that makes it; before is nil when the payment is created
+func (d *Database) auditPayment(tx *txn, action string, before, after *models.Payment) error {
+	var beforeValue interface{}
+	if before != nil {
+		beforeValue = before
+	}
+	entry, err := models.NewAuditEntry(action, models.AuditResourcePayment, after.ID, after.MerchantID, beforeValue, after)
+	if err != nil {
+		return err
+	}
+	return d.appendAuditEntry(tx, entry)
+}
+
+// statusAuditAction returns the audit action of a move to a payment status
+func statusAuditAction(to models.PaymentStatus) string {
+	switch to {
+	case models.PaymentStatusCancelled:
+		return models.AuditPaymentCancelled
+	case models.PaymentStatusRefunding:
+		return models.AuditPaymentRefundStarted
+	case models.PaymentStatusRefunded:
+		return models.AuditPaymentRefunded
+	}
+	return models.AuditPaymentStatusChanged
+}
+
+// appendAuditEntry links an entry to the head of the hash chain and inserts
+// it within a transaction. Actions without an actor are attributed to the
+// system.
+func (d *Database) appendAuditEntry(tx *txn, entry *models.AuditEntry) error {
+	if err := d.db.dialect.lockAuditLog(tx); err != nil {
+		return err
+	}
+
+	var lastID int64
+	var lastHash string
+	err := tx.QueryRow(`SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&lastID, &lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	actor := d.actor
+	if actor.Type == "" {
+		actor.Type = models.ActorSystem
+	}
+	entry.ID = lastID + 1
+	entry.PrevHash = lastHash
+	entry.ActorType = actor.Type
+	entry.ActorID = actor.ID
+	entry.RequestID = actor.RequestID
+	// Postgres keeps microseconds; hash the time as it will be read back
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = entry.ComputeHash()
+
+	_, err = tx.Exec(`
+	INSERT INTO audit_log (id, action, resource, resource_id, merchant_id, actor_type, actor_id, request_id, before_value, after_value, created_at, prev_hash, hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.Action, entry.Resource, entry.ResourceID, entry.MerchantID, entry.ActorType, entry.ActorID,
+		entry.RequestID, string(entry.Before), string(entry.After), entry.CreatedAt, entry.PrevHash, entry.Hash)
+	return err
+}
+
+// ListAuditEntries retrieves a page of audit entries matching the filter, oldest first
+func (d *Database) ListAuditEntries(filter models.AuditFilter) (*models.AuditEntryList, error) {
+	if filter.Limit <= 0 || filter.Limit > models.MaxPageSize {
+		filter.Limit = models.DefaultPageSize
+	}
+
+	query := `SELECT ` + auditEntryColumns + ` FROM audit_log WHERE id > ?`
+	args := []interface{}{filter.After}
+	if filter.MerchantID != "" {
+		query += ` AND merchant_id = ?`
+		args = append(args, filter.MerchantID)
+	}
+	if filter.Resource != "" {
+		query += ` AND resource = ?`
+		args = append(args, filter.Resource)
+	}
+	if filter.ResourceID != "" {
+		query += ` AND resource_id = ?`
+		args = append(args, filter.ResourceID)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	entries, err := d.queryAuditEntries(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &models.AuditEntryList{Entries: entries}
+	if len(entries) > filter.Limit {
+		list.Entries = entries[:filter.Limit]
+		list.HasMore = true
+	}
+	return list, nil
+}
+
+// ExportAuditEntries streams the audit entries recorded in the filter's
+// range, in chain order, to fn
+func (d *Database) ExportAuditEntries(filter models.ExportFilter, fn func(*models.AuditEntry) error) error {
+	var after int64
+	for {
+		query := `SELECT ` + auditEntryColumns + ` FROM audit_log WHERE id > ?`
+		args := []interface{}{after}
+		args = append(args, exportFilterArgs(&query, filter, "merchant_id", "created_at")...)
+		query += ` ORDER BY id LIMIT ?`
+		args = append(args, exportPageSize)
+
+		entries, err := d.queryAuditEntries(query, args...)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(entries) < exportPageSize {
+			return nil
+		}
+		after = entries[len(entries)-1].ID
+	}
+}
+
+// VerifyAuditLog walks the audit log in chain order and checks that IDs
+// have no gaps, that each entry links to the previous hash and that each
+// hash matches the entry's fields. It stops at the first broken entry.
+func (d *Database) VerifyAuditLog() (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+	var prevHash string
+	for {
+		entries, err := d.queryAuditEntries(`SELECT `+auditEntryColumns+` FROM audit_log WHERE id > ? ORDER BY id LIMIT ?`,
+			result.Entries, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			var problem string
+			switch {
+			case entry.ID != result.Entries+1:
+				problem = fmt.Sprintf("expected entry %d, found %d", result.Entries+1, entry.ID)
+			case entry.PrevHash != prevHash:
+				problem = "previous hash does not match the preceding entry"
+			case entry.ComputeHash() != entry.Hash:
+				problem = "hash does not match the entry's contents"
+			}
+			if problem != "" {
+				result.Valid = false
+				result.BrokenAt = result.Entries + 1
+				result.Error = problem
+				return result, nil
+			}
+			result.Entries++
+			prevHash = entry.Hash
+		}
+		if len(entries) < exportPageSize {
+			result.LastHash = prevHash
+			return result, nil
+		}
+	}
+}
+
+// queryAuditEntries runs a query selecting auditEntryColumns and scans every row
+func (d *Database) queryAuditEntries(query string, args ...interface{}) ([]*models.AuditEntry, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// scanAuditEntry scans a row selected with auditEntryColumns
+func scanAuditEntry(row scanner) (*models.AuditEntry, error) {
+	entry := &models.AuditEntry{}
+	var before, after string
+	err := row.Scan(
+		&entry.ID,
+		&entry.Action,
+		&entry.Resource,
+		&entry.ResourceID,
+		&entry.MerchantID,
+		&entry.ActorType,
+		&entry.ActorID,
+		&entry.RequestID,
+		&before,
+		&after,
+		&entry.CreatedAt,
+		&entry.PrevHash,
+		&entry.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if before != "" {
+		entry.Before = []byte(before)
+	}
+	if after != "" {
+		entry.After = []byte(after)
+	}
+	return entry, nil
+}
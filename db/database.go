@@ -2,128 +2,396 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"algopay/models"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// ErrPaymentNotPending is returned when an operation requires a pending payment
+var ErrPaymentNotPending = errors.New("payment is not pending")
+
+// ErrPaymentStatusChanged is returned when a payment is not in the state an update expects
+var ErrPaymentStatusChanged = errors.New("payment status changed")
+
+// DailyVolumeError is returned when a payment would take a merchant's daily
+// volume in an asset over its cap
+type DailyVolumeError struct {
+	AssetID uint64
+	Cap     uint64
+}
+
+// Error implements error
+func (e *DailyVolumeError) Error() string {
+	return fmt.Sprintf("payment would exceed the daily volume cap of %d for asset %d", e.Cap, e.AssetID)
+}
+
+// ErrPaymentVersionConflict is returned when a payment changed between being
+// read and being updated. It matches ErrPaymentStatusChanged.
+var ErrPaymentVersionConflict = fmt.Errorf("%w: it was updated concurrently", ErrPaymentStatusChanged)
+
 type Database struct {
-	db *sql.DB
+	db    *conn
+	actor models.Actor // recorded in the audit log; see As
 }
 
-// NewDatabase creates a new database connection
+// NewDatabase creates a new database connection. Call Migrate to create or
+// update its tables before use.
 func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	database := &Database{db: db}
-	if err := database.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
-	}
-
-	return database, nil
+	return &Database{db: &conn{DB: db, dialect: dialectSQLite}}, nil
 }
 
-// createTables creates the necessary database tables
-func (d *Database) createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS payments (
-		id TEXT PRIMARY KEY,
-		merchant_address TEXT NOT NULL,
-		amount INTEGER NOT NULL,
-		asset_id INTEGER NOT NULL DEFAULT 0,
-		callback_url TEXT,
-		status TEXT NOT NULL DEFAULT 'pending',
-		txn_id TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		expires_at TIMESTAMP NOT NULL
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
-	CREATE INDEX IF NOT EXISTS idx_payments_merchant ON payments(merchant_address);
-	CREATE INDEX IF NOT EXISTS idx_payments_expires ON payments(expires_at);
-	`
-	_, err := d.db.Exec(query)
-	return err
+// sqliteBusyTimeout is how long a SQLite transaction waits for another to
+// release the write lock, in milliseconds
+const sqliteBusyTimeout = 5000
+
+// sqliteDSN adds the connection options the store relies on to a SQLite
+// path. Transactions begin IMMEDIATE, taking the write lock before their
+// first read, so read-then-write transactions on different connections queue
+// behind each other instead of failing with "database is locked" when both
+// try to upgrade their read locks.
+func sqliteDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s_txlock=immediate&_busy_timeout=%d", path, separator, sqliteBusyTimeout)
 }
 
-// CreatePayment creates a new payment record
-func (d *Database) CreatePayment(payment *models.Payment) error {
+// CreatePayment creates a new payment record and audits its creation. It
+// returns ErrPaymentLinkExhausted or a *DailyVolumeError and records nothing
+// if the payment would exceed caps.
+func (d *Database) CreatePayment(payment *models.Payment, caps models.PaymentCaps) error {
+	metadata, err := encodeMetadata(payment.Metadata)
+	if err != nil {
+		return err
+	}
+	options, err := json.Marshal(payment.Options())
+	if err != nil {
+		return fmt.Errorf("failed to encode payment options: %w", err)
+	}
+	splitRules := ""
+	if payment.Splits != nil {
+		data, err := json.Marshal(payment.Splits)
+		if err != nil {
+			return fmt.Errorf("failed to encode split rules: %w", err)
+		}
+		splitRules = string(data)
+	}
+
 	query := `
-	INSERT INTO payments (id, merchant_address, amount, asset_id, callback_url, status, created_at, updated_at, expires_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO payments (id, merchant_id, merchant_address, subscription_id, payment_link_id, invoice_id, split_rules, amount, asset_id, payment_options, callback_url, order_reference, metadata, status,
+		fiat_amount, fiat_currency, exchange_rate, rate_source, rate_timestamp, created_at, updated_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := d.db.Exec(query,
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.db.dialect.lockMerchant(tx, payment.MerchantID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query,
 		payment.ID,
+		payment.MerchantID,
 		payment.MerchantAddress,
+		payment.SubscriptionID,
+		payment.PaymentLinkID,
+		payment.InvoiceID,
+		splitRules,
 		payment.Amount,
 		payment.AssetID,
+		string(options),
 		payment.CallbackURL,
+		payment.OrderReference,
+		metadata,
 		payment.Status,
+		payment.FiatAmount,
+		payment.FiatCurrency,
+		payment.ExchangeRate,
+		payment.RateSource,
+		payment.RateTimestamp,
 		payment.CreatedAt,
 		payment.UpdatedAt,
 		payment.ExpiresAt,
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPaymentCaps(tx, payment, caps); err != nil {
+		return err
+	}
+
+	created, err := scanPayment(tx.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, payment.ID))
+	if err != nil {
+		return err
+	}
+	if err := d.auditPayment(tx, models.AuditPaymentCreated, nil, created); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkPaymentCaps checks the payments in tx, including a newly inserted
+// one, against caps
+func checkPaymentCaps(tx *txn, payment *models.Payment, caps models.PaymentCaps) error {
+	for assetID, limit := range caps.DailyVolume {
+		if limit == 0 {
+			continue
+		}
+		volume, err := dailyVolume(tx, tx.dialect, payment.MerchantID, assetID, caps.DayStart)
+		if err != nil {
+			return err
+		}
+		if volume > limit {
+			return &DailyVolumeError{AssetID: assetID, Cap: limit}
+		}
+	}
+
+	if caps.LinkMaxPayments > 0 && payment.PaymentLinkID != "" {
+		var used int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM payments WHERE payment_link_id = ? AND status IN ('pending', 'completed')`,
+			payment.PaymentLinkID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used > caps.LinkMaxPayments {
+			return ErrPaymentLinkExhausted
+		}
+	}
+	return nil
+}
+
+// GetPayment retrieves a payment by ID, restricted to the given merchant
+func (d *Database) GetPayment(merchantID, id string) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id = ? AND merchant_id = ?`
+	return scanPayment(d.db.QueryRow(query, id, merchantID))
+}
+
+// UpdatePaymentStatus moves a payment to a new status and records the
+// transaction ID. It returns a *models.TransitionError if the payment's
+// current status cannot move to status.
+func (d *Database) UpdatePaymentStatus(id string, status models.PaymentStatus, txnID string) error {
+	_, err := d.transitionPayment("", id, nil, status, `txn_id = ?`, txnID)
 	return err
 }
 
-// GetPayment retrieves a payment by ID
-func (d *Database) GetPayment(id string) (*models.Payment, error) {
+// GetPendingPayments retrieves all pending payments
+func (d *Database) GetPendingPayments() ([]*models.Payment, error) {
 	query := `
-	SELECT id, merchant_address, amount, asset_id, callback_url, status, txn_id, created_at, updated_at, expires_at
-	FROM payments WHERE id = ?
+	SELECT ` + paymentColumns + `
+	FROM payments
+	WHERE status = 'pending' AND expires_at > ?
 	`
-	row := d.db.QueryRow(query, id)
+	return d.queryPayments(query, time.Now())
+}
 
-	payment := &models.Payment{}
-	var txnID sql.NullString
-	err := row.Scan(
-		&payment.ID,
-		&payment.MerchantAddress,
-		&payment.Amount,
-		&payment.AssetID,
-		&payment.CallbackURL,
-		&payment.Status,
-		&txnID,
-		&payment.CreatedAt,
-		&payment.UpdatedAt,
-		&payment.ExpiresAt,
-	)
+// GetLatePaymentCandidates retrieves closed payments that may still receive
+// funds: cancelled payments until grace after their expiry, and expired payments
+// (including pending ones not yet marked expired) within grace of expiring
+func (d *Database) GetLatePaymentCandidates(grace time.Duration) ([]*models.Payment, error) {
+	now := time.Now()
+	query := `
+	SELECT ` + paymentColumns + `
+	FROM payments
+	WHERE (status = 'cancelled' AND expires_at > ?)
+		OR (status IN ('pending', 'expired') AND expires_at <= ? AND expires_at > ?)
+	`
+	return d.queryPayments(query, now.Add(-grace), now, now.Add(-grace))
+}
+
+// RecordPaymentMatch stores the transaction that settled a payment and its new
+// status. The payment must still have the version it was read with, so a
+// match found while the payment was expired or cancelled is rejected with
+// ErrPaymentVersionConflict instead of overwriting that change. On success
+// the payment's version is updated.
+func (d *Database) RecordPaymentMatch(payment *models.Payment) error {
+	read := payment.Version
+	updated, err := d.transitionPayment("", payment.ID, func(current *models.Payment) error {
+		if current.Version != read {
+			return ErrPaymentVersionConflict
+		}
+		return nil
+	}, payment.Status, `txn_id = ?, settled_asset_id = ?, payer_address = ?, received_amount = ?, late = ?`,
+		payment.TxnID, payment.SettledAssetID, payment.PayerAddress, payment.ReceivedAmount, payment.Late)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if txnID.Valid {
-		payment.TxnID = txnID.String
-	}
+	payment.Version = updated.Version
+	payment.UpdatedAt = updated.UpdatedAt
+	return nil
+}
 
-	return payment, nil
+// ResolveLatePayment moves a merchant's payment from one late payment state to
+// another and returns the updated record. It returns ErrPaymentStatusChanged
+// if the payment is not in the expected state.
+func (d *Database) ResolveLatePayment(merchantID, id string, from, to models.PaymentStatus, refundTxnID string) (*models.Payment, error) {
+	return d.transitionPayment(merchantID, id, func(current *models.Payment) error {
+		if current.Status != from {
+			return ErrPaymentStatusChanged
+		}
+		return nil
+	}, to, `refund_txn_id = ?`, refundTxnID)
 }
 
-// UpdatePaymentStatus updates the payment status and transaction ID
-func (d *Database) UpdatePaymentStatus(id string, status models.PaymentStatus, txnID string) error {
+// SubmitRefund moves a merchant's late payment to refunding, recording the
+// signed refund transaction before it is sent. It returns
+// ErrPaymentStatusChanged if the payment is no longer a late payment.
+func (d *Database) SubmitRefund(merchantID, id, refundTxnID string, fee, lastValid uint64) (*models.Payment, error) {
+	return d.transitionPayment(merchantID, id, func(current *models.Payment) error {
+		if current.Status != models.PaymentStatusLatePayment {
+			return ErrPaymentStatusChanged
+		}
+		return nil
+	}, models.PaymentStatusRefunding, `refund_txn_id = ?, refund_fee = ?, refund_last_valid = ?`, refundTxnID, fee, lastValid)
+}
+
+// GetRefundingPayments retrieves the payments whose refunds await confirmation
+func (d *Database) GetRefundingPayments() ([]*models.Payment, error) {
+	return d.queryPayments(`SELECT `+paymentColumns+` FROM payments WHERE status = ? ORDER BY updated_at`, models.PaymentStatusRefunding)
+}
+
+// CancelPayment cancels a merchant's pending payment and returns the updated record.
+// It returns sql.ErrNoRows if the payment does not exist and ErrPaymentNotPending
+// if it is no longer pending.
+func (d *Database) CancelPayment(merchantID, id string) (*models.Payment, error) {
+	return d.transitionPayment(merchantID, id, func(current *models.Payment) error {
+		if current.Status != models.PaymentStatusPending {
+			return ErrPaymentNotPending
+		}
+		return nil
+	}, models.PaymentStatusCancelled, "")
+}
+
+// DailyVolume sums the amounts a merchant has invoiced in an asset since the
+// given time: pending payments offering the asset and completed payments
+// settled in it
+func (d *Database) DailyVolume(merchantID string, assetID uint64, since time.Time) (uint64, error) {
+	return dailyVolume(d.db, d.db.dialect, merchantID, assetID, since)
+}
+
+// dailyVolume runs the DailyVolume query on q
+func dailyVolume(q rowQuerier, dl dialect, merchantID string, assetID uint64, since time.Time) (uint64, error) {
+	from, sum, assetCondition := dl.optionVolume()
 	query := `
-	UPDATE payments 
-	SET status = ?, txn_id = ?, updated_at = CURRENT_TIMESTAMP
-	WHERE id = ?
+	SELECT ` + sum + `
+	FROM ` + from + `
+	WHERE payments.merchant_id = ? AND payments.created_at >= ?
+		AND ` + assetCondition + `
+		AND (payments.status = 'pending' OR (payments.status = 'completed' AND payments.settled_asset_id = ?))
 	`
-	_, err := d.db.Exec(query, status, txnID, id)
-	return err
+	var volume uint64
+	err := q.QueryRow(query, merchantID, since, assetID, assetID).Scan(&volume)
+	return volume, err
 }
 
-// GetPendingPayments retrieves all pending payments
-func (d *Database) GetPendingPayments() ([]*models.Payment, error) {
+// ExtendPayment moves the expiry of a merchant's pending payment to expiresAt
+// and returns the updated record. It returns ErrPaymentNotPending if the payment
+// is no longer pending or has already expired.
+func (d *Database) ExtendPayment(merchantID, id string, expiresAt time.Time) (*models.Payment, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	current, err := scanPayment(tx.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ? AND merchant_id = ?`, id, merchantID))
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != models.PaymentStatusPending || !current.ExpiresAt.After(now) {
+		return current, ErrPaymentNotPending
+	}
+
 	query := `
-	SELECT id, merchant_address, amount, asset_id, callback_url, status, txn_id, created_at, updated_at, expires_at
-	FROM payments 
-	WHERE status = 'pending' AND expires_at > CURRENT_TIMESTAMP
+	UPDATE payments
+	SET expires_at = ?, version = version + 1, updated_at = ?
+	WHERE id = ? AND status = 'pending' AND version = ?
 	`
-	rows, err := d.db.Query(query)
+	result, err := tx.Exec(query, expiresAt, now, id, current.Version)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return current, ErrPaymentVersionConflict
+	}
+
+	updated, err := scanPayment(tx.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := d.auditPayment(tx, models.AuditPaymentExtended, current, updated); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ExpireOldPayments marks pending payments past their expiry as expired. Each
+// payment moves through the state machine on its own, so a payment matched
+// or cancelled meanwhile keeps its new status and a match read before the
+// expiry can no longer be recorded as completed. A payment that fails to
+// expire does not stop the others; the failures are returned together.
+func (d *Database) ExpireOldPayments() error {
+	now := time.Now()
+	rows, err := d.db.Query(`SELECT id FROM payments WHERE status = 'pending' AND expires_at <= ?`, now)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var failures []error
+	for _, id := range ids {
+		_, err := d.transitionPayment("", id, func(current *models.Payment) error {
+			if current.Status != models.PaymentStatusPending || current.ExpiresAt.After(now) {
+				return ErrPaymentNotPending
+			}
+			return nil
+		}, models.PaymentStatusExpired, "")
+		if err != nil && !errors.Is(err, ErrPaymentNotPending) && !errors.Is(err, ErrPaymentStatusChanged) {
+			failures = append(failures, fmt.Errorf("payment %s: %w", id, err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// queryPayments runs a query selecting paymentColumns and scans every row
+func (d *Database) queryPayments(query string, args ...interface{}) ([]*models.Payment, error) {
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -131,43 +399,96 @@ func (d *Database) GetPendingPayments() ([]*models.Payment, error) {
 
 	var payments []*models.Payment
 	for rows.Next() {
-		payment := &models.Payment{}
-		var txnID sql.NullString
-		err := rows.Scan(
-			&payment.ID,
-			&payment.MerchantAddress,
-			&payment.Amount,
-			&payment.AssetID,
-			&payment.CallbackURL,
-			&payment.Status,
-			&txnID,
-			&payment.CreatedAt,
-			&payment.UpdatedAt,
-			&payment.ExpiresAt,
-		)
+		payment, err := scanPayment(rows)
 		if err != nil {
 			return nil, err
 		}
+		payments = append(payments, payment)
+	}
 
-		if txnID.Valid {
-			payment.TxnID = txnID.String
-		}
+	return payments, rows.Err()
+}
 
-		payments = append(payments, payment)
+// paymentColumns is the column list scanned by scanPayment
+const paymentColumns = `id, merchant_id, merchant_address, subscription_id, payment_link_id, invoice_id, split_rules, amount, asset_id, payment_options, callback_url, order_reference, metadata, status, version, txn_id, settled_asset_id, payer_address, received_amount, late, refund_txn_id, refund_fee, refund_last_valid, fiat_amount, fiat_currency, exchange_rate, rate_source, rate_timestamp, created_at, updated_at, expires_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPayment scans a row selected with paymentColumns
+func scanPayment(row scanner) (*models.Payment, error) {
+	payment := &models.Payment{}
+	var callbackURL, txnID sql.NullString
+	var options, metadata, splitRules string
+	err := row.Scan(
+		&payment.ID,
+		&payment.MerchantID,
+		&payment.MerchantAddress,
+		&payment.SubscriptionID,
+		&payment.PaymentLinkID,
+		&payment.InvoiceID,
+		&splitRules,
+		&payment.Amount,
+		&payment.AssetID,
+		&options,
+		&callbackURL,
+		&payment.OrderReference,
+		&metadata,
+		&payment.Status,
+		&payment.Version,
+		&txnID,
+		&payment.SettledAssetID,
+		&payment.PayerAddress,
+		&payment.ReceivedAmount,
+		&payment.Late,
+		&payment.RefundTxnID,
+		&payment.RefundFee,
+		&payment.RefundLastValid,
+		&payment.FiatAmount,
+		&payment.FiatCurrency,
+		&payment.ExchangeRate,
+		&payment.RateSource,
+		&payment.RateTimestamp,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+		&payment.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.CallbackURL = callbackURL.String
+	payment.TxnID = txnID.String
+	if err := json.Unmarshal([]byte(metadata), &payment.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if err := json.Unmarshal([]byte(options), &payment.PaymentOptions); err != nil {
+		return nil, fmt.Errorf("failed to decode payment options: %w", err)
 	}
+	if splitRules != "" {
+		if err := json.Unmarshal([]byte(splitRules), &payment.Splits); err != nil {
+			return nil, fmt.Errorf("failed to decode split rules: %w", err)
+		}
+	}
+	payment.PaymentOptions = payment.Options()
+	payment.DisplayAmount = payment.PaymentOptions[0].DisplayAmount
+	payment.UnitName = payment.PaymentOptions[0].UnitName
 
-	return payments, nil
+	return payment, nil
 }
 
-// ExpireOldPayments marks expired payments as expired
-func (d *Database) ExpireOldPayments() error {
-	query := `
-	UPDATE payments 
-	SET status = 'expired', updated_at = CURRENT_TIMESTAMP
-	WHERE status = 'pending' AND expires_at <= CURRENT_TIMESTAMP
-	`
-	_, err := d.db.Exec(query)
-	return err
+// encodeMetadata encodes payment metadata for storage
+func encodeMetadata(metadata map[string]interface{}) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return string(data), nil
 }
 
 // Close closes the database connection
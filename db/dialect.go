@@ -0,0 +1,197 @@
+package db
+
+import (
+	"database/sql"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect identifies the SQL flavour of the database behind a Database.
+// Queries are written for SQLite with ? placeholders; the few constructs the
+// dialects disagree on are built by the methods below.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// rebind rewrites ? placeholders outside string literals to the dialect's
+// own syntax; SQLite queries are returned unchanged
+func (dl dialect) rebind(query string) string {
+	if dl != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		switch ch := query[i]; {
+		case ch == '\'':
+			quoted = !quoted
+			b.WriteByte(ch)
+		case ch == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// optionHasAsset returns a condition matching payments that accept the asset
+// bound to both placeholders, as their primary asset or in any option
+func (dl dialect) optionHasAsset() string {
+	if dl == dialectPostgres {
+		return "(asset_id = ? OR EXISTS (SELECT 1 FROM jsonb_array_elements(payment_options::jsonb) AS option WHERE (option->>'asset_id')::bigint = ?))"
+	}
+	return "(asset_id = ? OR EXISTS (SELECT 1 FROM json_each(payment_options) WHERE json_extract(value, '$.asset_id') = ?))"
+}
+
+// metadataEquals returns a condition matching payments whose metadata value
+// under key equals the second argument, and the argument naming the key
+func (dl dialect) metadataEquals(key string) (string, interface{}) {
+	if dl == dialectPostgres {
+		return "metadata::jsonb ->> ? = ?", key
+	}
+	// Keys are restricted to [A-Za-z0-9_.-] by the API, so quoting them in the path is safe
+	return "CAST(json_extract(metadata, ?) AS TEXT) = ?", `$."` + key + `"`
+}
+
+// optionVolume returns the FROM clause and sum expression that add up the
+// amounts of payment options, and the condition selecting options by the
+// asset bound to its placeholder
+func (dl dialect) optionVolume() (from, sum, assetCondition string) {
+	if dl == dialectPostgres {
+		return "payments, jsonb_array_elements(payments.payment_options::jsonb) AS option",
+			"COALESCE(SUM((option->>'amount')::numeric), 0)",
+			"(option->>'asset_id')::bigint = ?"
+	}
+	return "payments, json_each(payments.payment_options) AS option",
+		"COALESCE(SUM(json_extract(option.value, '$.amount')), 0)",
+		"json_extract(option.value, '$.asset_id') = ?"
+}
+
+// invoiceNumber returns an expression joining the prefix bound to its
+// placeholder and the sequence expression, zero-padded to six digits
+func (dl dialect) invoiceNumber(sequence string) string {
+	if dl == dialectPostgres {
+		return "? || lpad(CAST(" + sequence + " AS TEXT), 6, '0')"
+	}
+	return "printf('%s%06d', ?, " + sequence + ")"
+}
+
+// lockMerchant serializes transactions that check a merchant's totals before
+// committing. SQLite transactions take the database write lock when they
+// begin (see sqliteDSN); Postgres takes a transaction-scoped advisory lock.
+func (dl dialect) lockMerchant(tx *txn, merchantID string) error {
+	if dl != dialectPostgres {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext(?))`, merchantID)
+	return err
+}
+
+// lockAuditLog serializes appends to the audit log's hash chain. SQLite
+// transactions hold the write lock from the start; Postgres takes a
+// transaction-scoped advisory lock.
+func (dl dialect) lockAuditLog(tx *txn) error {
+	if dl != dialectPostgres {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('algopay_audit_log'))`)
+	return err
+}
+
+// utcArgs returns args with times converted to UTC. SQLite stores times as
+// text with their offset and compares them as text, so every time has to be
+// written and bound in the same zone whatever the server's local zone is.
+func utcArgs(args []interface{}) []interface{} {
+	var converted []interface{}
+	for i, arg := range args {
+		var t time.Time
+		switch v := arg.(type) {
+		case time.Time:
+			t = v
+		case *time.Time:
+			if v == nil {
+				continue
+			}
+			t = *v
+		default:
+			continue
+		}
+		// Copy before the first change so the caller's slice is left alone
+		if converted == nil {
+			converted = slices.Clone(args)
+		}
+		converted[i] = t.UTC()
+	}
+	if converted == nil {
+		return args
+	}
+	return converted
+}
+
+// conn runs queries written for SQLite on the database's dialect, binding
+// times in UTC
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+// Exec executes a query that returns no rows
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), utcArgs(args)...)
+}
+
+// Query executes a query that returns rows
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), utcArgs(args)...)
+}
+
+// QueryRow executes a query that returns at most one row
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), utcArgs(args)...)
+}
+
+// Begin starts a transaction
+func (c *conn) Begin() (*txn, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, dialect: c.dialect}, nil
+}
+
+// rowQuerier is implemented by conn and txn
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// txn is a transaction on a conn, binding times in UTC
+type txn struct {
+	*sql.Tx
+	dialect dialect
+}
+
+// Exec executes a query that returns no rows
+func (t *txn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), utcArgs(args)...)
+}
+
+// Query executes a query that returns rows
+func (t *txn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.rebind(query), utcArgs(args)...)
+}
+
+// QueryRow executes a query that returns at most one row
+func (t *txn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), utcArgs(args)...)
+}
@@ -0,0 +1,387 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"algopay/models"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// exportPageSize is the number of rows read per query while streaming an
+// export, so no query holds the database for the length of a large export
+const exportPageSize = 500
+
+// exportJobColumns is the column list scanned by scanExportJob
+const exportJobColumns = `id, merchant_id, dataset, format, range_start, range_end, status, rows, size, error, created_at, completed_at, expires_at`
+
+// transactionsQuery selects every matched on-chain transaction: payments,
+// refunds and confirmed split payouts and payouts. Amounts and times come
+// from the journal where an entry was posted.
+const transactionsQuery = `
+WITH entry_lines AS (
+	SELECT e.kind, e.reference, e.created_at, l.account, l.debit, l.credit
+	FROM journal_entries e JOIN journal_lines l ON l.entry_id = e.id
+)
+SELECT type, merchant_id, reference, payment_id, txn_id, asset_id, amount, counterparty, fee, occurred_at FROM (
+	SELECT 'payment' AS type, p.merchant_id, p.id AS reference, p.id AS payment_id, p.txn_id,
+		COALESCE(p.settled_asset_id, p.asset_id) AS asset_id,
+		COALESCE(received.credit, CASE WHEN p.received_amount > 0 THEN p.received_amount ELSE p.amount END) AS amount,
+		p.payer_address AS counterparty, 0 AS fee,
+		COALESCE(received.created_at, p.updated_at) AS occurred_at
+	FROM payments p
+	LEFT JOIN entry_lines received
+		ON received.kind = 'payment_received' AND received.account = 'payments' AND received.reference = p.id
+	WHERE p.txn_id != ''
+
+	UNION ALL
+
+	SELECT 'refund', p.merchant_id, p.id, p.id, p.refund_txn_id,
+		COALESCE(p.settled_asset_id, p.asset_id),
+		COALESCE(refund.debit, CASE WHEN p.received_amount > 0 THEN p.received_amount ELSE p.amount END),
+		p.payer_address, COALESCE(fee.debit, 0),
+		COALESCE(refund.created_at, p.updated_at)
+	FROM payments p
+	LEFT JOIN entry_lines refund
+		ON refund.kind = 'refund' AND refund.account = 'refunds' AND refund.reference = p.id
+	LEFT JOIN entry_lines fee
+		ON fee.kind = 'network_fee' AND fee.account = 'network_fees' AND fee.reference = p.refund_txn_id
+	WHERE p.refund_txn_id != '' AND p.status = 'refunded'
+
+	UNION ALL
+
+	SELECT 'split_payout', merchant_id, id, payment_id, txn_id, asset_id, amount, address, fee, updated_at
+	FROM split_payouts WHERE status = 'confirmed'
+
+	UNION ALL
+
+	SELECT 'payout', merchant_id, id, '', txn_id, asset_id, amount, destination, fee, updated_at
+	FROM payouts WHERE status = 'confirmed'
+) transactions
+`
+
+// ExportPayments streams the payments created in the filter's range, oldest
+// first, to fn
+func (d *Database) ExportPayments(filter models.ExportFilter, fn func(*models.Payment) error) error {
+	var last *models.Payment
+	for {
+		query := `SELECT ` + paymentColumns + ` FROM payments WHERE 1 = 1`
+		args := exportFilterArgs(&query, filter, "merchant_id", "created_at")
+		if last != nil {
+			query += ` AND (created_at, id) > (?, ?)`
+			args = append(args, last.CreatedAt, last.ID)
+		}
+		query += ` ORDER BY created_at, id LIMIT ?`
+		args = append(args, exportPageSize)
+
+		payments, err := d.queryPayments(query, args...)
+		if err != nil {
+			return err
+		}
+		for _, payment := range payments {
+			if err := fn(payment); err != nil {
+				return err
+			}
+		}
+		if len(payments) < exportPageSize {
+			return nil
+		}
+		last = payments[len(payments)-1]
+	}
+}
+
+// ExportTransactions streams the matched transactions in the filter's range,
+// oldest first, to fn. Types limits the transactions to those types.
+func (d *Database) ExportTransactions(filter models.ExportFilter, types []string, fn func(*models.ExportTransaction) error) error {
+	var last *models.ExportTransaction
+	for {
+		query := transactionsQuery + ` WHERE 1 = 1`
+		args := exportFilterArgs(&query, filter, "merchant_id", "occurred_at")
+		if len(types) > 0 {
+			query += ` AND type IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(types)), ", ") + `)`
+			for _, t := range types {
+				args = append(args, t)
+			}
+		}
+		if last != nil {
+			query += ` AND (occurred_at, type, reference) > (?, ?, ?)`
+			args = append(args, last.OccurredAt, last.Type, last.Reference)
+		}
+		query += ` ORDER BY occurred_at, type, reference LIMIT ?`
+		args = append(args, exportPageSize)
+
+		transactions, err := d.queryExportTransactions(query, args...)
+		if err != nil {
+			return err
+		}
+		for _, transaction := range transactions {
+			if err := fn(transaction); err != nil {
+				return err
+			}
+		}
+		if len(transactions) < exportPageSize {
+			return nil
+		}
+		last = transactions[len(transactions)-1]
+	}
+}
+
+// queryExportTransactions runs a page of transactionsQuery
+func (d *Database) queryExportTransactions(query string, args ...interface{}) ([]*models.ExportTransaction, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []*models.ExportTransaction
+	for rows.Next() {
+		transaction := &models.ExportTransaction{}
+		var occurredAt exportTime
+		err := rows.Scan(
+			&transaction.Type,
+			&transaction.MerchantID,
+			&transaction.Reference,
+			&transaction.PaymentID,
+			&transaction.TxnID,
+			&transaction.AssetID,
+			&transaction.Amount,
+			&transaction.Counterparty,
+			&transaction.Fee,
+			&occurredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transaction.OccurredAt = occurredAt.Time
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+// ExportFees streams the network fees posted in the filter's range, oldest
+// first, to fn
+func (d *Database) ExportFees(filter models.ExportFilter, fn func(*models.ExportFee) error) error {
+	var after int64
+	for {
+		query := `
+		SELECT e.id, e.merchant_id, e.reference, e.description, l.debit, e.created_at
+		FROM journal_entries e
+		JOIN journal_lines l ON l.entry_id = e.id AND l.account = ?
+		WHERE e.kind = ? AND e.id > ?`
+		args := []interface{}{models.LedgerNetworkFees, models.EntryNetworkFee, after}
+		args = append(args, exportFilterArgs(&query, filter, "e.merchant_id", "e.created_at")...)
+		query += ` ORDER BY e.id LIMIT ?`
+		args = append(args, exportPageSize)
+
+		rows, err := d.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		var fees []*models.ExportFee
+		for rows.Next() {
+			fee := &models.ExportFee{}
+			if err := rows.Scan(&fee.EntryID, &fee.MerchantID, &fee.Reference, &fee.Description, &fee.Amount, &fee.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			fees = append(fees, fee)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, fee := range fees {
+			if err := fn(fee); err != nil {
+				return err
+			}
+		}
+		if len(fees) < exportPageSize {
+			return nil
+		}
+		after = fees[len(fees)-1].EntryID
+	}
+}
+
+// exportFilterArgs appends the filter's conditions on the merchant and time
+// columns to query and returns their arguments
+func exportFilterArgs(query *string, filter models.ExportFilter, merchantColumn, timeColumn string) []interface{} {
+	var args []interface{}
+	if filter.MerchantID != "" {
+		*query += ` AND ` + merchantColumn + ` = ?`
+		args = append(args, filter.MerchantID)
+	}
+	if filter.From != nil {
+		*query += ` AND ` + timeColumn + ` >= ?`
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		*query += ` AND ` + timeColumn + ` < ?`
+		args = append(args, *filter.To)
+	}
+	return args
+}
+
+// exportTime scans a timestamp computed by an expression, which SQLite
+// returns as text because it cannot tell the result is a time
+type exportTime struct {
+	time.Time
+}
+
+// Scan implements sql.Scanner
+func (t *exportTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("cannot scan %T into a time", value)
+}
+
+// parse reads a timestamp in any format the SQLite driver writes
+func (t *exportTime) parse(value string) error {
+	value = strings.TrimSuffix(value, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if parsed, err := time.ParseInLocation(format, value, time.UTC); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", value)
+}
+
+// CreateExportJob records a new export job
+func (d *Database) CreateExportJob(job *models.ExportJob) error {
+	query := `
+	INSERT INTO export_jobs (` + exportJobColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := d.db.Exec(query,
+		job.ID,
+		job.MerchantID,
+		job.Dataset,
+		job.Format,
+		job.From,
+		job.To,
+		job.Status,
+		job.Rows,
+		job.Size,
+		job.Error,
+		job.CreatedAt,
+		job.CompletedAt,
+		job.ExpiresAt,
+	)
+	return err
+}
+
+// GetExportJob retrieves an export job by ID
+func (d *Database) GetExportJob(id string) (*models.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE id = ?`
+	return scanExportJob(d.db.QueryRow(query, id))
+}
+
+// ListExportJobs retrieves the most recent export jobs of a merchant, or of
+// every merchant when merchantID is empty
+func (d *Database) ListExportJobs(merchantID string, limit int) ([]*models.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE ? IN ('', merchant_id) ORDER BY created_at DESC LIMIT ?`
+	return d.queryExportJobs(query, merchantID, limit)
+}
+
+// ClaimExportJob marks the oldest pending export job as running and returns
+// it, or returns sql.ErrNoRows when none is pending
+func (d *Database) ClaimExportJob() (*models.ExportJob, error) {
+	query := `
+	UPDATE export_jobs SET status = ?
+	WHERE id = (SELECT id FROM export_jobs WHERE status = ? ORDER BY created_at LIMIT 1) AND status = ?
+	RETURNING ` + exportJobColumns
+	return scanExportJob(d.db.QueryRow(query, models.ExportRunning, models.ExportPending, models.ExportPending))
+}
+
+// RequeueExportJobs returns jobs left running by a previous process to the queue
+func (d *Database) RequeueExportJobs() error {
+	_, err := d.db.Exec(`UPDATE export_jobs SET status = ? WHERE status = ?`, models.ExportPending, models.ExportRunning)
+	return err
+}
+
+// UpdateExportJob saves the outcome of an export job
+func (d *Database) UpdateExportJob(job *models.ExportJob) error {
+	query := `
+	UPDATE export_jobs
+	SET status = ?, rows = ?, size = ?, error = ?, completed_at = ?, expires_at = ?
+	WHERE id = ?
+	`
+	_, err := d.db.Exec(query, job.Status, job.Rows, job.Size, job.Error, job.CompletedAt, job.ExpiresAt, job.ID)
+	return err
+}
+
+// GetExpiredExportJobs retrieves completed export jobs whose files expired by now
+func (d *Database) GetExpiredExportJobs(now time.Time) ([]*models.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE status = ? AND expires_at <= ?`
+	return d.queryExportJobs(query, models.ExportCompleted, now)
+}
+
+// queryExportJobs runs a query selecting exportJobColumns
+func (d *Database) queryExportJobs(query string, args ...interface{}) ([]*models.ExportJob, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*models.ExportJob{}
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// scanExportJob reads an export job from a row selected with exportJobColumns
+func scanExportJob(row scanner) (*models.ExportJob, error) {
+	job := &models.ExportJob{}
+	var from, to, completedAt, expiresAt sql.NullTime
+	err := row.Scan(
+		&job.ID,
+		&job.MerchantID,
+		&job.Dataset,
+		&job.Format,
+		&from,
+		&to,
+		&job.Status,
+		&job.Rows,
+		&job.Size,
+		&job.Error,
+		&job.CreatedAt,
+		&completedAt,
+		&expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if from.Valid {
+		job.From = &from.Time
+	}
+	if to.Valid {
+		job.To = &to.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	return job, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"time"
+
+	"algopay/models"
+)
+
+// ReserveIdempotencyKey claims an idempotency key for a new request. If the key is
+// already held by an unexpired record, that record is returned and nothing is stored.
+func (d *Database) ReserveIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Free the key if its previous use has expired
+	_, err = tx.Exec(`DELETE FROM idempotency_keys WHERE merchant_id = ? AND idempotency_key = ? AND expires_at <= ?`,
+		record.MerchantID, record.Key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO idempotency_keys (merchant_id, idempotency_key, request_hash, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (merchant_id, idempotency_key) DO NOTHING
+	`
+	result, err := tx.Exec(query, record.MerchantID, record.Key, record.RequestHash, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 1 {
+		return nil, tx.Commit()
+	}
+
+	existing := &models.IdempotencyRecord{}
+	var responseBody string
+	err = tx.QueryRow(`
+	SELECT merchant_id, idempotency_key, request_hash, status_code, response_body, created_at, expires_at
+	FROM idempotency_keys WHERE merchant_id = ? AND idempotency_key = ?
+	`, record.MerchantID, record.Key).Scan(
+		&existing.MerchantID,
+		&existing.Key,
+		&existing.RequestHash,
+		&existing.StatusCode,
+		&responseBody,
+		&existing.CreatedAt,
+		&existing.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	existing.ResponseBody = []byte(responseBody)
+
+	return existing, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response for a reserved idempotency key
+func (d *Database) CompleteIdempotencyKey(merchantID, key string, statusCode int, responseBody []byte) error {
+	query := `
+	UPDATE idempotency_keys
+	SET status_code = ?, response_body = ?
+	WHERE merchant_id = ? AND idempotency_key = ?
+	`
+	_, err := d.db.Exec(query, statusCode, string(responseBody), merchantID, key)
+	return err
+}
+
+// ReleaseIdempotencyKey removes a reservation so the request can be retried
+func (d *Database) ReleaseIdempotencyKey(merchantID, key string) error {
+	_, err := d.db.Exec(`DELETE FROM idempotency_keys WHERE merchant_id = ? AND idempotency_key = ?`, merchantID, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes idempotency records past their retention window
+func (d *Database) DeleteExpiredIdempotencyKeys() error {
+	_, err := d.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now())
+	return err
+}
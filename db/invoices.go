@@ -0,0 +1,169 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"algopay/models"
+)
+
+// InvoiceNumberPrefix starts every invoice number
+const InvoiceNumberPrefix = "INV-"
+
+// invoiceColumns is the column list scanned by scanInvoice, with the status
+// and expiry of the invoice's payment joined in
+const invoiceColumns = `i.id, i.merchant_id, i.number, i.sequence, i.payment_id, i.asset_id, i.unit_name, i.decimals, i.customer_name, i.customer_email, i.customer_address, i.notes, i.line_items, i.discounts, i.tax_lines, i.subtotal, i.discount_total, i.tax_total, i.total, i.metadata, i.created_at, p.status, p.expires_at`
+
+// CreateInvoice creates a new invoice record, assigning it the merchant's next
+// invoice number. Numbers are taken in the insert itself so concurrent
+// invoices never share or skip one.
+func (d *Database) CreateInvoice(invoice *models.Invoice) error {
+	metadata, err := encodeMetadata(invoice.Metadata)
+	if err != nil {
+		return err
+	}
+	lineItems, err := json.Marshal(invoice.LineItems)
+	if err != nil {
+		return fmt.Errorf("failed to encode line items: %w", err)
+	}
+	discounts, err := json.Marshal(invoice.Discounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode discounts: %w", err)
+	}
+	taxLines, err := json.Marshal(invoice.TaxLines)
+	if err != nil {
+		return fmt.Errorf("failed to encode tax lines: %w", err)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Postgres can let concurrent inserts read the same maximum sequence
+	if err := d.db.dialect.lockMerchant(tx, invoice.MerchantID); err != nil {
+		return err
+	}
+
+	sequence := `(SELECT COALESCE(MAX(sequence), 0) + 1 FROM invoices WHERE merchant_id = ?)`
+	query := `
+	INSERT INTO invoices (id, merchant_id, number, sequence, payment_id, asset_id, unit_name, decimals, customer_name, customer_email,
+		customer_address, notes, line_items, discounts, tax_lines, subtotal, discount_total, tax_total, total, metadata, created_at)
+	VALUES (?, ?, ` + d.db.dialect.invoiceNumber(sequence) + `, ` + sequence + `,
+		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING sequence, number
+	`
+	err = tx.QueryRow(query,
+		invoice.ID,
+		invoice.MerchantID,
+		InvoiceNumberPrefix,
+		invoice.MerchantID,
+		invoice.MerchantID,
+		invoice.PaymentID,
+		invoice.AssetID,
+		invoice.UnitName,
+		invoice.Decimals,
+		invoice.CustomerName,
+		invoice.CustomerEmail,
+		invoice.CustomerAddress,
+		invoice.Notes,
+		string(lineItems),
+		string(discounts),
+		string(taxLines),
+		invoice.Subtotal,
+		invoice.DiscountTotal,
+		invoice.TaxTotal,
+		invoice.Total,
+		metadata,
+		invoice.CreatedAt,
+	).Scan(&invoice.Sequence, &invoice.Number)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetInvoice retrieves an invoice by ID, restricted to the given merchant
+func (d *Database) GetInvoice(merchantID, id string) (*models.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices i JOIN payments p ON p.id = i.payment_id WHERE i.id = ? AND i.merchant_id = ?`
+	return scanInvoice(d.db.QueryRow(query, id, merchantID))
+}
+
+// ListInvoices retrieves a merchant's invoices, newest first, optionally
+// restricted to those whose payment has the given status
+func (d *Database) ListInvoices(merchantID string, status models.PaymentStatus) ([]*models.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices i JOIN payments p ON p.id = i.payment_id WHERE i.merchant_id = ?`
+	args := []interface{}{merchantID}
+	if status != "" {
+		query += ` AND p.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY i.sequence DESC`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []*models.Invoice{}
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, rows.Err()
+}
+
+// scanInvoice reads an invoice from a row selected with invoiceColumns
+func scanInvoice(row scanner) (*models.Invoice, error) {
+	invoice := &models.Invoice{}
+	var lineItems, discounts, taxLines, metadata string
+	err := row.Scan(
+		&invoice.ID,
+		&invoice.MerchantID,
+		&invoice.Number,
+		&invoice.Sequence,
+		&invoice.PaymentID,
+		&invoice.AssetID,
+		&invoice.UnitName,
+		&invoice.Decimals,
+		&invoice.CustomerName,
+		&invoice.CustomerEmail,
+		&invoice.CustomerAddress,
+		&invoice.Notes,
+		&lineItems,
+		&discounts,
+		&taxLines,
+		&invoice.Subtotal,
+		&invoice.DiscountTotal,
+		&invoice.TaxTotal,
+		&invoice.Total,
+		&metadata,
+		&invoice.CreatedAt,
+		&invoice.Status,
+		&invoice.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(lineItems), &invoice.LineItems); err != nil {
+		return nil, fmt.Errorf("failed to decode line items: %w", err)
+	}
+	if err := json.Unmarshal([]byte(discounts), &invoice.Discounts); err != nil {
+		return nil, fmt.Errorf("failed to decode discounts: %w", err)
+	}
+	if err := json.Unmarshal([]byte(taxLines), &invoice.TaxLines); err != nil {
+		return nil, fmt.Errorf("failed to decode tax lines: %w", err)
+	}
+	if err := json.Unmarshal([]byte(metadata), &invoice.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	return invoice, nil
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"algopay/models"
+)
+
+// ErrJournalEntryExists is returned when an entry of the same kind and
+// reference was already posted
+var ErrJournalEntryExists = errors.New("journal entry already posted")
+
+// journalEntryColumns is the column list scanned by scanJournalEntry
+const journalEntryColumns = `id, merchant_id, asset_id, kind, reference, description, created_at`
+
+// PostJournalEntry records a balanced entry and its lines
+func (d *Database) PostJournalEntry(entry *models.JournalEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := postJournalEntry(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// postJournalEntries posts entries in a transaction that also changes the
+// state they record; entries that were already posted are skipped
+func postJournalEntries(tx *txn, entries []*models.JournalEntry) error {
+	for _, entry := range entries {
+		err := postJournalEntry(tx, entry)
+		if err != nil && !errors.Is(err, ErrJournalEntryExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// postJournalEntry inserts an entry and its lines within a transaction
+func postJournalEntry(tx *txn, entry *models.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	err := tx.QueryRow(`
+	INSERT INTO journal_entries (merchant_id, asset_id, kind, reference, description, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (kind, reference) DO NOTHING
+	RETURNING id
+	`, entry.MerchantID, entry.AssetID, entry.Kind, entry.Reference, entry.Description, entry.CreatedAt).Scan(&entry.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJournalEntryExists
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range entry.Lines {
+		_, err := tx.Exec(`
+		INSERT INTO journal_lines (entry_id, merchant_id, asset_id, account, debit, credit)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`, entry.ID, entry.MerchantID, entry.AssetID, line.Account, line.Debit, line.Credit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAccountBalances sums a merchant's ledger lines per asset and account
+func (d *Database) GetAccountBalances(merchantID string) ([]models.AccountBalance, error) {
+	rows, err := d.db.Query(`
+	SELECT account, asset_id, COALESCE(SUM(debit), 0), COALESCE(SUM(credit), 0)
+	FROM journal_lines
+	WHERE merchant_id = ?
+	GROUP BY asset_id, account
+	ORDER BY asset_id, account
+	`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []models.AccountBalance{}
+	for rows.Next() {
+		var balance models.AccountBalance
+		if err := rows.Scan(&balance.Account, &balance.AssetID, &balance.Debits, &balance.Credits); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, rows.Err()
+}
+
+// accountBalance returns the balance of one account within a transaction
+func accountBalance(tx *txn, merchantID string, assetID uint64, account models.LedgerAccount) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(`
+	SELECT COALESCE(SUM(debit), 0) - COALESCE(SUM(credit), 0)
+	FROM journal_lines
+	WHERE merchant_id = ? AND asset_id = ? AND account = ?
+	`, merchantID, assetID, account).Scan(&balance)
+	return balance, err
+}
+
+// ListJournalEntries retrieves a page of a merchant's entries in posting
+// order, starting after the entry with ID after. A nil assetID matches every
+// asset.
+func (d *Database) ListJournalEntries(merchantID string, assetID *uint64, after int64, limit int) (*models.JournalEntryList, error) {
+	if limit <= 0 || limit > models.MaxPageSize {
+		limit = models.DefaultPageSize
+	}
+
+	query := `SELECT ` + journalEntryColumns + ` FROM journal_entries WHERE merchant_id = ? AND id > ?`
+	args := []interface{}{merchantID, after}
+	if assetID != nil {
+		query += ` AND asset_id = ?`
+		args = append(args, *assetID)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &models.JournalEntryList{Entries: []*models.JournalEntry{}}
+	byID := map[int64]*models.JournalEntry{}
+	for rows.Next() {
+		entry, err := scanJournalEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list.Entries = append(list.Entries, entry)
+		byID[entry.ID] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(list.Entries) > limit {
+		delete(byID, list.Entries[limit].ID)
+		list.Entries = list.Entries[:limit]
+		list.HasMore = true
+	}
+	if len(list.Entries) == 0 {
+		return list, nil
+	}
+
+	placeholders := make([]string, len(list.Entries))
+	ids := make([]interface{}, len(list.Entries))
+	for i, entry := range list.Entries {
+		placeholders[i] = "?"
+		ids[i] = entry.ID
+	}
+	lines, err := d.db.Query(`SELECT entry_id, account, debit, credit FROM journal_lines WHERE entry_id IN (`+
+		strings.Join(placeholders, ", ")+`) ORDER BY rowid`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer lines.Close()
+
+	for lines.Next() {
+		var entryID int64
+		var line models.JournalLine
+		if err := lines.Scan(&entryID, &line.Account, &line.Debit, &line.Credit); err != nil {
+			return nil, err
+		}
+		if entry := byID[entryID]; entry != nil {
+			entry.Lines = append(entry.Lines, line)
+		}
+	}
+
+	return list, lines.Err()
+}
+
+// scanJournalEntry reads an entry, without its lines, from a row selected
+// with journalEntryColumns
+func scanJournalEntry(row scanner) (*models.JournalEntry, error) {
+	entry := &models.JournalEntry{}
+	err := row.Scan(
+		&entry.ID,
+		&entry.MerchantID,
+		&entry.AssetID,
+		&entry.Kind,
+		&entry.Reference,
+		&entry.Description,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
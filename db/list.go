@@ -0,0 +1,229 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"algopay/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// does not match the requested ordering
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumns maps allowed sort fields to their columns
+var sortColumns = map[string]string{
+	models.SortByCreatedAt: "created_at",
+	models.SortByUpdatedAt: "updated_at",
+	models.SortByExpiresAt: "expires_at",
+	models.SortByAmount:    "amount",
+}
+
+// paymentCursor is the decoded form of an opaque pagination cursor: the sort
+// key and ID of the last payment on the previous page
+type paymentCursor struct {
+	SortBy     string     `json:"s"`
+	Descending bool       `json:"d"`
+	Time       *time.Time `json:"t,omitempty"`
+	Amount     uint64     `json:"a,omitempty"`
+	ID         string     `json:"i"`
+}
+
+// ListPayments retrieves a page of payments matching the filter using keyset pagination
+func (d *Database) ListPayments(filter models.PaymentFilter) (*models.PaymentList, error) {
+	if filter.SortBy == "" {
+		filter.SortBy = models.SortByCreatedAt
+	}
+	column, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return nil, errors.New("invalid sort field " + filter.SortBy)
+	}
+	if filter.Limit <= 0 || filter.Limit > models.MaxPageSize {
+		filter.Limit = models.DefaultPageSize
+	}
+
+	conditions, args := paymentConditions(d.db.dialect, filter)
+
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil || cursor.SortBy != filter.SortBy || cursor.Descending != filter.Descending {
+			return nil, ErrInvalidCursor
+		}
+
+		var value interface{} = cursor.Amount
+		if filter.SortBy != models.SortByAmount {
+			if cursor.Time == nil {
+				return nil, ErrInvalidCursor
+			}
+			value = *cursor.Time
+		}
+
+		op := ">"
+		if filter.Descending {
+			op = "<"
+		}
+		conditions = append(conditions, "("+column+" "+op+" ? OR ("+column+" = ? AND id "+op+" ?))")
+		args = append(args, value, value, cursor.ID)
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	query := `SELECT ` + paymentColumns + ` FROM payments`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY ` + column + ` ` + direction + `, id ` + direction + ` LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &models.PaymentList{Payments: []*models.Payment{}}
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list.Payments = append(list.Payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The extra row only signals that another page exists
+	if len(list.Payments) > filter.Limit {
+		list.Payments = list.Payments[:filter.Limit]
+		list.HasMore = true
+		list.NextCursor = encodeCursor(filter, list.Payments[len(list.Payments)-1])
+	}
+
+	return list, nil
+}
+
+// paymentConditions builds the WHERE conditions for a payment filter
+func paymentConditions(dl dialect, filter models.PaymentFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.MerchantID != "" {
+		conditions = append(conditions, "merchant_id = ?")
+		args = append(args, filter.MerchantID)
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = "?"
+			args = append(args, status)
+		}
+		conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.MerchantAddress != "" {
+		conditions = append(conditions, "merchant_address = ?")
+		args = append(args, filter.MerchantAddress)
+	}
+	if filter.AssetID != nil {
+		// Match payments accepting the asset in any of their options
+		conditions = append(conditions, dl.optionHasAsset())
+		args = append(args, *filter.AssetID, *filter.AssetID)
+	}
+	if filter.TxnID != "" {
+		conditions = append(conditions, "txn_id = ?")
+		args = append(args, filter.TxnID)
+	}
+	if filter.OrderReference != "" {
+		conditions = append(conditions, "order_reference = ?")
+		args = append(args, filter.OrderReference)
+	}
+	if filter.SubscriptionID != "" {
+		conditions = append(conditions, "subscription_id = ?")
+		args = append(args, filter.SubscriptionID)
+	}
+	if filter.PaymentLinkID != "" {
+		conditions = append(conditions, "payment_link_id = ?")
+		args = append(args, filter.PaymentLinkID)
+	}
+	if filter.InvoiceID != "" {
+		conditions = append(conditions, "invoice_id = ?")
+		args = append(args, filter.InvoiceID)
+	}
+	for _, key := range sortedKeys(filter.Metadata) {
+		condition, path := dl.metadataEquals(key)
+		conditions = append(conditions, condition)
+		args = append(args, path, filter.Metadata[key])
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *filter.CreatedBefore)
+	}
+	if filter.UpdatedAfter != nil {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, *filter.UpdatedAfter)
+	}
+	if filter.UpdatedBefore != nil {
+		conditions = append(conditions, "updated_at < ?")
+		args = append(args, *filter.UpdatedBefore)
+	}
+
+	return conditions, args
+}
+
+// sortedKeys returns map keys in a stable order so generated SQL is deterministic
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeCursor builds the cursor pointing after the given payment
+func encodeCursor(filter models.PaymentFilter, last *models.Payment) string {
+	cursor := paymentCursor{
+		SortBy:     filter.SortBy,
+		Descending: filter.Descending,
+		ID:         last.ID,
+	}
+
+	switch filter.SortBy {
+	case models.SortByAmount:
+		cursor.Amount = last.Amount
+	case models.SortByUpdatedAt:
+		cursor.Time = &last.UpdatedAt
+	case models.SortByExpiresAt:
+		cursor.Time = &last.ExpiresAt
+	default:
+		cursor.Time = &last.CreatedAt
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes an opaque cursor string
+func decodeCursor(encoded string) (*paymentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &paymentCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"algopay/models"
+)
+
+// merchantColumns is the column list scanned by scanMerchant
+const merchantColumns = `id, display_name, receiving_address, payout_address, accepted_assets, asset_limits, default_timeout, min_expiry_seconds, max_expiry_seconds, webhook_url, webhook_secret, late_payment_action, branding, created_at, updated_at`
+
+// CreateMerchant creates a new merchant record
+func (d *Database) CreateMerchant(merchant *models.Merchant) error {
+	acceptedAssets, assetLimits, branding, err := encodeMerchant(merchant)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO merchants (id, display_name, receiving_address, payout_address, accepted_assets, asset_limits, default_timeout, min_expiry_seconds, max_expiry_seconds, webhook_url, webhook_secret, late_payment_action, branding, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = d.db.Exec(query,
+		merchant.ID,
+		merchant.DisplayName,
+		merchant.ReceivingAddress,
+		merchant.PayoutAddress,
+		acceptedAssets,
+		assetLimits,
+		merchant.DefaultTimeout,
+		merchant.MinExpirySeconds,
+		merchant.MaxExpirySeconds,
+		merchant.WebhookURL,
+		merchant.WebhookSecret,
+		merchant.LatePaymentAction,
+		branding,
+		merchant.CreatedAt,
+		merchant.UpdatedAt,
+	)
+	return err
+}
+
+// GetMerchant retrieves a merchant by ID
+func (d *Database) GetMerchant(id string) (*models.Merchant, error) {
+	query := `SELECT ` + merchantColumns + ` FROM merchants WHERE id = ?`
+	return scanMerchant(d.db.QueryRow(query, id))
+}
+
+// ListMerchants retrieves all merchants
+func (d *Database) ListMerchants() ([]*models.Merchant, error) {
+	query := `SELECT ` + merchantColumns + ` FROM merchants ORDER BY created_at`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []*models.Merchant{}
+	for rows.Next() {
+		merchant, err := scanMerchant(rows)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, merchant)
+	}
+
+	return merchants, rows.Err()
+}
+
+// UpdateMerchant updates a merchant's settings
+func (d *Database) UpdateMerchant(merchant *models.Merchant) error {
+	acceptedAssets, assetLimits, branding, err := encodeMerchant(merchant)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE merchants
+	SET display_name = ?, receiving_address = ?, payout_address = ?, accepted_assets = ?, asset_limits = ?, default_timeout = ?,
+		min_expiry_seconds = ?, max_expiry_seconds = ?, webhook_url = ?, webhook_secret = ?, late_payment_action = ?, branding = ?, updated_at = ?
+	WHERE id = ?
+	`
+	result, err := d.db.Exec(query,
+		merchant.DisplayName,
+		merchant.ReceivingAddress,
+		merchant.PayoutAddress,
+		acceptedAssets,
+		assetLimits,
+		merchant.DefaultTimeout,
+		merchant.MinExpirySeconds,
+		merchant.MaxExpirySeconds,
+		merchant.WebhookURL,
+		merchant.WebhookSecret,
+		merchant.LatePaymentAction,
+		branding,
+		merchant.UpdatedAt,
+		merchant.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// encodeMerchant encodes the JSON columns of a merchant
+func encodeMerchant(merchant *models.Merchant) (string, string, string, error) {
+	acceptedAssets := merchant.AcceptedAssets
+	if acceptedAssets == nil {
+		acceptedAssets = []uint64{}
+	}
+	assetsJSON, err := json.Marshal(acceptedAssets)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode accepted assets: %w", err)
+	}
+
+	assetLimits := merchant.AssetLimits
+	if assetLimits == nil {
+		assetLimits = []models.AssetLimit{}
+	}
+	limitsJSON, err := json.Marshal(assetLimits)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode asset limits: %w", err)
+	}
+
+	brandingJSON, err := json.Marshal(merchant.Branding)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to encode branding: %w", err)
+	}
+
+	return string(assetsJSON), string(limitsJSON), string(brandingJSON), nil
+}
+
+// scanMerchant scans a row selected with merchantColumns
+func scanMerchant(row scanner) (*models.Merchant, error) {
+	merchant := &models.Merchant{}
+	var acceptedAssets, assetLimits, branding string
+	err := row.Scan(
+		&merchant.ID,
+		&merchant.DisplayName,
+		&merchant.ReceivingAddress,
+		&merchant.PayoutAddress,
+		&acceptedAssets,
+		&assetLimits,
+		&merchant.DefaultTimeout,
+		&merchant.MinExpirySeconds,
+		&merchant.MaxExpirySeconds,
+		&merchant.WebhookURL,
+		&merchant.WebhookSecret,
+		&merchant.LatePaymentAction,
+		&branding,
+		&merchant.CreatedAt,
+		&merchant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(acceptedAssets), &merchant.AcceptedAssets); err != nil {
+		return nil, fmt.Errorf("failed to decode accepted assets: %w", err)
+	}
+	if err := json.Unmarshal([]byte(assetLimits), &merchant.AssetLimits); err != nil {
+		return nil, fmt.Errorf("failed to decode asset limits: %w", err)
+	}
+	if err := json.Unmarshal([]byte(branding), &merchant.Branding); err != nil {
+		return nil, fmt.Errorf("failed to decode branding: %w", err)
+	}
+
+	return merchant, nil
+}
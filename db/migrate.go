@@ -0,0 +1,248 @@
+package db
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations of every dialect, one
+// NNNN_name.sql file per version under migrations/<dialect>/
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrMigrationDrift is returned when an applied migration no longer matches
+// the file it was applied from
+var ErrMigrationDrift = errors.New("applied migration has changed")
+
+// ErrUnknownMigration is returned when the database has a migration applied
+// that this build does not include, usually because a newer build ran
+var ErrUnknownMigration = errors.New("database has a migration this build does not know")
+
+// Migration is one versioned change to the schema
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string // hex SHA-256 of SQL
+}
+
+// AppliedMigration records a migration in the schema_version table
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// migrationDir returns the directory of the dialect's migrations
+func (dl dialect) migrationDir() string {
+	if dl == dialectPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// timestampType returns the column type of stored times
+func (dl dialect) timestampType() string {
+	if dl == dialectPostgres {
+		return "TIMESTAMPTZ"
+	}
+	return "TIMESTAMP"
+}
+
+// tableExists returns a query counting the tables named by its placeholder
+func (dl dialect) tableExists() string {
+	if dl == dialectPostgres {
+		return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+// lockMigrations keeps instances starting together from applying the same
+// migration. SQLite transactions hold the write lock from the start.
+func (dl dialect) lockMigrations(tx *txn) error {
+	if dl != dialectPostgres {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('algopay_schema_version'))`)
+	return err
+}
+
+// Migrations returns every migration of the database's dialect in version order
+func (d *Database) Migrations() ([]Migration, error) {
+	return loadMigrations(d.db.dialect.migrationDir())
+}
+
+// loadMigrations reads the migrations in dir. Versions must start at 1 and
+// have no gaps, so a missing file is caught before anything is applied.
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, label, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: file name must be NNNN_name.sql", entry.Name())
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     label,
+			SQL:      string(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: expected version %d", migration.Version, migration.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// AppliedMigrations returns the migrations recorded in schema_version in
+// version order; none when the table does not exist yet
+func (d *Database) AppliedMigrations() ([]AppliedMigration, error) {
+	var tables int
+	if err := d.db.QueryRow(d.db.dialect.tableExists(), "schema_version").Scan(&tables); err != nil {
+		return nil, err
+	}
+	if tables == 0 {
+		return nil, nil
+	}
+
+	rows, err := d.db.Query(`SELECT version, name, checksum, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var migration AppliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.Checksum, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, rows.Err()
+}
+
+// PendingMigrations returns the migrations Migrate would apply, without
+// changing the database. It returns ErrMigrationDrift or ErrUnknownMigration
+// if the applied migrations do not match this build's.
+func (d *Database) PendingMigrations() ([]Migration, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(migrations, applied)
+}
+
+// pendingMigrations checks the applied migrations against the known ones and
+// returns those not applied yet
+func pendingMigrations(migrations []Migration, applied []AppliedMigration) ([]Migration, error) {
+	for _, record := range applied {
+		if record.Version > len(migrations) {
+			return nil, fmt.Errorf("%w: version %d (%s)", ErrUnknownMigration, record.Version, record.Name)
+		}
+		if migration := migrations[record.Version-1]; migration.Checksum != record.Checksum {
+			return nil, fmt.Errorf("%w: %04d_%s.sql was applied with checksum %s but is now %s",
+				ErrMigrationDrift, migration.Version, migration.Name, record.Checksum, migration.Checksum)
+		}
+	}
+	return migrations[len(applied):], nil
+}
+
+// Migrate applies every pending migration in order and returns the ones it
+// applied. Each migration runs in its own transaction with its
+// schema_version record, so a failure leaves the earlier ones applied.
+func (d *Database) Migrate() ([]Migration, error) {
+	if _, err := d.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at ` + d.db.dialect.timestampType() + ` NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_version: %w", err)
+	}
+
+	pending, err := d.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range pending {
+		ok, err := d.applyMigration(migration)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ok {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration runs one migration and records it, reporting false when
+// another process applied it first
+func (d *Database) applyMigration(migration Migration) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := d.db.dialect.lockMigrations(tx); err != nil {
+		return false, err
+	}
+	var done int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM schema_version WHERE version = ?`, migration.Version).Scan(&done); err != nil {
+		return false, err
+	}
+	if done > 0 {
+		return false, nil
+	}
+
+	// Run on the raw transaction: migration files may contain ? in literals
+	if _, err := tx.Tx.Exec(migration.SQL); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_version (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
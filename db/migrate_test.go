@@ -0,0 +1,97 @@
+package db_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+)
+
+// baselineSchema is the schema created by releases before versioned
+// migrations
+const baselineSchema = `
+CREATE TABLE IF NOT EXISTS payments (
+	id TEXT PRIMARY KEY,
+	merchant_address TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	callback_url TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	txn_id TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
+CREATE INDEX IF NOT EXISTS idx_payments_merchant ON payments(merchant_address);
+CREATE INDEX IF NOT EXISTS idx_payments_expires ON payments(expires_at);
+`
+
+// TestMigrateBaselineDatabase migrates a database created before versioned
+// migrations and checks its payments survive
+func TestMigrateBaselineDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "algopay.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	created := time.Now().UTC().Truncate(time.Second)
+	if _, err := legacy.Exec(baselineSchema); err != nil {
+		t.Fatalf("create baseline schema: %v", err)
+	}
+	_, err = legacy.Exec(`INSERT INTO payments (id, merchant_address, amount, asset_id, callback_url, status, txn_id, created_at, updated_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		"legacy-1", "LEGACYADDR", 1500000, 0, "https://example.com/cb", "completed", "TXN-1", created, created, created.Add(time.Hour))
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("insert legacy payment: %v", err)
+	}
+
+	database, err := db.NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer database.Close()
+
+	applied, err := database.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	migrations, err := database.Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if pending, err := database.PendingMigrations(); err != nil || len(pending) != 0 {
+		t.Fatalf("PendingMigrations = %d, %v after Migrate", len(pending), err)
+	}
+
+	payment, err := database.GetPayment("", "legacy-1")
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if payment.MerchantAddress != "LEGACYADDR" || payment.Amount != 1500000 ||
+		payment.Status != models.PaymentStatusCompleted || payment.TxnID != "TXN-1" || payment.Version != 0 {
+		t.Fatalf("legacy payment = %+v", payment)
+	}
+
+	fresh := &models.Payment{
+		ID:              "new-1",
+		MerchantID:      "m1",
+		MerchantAddress: "ADDR",
+		Amount:          10,
+		Status:          models.PaymentStatusPending,
+		CreatedAt:       created,
+		UpdatedAt:       created,
+		ExpiresAt:       created.Add(time.Hour),
+	}
+	if err := database.CreatePayment(fresh, models.PaymentCaps{}); err != nil {
+		t.Fatalf("CreatePayment after migrating: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+-- The SQLite baseline with PostgreSQL types
+
+CREATE TABLE IF NOT EXISTS payments (
+	id TEXT PRIMARY KEY,
+	merchant_address TEXT NOT NULL,
+	amount BIGINT NOT NULL,
+	asset_id BIGINT NOT NULL DEFAULT 0,
+	callback_url TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	txn_id TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
+CREATE INDEX IF NOT EXISTS idx_payments_merchant ON payments(merchant_address);
+CREATE INDEX IF NOT EXISTS idx_payments_expires ON payments(expires_at);
@@ -0,0 +1,3 @@
+-- Payment updates are conditional on the version they read
+
+ALTER TABLE payments ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,32 @@
+-- Append-only, hash-chained audit trail of payment changes and admin actions
+
+CREATE TABLE audit_log (
+	id BIGINT PRIMARY KEY,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	resource_id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL DEFAULT '',
+	actor_type TEXT NOT NULL,
+	actor_id TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	before_value TEXT NOT NULL DEFAULT '',
+	after_value TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	prev_hash TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_log_resource ON audit_log(resource, resource_id, id);
+CREATE INDEX idx_audit_log_merchant ON audit_log(merchant_id, id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
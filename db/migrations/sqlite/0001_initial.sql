@@ -0,0 +1,19 @@
+-- Tables as created before versioned migrations. IF NOT EXISTS lets this
+-- baseline apply to databases that already have them.
+
+CREATE TABLE IF NOT EXISTS payments (
+	id TEXT PRIMARY KEY,
+	merchant_address TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	callback_url TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	txn_id TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments(status);
+CREATE INDEX IF NOT EXISTS idx_payments_merchant ON payments(merchant_address);
+CREATE INDEX IF NOT EXISTS idx_payments_expires ON payments(expires_at);
@@ -0,0 +1,265 @@
+-- Merchants, API keys and the features built on them, with the payment
+-- columns they need
+
+ALTER TABLE payments ADD COLUMN merchant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN subscription_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN payment_link_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN invoice_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN split_rules TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN payment_options TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE payments ADD COLUMN order_reference TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE payments ADD COLUMN settled_asset_id INTEGER;
+ALTER TABLE payments ADD COLUMN payer_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN received_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN late BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE payments ADD COLUMN refund_txn_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN refund_fee INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN refund_last_valid INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN fiat_amount TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN fiat_currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN exchange_rate TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN rate_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN rate_timestamp TIMESTAMP;
+
+CREATE INDEX idx_payments_merchant_id ON payments(merchant_id, created_at);
+CREATE INDEX idx_payments_txn ON payments(txn_id);
+CREATE INDEX idx_payments_order_reference ON payments(merchant_id, order_reference);
+CREATE INDEX idx_payments_subscription ON payments(subscription_id);
+CREATE INDEX idx_payments_payment_link ON payments(payment_link_id);
+CREATE INDEX idx_payments_invoice ON payments(invoice_id);
+
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	type TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_merchant ON api_keys(merchant_id);
+
+CREATE TABLE merchants (
+	id TEXT PRIMARY KEY,
+	display_name TEXT NOT NULL,
+	receiving_address TEXT NOT NULL,
+	payout_address TEXT NOT NULL DEFAULT '',
+	accepted_assets TEXT NOT NULL DEFAULT '[]',
+	asset_limits TEXT NOT NULL DEFAULT '[]',
+	default_timeout INTEGER NOT NULL DEFAULT 0,
+	min_expiry_seconds INTEGER NOT NULL DEFAULT 0,
+	max_expiry_seconds INTEGER NOT NULL DEFAULT 0,
+	webhook_url TEXT NOT NULL DEFAULT '',
+	webhook_secret TEXT NOT NULL DEFAULT '',
+	late_payment_action TEXT NOT NULL DEFAULT 'manual',
+	branding TEXT NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE idempotency_keys (
+	merchant_id TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	response_body TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (merchant_id, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+
+CREATE TABLE monitor_state (
+	name TEXT PRIMARY KEY,
+	last_round INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE subscriptions (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	plan TEXT NOT NULL,
+	customer_reference TEXT NOT NULL DEFAULT '',
+	amount INTEGER NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	interval_unit TEXT NOT NULL,
+	interval_count INTEGER NOT NULL DEFAULT 1,
+	anchor_date TIMESTAMP NOT NULL,
+	grace_period_seconds INTEGER NOT NULL,
+	dunning_retries INTEGER NOT NULL DEFAULT 0,
+	dunning_interval_seconds INTEGER NOT NULL,
+	callback_url TEXT NOT NULL DEFAULT '',
+	metadata TEXT NOT NULL DEFAULT '{}',
+	status TEXT NOT NULL DEFAULT 'active',
+	period INTEGER NOT NULL DEFAULT 0,
+	next_billing_at TIMESTAMP NOT NULL,
+	open_payment_id TEXT NOT NULL DEFAULT '',
+	attempt INTEGER NOT NULL DEFAULT 0,
+	next_retry_at TIMESTAMP,
+	last_paid_at TIMESTAMP,
+	cancelled_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_subscriptions_merchant ON subscriptions(merchant_id, created_at);
+CREATE INDEX idx_subscriptions_billing ON subscriptions(status, next_billing_at);
+
+CREATE TABLE payment_links (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	slug TEXT NOT NULL UNIQUE,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	amount_type TEXT NOT NULL,
+	amount INTEGER NOT NULL DEFAULT 0,
+	min_amount INTEGER NOT NULL DEFAULT 0,
+	max_amount INTEGER NOT NULL DEFAULT 0,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	max_payments INTEGER NOT NULL DEFAULT 0,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	active_from TIMESTAMP,
+	active_until TIMESTAMP,
+	expires_in_seconds INTEGER NOT NULL DEFAULT 0,
+	callback_url TEXT NOT NULL DEFAULT '',
+	order_reference TEXT NOT NULL DEFAULT '',
+	metadata TEXT NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_payment_links_merchant ON payment_links(merchant_id, created_at);
+
+CREATE TABLE invoices (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	number TEXT NOT NULL,
+	sequence INTEGER NOT NULL,
+	payment_id TEXT NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	unit_name TEXT NOT NULL DEFAULT '',
+	decimals INTEGER NOT NULL DEFAULT 0,
+	customer_name TEXT NOT NULL DEFAULT '',
+	customer_email TEXT NOT NULL DEFAULT '',
+	customer_address TEXT NOT NULL DEFAULT '',
+	notes TEXT NOT NULL DEFAULT '',
+	line_items TEXT NOT NULL DEFAULT '[]',
+	discounts TEXT NOT NULL DEFAULT '[]',
+	tax_lines TEXT NOT NULL DEFAULT '[]',
+	subtotal INTEGER NOT NULL,
+	discount_total INTEGER NOT NULL DEFAULT 0,
+	tax_total INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL,
+	metadata TEXT NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (merchant_id, sequence)
+);
+
+CREATE INDEX idx_invoices_merchant ON invoices(merchant_id, created_at);
+
+CREATE TABLE split_payouts (
+	id TEXT PRIMARY KEY,
+	payment_id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	address TEXT NOT NULL,
+	label TEXT NOT NULL DEFAULT '',
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	amount INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	txn_id TEXT NOT NULL DEFAULT '',
+	group_id TEXT NOT NULL DEFAULT '',
+	fee INTEGER NOT NULL DEFAULT 0,
+	last_valid INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (payment_id, position)
+);
+
+CREATE INDEX idx_split_payouts_status ON split_payouts(status);
+
+CREATE TABLE journal_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	merchant_id TEXT NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	kind TEXT NOT NULL,
+	reference TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (kind, reference)
+);
+
+CREATE INDEX idx_journal_entries_merchant ON journal_entries(merchant_id, asset_id);
+
+CREATE TABLE journal_lines (
+	entry_id INTEGER NOT NULL REFERENCES journal_entries(id),
+	merchant_id TEXT NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	account TEXT NOT NULL,
+	debit INTEGER NOT NULL DEFAULT 0,
+	credit INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_journal_lines_entry ON journal_lines(entry_id);
+CREATE INDEX idx_journal_lines_account ON journal_lines(merchant_id, asset_id, account);
+
+CREATE TABLE payouts (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	asset_id INTEGER NOT NULL DEFAULT 0,
+	amount INTEGER NOT NULL,
+	source TEXT NOT NULL,
+	destination TEXT NOT NULL,
+	status TEXT NOT NULL,
+	txn_id TEXT NOT NULL DEFAULT '',
+	fee INTEGER NOT NULL DEFAULT 0,
+	last_valid INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_payouts_merchant ON payouts(merchant_id, created_at);
+CREATE INDEX idx_payouts_status ON payouts(status);
+
+CREATE TABLE reconciliation_reports (
+	id TEXT PRIMARY KEY,
+	scope TEXT NOT NULL,
+	addresses INTEGER NOT NULL DEFAULT 0,
+	transfers_checked INTEGER NOT NULL DEFAULT 0,
+	payments_checked INTEGER NOT NULL DEFAULT 0,
+	matched INTEGER NOT NULL DEFAULT 0,
+	discrepancies TEXT NOT NULL DEFAULT '[]',
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_reconciliation_reports_started ON reconciliation_reports(started_at);
+
+CREATE TABLE export_jobs (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL DEFAULT '',
+	dataset TEXT NOT NULL,
+	format TEXT NOT NULL,
+	range_start TIMESTAMP,
+	range_end TIMESTAMP,
+	status TEXT NOT NULL,
+	rows INTEGER NOT NULL DEFAULT 0,
+	size INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	completed_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+
+CREATE INDEX idx_export_jobs_merchant ON export_jobs(merchant_id, created_at);
+CREATE INDEX idx_export_jobs_status ON export_jobs(status);
@@ -0,0 +1,30 @@
+-- Append-only, hash-chained audit trail of payment changes and admin actions
+
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	resource_id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL DEFAULT '',
+	actor_type TEXT NOT NULL,
+	actor_id TEXT NOT NULL DEFAULT '',
+	request_id TEXT NOT NULL DEFAULT '',
+	before_value TEXT NOT NULL DEFAULT '',
+	after_value TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	prev_hash TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_audit_log_resource ON audit_log(resource, resource_id, id);
+CREATE INDEX idx_audit_log_merchant ON audit_log(merchant_id, id);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GetMonitorRound returns the last round the named monitor scanned, or 0 if
+// it has not recorded one
+func (d *Database) GetMonitorRound(name string) (uint64, error) {
+	var round uint64
+	err := d.db.QueryRow(`SELECT last_round FROM monitor_state WHERE name = ?`, name).Scan(&round)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return round, err
+}
+
+// SetMonitorRound records the last round the named monitor scanned
+func (d *Database) SetMonitorRound(name string, round uint64) error {
+	_, err := d.db.Exec(`
+	INSERT INTO monitor_state (name, last_round, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET last_round = excluded.last_round, updated_at = excluded.updated_at
+	`, name, round, time.Now())
+	return err
+}
+
+// PaymentTxnRecorded reports whether a transaction already settles a payment
+func (d *Database) PaymentTxnRecorded(txnID string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM payments WHERE txn_id = ?`, txnID).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"algopay/models"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrSlugTaken is returned when a payment link slug is already in use
+var ErrSlugTaken = errors.New("payment link slug is taken")
+
+// ErrPaymentLinkExhausted is returned when a payment would take its link over
+// the link's max_payments
+var ErrPaymentLinkExhausted = errors.New("payment link has reached its payment limit")
+
+// paymentLinkColumns is the column list scanned by scanPaymentLink
+const paymentLinkColumns = `id, merchant_id, slug, title, description, amount_type, amount, min_amount, max_amount, asset_id, max_payments, active, active_from, active_until, expires_in_seconds, callback_url, order_reference, metadata, created_at, updated_at`
+
+// CreatePaymentLink creates a new payment link record
+func (d *Database) CreatePaymentLink(link *models.PaymentLink) error {
+	metadata, err := encodeMetadata(link.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO payment_links (` + paymentLinkColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = d.db.Exec(query,
+		link.ID,
+		link.MerchantID,
+		link.Slug,
+		link.Title,
+		link.Description,
+		link.AmountType,
+		link.Amount,
+		link.MinAmount,
+		link.MaxAmount,
+		link.AssetID,
+		link.MaxPayments,
+		link.Active,
+		link.ActiveFrom,
+		link.ActiveUntil,
+		link.ExpiresInSeconds,
+		link.CallbackURL,
+		link.OrderReference,
+		metadata,
+		link.CreatedAt,
+		link.UpdatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	return err
+}
+
+// GetPaymentLink retrieves a payment link by ID, restricted to the given merchant
+func (d *Database) GetPaymentLink(merchantID, id string) (*models.PaymentLink, error) {
+	query := `SELECT ` + paymentLinkColumns + ` FROM payment_links WHERE id = ? AND merchant_id = ?`
+	return scanPaymentLink(d.db.QueryRow(query, id, merchantID))
+}
+
+// GetPaymentLinkBySlug retrieves a payment link by its public slug
+func (d *Database) GetPaymentLinkBySlug(slug string) (*models.PaymentLink, error) {
+	query := `SELECT ` + paymentLinkColumns + ` FROM payment_links WHERE slug = ?`
+	return scanPaymentLink(d.db.QueryRow(query, slug))
+}
+
+// ListPaymentLinks retrieves a merchant's payment links, newest first
+func (d *Database) ListPaymentLinks(merchantID string) ([]*models.PaymentLink, error) {
+	query := `SELECT ` + paymentLinkColumns + ` FROM payment_links WHERE merchant_id = ? ORDER BY created_at DESC`
+	rows, err := d.db.Query(query, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*models.PaymentLink{}
+	for rows.Next() {
+		link, err := scanPaymentLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// UpdatePaymentLink updates a payment link's settings
+func (d *Database) UpdatePaymentLink(link *models.PaymentLink) error {
+	metadata, err := encodeMetadata(link.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE payment_links
+	SET slug = ?, title = ?, description = ?, amount_type = ?, amount = ?, min_amount = ?, max_amount = ?, asset_id = ?,
+		max_payments = ?, active = ?, active_from = ?, active_until = ?, expires_in_seconds = ?, callback_url = ?,
+		order_reference = ?, metadata = ?, updated_at = ?
+	WHERE id = ? AND merchant_id = ?
+	`
+	result, err := d.db.Exec(query,
+		link.Slug,
+		link.Title,
+		link.Description,
+		link.AmountType,
+		link.Amount,
+		link.MinAmount,
+		link.MaxAmount,
+		link.AssetID,
+		link.MaxPayments,
+		link.Active,
+		link.ActiveFrom,
+		link.ActiveUntil,
+		link.ExpiresInSeconds,
+		link.CallbackURL,
+		link.OrderReference,
+		metadata,
+		link.UpdatedAt,
+		link.ID,
+		link.MerchantID,
+	)
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPaymentLinkStats counts the payments produced by each of the given
+// links; links without payments have zero stats
+func (d *Database) GetPaymentLinkStats(linkIDs ...string) (map[string]*models.PaymentLinkStats, error) {
+	stats := make(map[string]*models.PaymentLinkStats, len(linkIDs))
+	if len(linkIDs) == 0 {
+		return stats, nil
+	}
+
+	args := make([]interface{}, len(linkIDs))
+	for i, id := range linkIDs {
+		stats[id] = &models.PaymentLinkStats{}
+		args[i] = id
+	}
+
+	query := `
+	SELECT payment_link_id, COUNT(*),
+		COUNT(CASE WHEN status = 'pending' THEN 1 END),
+		COUNT(CASE WHEN status = 'completed' THEN 1 END),
+		COALESCE(SUM(CASE WHEN status = 'completed' THEN COALESCE(NULLIF(received_amount, 0), amount) END), 0)
+	FROM payments
+	WHERE payment_link_id IN (?` + strings.Repeat(", ?", len(linkIDs)-1) + `)
+	GROUP BY payment_link_id
+	`
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var linkStats models.PaymentLinkStats
+		if err := rows.Scan(&id, &linkStats.Payments, &linkStats.Pending, &linkStats.Completed, &linkStats.AmountCollected); err != nil {
+			return nil, err
+		}
+		stats[id] = &linkStats
+	}
+
+	return stats, rows.Err()
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure.
+// Postgres drivers report the SQLSTATE, where 23505 is unique_violation.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == "23505"
+}
+
+// scanPaymentLink scans a row selected with paymentLinkColumns
+func scanPaymentLink(row scanner) (*models.PaymentLink, error) {
+	link := &models.PaymentLink{}
+	var metadata string
+	var activeFrom, activeUntil sql.NullTime
+	err := row.Scan(
+		&link.ID,
+		&link.MerchantID,
+		&link.Slug,
+		&link.Title,
+		&link.Description,
+		&link.AmountType,
+		&link.Amount,
+		&link.MinAmount,
+		&link.MaxAmount,
+		&link.AssetID,
+		&link.MaxPayments,
+		&link.Active,
+		&activeFrom,
+		&activeUntil,
+		&link.ExpiresInSeconds,
+		&link.CallbackURL,
+		&link.OrderReference,
+		&metadata,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &link.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if activeFrom.Valid {
+		link.ActiveFrom = &activeFrom.Time
+	}
+	if activeUntil.Valid {
+		link.ActiveUntil = &activeUntil.Time
+	}
+
+	return link, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"algopay/models"
+)
+
+// ErrInsufficientBalance is returned when a payout exceeds the available balance
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// ErrPayoutChanged is returned when a payout is not in the state an update expects
+var ErrPayoutChanged = errors.New("payout changed")
+
+// payoutColumns is the column list scanned by scanPayout
+const payoutColumns = `id, merchant_id, asset_id, amount, source, destination, status, txn_id, fee, last_valid, attempts, error, created_at, updated_at`
+
+// CreatePayout records a payout with the journal entry that sets its funds
+// aside. It returns ErrInsufficientBalance and records nothing unless at least
+// reserve remains available afterwards. The balance is checked after the
+// entry is written, while the merchant is locked, so concurrent payouts
+// cannot overdraw it.
+func (d *Database) CreatePayout(payout *models.Payout, entry *models.JournalEntry, reserve uint64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.db.dialect.lockMerchant(tx, payout.MerchantID); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO payouts (` + payoutColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(query,
+		payout.ID,
+		payout.MerchantID,
+		payout.AssetID,
+		payout.Amount,
+		payout.Source,
+		payout.Destination,
+		payout.Status,
+		payout.TxnID,
+		payout.Fee,
+		payout.LastValid,
+		payout.Attempts,
+		payout.Error,
+		payout.CreatedAt,
+		payout.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := postJournalEntry(tx, entry); err != nil {
+		return err
+	}
+
+	available, err := accountBalance(tx, payout.MerchantID, payout.AssetID, models.LedgerReceiving)
+	if err != nil {
+		return err
+	}
+	if available < int64(reserve) {
+		return ErrInsufficientBalance
+	}
+	return tx.Commit()
+}
+
+// GetPayout retrieves a merchant's payout by ID
+func (d *Database) GetPayout(merchantID, id string) (*models.Payout, error) {
+	query := `SELECT ` + payoutColumns + ` FROM payouts WHERE merchant_id = ? AND id = ?`
+	return scanPayout(d.db.QueryRow(query, merchantID, id))
+}
+
+// ListPayouts retrieves a merchant's payouts, newest first, optionally
+// filtered by status
+func (d *Database) ListPayouts(merchantID string, status models.PayoutStatus) ([]*models.Payout, error) {
+	query := `SELECT ` + payoutColumns + ` FROM payouts WHERE merchant_id = ?`
+	args := []interface{}{merchantID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	return d.queryPayouts(query, args...)
+}
+
+// GetPayoutsByStatus retrieves the payouts of every merchant in a status
+func (d *Database) GetPayoutsByStatus(status models.PayoutStatus) ([]*models.Payout, error) {
+	query := `SELECT ` + payoutColumns + ` FROM payouts WHERE status = ? ORDER BY created_at`
+	return d.queryPayouts(query, status)
+}
+
+// queryPayouts runs a query selecting payoutColumns
+func (d *Database) queryPayouts(query string, args ...interface{}) ([]*models.Payout, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []*models.Payout{}
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, rows.Err()
+}
+
+// UpdatePayout saves the state of a payout expected to be in status from,
+// posting any journal entries that record the change. It returns
+// ErrPayoutChanged and saves nothing if the payout has moved on.
+func (d *Database) UpdatePayout(from models.PayoutStatus, payout *models.Payout, entries ...*models.JournalEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+	UPDATE payouts
+	SET status = ?, txn_id = ?, fee = ?, last_valid = ?, attempts = ?, error = ?, updated_at = ?
+	WHERE id = ? AND status = ?
+	`, payout.Status, payout.TxnID, payout.Fee, payout.LastValid, payout.Attempts, payout.Error, now, payout.ID, from)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPayoutChanged
+	}
+	if err := postJournalEntries(tx, entries); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	payout.UpdatedAt = now
+	return nil
+}
+
+// scanPayout reads a payout from a row selected with payoutColumns
+func scanPayout(row scanner) (*models.Payout, error) {
+	payout := &models.Payout{}
+	err := row.Scan(
+		&payout.ID,
+		&payout.MerchantID,
+		&payout.AssetID,
+		&payout.Amount,
+		&payout.Source,
+		&payout.Destination,
+		&payout.Status,
+		&payout.TxnID,
+		&payout.Fee,
+		&payout.LastValid,
+		&payout.Attempts,
+		&payout.Error,
+		&payout.CreatedAt,
+		&payout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// postgresDriver is the database/sql driver name Postgres connections use.
+// No driver is linked by default; build with -tags postgres to include one.
+const postgresDriver = "postgres"
+
+// NewPostgresDatabase connects to a PostgreSQL database. Like NewDatabase,
+// it leaves the schema to Migrate.
+func NewPostgresDatabase(dsn string) (*Database, error) {
+	if !driverRegistered(postgresDriver) {
+		return nil, fmt.Errorf("failed to open database: PostgreSQL support is not compiled in; rebuild with -tags postgres")
+	}
+
+	db, err := sql.Open(postgresDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &Database{db: &conn{DB: db, dialect: dialectPostgres}}, nil
+}
+
+// Open opens the database named by a postgres:// or postgresql:// URL, or the
+// SQLite file at path when url is empty
+func Open(url, path string) (*Database, error) {
+	switch {
+	case url == "":
+		return NewDatabase(path)
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return NewPostgresDatabase(url)
+	}
+	return nil, fmt.Errorf("unsupported database URL %q: expected postgres:// or postgresql://", redactURL(url))
+}
+
+// driverRegistered reports whether a database/sql driver is linked in
+func driverRegistered(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL returns the scheme of a database URL, so errors never echo its
+// credentials
+func redactURL(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		return url[:i+3] + "..."
+	}
+	return "..."
+}
@@ -0,0 +1,6 @@
+//go:build postgres
+
+package db
+
+// Registers the "postgres" database/sql driver used by NewPostgresDatabase
+import _ "github.com/lib/pq"
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"algopay/models"
+)
+
+// reconciliationReportColumns is the column list scanned by scanReconciliationReport
+const reconciliationReportColumns = `id, scope, addresses, transfers_checked, payments_checked, matched, discrepancies, started_at, finished_at`
+
+// txnIDBatchSize bounds the transaction IDs bound into one query
+const txnIDBatchSize = 500
+
+// ReconciliationAddresses returns the receiving addresses of a merchant, or of
+// every merchant when merchantID is empty, mapped to the merchant they belong
+// to. Addresses that earlier payments were sent to are included.
+func (d *Database) ReconciliationAddresses(merchantID string) (map[string]string, error) {
+	query := `
+	SELECT receiving_address, id FROM merchants WHERE ? IN ('', id)
+	UNION
+	SELECT DISTINCT merchant_address, merchant_id FROM payments WHERE ? IN ('', merchant_id)
+	`
+	rows, err := d.db.Query(query, merchantID, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := map[string]string{}
+	for rows.Next() {
+		var address, owner string
+		if err := rows.Scan(&address, &owner); err != nil {
+			return nil, err
+		}
+		if _, ok := addresses[address]; !ok || owner != "" {
+			addresses[address] = owner
+		}
+	}
+
+	return addresses, rows.Err()
+}
+
+// ReconciliationPayments retrieves payments that claim a transaction and were
+// active in the window: created before it ends and last updated after it
+// starts. Zero times leave that side open.
+func (d *Database) ReconciliationPayments(merchantID string, from, to time.Time) ([]*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE txn_id != ''`
+	var args []interface{}
+	if merchantID != "" {
+		query += ` AND merchant_id = ?`
+		args = append(args, merchantID)
+	}
+	if !from.IsZero() {
+		query += ` AND updated_at >= ?`
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += ` AND created_at <= ?`
+		args = append(args, to)
+	}
+	query += ` ORDER BY created_at`
+
+	return d.queryPayments(query, args...)
+}
+
+// GetPaymentsByTxnIDs retrieves the payments of every merchant that claim any
+// of the transactions
+func (d *Database) GetPaymentsByTxnIDs(txnIDs []string) ([]*models.Payment, error) {
+	payments := []*models.Payment{}
+	for start := 0; start < len(txnIDs); start += txnIDBatchSize {
+		batch := txnIDs[start:min(start+txnIDBatchSize, len(txnIDs))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		found, err := d.queryPayments(`SELECT `+paymentColumns+` FROM payments WHERE txn_id IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, found...)
+	}
+	return payments, nil
+}
+
+// CreateReconciliationReport stores the outcome of a reconciliation run
+func (d *Database) CreateReconciliationReport(report *models.ReconciliationReport) error {
+	window, err := json.Marshal(report.Window)
+	if err != nil {
+		return fmt.Errorf("failed to encode reconciliation window: %w", err)
+	}
+	discrepancies, err := json.Marshal(report.Discrepancies)
+	if err != nil {
+		return fmt.Errorf("failed to encode discrepancies: %w", err)
+	}
+
+	query := `
+	INSERT INTO reconciliation_reports (` + reconciliationReportColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = d.db.Exec(query,
+		report.ID,
+		string(window),
+		report.Addresses,
+		report.TransfersChecked,
+		report.PaymentsChecked,
+		report.Matched,
+		string(discrepancies),
+		report.StartedAt,
+		report.FinishedAt,
+	)
+	return err
+}
+
+// GetReconciliationReport retrieves a reconciliation report by ID
+func (d *Database) GetReconciliationReport(id string) (*models.ReconciliationReport, error) {
+	query := `SELECT ` + reconciliationReportColumns + ` FROM reconciliation_reports WHERE id = ?`
+	return scanReconciliationReport(d.db.QueryRow(query, id))
+}
+
+// ListReconciliationReports retrieves the most recent reconciliation reports
+func (d *Database) ListReconciliationReports(limit int) ([]*models.ReconciliationReport, error) {
+	query := `SELECT ` + reconciliationReportColumns + ` FROM reconciliation_reports ORDER BY started_at DESC LIMIT ?`
+	rows, err := d.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*models.ReconciliationReport{}
+	for rows.Next() {
+		report, err := scanReconciliationReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// scanReconciliationReport reads a report from a row selected with
+// reconciliationReportColumns
+func scanReconciliationReport(row scanner) (*models.ReconciliationReport, error) {
+	report := &models.ReconciliationReport{}
+	var window, discrepancies string
+	err := row.Scan(
+		&report.ID,
+		&window,
+		&report.Addresses,
+		&report.TransfersChecked,
+		&report.PaymentsChecked,
+		&report.Matched,
+		&discrepancies,
+		&report.StartedAt,
+		&report.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(window), &report.Window); err != nil {
+		return nil, fmt.Errorf("failed to decode reconciliation window: %w", err)
+	}
+	if err := json.Unmarshal([]byte(discrepancies), &report.Discrepancies); err != nil {
+		return nil, fmt.Errorf("failed to decode discrepancies: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"algopay/models"
+)
+
+// ErrSplitPayoutsChanged is returned when payouts are not in the state an update expects
+var ErrSplitPayoutsChanged = errors.New("split payouts changed")
+
+// splitPayoutColumns is the column list scanned by scanSplitPayout
+const splitPayoutColumns = `id, payment_id, merchant_id, position, address, label, asset_id, amount, status, txn_id, group_id, fee, last_valid, attempts, error, created_at, updated_at`
+
+// CreateSplitPayouts records the payouts of a completed payment with the
+// journal entries that set their funds aside. Payouts and entries that already
+// exist are left alone, so recording them twice is harmless.
+func (d *Database) CreateSplitPayouts(payouts []*models.SplitPayout, entries ...*models.JournalEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO split_payouts (` + splitPayoutColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (payment_id, position) DO NOTHING
+	`
+	for _, payout := range payouts {
+		_, err := tx.Exec(query,
+			payout.ID,
+			payout.PaymentID,
+			payout.MerchantID,
+			payout.Position,
+			payout.Address,
+			payout.Label,
+			payout.AssetID,
+			payout.Amount,
+			payout.Status,
+			payout.TxnID,
+			payout.GroupID,
+			payout.Fee,
+			payout.LastValid,
+			payout.Attempts,
+			payout.Error,
+			payout.CreatedAt,
+			payout.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := postJournalEntries(tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSplitPayouts retrieves a payment's payouts in split rule order
+func (d *Database) GetSplitPayouts(paymentID string) ([]*models.SplitPayout, error) {
+	query := `SELECT ` + splitPayoutColumns + ` FROM split_payouts WHERE payment_id = ? ORDER BY position`
+	rows, err := d.db.Query(query, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []*models.SplitPayout{}
+	for rows.Next() {
+		payout, err := scanSplitPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, rows.Err()
+}
+
+// GetPaymentsWithSplitPayouts returns the IDs of payments that have payouts
+// in the given status
+func (d *Database) GetPaymentsWithSplitPayouts(status models.SplitPayoutStatus) ([]string, error) {
+	rows, err := d.db.Query(`SELECT DISTINCT payment_id FROM split_payouts WHERE status = ?`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// UpdateSplitPayouts saves the state of payouts that are all expected to be in
+// status from, posting any journal entries that record the change. It returns
+// ErrSplitPayoutsChanged and saves nothing if any of them has moved on.
+func (d *Database) UpdateSplitPayouts(from models.SplitPayoutStatus, payouts []*models.SplitPayout, entries ...*models.JournalEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE split_payouts
+	SET status = ?, txn_id = ?, group_id = ?, fee = ?, last_valid = ?, attempts = ?, error = ?, updated_at = ?
+	WHERE id = ? AND status = ?
+	`
+	now := time.Now()
+	for _, payout := range payouts {
+		result, err := tx.Exec(query,
+			payout.Status,
+			payout.TxnID,
+			payout.GroupID,
+			payout.Fee,
+			payout.LastValid,
+			payout.Attempts,
+			payout.Error,
+			now,
+			payout.ID,
+			from,
+		)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrSplitPayoutsChanged
+		}
+		payout.UpdatedAt = now
+	}
+	if err := postJournalEntries(tx, entries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanSplitPayout reads a payout from a row selected with splitPayoutColumns
+func scanSplitPayout(row scanner) (*models.SplitPayout, error) {
+	payout := &models.SplitPayout{}
+	err := row.Scan(
+		&payout.ID,
+		&payout.PaymentID,
+		&payout.MerchantID,
+		&payout.Position,
+		&payout.Address,
+		&payout.Label,
+		&payout.AssetID,
+		&payout.Amount,
+		&payout.Status,
+		&payout.TxnID,
+		&payout.GroupID,
+		&payout.Fee,
+		&payout.LastValid,
+		&payout.Attempts,
+		&payout.Error,
+		&payout.CreatedAt,
+		&payout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
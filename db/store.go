@@ -0,0 +1,115 @@
+package db
+
+import (
+	"time"
+
+	"algopay/models"
+)
+
+// Store is the persistence layer the server, jobs and commands depend on.
+// *Database implements it on SQLite and PostgreSQL.
+type Store interface {
+	// Payments
+	CreatePayment(payment *models.Payment, caps models.PaymentCaps) error
+	GetPayment(merchantID, id string) (*models.Payment, error)
+	ListPayments(filter models.PaymentFilter) (*models.PaymentList, error)
+	UpdatePaymentStatus(id string, status models.PaymentStatus, txnID string) error
+	GetPendingPayments() ([]*models.Payment, error)
+	GetLatePaymentCandidates(grace time.Duration) ([]*models.Payment, error)
+	RecordPaymentMatch(payment *models.Payment) error
+	ResolveLatePayment(merchantID, id string, from, to models.PaymentStatus, refundTxnID string) (*models.Payment, error)
+	SubmitRefund(merchantID, id, refundTxnID string, fee, lastValid uint64) (*models.Payment, error)
+	GetRefundingPayments() ([]*models.Payment, error)
+	CancelPayment(merchantID, id string) (*models.Payment, error)
+	ExtendPayment(merchantID, id string, expiresAt time.Time) (*models.Payment, error)
+	ExpireOldPayments() error
+	DailyVolume(merchantID string, assetID uint64, since time.Time) (uint64, error)
+	PaymentTxnRecorded(txnID string) (bool, error)
+	GetMonitorRound(name string) (uint64, error)
+	SetMonitorRound(name string, round uint64) error
+
+	// Merchants and API keys
+	CreateMerchant(merchant *models.Merchant) error
+	GetMerchant(id string) (*models.Merchant, error)
+	ListMerchants() ([]*models.Merchant, error)
+	UpdateMerchant(merchant *models.Merchant) error
+	CreateAPIKey(key *models.APIKey) error
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	ListAPIKeys(merchantID string) ([]*models.APIKey, error)
+	TouchAPIKey(id string) error
+	RevokeAPIKey(id string) error
+
+	// Idempotency keys
+	ReserveIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(merchantID, key string, statusCode int, responseBody []byte) error
+	ReleaseIdempotencyKey(merchantID, key string) error
+	DeleteExpiredIdempotencyKeys() error
+
+	// Subscriptions
+	CreateSubscription(sub *models.Subscription) error
+	GetSubscription(merchantID, id string) (*models.Subscription, error)
+	ListSubscriptions(merchantID string, status models.SubscriptionStatus) ([]*models.Subscription, error)
+	GetDueSubscriptions(now time.Time) ([]*models.Subscription, error)
+	GetSubscriptionsWithClosedInvoices() ([]*models.Subscription, error)
+	SaveSubscriptionState(sub *models.Subscription, fromStatus models.SubscriptionStatus, fromOpenPaymentID string) error
+
+	// Payment links
+	CreatePaymentLink(link *models.PaymentLink) error
+	GetPaymentLink(merchantID, id string) (*models.PaymentLink, error)
+	GetPaymentLinkBySlug(slug string) (*models.PaymentLink, error)
+	ListPaymentLinks(merchantID string) ([]*models.PaymentLink, error)
+	UpdatePaymentLink(link *models.PaymentLink) error
+	GetPaymentLinkStats(linkIDs ...string) (map[string]*models.PaymentLinkStats, error)
+
+	// Invoices
+	CreateInvoice(invoice *models.Invoice) error
+	GetInvoice(merchantID, id string) (*models.Invoice, error)
+	ListInvoices(merchantID string, status models.PaymentStatus) ([]*models.Invoice, error)
+
+	// Split payouts
+	CreateSplitPayouts(payouts []*models.SplitPayout, entries ...*models.JournalEntry) error
+	GetSplitPayouts(paymentID string) ([]*models.SplitPayout, error)
+	GetPaymentsWithSplitPayouts(status models.SplitPayoutStatus) ([]string, error)
+	UpdateSplitPayouts(from models.SplitPayoutStatus, payouts []*models.SplitPayout, entries ...*models.JournalEntry) error
+
+	// Ledger and payouts
+	PostJournalEntry(entry *models.JournalEntry) error
+	GetAccountBalances(merchantID string) ([]models.AccountBalance, error)
+	ListJournalEntries(merchantID string, assetID *uint64, after int64, limit int) (*models.JournalEntryList, error)
+	CreatePayout(payout *models.Payout, entry *models.JournalEntry, reserve uint64) error
+	GetPayout(merchantID, id string) (*models.Payout, error)
+	ListPayouts(merchantID string, status models.PayoutStatus) ([]*models.Payout, error)
+	GetPayoutsByStatus(status models.PayoutStatus) ([]*models.Payout, error)
+	UpdatePayout(from models.PayoutStatus, payout *models.Payout, entries ...*models.JournalEntry) error
+
+	// Reconciliation
+	ReconciliationAddresses(merchantID string) (map[string]string, error)
+	ReconciliationPayments(merchantID string, from, to time.Time) ([]*models.Payment, error)
+	GetPaymentsByTxnIDs(txnIDs []string) ([]*models.Payment, error)
+	CreateReconciliationReport(report *models.ReconciliationReport) error
+	GetReconciliationReport(id string) (*models.ReconciliationReport, error)
+	ListReconciliationReports(limit int) ([]*models.ReconciliationReport, error)
+
+	// Exports
+	ExportPayments(filter models.ExportFilter, fn func(*models.Payment) error) error
+	ExportTransactions(filter models.ExportFilter, types []string, fn func(*models.ExportTransaction) error) error
+	ExportFees(filter models.ExportFilter, fn func(*models.ExportFee) error) error
+	CreateExportJob(job *models.ExportJob) error
+	GetExportJob(id string) (*models.ExportJob, error)
+	ListExportJobs(merchantID string, limit int) ([]*models.ExportJob, error)
+	ClaimExportJob() (*models.ExportJob, error)
+	RequeueExportJobs() error
+	UpdateExportJob(job *models.ExportJob) error
+	GetExpiredExportJobs(now time.Time) ([]*models.ExportJob, error)
+
+	// Audit log
+	As(actor models.Actor) Store
+	AppendAuditEntry(entry *models.AuditEntry) error
+	ListAuditEntries(filter models.AuditFilter) (*models.AuditEntryList, error)
+	ExportAuditEntries(filter models.ExportFilter, fn func(*models.AuditEntry) error) error
+	VerifyAuditLog() (*models.AuditVerification, error)
+
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,15 @@
+//go:build postgres
+
+package db_test
+
+import (
+	"testing"
+
+	"algopay/db/storetest"
+)
+
+// TestPostgres runs the store conformance suite on the PostgreSQL database
+// named by ALGOPAY_TEST_POSTGRES_URL, and skips when it is unset
+func TestPostgres(t *testing.T) {
+	storetest.Run(t, storetest.Postgres)
+}
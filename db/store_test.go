@@ -0,0 +1,23 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"algopay/db/storetest"
+)
+
+// TestSQLite runs the store conformance suite on SQLite
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, storetest.SQLite)
+}
+
+// TestSQLiteNonUTC runs the store conformance suite on SQLite with a local
+// zone ahead of UTC, as on servers not running in UTC
+func TestSQLiteNonUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("JST", 9*60*60)
+	defer func() { time.Local = local }()
+
+	storetest.Run(t, storetest.SQLite)
+}
@@ -0,0 +1,1055 @@
+// Package storetest is a conformance suite for db.Store implementations.
+// A backend passes when every subtest of Run passes against a fresh store:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, storetest.SQLite)
+//	}
+package storetest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/google/uuid"
+)
+
+// PostgresURLEnv names the environment variable holding the URL of a
+// PostgreSQL database the suite may wipe. Postgres skips when it is unset.
+const PostgresURLEnv = "ALGOPAY_TEST_POSTGRES_URL"
+
+// Run runs the suite, opening a new empty store for each subtest
+func Run(t *testing.T, open func(t *testing.T) db.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store db.Store)
+	}{
+		{"Payments", testPayments},
+		{"PaymentStatus", testPaymentStatus},
+		{"PaymentVersion", testPaymentVersion},
+		{"ConcurrentTransitions", testConcurrentTransitions},
+		{"ListPayments", testListPayments},
+		{"DailyVolume", testDailyVolume},
+		{"PaymentMonitor", testPaymentMonitor},
+		{"Merchants", testMerchants},
+		{"APIKeys", testAPIKeys},
+		{"Idempotency", testIdempotency},
+		{"Ledger", testLedger},
+		{"Payouts", testPayouts},
+		{"SplitPayouts", testSplitPayouts},
+		{"Subscriptions", testSubscriptions},
+		{"PaymentLinks", testPaymentLinks},
+		{"Invoices", testInvoices},
+		{"Reconciliation", testReconciliation},
+		{"ExportJobs", testExportJobs},
+		{"Exports", testExports},
+		{"AuditLog", testAuditLog},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := open(t)
+			t.Cleanup(func() { store.Close() })
+			tt.fn(t, store)
+		})
+	}
+}
+
+// SQLite opens a store on a new SQLite file in a temporary directory
+func SQLite(t *testing.T) db.Store {
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "algopay.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	return migrate(t, database)
+}
+
+// Postgres opens a store on the database named by PostgresURLEnv after
+// dropping everything in its public schema
+func Postgres(t *testing.T) db.Store {
+	url := os.Getenv(PostgresURLEnv)
+	if url == "" {
+		t.Skip(PostgresURLEnv + " is not set")
+	}
+
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to open %s (PostgreSQL support needs -tags postgres): %v", PostgresURLEnv, err)
+	}
+	_, err = conn.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to reset the database: %v", err)
+	}
+
+	database, err := db.Open(url, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return migrate(t, database)
+}
+
+// migrate applies every migration to a new database
+func migrate(t *testing.T, database *db.Database) db.Store {
+	if _, err := database.Migrate(); err != nil {
+		database.Close()
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+// now returns the current time at the precision every backend stores
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// newPayment builds a pending payment of a merchant expiring in an hour
+func newPayment(merchantID string, amount uint64) *models.Payment {
+	created := now()
+	return &models.Payment{
+		ID:              uuid.New().String(),
+		MerchantID:      merchantID,
+		MerchantAddress: "ADDR-" + merchantID,
+		Amount:          amount,
+		Metadata:        map[string]interface{}{"order": "A-1"},
+		Status:          models.PaymentStatusPending,
+		CreatedAt:       created,
+		UpdatedAt:       created,
+		ExpiresAt:       created.Add(time.Hour),
+	}
+}
+
+// mustCreatePayment stores a payment or fails the test
+func mustCreatePayment(t *testing.T, store db.Store, payment *models.Payment) {
+	t.Helper()
+	if err := store.CreatePayment(payment, models.PaymentCaps{}); err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+}
+
+// received builds the entry posted when a payment's funds arrive
+func received(merchantID, paymentID string, amount uint64) *models.JournalEntry {
+	return models.NewTransferEntry(merchantID, 0, models.EntryPaymentReceived, paymentID, "",
+		models.LedgerReceiving, models.LedgerPayments, amount)
+}
+
+// testPayments checks that payments round-trip and are scoped to merchants
+func testPayments(t *testing.T, store db.Store) {
+	payment := newPayment("m1", 1000)
+	payment.PaymentOptions = []models.PaymentOption{{AssetID: 0, Amount: 1000}, {AssetID: 31566704, Amount: 250}}
+	mustCreatePayment(t, store, payment)
+
+	got, err := store.GetPayment("m1", payment.ID)
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if got.Amount != 1000 || got.Status != models.PaymentStatusPending || len(got.PaymentOptions) != 2 {
+		t.Errorf("GetPayment = %+v, want the stored payment", got)
+	}
+	if got.Metadata["order"] != "A-1" {
+		t.Errorf("metadata = %v, want order A-1", got.Metadata)
+	}
+	if !got.CreatedAt.Equal(payment.CreatedAt) || !got.ExpiresAt.Equal(payment.ExpiresAt) {
+		t.Errorf("times = %v, %v, want %v, %v", got.CreatedAt, got.ExpiresAt, payment.CreatedAt, payment.ExpiresAt)
+	}
+	if _, err := store.GetPayment("m2", payment.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPayment for another merchant: err = %v, want sql.ErrNoRows", err)
+	}
+
+	assetID := uint64(31566704)
+	got.Status = models.PaymentStatusCompleted
+	got.TxnID = "TXN1"
+	got.SettledAssetID = &assetID
+	got.ReceivedAmount = 250
+	got.PayerAddress = "PAYER"
+	if err := store.RecordPaymentMatch(got); err != nil {
+		t.Fatalf("RecordPaymentMatch: %v", err)
+	}
+	matched, err := store.GetPaymentsByTxnIDs([]string{"TXN1", "TXN-UNKNOWN"})
+	if err != nil {
+		t.Fatalf("GetPaymentsByTxnIDs: %v", err)
+	}
+	if len(matched) != 1 || matched[0].SettledAssetID == nil || *matched[0].SettledAssetID != assetID || matched[0].ReceivedAmount != 250 {
+		t.Errorf("GetPaymentsByTxnIDs = %+v, want the matched payment", matched)
+	}
+}
+
+// testPaymentStatus checks cancelling, extending, expiring and resolving payments
+func testPaymentStatus(t *testing.T, store db.Store) {
+	pending := newPayment("m1", 100)
+	mustCreatePayment(t, store, pending)
+	expiresAt := pending.ExpiresAt.Add(time.Hour)
+	extended, err := store.ExtendPayment("m1", pending.ID, expiresAt)
+	if err != nil || !extended.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExtendPayment = %v, %v, want expiry %v", extended, err, expiresAt)
+	}
+	cancelled, err := store.CancelPayment("m1", pending.ID)
+	if err != nil || cancelled.Status != models.PaymentStatusCancelled {
+		t.Errorf("CancelPayment = %v, %v, want cancelled", cancelled, err)
+	}
+	if _, err := store.CancelPayment("m1", pending.ID); !errors.Is(err, db.ErrPaymentNotPending) {
+		t.Errorf("second CancelPayment: err = %v, want ErrPaymentNotPending", err)
+	}
+	if _, err := store.CancelPayment("m1", "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CancelPayment of a missing payment: err = %v, want sql.ErrNoRows", err)
+	}
+
+	overdue := newPayment("m1", 100)
+	overdue.ExpiresAt = now().Add(-time.Minute)
+	mustCreatePayment(t, store, overdue)
+	if err := store.ExpireOldPayments(); err != nil {
+		t.Fatalf("ExpireOldPayments: %v", err)
+	}
+	if got, _ := store.GetPayment("m1", overdue.ID); got == nil || got.Status != models.PaymentStatusExpired {
+		t.Errorf("overdue payment = %+v, want expired", got)
+	}
+	candidates, err := store.GetLatePaymentCandidates(time.Hour)
+	if err != nil || len(candidates) != 2 {
+		t.Errorf("GetLatePaymentCandidates = %d payments, %v, want 2", len(candidates), err)
+	}
+
+	if err := store.UpdatePaymentStatus(overdue.ID, models.PaymentStatusLatePayment, "TXN-LATE"); err != nil {
+		t.Fatalf("UpdatePaymentStatus: %v", err)
+	}
+	resolved, err := store.ResolveLatePayment("m1", overdue.ID, models.PaymentStatusLatePayment, models.PaymentStatusRefunded, "TXN-REFUND")
+	if err != nil || resolved.RefundTxnID != "TXN-REFUND" {
+		t.Errorf("ResolveLatePayment = %+v, %v, want refunded", resolved, err)
+	}
+	if _, err := store.ResolveLatePayment("m1", overdue.ID, models.PaymentStatusLatePayment, models.PaymentStatusRefunded, ""); !errors.Is(err, db.ErrPaymentStatusChanged) {
+		t.Errorf("second ResolveLatePayment: err = %v, want ErrPaymentStatusChanged", err)
+	}
+	var transition *models.TransitionError
+	if err := store.UpdatePaymentStatus(overdue.ID, models.PaymentStatusCompleted, "TXN-LATE"); !errors.As(err, &transition) {
+		t.Errorf("UpdatePaymentStatus of a refunded payment: err = %v, want a TransitionError", err)
+	}
+	if _, err := store.SubmitRefund("m1", overdue.ID, "TXN-AGAIN", 1000, 50); !errors.Is(err, db.ErrPaymentStatusChanged) {
+		t.Errorf("SubmitRefund of a refunded payment: err = %v, want ErrPaymentStatusChanged", err)
+	}
+
+	late := newPayment("m1", 100)
+	mustCreatePayment(t, store, late)
+	if err := store.UpdatePaymentStatus(late.ID, models.PaymentStatusLatePayment, "TXN-LATE-2"); err != nil {
+		t.Fatalf("UpdatePaymentStatus: %v", err)
+	}
+	refunding, err := store.SubmitRefund("m1", late.ID, "TXN-SUBMITTED", 1000, 50)
+	if err != nil || refunding.Status != models.PaymentStatusRefunding || refunding.RefundTxnID != "TXN-SUBMITTED" ||
+		refunding.RefundFee != 1000 || refunding.RefundLastValid != 50 {
+		t.Fatalf("SubmitRefund = %+v, %v, want refunding with the submitted transaction", refunding, err)
+	}
+	awaiting, err := store.GetRefundingPayments()
+	if err != nil || len(awaiting) != 1 || awaiting[0].ID != late.ID {
+		t.Errorf("GetRefundingPayments = %d payments, %v, want the submitted refund", len(awaiting), err)
+	}
+}
+
+// testPaymentVersion checks that updates bump the version and that a match
+// read before another update is rejected
+func testPaymentVersion(t *testing.T, store db.Store) {
+	payment := newPayment("m1", 100)
+	mustCreatePayment(t, store, payment)
+	read, err := store.GetPayment("m1", payment.ID)
+	if err != nil || read.Version != 0 {
+		t.Fatalf("GetPayment = %+v, %v, want version 0", read, err)
+	}
+
+	extended, err := store.ExtendPayment("m1", payment.ID, read.ExpiresAt.Add(time.Hour))
+	if err != nil || extended.Version != 1 {
+		t.Fatalf("ExtendPayment = %+v, %v, want version 1", extended, err)
+	}
+
+	read.Status = models.PaymentStatusCompleted
+	read.TxnID = "TXN-STALE"
+	if err := store.RecordPaymentMatch(read); !errors.Is(err, db.ErrPaymentVersionConflict) {
+		t.Errorf("RecordPaymentMatch with a stale version: err = %v, want ErrPaymentVersionConflict", err)
+	}
+	if got, _ := store.GetPayment("m1", payment.ID); got == nil || got.Status != models.PaymentStatusPending || got.TxnID != "" {
+		t.Errorf("payment after stale match = %+v, want it unchanged", got)
+	}
+
+	extended.Status = models.PaymentStatusCompleted
+	extended.TxnID = "TXN-FRESH"
+	if err := store.RecordPaymentMatch(extended); err != nil || extended.Version != 2 {
+		t.Errorf("RecordPaymentMatch = %v, version %d, want version 2", err, extended.Version)
+	}
+}
+
+// testConcurrentTransitions checks that concurrent status changes of
+// different payments all succeed, and that when the expiry job and a match
+// race on one payment exactly one of them wins
+func testConcurrentTransitions(t *testing.T, store db.Store) {
+	const count = 40
+	payments := make([]*models.Payment, count)
+	for i := range payments {
+		payments[i] = newPayment("m1", 100)
+		mustCreatePayment(t, store, payments[i])
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for _, payment := range payments {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if _, err := store.CancelPayment("m1", id); err != nil {
+				errs <- err
+			}
+		}(payment.ID)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent CancelPayment: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		overdue := newPayment("m1", 100)
+		overdue.ExpiresAt = now().Add(-time.Second)
+		mustCreatePayment(t, store, overdue)
+		match, err := store.GetPayment("m1", overdue.ID)
+		if err != nil {
+			t.Fatalf("GetPayment: %v", err)
+		}
+		match.Status = models.PaymentStatusCompleted
+		match.TxnID = "TXN-RACE-" + overdue.ID
+
+		var expireErr, matchErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			expireErr = store.ExpireOldPayments()
+		}()
+		go func() {
+			defer wg.Done()
+			matchErr = store.RecordPaymentMatch(match)
+		}()
+		wg.Wait()
+
+		if expireErr != nil {
+			t.Fatalf("ExpireOldPayments: %v", expireErr)
+		}
+		got, err := store.GetPayment("m1", overdue.ID)
+		if err != nil {
+			t.Fatalf("GetPayment: %v", err)
+		}
+		switch {
+		case matchErr == nil && got.Status == models.PaymentStatusCompleted:
+		case errors.Is(matchErr, db.ErrPaymentVersionConflict) && got.Status == models.PaymentStatusExpired:
+		default:
+			t.Fatalf("race outcome = %s, %v, want completed or expired with a version conflict", got.Status, matchErr)
+		}
+		if got.Version != 1 {
+			t.Errorf("version after race = %d, want 1", got.Version)
+		}
+	}
+}
+
+// testListPayments checks filtering and cursor paging
+func testListPayments(t *testing.T, store db.Store) {
+	for i := 0; i < 5; i++ {
+		payment := newPayment("m1", uint64(100+i))
+		payment.CreatedAt = payment.CreatedAt.Add(time.Duration(i) * time.Second)
+		if i == 3 {
+			payment.AssetID = 31566704
+			payment.Metadata = map[string]interface{}{"order": "B-2"}
+		}
+		mustCreatePayment(t, store, payment)
+	}
+	mustCreatePayment(t, store, newPayment("m2", 100))
+
+	filter := models.PaymentFilter{MerchantID: "m1", Limit: 2}
+	var seen int
+	for {
+		list, err := store.ListPayments(filter)
+		if err != nil {
+			t.Fatalf("ListPayments: %v", err)
+		}
+		seen += len(list.Payments)
+		if !list.HasMore {
+			break
+		}
+		filter.Cursor = list.NextCursor
+	}
+	if seen != 5 {
+		t.Errorf("paged through %d payments, want 5", seen)
+	}
+
+	assetID := uint64(31566704)
+	list, err := store.ListPayments(models.PaymentFilter{MerchantID: "m1", AssetID: &assetID, Limit: 10})
+	if err != nil || len(list.Payments) != 1 {
+		t.Errorf("ListPayments by asset = %v, %v, want 1 payment", list, err)
+	}
+	list, err = store.ListPayments(models.PaymentFilter{MerchantID: "m1", Metadata: map[string]string{"order": "B-2"}, Limit: 10})
+	if err != nil || len(list.Payments) != 1 {
+		t.Errorf("ListPayments by metadata = %v, %v, want 1 payment", list, err)
+	}
+}
+
+// testDailyVolume checks that volume sums pending options and settled payments
+func testDailyVolume(t *testing.T, store db.Store) {
+	since := now().Add(-time.Minute)
+	pending := newPayment("m1", 300)
+	mustCreatePayment(t, store, pending)
+	other := newPayment("m1", 500)
+	other.PaymentOptions = []models.PaymentOption{{AssetID: 31566704, Amount: 500}}
+	mustCreatePayment(t, store, other)
+
+	volume, err := store.DailyVolume("m1", 0, since)
+	if err != nil || volume != 300 {
+		t.Errorf("DailyVolume = %d, %v, want 300", volume, err)
+	}
+
+	// With 300 used, racing payments of 200 under a cap of 1000 must add
+	// exactly 3 more
+	caps := models.PaymentCaps{DailyVolume: map[uint64]uint64{0: 1000}, DayStart: since}
+	var wg sync.WaitGroup
+	results := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- store.CreatePayment(newPayment("m1", 200), caps)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	added := 0
+	for err := range results {
+		var capErr *db.DailyVolumeError
+		switch {
+		case err == nil:
+			added++
+		case !errors.As(err, &capErr) || capErr.AssetID != 0 || capErr.Cap != 1000:
+			t.Errorf("CreatePayment under the daily volume cap: %v", err)
+		}
+	}
+	volume, err = store.DailyVolume("m1", 0, since)
+	if err != nil || added != 3 || volume != 900 {
+		t.Errorf("created %d payments under the daily volume cap, volume %d, %v, want 3 and 900", added, volume, err)
+	}
+}
+
+// testPaymentMonitor checks that the monitor's round persists and that
+// recorded transactions are reported as taken
+func testPaymentMonitor(t *testing.T, store db.Store) {
+	if round, err := store.GetMonitorRound("payments"); err != nil || round != 0 {
+		t.Errorf("GetMonitorRound before any scan = %d, %v, want 0", round, err)
+	}
+	for _, round := range []uint64{1000, 1012} {
+		if err := store.SetMonitorRound("payments", round); err != nil {
+			t.Fatalf("SetMonitorRound: %v", err)
+		}
+	}
+	if round, err := store.GetMonitorRound("payments"); err != nil || round != 1012 {
+		t.Errorf("GetMonitorRound = %d, %v, want 1012", round, err)
+	}
+
+	payment := newPayment("m1", 100)
+	mustCreatePayment(t, store, payment)
+	if err := store.UpdatePaymentStatus(payment.ID, models.PaymentStatusCompleted, "TXN-PAID"); err != nil {
+		t.Fatalf("UpdatePaymentStatus: %v", err)
+	}
+	if taken, err := store.PaymentTxnRecorded("TXN-PAID"); err != nil || !taken {
+		t.Errorf("PaymentTxnRecorded of a settling transaction = %v, %v, want true", taken, err)
+	}
+	if taken, err := store.PaymentTxnRecorded("TXN-NEW"); err != nil || taken {
+		t.Errorf("PaymentTxnRecorded of a new transaction = %v, %v, want false", taken, err)
+	}
+}
+
+// testMerchants checks that merchants round-trip and update
+func testMerchants(t *testing.T, store db.Store) {
+	created := now()
+	merchant := &models.Merchant{
+		ID:                "m1",
+		DisplayName:       "Shop",
+		ReceivingAddress:  "ADDR",
+		AcceptedAssets:    []uint64{0, 31566704},
+		LatePaymentAction: "manual",
+		CreatedAt:         created,
+		UpdatedAt:         created,
+	}
+	if err := store.CreateMerchant(merchant); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+	merchant.DisplayName = "Renamed"
+	if err := store.UpdateMerchant(merchant); err != nil {
+		t.Fatalf("UpdateMerchant: %v", err)
+	}
+	got, err := store.GetMerchant("m1")
+	if err != nil || got.DisplayName != "Renamed" || len(got.AcceptedAssets) != 2 {
+		t.Errorf("GetMerchant = %+v, %v, want the renamed merchant", got, err)
+	}
+	merchants, err := store.ListMerchants()
+	if err != nil || len(merchants) != 1 {
+		t.Errorf("ListMerchants = %d merchants, %v, want 1", len(merchants), err)
+	}
+	if _, err := store.GetMerchant("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetMerchant of a missing merchant: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+// testAPIKeys checks that keys are found by hash, touched and revoked
+func testAPIKeys(t *testing.T, store db.Store) {
+	key := &models.APIKey{
+		ID:         uuid.New().String(),
+		MerchantID: "m1",
+		Type:       models.APIKeyTypeSecret,
+		Prefix:     "sk_test",
+		KeyHash:    "hash",
+		Scopes:     []string{models.ScopePaymentsRead},
+		CreatedAt:  now(),
+	}
+	if err := store.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := store.TouchAPIKey(key.ID); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	got, err := store.GetAPIKeyByHash("hash")
+	if err != nil || !got.HasScope(models.ScopePaymentsRead) || got.LastUsedAt == nil {
+		t.Errorf("GetAPIKeyByHash = %+v, %v, want the touched key", got, err)
+	}
+	if err := store.RevokeAPIKey(key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	keys, err := store.ListAPIKeys("m1")
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("ListAPIKeys = %+v, %v, want the revoked key", keys, err)
+	}
+}
+
+// testIdempotency checks that a reserved key returns the stored response
+func testIdempotency(t *testing.T, store db.Store) {
+	record := &models.IdempotencyRecord{
+		MerchantID:  "m1",
+		Key:         "key-1",
+		RequestHash: "hash",
+		CreatedAt:   now(),
+		ExpiresAt:   now().Add(time.Hour),
+	}
+	if existing, err := store.ReserveIdempotencyKey(record); err != nil || existing != nil {
+		t.Fatalf("ReserveIdempotencyKey = %v, %v, want a new reservation", existing, err)
+	}
+	if err := store.CompleteIdempotencyKey("m1", "key-1", 201, []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	existing, err := store.ReserveIdempotencyKey(record)
+	if err != nil || existing == nil || existing.StatusCode != 201 || string(existing.ResponseBody) != `{"ok":true}` {
+		t.Errorf("ReserveIdempotencyKey again = %+v, %v, want the stored response", existing, err)
+	}
+	if err := store.ReleaseIdempotencyKey("m1", "key-1"); err != nil {
+		t.Fatalf("ReleaseIdempotencyKey: %v", err)
+	}
+	if existing, err := store.ReserveIdempotencyKey(record); err != nil || existing != nil {
+		t.Errorf("ReserveIdempotencyKey after release = %v, %v, want a new reservation", existing, err)
+	}
+	if err := store.DeleteExpiredIdempotencyKeys(); err != nil {
+		t.Errorf("DeleteExpiredIdempotencyKeys: %v", err)
+	}
+}
+
+// testLedger checks posting, duplicate detection, balances and paging
+func testLedger(t *testing.T, store db.Store) {
+	if err := store.PostJournalEntry(received("m1", "p1", 1000)); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+	if err := store.PostJournalEntry(received("m1", "p1", 1000)); !errors.Is(err, db.ErrJournalEntryExists) {
+		t.Errorf("duplicate PostJournalEntry: err = %v, want ErrJournalEntryExists", err)
+	}
+	if err := store.PostJournalEntry(received("m1", "p2", 500)); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+
+	accounts, err := store.GetAccountBalances("m1")
+	if err != nil {
+		t.Fatalf("GetAccountBalances: %v", err)
+	}
+	balances := models.BalancesFrom(accounts)
+	if len(balances) != 1 || balances[0].Available != 1500 || balances[0].Received != 1500 {
+		t.Errorf("balances = %+v, want 1500 available and received", balances)
+	}
+
+	page, err := store.ListJournalEntries("m1", nil, 0, 1)
+	if err != nil || len(page.Entries) != 1 || !page.HasMore || len(page.Entries[0].Lines) != 2 {
+		t.Fatalf("ListJournalEntries = %+v, %v, want one entry and more", page, err)
+	}
+	page, err = store.ListJournalEntries("m1", nil, page.Entries[0].ID, 10)
+	if err != nil || len(page.Entries) != 1 || page.HasMore {
+		t.Errorf("second ListJournalEntries = %+v, %v, want the last entry", page, err)
+	}
+}
+
+// testPayouts checks that payouts cannot overdraw and move through statuses
+func testPayouts(t *testing.T, store db.Store) {
+	if err := store.PostJournalEntry(received("m1", "p1", 1000)); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+
+	newPayout := func(amount uint64) (*models.Payout, *models.JournalEntry) {
+		created := now()
+		payout := &models.Payout{
+			ID:          uuid.New().String(),
+			MerchantID:  "m1",
+			Amount:      amount,
+			Source:      "ADDR",
+			Destination: "DEST",
+			Status:      models.PayoutPending,
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		}
+		entry := models.NewTransferEntry("m1", 0, models.EntryPayoutRequested, payout.ID, "",
+			models.LedgerPayoutsPending, models.LedgerReceiving, amount)
+		return payout, entry
+	}
+
+	payout, entry := newPayout(800)
+	if err := store.CreatePayout(payout, entry, 0); err != nil {
+		t.Fatalf("CreatePayout: %v", err)
+	}
+	overdraft, entry := newPayout(300)
+	if err := store.CreatePayout(overdraft, entry, 0); !errors.Is(err, db.ErrInsufficientBalance) {
+		t.Errorf("overdrawing CreatePayout: err = %v, want ErrInsufficientBalance", err)
+	}
+	if _, err := store.GetPayout("m1", overdraft.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("rejected payout was stored: err = %v", err)
+	}
+
+	payout.Status = models.PayoutSubmitted
+	payout.TxnID = "TXN-PAYOUT"
+	if err := store.UpdatePayout(models.PayoutPending, payout); err != nil {
+		t.Fatalf("UpdatePayout: %v", err)
+	}
+	if err := store.UpdatePayout(models.PayoutPending, payout); !errors.Is(err, db.ErrPayoutChanged) {
+		t.Errorf("stale UpdatePayout: err = %v, want ErrPayoutChanged", err)
+	}
+	submitted, err := store.GetPayoutsByStatus(models.PayoutSubmitted)
+	if err != nil || len(submitted) != 1 {
+		t.Errorf("GetPayoutsByStatus = %d payouts, %v, want 1", len(submitted), err)
+	}
+	payouts, err := store.ListPayouts("m1", "")
+	if err != nil || len(payouts) != 1 || payouts[0].TxnID != "TXN-PAYOUT" {
+		t.Errorf("ListPayouts = %+v, %v, want the submitted payout", payouts, err)
+	}
+}
+
+// testSplitPayouts checks that split payouts are recorded once and updated together
+func testSplitPayouts(t *testing.T, store db.Store) {
+	created := now()
+	var payouts []*models.SplitPayout
+	for i := 0; i < 2; i++ {
+		payouts = append(payouts, &models.SplitPayout{
+			ID:         uuid.New().String(),
+			PaymentID:  "p1",
+			MerchantID: "m1",
+			Position:   i,
+			Address:    "RECIPIENT",
+			Amount:     100,
+			Status:     models.SplitPayoutPending,
+			CreatedAt:  created,
+			UpdatedAt:  created,
+		})
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.CreateSplitPayouts(payouts); err != nil {
+			t.Fatalf("CreateSplitPayouts: %v", err)
+		}
+	}
+	got, err := store.GetSplitPayouts("p1")
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetSplitPayouts = %d payouts, %v, want 2", len(got), err)
+	}
+	ids, err := store.GetPaymentsWithSplitPayouts(models.SplitPayoutPending)
+	if err != nil || len(ids) != 1 || ids[0] != "p1" {
+		t.Errorf("GetPaymentsWithSplitPayouts = %v, %v, want [p1]", ids, err)
+	}
+
+	for _, payout := range got {
+		payout.Status = models.SplitPayoutSubmitted
+	}
+	if err := store.UpdateSplitPayouts(models.SplitPayoutPending, got); err != nil {
+		t.Fatalf("UpdateSplitPayouts: %v", err)
+	}
+	if err := store.UpdateSplitPayouts(models.SplitPayoutPending, got); !errors.Is(err, db.ErrSplitPayoutsChanged) {
+		t.Errorf("stale UpdateSplitPayouts: err = %v, want ErrSplitPayoutsChanged", err)
+	}
+}
+
+// testSubscriptions checks due subscriptions and conditional state saves
+func testSubscriptions(t *testing.T, store db.Store) {
+	created := now()
+	sub := &models.Subscription{
+		ID:                     uuid.New().String(),
+		MerchantID:             "m1",
+		Plan:                   "pro",
+		Amount:                 1000,
+		IntervalUnit:           models.IntervalMonth,
+		IntervalCount:          1,
+		AnchorDate:             created,
+		GracePeriodSeconds:     3600,
+		DunningIntervalSeconds: 3600,
+		Status:                 models.SubscriptionStatusActive,
+		NextBillingAt:          created.Add(-time.Minute),
+		CreatedAt:              created,
+		UpdatedAt:              created,
+	}
+	if err := store.CreateSubscription(sub); err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	due, err := store.GetDueSubscriptions(now())
+	if err != nil || len(due) != 1 {
+		t.Fatalf("GetDueSubscriptions = %d subscriptions, %v, want 1", len(due), err)
+	}
+
+	invoice := newPayment("m1", 1000)
+	invoice.SubscriptionID = sub.ID
+	invoice.Status = models.PaymentStatusExpired
+	mustCreatePayment(t, store, invoice)
+	sub.OpenPaymentID = invoice.ID
+	sub.Attempt = 1
+	if err := store.SaveSubscriptionState(sub, models.SubscriptionStatusActive, ""); err != nil {
+		t.Fatalf("SaveSubscriptionState: %v", err)
+	}
+	if err := store.SaveSubscriptionState(sub, models.SubscriptionStatusActive, ""); !errors.Is(err, db.ErrSubscriptionChanged) {
+		t.Errorf("stale SaveSubscriptionState: err = %v, want ErrSubscriptionChanged", err)
+	}
+	closed, err := store.GetSubscriptionsWithClosedInvoices()
+	if err != nil || len(closed) != 1 {
+		t.Errorf("GetSubscriptionsWithClosedInvoices = %d subscriptions, %v, want 1", len(closed), err)
+	}
+	subs, err := store.ListSubscriptions("m1", models.SubscriptionStatusActive)
+	if err != nil || len(subs) != 1 || subs[0].OpenPaymentID != invoice.ID {
+		t.Errorf("ListSubscriptions = %+v, %v, want the saved subscription", subs, err)
+	}
+	if _, err := store.GetSubscription("m2", sub.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetSubscription for another merchant: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+// testPaymentLinks checks slugs, updates and link stats
+func testPaymentLinks(t *testing.T, store db.Store) {
+	created := now()
+	link := &models.PaymentLink{
+		ID:         uuid.New().String(),
+		MerchantID: "m1",
+		Slug:       "coffee",
+		Title:      "Coffee",
+		AmountType: models.PaymentLinkAmountFixed,
+		Amount:     500,
+		Active:     true,
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	if err := store.CreatePaymentLink(link); err != nil {
+		t.Fatalf("CreatePaymentLink: %v", err)
+	}
+	duplicate := *link
+	duplicate.ID = uuid.New().String()
+	if err := store.CreatePaymentLink(&duplicate); !errors.Is(err, db.ErrSlugTaken) {
+		t.Errorf("CreatePaymentLink with a taken slug: err = %v, want ErrSlugTaken", err)
+	}
+
+	link.Active = false
+	if err := store.UpdatePaymentLink(link); err != nil {
+		t.Fatalf("UpdatePaymentLink: %v", err)
+	}
+	got, err := store.GetPaymentLinkBySlug("coffee")
+	if err != nil || got.Active {
+		t.Errorf("GetPaymentLinkBySlug = %+v, %v, want the inactive link", got, err)
+	}
+	if links, err := store.ListPaymentLinks("m1"); err != nil || len(links) != 1 {
+		t.Errorf("ListPaymentLinks = %d links, %v, want 1", len(links), err)
+	}
+
+	for _, status := range []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusCompleted, models.PaymentStatusExpired} {
+		payment := newPayment("m1", 500)
+		payment.PaymentLinkID = link.ID
+		payment.Status = status
+		mustCreatePayment(t, store, payment)
+	}
+	stats, err := store.GetPaymentLinkStats(link.ID, "unused")
+	if err != nil {
+		t.Fatalf("GetPaymentLinkStats: %v", err)
+	}
+	if s := stats[link.ID]; s.Payments != 3 || s.Pending != 1 || s.Completed != 1 || s.AmountCollected != 500 {
+		t.Errorf("stats = %+v, want 3 payments, 1 pending, 1 completed, 500 collected", s)
+	}
+	if s := stats["unused"]; s == nil || s.Payments != 0 {
+		t.Errorf("unused link stats = %+v, want zero", s)
+	}
+
+	// The link has 2 pending and completed payments; racing creations under a
+	// cap of 4 must add exactly 2 more
+	var wg sync.WaitGroup
+	results := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payment := newPayment("m1", 500)
+			payment.PaymentLinkID = link.ID
+			results <- store.CreatePayment(payment, models.PaymentCaps{LinkMaxPayments: 4})
+		}()
+	}
+	wg.Wait()
+	close(results)
+	added := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			added++
+		case !errors.Is(err, db.ErrPaymentLinkExhausted):
+			t.Errorf("CreatePayment under the link cap: %v", err)
+		}
+	}
+	stats, err = store.GetPaymentLinkStats(link.ID)
+	if err != nil || added != 2 || stats[link.ID].Pending != 3 {
+		t.Errorf("created %d payments under the link cap (stats %+v, %v), want 2", added, stats[link.ID], err)
+	}
+}
+
+// testInvoices checks that invoice numbers are sequential per merchant
+func testInvoices(t *testing.T, store db.Store) {
+	create := func(merchantID string) *models.Invoice {
+		payment := newPayment(merchantID, 1000)
+		mustCreatePayment(t, store, payment)
+		invoice := &models.Invoice{
+			ID:         uuid.New().String(),
+			MerchantID: merchantID,
+			PaymentID:  payment.ID,
+			LineItems:  []models.InvoiceLineItem{{Description: "Widget", Quantity: "1", UnitPrice: 1000, Amount: 1000}},
+			Subtotal:   1000,
+			Total:      1000,
+			CreatedAt:  now(),
+		}
+		if err := store.CreateInvoice(invoice); err != nil {
+			t.Fatalf("CreateInvoice: %v", err)
+		}
+		return invoice
+	}
+
+	first, second, other := create("m1"), create("m1"), create("m2")
+	if first.Number != db.InvoiceNumberPrefix+"000001" || second.Number != db.InvoiceNumberPrefix+"000002" || other.Sequence != 1 {
+		t.Errorf("numbers = %s, %s, %s, want sequential per merchant", first.Number, second.Number, other.Number)
+	}
+
+	got, err := store.GetInvoice("m1", second.ID)
+	if err != nil || got.Number != second.Number || got.Status != models.PaymentStatusPending || len(got.LineItems) != 1 {
+		t.Errorf("GetInvoice = %+v, %v, want the second invoice", got, err)
+	}
+	invoices, err := store.ListInvoices("m1", models.PaymentStatusPending)
+	if err != nil || len(invoices) != 2 {
+		t.Errorf("ListInvoices = %d invoices, %v, want 2", len(invoices), err)
+	}
+}
+
+// testReconciliation checks reconciliation lookups and reports
+func testReconciliation(t *testing.T, store db.Store) {
+	created := now()
+	merchant := &models.Merchant{ID: "m1", DisplayName: "Shop", ReceivingAddress: "ADDR", LatePaymentAction: "manual", CreatedAt: created, UpdatedAt: created}
+	if err := store.CreateMerchant(merchant); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+	payment := newPayment("m1", 100)
+	mustCreatePayment(t, store, payment)
+	payment.Status = models.PaymentStatusCompleted
+	payment.TxnID = "TXN1"
+	if err := store.RecordPaymentMatch(payment); err != nil {
+		t.Fatalf("RecordPaymentMatch: %v", err)
+	}
+
+	addresses, err := store.ReconciliationAddresses("m1")
+	if err != nil || addresses["ADDR"] != "m1" || addresses["ADDR-m1"] != "m1" {
+		t.Errorf("ReconciliationAddresses = %v, %v, want both addresses", addresses, err)
+	}
+	payments, err := store.ReconciliationPayments("m1", created.Add(-time.Hour), created.Add(time.Hour))
+	if err != nil || len(payments) != 1 {
+		t.Errorf("ReconciliationPayments = %d payments, %v, want 1", len(payments), err)
+	}
+
+	report := &models.ReconciliationReport{
+		ID:            uuid.New().String(),
+		Window:        models.ReconciliationWindow{MerchantID: "m1", MinRound: 1, MaxRound: 10},
+		Matched:       1,
+		Discrepancies: []models.Discrepancy{},
+		StartedAt:     created,
+		FinishedAt:    created,
+	}
+	if err := store.CreateReconciliationReport(report); err != nil {
+		t.Fatalf("CreateReconciliationReport: %v", err)
+	}
+	got, err := store.GetReconciliationReport(report.ID)
+	if err != nil || got.Window.MaxRound != 10 || got.Matched != 1 {
+		t.Errorf("GetReconciliationReport = %+v, %v, want the stored report", got, err)
+	}
+	if reports, err := store.ListReconciliationReports(10); err != nil || len(reports) != 1 {
+		t.Errorf("ListReconciliationReports = %d reports, %v, want 1", len(reports), err)
+	}
+}
+
+// testExportJobs checks queueing, claiming and expiring export jobs
+func testExportJobs(t *testing.T, store db.Store) {
+	job := &models.ExportJob{
+		ID:         uuid.New().String(),
+		MerchantID: "m1",
+		Dataset:    models.ExportPayments,
+		Format:     models.ExportCSV,
+		Status:     models.ExportPending,
+		CreatedAt:  now(),
+	}
+	if err := store.CreateExportJob(job); err != nil {
+		t.Fatalf("CreateExportJob: %v", err)
+	}
+	claimed, err := store.ClaimExportJob()
+	if err != nil || claimed.ID != job.ID || claimed.Status != models.ExportRunning {
+		t.Fatalf("ClaimExportJob = %+v, %v, want the running job", claimed, err)
+	}
+	if _, err := store.ClaimExportJob(); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ClaimExportJob with none pending: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := store.RequeueExportJobs(); err != nil {
+		t.Fatalf("RequeueExportJobs: %v", err)
+	}
+	if claimed, err = store.ClaimExportJob(); err != nil {
+		t.Fatalf("ClaimExportJob after requeue: %v", err)
+	}
+
+	completed := now().Add(-time.Hour)
+	claimed.Status = models.ExportCompleted
+	claimed.Rows = 7
+	claimed.CompletedAt = &completed
+	claimed.ExpiresAt = &completed
+	if err := store.UpdateExportJob(claimed); err != nil {
+		t.Fatalf("UpdateExportJob: %v", err)
+	}
+	expired, err := store.GetExpiredExportJobs(now())
+	if err != nil || len(expired) != 1 || expired[0].Rows != 7 {
+		t.Errorf("GetExpiredExportJobs = %+v, %v, want the completed job", expired, err)
+	}
+	if jobs, err := store.ListExportJobs("m2", 10); err != nil || len(jobs) != 0 {
+		t.Errorf("ListExportJobs for another merchant = %d jobs, %v, want 0", len(jobs), err)
+	}
+	if jobs, err := store.ListExportJobs("", 10); err != nil || len(jobs) != 1 {
+		t.Errorf("ListExportJobs for every merchant = %d jobs, %v, want 1", len(jobs), err)
+	}
+}
+
+// testExports checks that exports stream every record in range once
+func testExports(t *testing.T, store db.Store) {
+	const count = 1203
+	start := now().Add(-time.Hour)
+	for i := 0; i < count; i++ {
+		payment := newPayment("m1", 100)
+		payment.CreatedAt = start.Add(time.Duration(i%600) * time.Second)
+		mustCreatePayment(t, store, payment)
+		if i%2 == 0 {
+			payment.Status = models.PaymentStatusCompleted
+			payment.TxnID = uuid.New().String()
+			if err := store.RecordPaymentMatch(payment); err != nil {
+				t.Fatalf("RecordPaymentMatch: %v", err)
+			}
+		}
+	}
+	if err := store.PostJournalEntry(models.NewTransferEntry("m1", 0, models.EntryNetworkFee, "TXN-FEE", "",
+		models.LedgerNetworkFees, models.LedgerReceiving, 1000)); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+
+	filter := models.ExportFilter{MerchantID: "m1"}
+	seen := map[string]bool{}
+	err := store.ExportPayments(filter, func(p *models.Payment) error {
+		if seen[p.ID] {
+			t.Errorf("payment %s exported twice", p.ID)
+		}
+		seen[p.ID] = true
+		return nil
+	})
+	if err != nil || len(seen) != count {
+		t.Errorf("ExportPayments = %d payments, %v, want %d", len(seen), err, count)
+	}
+
+	var transactions int
+	err = store.ExportTransactions(filter, nil, func(*models.ExportTransaction) error {
+		transactions++
+		return nil
+	})
+	if err != nil || transactions != (count+1)/2 {
+		t.Errorf("ExportTransactions = %d transactions, %v, want %d", transactions, err, (count+1)/2)
+	}
+
+	var fees []*models.ExportFee
+	err = store.ExportFees(models.ExportFilter{}, func(f *models.ExportFee) error {
+		fees = append(fees, f)
+		return nil
+	})
+	if err != nil || len(fees) != 1 || fees[0].Amount != 1000 {
+		t.Errorf("ExportFees = %+v, %v, want one 1000 fee", fees, err)
+	}
+}
+
+// testAuditLog checks that payment changes and appended entries are audited
+// with their actor and form a verifiable chain
+func testAuditLog(t *testing.T, store db.Store) {
+	merchantKey := models.Actor{Type: models.ActorAPIKey, ID: "key1", RequestID: "req-1"}
+	payment := newPayment("m1", 100)
+	mustCreatePayment(t, store.As(merchantKey), payment)
+	if _, err := store.As(merchantKey).CancelPayment("m1", payment.ID); err != nil {
+		t.Fatalf("CancelPayment: %v", err)
+	}
+	if err := store.As(models.SystemActor("payment_expiry")).ExpireOldPayments(); err != nil {
+		t.Fatalf("ExpireOldPayments: %v", err)
+	}
+
+	entry, err := models.NewAuditEntry(models.AuditMerchantUpdated, models.AuditResourceMerchant, "m1", "m1",
+		map[string]string{"display_name": "Old"}, map[string]string{"display_name": "New"})
+	if err != nil {
+		t.Fatalf("NewAuditEntry: %v", err)
+	}
+	if err := store.As(models.Actor{Type: models.ActorAdmin, RequestID: "req-2"}).AppendAuditEntry(entry); err != nil {
+		t.Fatalf("AppendAuditEntry: %v", err)
+	}
+
+	list, err := store.ListAuditEntries(models.AuditFilter{Resource: models.AuditResourcePayment, ResourceID: payment.ID})
+	if err != nil || len(list.Entries) != 2 {
+		t.Fatalf("ListAuditEntries = %+v, %v, want 2 entries", list, err)
+	}
+	created, cancelled := list.Entries[0], list.Entries[1]
+	if created.Action != models.AuditPaymentCreated || created.Before != nil || created.ActorType != models.ActorAPIKey || created.ActorID != "key1" || created.RequestID != "req-1" {
+		t.Errorf("creation entry = %+v, want payment.created by key1 in req-1", created)
+	}
+	var before, after models.Payment
+	if err := json.Unmarshal(cancelled.Before, &before); err != nil || before.Status != models.PaymentStatusPending {
+		t.Errorf("cancellation before = %s, %v, want a pending payment", cancelled.Before, err)
+	}
+	if err := json.Unmarshal(cancelled.After, &after); err != nil || after.Status != models.PaymentStatusCancelled || after.Version != 1 {
+		t.Errorf("cancellation after = %s, %v, want the cancelled payment at version 1", cancelled.After, err)
+	}
+	if cancelled.Action != models.AuditPaymentCancelled || cancelled.PrevHash != created.Hash {
+		t.Errorf("cancellation entry = %+v, want payment.cancelled chained to %s", cancelled, created.Hash)
+	}
+
+	page, err := store.ListAuditEntries(models.AuditFilter{MerchantID: "m1", Limit: 1})
+	if err != nil || len(page.Entries) != 1 || !page.HasMore {
+		t.Errorf("ListAuditEntries with limit 1 = %+v, %v, want one entry and more", page, err)
+	}
+
+	result, err := store.VerifyAuditLog()
+	if err != nil || !result.Valid || result.Entries != 3 || result.LastHash != entry.Hash {
+		t.Errorf("VerifyAuditLog = %+v, %v, want 3 valid entries ending at %s", result, err, entry.Hash)
+	}
+
+	var exported []int64
+	err = store.ExportAuditEntries(models.ExportFilter{MerchantID: "m1"}, func(e *models.AuditEntry) error {
+		exported = append(exported, e.ID)
+		return nil
+	})
+	if err != nil || len(exported) != 3 || exported[0] != 1 || exported[2] != 3 {
+		t.Errorf("ExportAuditEntries = %v, %v, want entries 1 to 3", exported, err)
+	}
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"algopay/models"
+)
+
+// ErrSubscriptionChanged is returned when a subscription is not in the state an update expects
+var ErrSubscriptionChanged = errors.New("subscription changed")
+
+// subscriptionColumns is the column list scanned by scanSubscription
+const subscriptionColumns = `id, merchant_id, plan, customer_reference, amount, asset_id, interval_unit, interval_count, anchor_date, grace_period_seconds, dunning_retries, dunning_interval_seconds, callback_url, metadata, status, period, next_billing_at, open_payment_id, attempt, next_retry_at, last_paid_at, cancelled_at, created_at, updated_at`
+
+// CreateSubscription creates a new subscription record
+func (d *Database) CreateSubscription(sub *models.Subscription) error {
+	metadata, err := encodeMetadata(sub.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO subscriptions (` + subscriptionColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = d.db.Exec(query,
+		sub.ID,
+		sub.MerchantID,
+		sub.Plan,
+		sub.CustomerReference,
+		sub.Amount,
+		sub.AssetID,
+		sub.IntervalUnit,
+		sub.IntervalCount,
+		sub.AnchorDate,
+		sub.GracePeriodSeconds,
+		sub.DunningRetries,
+		sub.DunningIntervalSeconds,
+		sub.CallbackURL,
+		metadata,
+		sub.Status,
+		sub.Period,
+		sub.NextBillingAt,
+		sub.OpenPaymentID,
+		sub.Attempt,
+		sub.NextRetryAt,
+		sub.LastPaidAt,
+		sub.CancelledAt,
+		sub.CreatedAt,
+		sub.UpdatedAt,
+	)
+	return err
+}
+
+// GetSubscription retrieves a subscription by ID, restricted to the given merchant
+func (d *Database) GetSubscription(merchantID, id string) (*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = ? AND merchant_id = ?`
+	return scanSubscription(d.db.QueryRow(query, id, merchantID))
+}
+
+// ListSubscriptions retrieves a merchant's subscriptions, newest first,
+// optionally restricted to one status
+func (d *Database) ListSubscriptions(merchantID string, status models.SubscriptionStatus) ([]*models.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE merchant_id = ?`
+	args := []interface{}{merchantID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	subs, err := d.querySubscriptions(query, args...)
+	if subs == nil {
+		subs = []*models.Subscription{}
+	}
+	return subs, err
+}
+
+// GetDueSubscriptions retrieves subscriptions that need an invoice: active
+// ones whose next billing date has passed and past due ones whose dunning
+// retry is due
+func (d *Database) GetDueSubscriptions(now time.Time) ([]*models.Subscription, error) {
+	query := `
+	SELECT ` + subscriptionColumns + `
+	FROM subscriptions
+	WHERE open_payment_id = ''
+		AND ((status = 'active' AND next_billing_at <= ?) OR (status = 'past_due' AND next_retry_at <= ?))
+	ORDER BY next_billing_at
+	`
+	return d.querySubscriptions(query, now, now)
+}
+
+// GetSubscriptionsWithClosedInvoices retrieves subscriptions whose open
+// invoice is no longer pending
+func (d *Database) GetSubscriptionsWithClosedInvoices() ([]*models.Subscription, error) {
+	query := `
+	SELECT ` + subscriptionColumns + `
+	FROM subscriptions
+	WHERE open_payment_id != '' AND EXISTS (
+		SELECT 1 FROM payments WHERE payments.id = subscriptions.open_payment_id AND payments.status != 'pending'
+	)
+	`
+	return d.querySubscriptions(query)
+}
+
+// SaveSubscriptionState stores a subscription's billing state. The update only
+// applies if the stored subscription still has the given status and open
+// invoice; otherwise ErrSubscriptionChanged is returned.
+func (d *Database) SaveSubscriptionState(sub *models.Subscription, fromStatus models.SubscriptionStatus, fromOpenPaymentID string) error {
+	sub.UpdatedAt = time.Now()
+	query := `
+	UPDATE subscriptions
+	SET status = ?, period = ?, next_billing_at = ?, open_payment_id = ?, attempt = ?,
+		next_retry_at = ?, last_paid_at = ?, cancelled_at = ?, updated_at = ?
+	WHERE id = ? AND status = ? AND open_payment_id = ?
+	`
+	result, err := d.db.Exec(query,
+		sub.Status,
+		sub.Period,
+		sub.NextBillingAt,
+		sub.OpenPaymentID,
+		sub.Attempt,
+		sub.NextRetryAt,
+		sub.LastPaidAt,
+		sub.CancelledAt,
+		sub.UpdatedAt,
+		sub.ID,
+		fromStatus,
+		fromOpenPaymentID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSubscriptionChanged
+	}
+	return nil
+}
+
+// querySubscriptions runs a query selecting subscriptionColumns and scans every row
+func (d *Database) querySubscriptions(query string, args ...interface{}) ([]*models.Subscription, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*models.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row scanner) (*models.Subscription, error) {
+	sub := &models.Subscription{}
+	var metadata string
+	var nextRetryAt, lastPaidAt, cancelledAt sql.NullTime
+	err := row.Scan(
+		&sub.ID,
+		&sub.MerchantID,
+		&sub.Plan,
+		&sub.CustomerReference,
+		&sub.Amount,
+		&sub.AssetID,
+		&sub.IntervalUnit,
+		&sub.IntervalCount,
+		&sub.AnchorDate,
+		&sub.GracePeriodSeconds,
+		&sub.DunningRetries,
+		&sub.DunningIntervalSeconds,
+		&sub.CallbackURL,
+		&metadata,
+		&sub.Status,
+		&sub.Period,
+		&sub.NextBillingAt,
+		&sub.OpenPaymentID,
+		&sub.Attempt,
+		&nextRetryAt,
+		&lastPaidAt,
+		&cancelledAt,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &sub.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if nextRetryAt.Valid {
+		sub.NextRetryAt = &nextRetryAt.Time
+	}
+	if lastPaidAt.Valid {
+		sub.LastPaidAt = &lastPaidAt.Time
+	}
+	if cancelledAt.Valid {
+		sub.CancelledAt = &cancelledAt.Time
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"algopay/models"
+)
+
+// transitionAttempts bounds how often a status change is retried when another
+// writer updates the payment between the read and the update
+const transitionAttempts = 3
+
+// errStalePayment is returned by one transition attempt when the payment's
+// status or version changed after it was read
+var errStalePayment = errors.New("stale payment")
+
+// transitionPayment moves a payment to status to, setting the extra
+// assignments in set from args, and returns the updated record. An empty
+// merchantID matches any merchant. check, when not nil, is called with the
+// current record and its error returned with that record; the change must
+// also be allowed by the payment state machine, or a *models.TransitionError
+// is returned. The update is conditional on the status and version that were
+// read, is audited in the same transaction, and is retried when another
+// writer got there first.
+func (d *Database) transitionPayment(merchantID, id string, check func(*models.Payment) error, to models.PaymentStatus, set string, args ...interface{}) (*models.Payment, error) {
+	for attempt := 0; attempt < transitionAttempts; attempt++ {
+		payment, err := d.tryTransition(merchantID, id, check, to, set, args)
+		if err != errStalePayment {
+			return payment, err
+		}
+	}
+	return nil, ErrPaymentVersionConflict
+}
+
+// tryTransition makes one attempt at transitionPayment in a transaction
+func (d *Database) tryTransition(merchantID, id string, check func(*models.Payment) error, to models.PaymentStatus, set string, args []interface{}) (*models.Payment, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id = ? AND ? IN ('', merchant_id)`
+	current, err := scanPayment(tx.QueryRow(query, id, merchantID))
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(current); err != nil {
+			return current, err
+		}
+	}
+	if err := models.CheckTransition(current.Status, to); err != nil {
+		return current, err
+	}
+
+	update := `UPDATE payments SET status = ?, version = version + 1, updated_at = ?`
+	if set != "" {
+		update += `, ` + set
+	}
+	update += ` WHERE id = ? AND status = ? AND version = ?`
+	values := append([]interface{}{to, time.Now()}, args...)
+	values = append(values, id, current.Status, current.Version)
+
+	result, err := tx.Exec(update, values...)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, errStalePayment
+	}
+
+	updated, err := scanPayment(tx.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := d.auditPayment(tx, statusAuditAction(to), current, updated); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"algopay/models"
+	"algopay/parquet"
+)
+
+// paymentColumns are the columns of a payments export
+var paymentColumns = []column{
+	{"id", parquet.String},
+	{"merchant_id", parquet.String},
+	{"status", parquet.String},
+	{"amount", parquet.Int64},
+	{"asset_id", parquet.Int64},
+	{"settled_asset_id", parquet.Int64},
+	{"received_amount", parquet.Int64},
+	{"merchant_address", parquet.String},
+	{"payer_address", parquet.String},
+	{"txn_id", parquet.String},
+	{"late", parquet.Boolean},
+	{"refund_txn_id", parquet.String},
+	{"order_reference", parquet.String},
+	{"subscription_id", parquet.String},
+	{"payment_link_id", parquet.String},
+	{"invoice_id", parquet.String},
+	{"fiat_amount", parquet.String},
+	{"fiat_currency", parquet.String},
+	{"exchange_rate", parquet.String},
+	{"created_at", parquet.Timestamp},
+	{"updated_at", parquet.Timestamp},
+	{"expires_at", parquet.Timestamp},
+}
+
+// paymentRow returns a payment's values in paymentColumns order
+func paymentRow(p *models.Payment) []interface{} {
+	var settledAssetID interface{}
+	if p.SettledAssetID != nil {
+		settledAssetID = *p.SettledAssetID
+	}
+	return []interface{}{
+		p.ID, p.MerchantID, string(p.Status), p.Amount, p.AssetID, settledAssetID, p.ReceivedAmount,
+		p.MerchantAddress, p.PayerAddress, p.TxnID, p.Late, p.RefundTxnID, p.OrderReference,
+		p.SubscriptionID, p.PaymentLinkID, p.InvoiceID, p.FiatAmount, p.FiatCurrency, p.ExchangeRate,
+		p.CreatedAt, p.UpdatedAt, p.ExpiresAt,
+	}
+}
+
+// transactionColumns are the columns of transactions and refunds exports
+var transactionColumns = []column{
+	{"type", parquet.String},
+	{"merchant_id", parquet.String},
+	{"reference", parquet.String},
+	{"payment_id", parquet.String},
+	{"txn_id", parquet.String},
+	{"asset_id", parquet.Int64},
+	{"amount", parquet.Int64},
+	{"counterparty", parquet.String},
+	{"fee", parquet.Int64},
+	{"occurred_at", parquet.Timestamp},
+}
+
+// transactionRow returns a transaction's values in transactionColumns order
+func transactionRow(t *models.ExportTransaction) []interface{} {
+	return []interface{}{
+		t.Type, t.MerchantID, t.Reference, t.PaymentID, t.TxnID, t.AssetID, t.Amount,
+		t.Counterparty, t.Fee, t.OccurredAt,
+	}
+}
+
+// feeColumns are the columns of a fees export
+var feeColumns = []column{
+	{"entry_id", parquet.Int64},
+	{"merchant_id", parquet.String},
+	{"reference", parquet.String},
+	{"description", parquet.String},
+	{"amount", parquet.Int64},
+	{"created_at", parquet.Timestamp},
+}
+
+// feeRow returns a fee's values in feeColumns order
+func feeRow(f *models.ExportFee) []interface{} {
+	return []interface{}{f.EntryID, f.MerchantID, f.Reference, f.Description, f.Amount, f.CreatedAt}
+}
+
+// auditColumns are the columns of an audit export; before and after are JSON
+var auditColumns = []column{
+	{"id", parquet.Int64},
+	{"action", parquet.String},
+	{"resource", parquet.String},
+	{"resource_id", parquet.String},
+	{"merchant_id", parquet.String},
+	{"actor_type", parquet.String},
+	{"actor_id", parquet.String},
+	{"request_id", parquet.String},
+	{"before", parquet.String},
+	{"after", parquet.String},
+	{"created_at", parquet.Timestamp},
+	{"prev_hash", parquet.String},
+	{"hash", parquet.String},
+}
+
+// auditRow returns an audit entry's values in auditColumns order
+func auditRow(e *models.AuditEntry) []interface{} {
+	return []interface{}{
+		e.ID, e.Action, e.Resource, e.ResourceID, e.MerchantID, string(e.ActorType), e.ActorID, e.RequestID,
+		string(e.Before), string(e.After), e.CreatedAt, e.PrevHash, e.Hash,
+	}
+}
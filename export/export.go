@@ -0,0 +1,113 @@
+// Package export streams payment datasets from the database as CSV, JSON
+// Lines or Parquet.
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"algopay/db"
+	"algopay/models"
+	"algopay/parquet"
+)
+
+// Options selects what an export contains and how it is written
+type Options struct {
+	Dataset models.ExportDataset
+	Format  models.ExportFormat
+	Filter  models.ExportFilter
+}
+
+// column is one field of an exported record
+type column struct {
+	name string
+	kind parquet.Type
+}
+
+// Write streams the dataset to w in the format and returns the number of
+// rows written
+func Write(database db.Store, opts Options, w io.Writer) (int64, error) {
+	columns, err := datasetColumns(opts.Dataset)
+	if err != nil {
+		return 0, err
+	}
+
+	buffered := bufio.NewWriter(w)
+	out, err := newRowWriter(opts.Format, buffered, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	write := func(row []interface{}) error {
+		rows++
+		return out.write(row)
+	}
+	if err := stream(database, opts, write); err != nil {
+		return rows, err
+	}
+	if err := out.close(); err != nil {
+		return rows, err
+	}
+	return rows, buffered.Flush()
+}
+
+// ContentType returns the MIME type of files in the format
+func ContentType(format models.ExportFormat) string {
+	switch format {
+	case models.ExportJSONL:
+		return "application/jsonl"
+	case models.ExportParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv"
+	}
+}
+
+// FileName returns the name an export is downloaded as
+func FileName(id string, opts Options) string {
+	return fmt.Sprintf("%s-%s.%s", opts.Dataset, id, opts.Format)
+}
+
+// datasetColumns returns the columns of a dataset
+func datasetColumns(dataset models.ExportDataset) ([]column, error) {
+	switch dataset {
+	case models.ExportPayments:
+		return paymentColumns, nil
+	case models.ExportTransactions, models.ExportRefunds:
+		return transactionColumns, nil
+	case models.ExportFees:
+		return feeColumns, nil
+	case models.ExportAudit:
+		return auditColumns, nil
+	}
+	return nil, fmt.Errorf("unknown dataset %q", dataset)
+}
+
+// stream reads the dataset and passes each record to write as a row
+func stream(database db.Store, opts Options, write func([]interface{}) error) error {
+	switch opts.Dataset {
+	case models.ExportPayments:
+		return database.ExportPayments(opts.Filter, func(payment *models.Payment) error {
+			return write(paymentRow(payment))
+		})
+	case models.ExportTransactions, models.ExportRefunds:
+		var types []string
+		if opts.Dataset == models.ExportRefunds {
+			types = []string{models.TransactionRefund}
+		}
+		return database.ExportTransactions(opts.Filter, types, func(transaction *models.ExportTransaction) error {
+			return write(transactionRow(transaction))
+		})
+	case models.ExportFees:
+		return database.ExportFees(opts.Filter, func(fee *models.ExportFee) error {
+			return write(feeRow(fee))
+		})
+	case models.ExportAudit:
+		return database.ExportAuditEntries(opts.Filter, func(entry *models.AuditEntry) error {
+			return write(auditRow(entry))
+		})
+	}
+	return fmt.Errorf("unknown dataset %q", opts.Dataset)
+}
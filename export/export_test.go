@@ -0,0 +1,186 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"algopay/db"
+	"algopay/export"
+	"algopay/models"
+)
+
+// newExportDatabase returns a database with three payments of one merchant,
+// created a day apart from 2024-01-01, and one of another merchant
+func newExportDatabase(t *testing.T) *db.Database {
+	t.Helper()
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "algopay.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"m1", "m2"} {
+		merchant := &models.Merchant{ID: id, DisplayName: id, ReceivingAddress: "ADDR-" + id, LatePaymentAction: "manual", CreatedAt: start, UpdatedAt: start}
+		if err := database.CreateMerchant(merchant); err != nil {
+			t.Fatalf("CreateMerchant: %v", err)
+		}
+	}
+	payments := []*models.Payment{
+		{ID: "p1", MerchantID: "m1", Amount: 1000000},
+		{ID: "p2", MerchantID: "m1", Amount: 2000000, OrderReference: "order, \"quoted\""},
+		{ID: "p3", MerchantID: "m1", Amount: 3000000},
+		{ID: "p4", MerchantID: "m2", Amount: 4000000},
+	}
+	for i, payment := range payments {
+		payment.MerchantAddress = "ADDR-" + payment.MerchantID
+		payment.Status = models.PaymentStatusPending
+		payment.CreatedAt = start.Add(time.Duration(i%3) * 24 * time.Hour)
+		payment.UpdatedAt = payment.CreatedAt
+		payment.ExpiresAt = payment.CreatedAt.Add(time.Hour)
+		if err := database.CreatePayment(payment, models.PaymentCaps{}); err != nil {
+			t.Fatalf("CreatePayment: %v", err)
+		}
+	}
+	return database
+}
+
+// TestWriteCSV exports one merchant's payments in a range as CSV
+func TestWriteCSV(t *testing.T) {
+	database := newExportDatabase(t)
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	opts := export.Options{
+		Dataset: models.ExportPayments,
+		Format:  models.ExportCSV,
+		Filter:  models.ExportFilter{MerchantID: "m1", From: &from},
+	}
+
+	var buf bytes.Buffer
+	rows, err := export.Write(database, opts, &buf)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if rows != 2 || len(records) != 3 {
+		t.Fatalf("wrote %d rows and %d records, want 2 rows after a header", rows, len(records))
+	}
+	header := records[0]
+	column := func(record []string, name string) string {
+		for i, field := range header {
+			if field == name {
+				return record[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	if column(records[1], "id") != "p2" || column(records[2], "id") != "p3" {
+		t.Fatalf("exported %v, want p2 and p3 oldest first", records[1:])
+	}
+	if got := column(records[1], "order_reference"); got != `order, "quoted"` {
+		t.Errorf("order_reference = %q", got)
+	}
+	if got := column(records[1], "created_at"); got != "2024-01-02T12:00:00Z" {
+		t.Errorf("created_at = %q, want UTC RFC 3339", got)
+	}
+	if got := column(records[1], "settled_asset_id"); got != "" {
+		t.Errorf("settled_asset_id of an unpaid payment = %q, want empty", got)
+	}
+}
+
+// TestWriteJSONL exports every merchant's payments as JSON Lines
+func TestWriteJSONL(t *testing.T) {
+	database := newExportDatabase(t)
+	opts := export.Options{Dataset: models.ExportPayments, Format: models.ExportJSONL}
+
+	var buf bytes.Buffer
+	rows, err := export.Write(database, opts, &buf)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if rows != 4 {
+		t.Fatalf("wrote %d rows, want 4", rows)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	amounts := map[string]uint64{}
+	for scanner.Scan() {
+		var row struct {
+			ID         string `json:"id"`
+			MerchantID string `json:"merchant_id"`
+			Amount     uint64 `json:"amount"`
+			Late       bool   `json:"late"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		amounts[row.ID] = row.Amount
+	}
+	if amounts["p1"] != 1000000 || amounts["p4"] != 4000000 {
+		t.Fatalf("amounts = %v", amounts)
+	}
+}
+
+// TestWriteFees exports network fees posted to the ledger
+func TestWriteFees(t *testing.T) {
+	database := newExportDatabase(t)
+	entry := models.NewTransferEntry("m1", 0, models.EntryNetworkFee, "txn-1", "Refund fee",
+		models.LedgerNetworkFees, models.LedgerReceiving, 1000)
+	if err := database.PostJournalEntry(entry); err != nil {
+		t.Fatalf("PostJournalEntry: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rows, err := export.Write(database, export.Options{Dataset: models.ExportFees, Format: models.ExportCSV}, &buf)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if rows != 1 || len(records) != 2 || records[1][2] != "txn-1" || records[1][4] != "1000" {
+		t.Fatalf("fees export = %v", records)
+	}
+}
+
+// TestWriteRejectsUnknownOptions checks unknown datasets and formats fail
+func TestWriteRejectsUnknownOptions(t *testing.T) {
+	database := newExportDatabase(t)
+	for _, opts := range []export.Options{
+		{Dataset: "customers", Format: models.ExportCSV},
+		{Dataset: models.ExportPayments, Format: "xlsx"},
+	} {
+		if _, err := export.Write(database, opts, &bytes.Buffer{}); err == nil {
+			t.Errorf("Write(%+v) succeeded", opts)
+		}
+	}
+}
+
+// TestFileName checks download names and content types
+func TestFileName(t *testing.T) {
+	opts := export.Options{Dataset: models.ExportRefunds, Format: models.ExportParquet}
+	if got := export.FileName("job-1", opts); got != "refunds-job-1.parquet" {
+		t.Errorf("FileName = %q", got)
+	}
+	for format, want := range map[models.ExportFormat]string{
+		models.ExportCSV:     "text/csv",
+		models.ExportJSONL:   "application/jsonl",
+		models.ExportParquet: "application/vnd.apache.parquet",
+	} {
+		if got := export.ContentType(format); got != want {
+			t.Errorf("ContentType(%s) = %q, want %q", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"algopay/models"
+	"algopay/parquet"
+)
+
+// rowWriter writes rows of values in column order
+type rowWriter interface {
+	write(row []interface{}) error
+	close() error
+}
+
+// newRowWriter creates a writer for the format and writes any header
+func newRowWriter(format models.ExportFormat, w io.Writer, columns []column) (rowWriter, error) {
+	switch format {
+	case models.ExportCSV:
+		return newCSVWriter(w, columns)
+	case models.ExportJSONL:
+		return &jsonlWriter{w: w, columns: columns}, nil
+	case models.ExportParquet:
+		schema := make([]parquet.Column, len(columns))
+		for i, c := range columns {
+			schema[i] = parquet.Column{Name: c.name, Type: c.kind}
+		}
+		writer, err := parquet.NewWriter(w, schema)
+		if err != nil {
+			return nil, err
+		}
+		return parquetWriter{writer}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// csvWriter writes rows as CSV with a header line
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+// newCSVWriter creates a CSV writer and writes the header line
+func newCSVWriter(w io.Writer, columns []column) (*csvWriter, error) {
+	writer := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, c := range columns {
+		writer.record[i] = c.name
+	}
+	if err := writer.w.Write(writer.record); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// write writes a row as a CSV record
+func (c *csvWriter) write(row []interface{}) error {
+	for i, value := range row {
+		c.record[i] = formatValue(value)
+	}
+	return c.w.Write(c.record)
+}
+
+// close flushes buffered records
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatValue renders a value as CSV text; nil is empty
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonlWriter writes each row as a JSON object on its own line, with keys in
+// column order
+type jsonlWriter struct {
+	w       io.Writer
+	columns []column
+	line    bytes.Buffer
+}
+
+// write writes a row as one line of JSON
+func (j *jsonlWriter) write(row []interface{}) error {
+	j.line.Reset()
+	j.line.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			j.line.WriteByte(',')
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC()
+		}
+		key, _ := json.Marshal(j.columns[i].name)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		j.line.Write(key)
+		j.line.WriteByte(':')
+		j.line.Write(encoded)
+	}
+	j.line.WriteString("}\n")
+	_, err := j.w.Write(j.line.Bytes())
+	return err
+}
+
+// close does nothing; every line is written whole
+func (j *jsonlWriter) close() error {
+	return nil
+}
+
+// parquetWriter adapts a Parquet writer to rowWriter
+type parquetWriter struct {
+	w *parquet.Writer
+}
+
+// write buffers a row in the current row group
+func (p parquetWriter) write(row []interface{}) error {
+	return p.w.Write(row)
+}
+
+// close writes the last row group and the footer
+func (p parquetWriter) close() error {
+	return p.w.Close()
+}
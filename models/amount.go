@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// DecimalPattern matches non-negative decimal strings such as "12" or "12.50",
+// as used by display amounts and exchange rates
+var DecimalPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ratePattern matches percentage rates such as "20" or "8.875", as used by
+// invoice adjustments and payment splits
+var ratePattern = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,4})?$`)
+
+// FormatAmount renders base units as a decimal string in whole asset units,
+// without trailing zeros
+func FormatAmount(amount, decimals uint64) string {
+	digits := new(big.Int).SetUint64(amount).String()
+	if decimals == 0 {
+		return digits
+	}
+
+	d := int(decimals)
+	if len(digits) <= d {
+		digits = strings.Repeat("0", d-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-d], strings.TrimRight(digits[len(digits)-d:], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// ParseAmount converts a decimal string in whole asset units to base units.
+// It fails if the string has more fractional digits than the asset supports.
+func ParseAmount(value string, decimals uint64) (uint64, error) {
+	if !DecimalPattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if uint64(len(fraction)) > decimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", value, decimals)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", int(decimals)-len(fraction))
+	units, ok := new(big.Int).SetString(digits, 10)
+	if !ok || !units.IsUint64() {
+		return 0, fmt.Errorf("amount %q is too large", value)
+	}
+	return units.Uint64(), nil
+}
+
+// parseRate parses a percentage between 0 (exclusive) and 100
+func parseRate(value string) (*big.Rat, error) {
+	if !ratePattern.MatchString(value) {
+		return nil, errors.New("rate must be a percentage with at most 4 decimal places")
+	}
+	rate, _ := new(big.Rat).SetString(value)
+	if rate.Sign() == 0 || rate.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, errors.New("rate must be greater than 0 and at most 100")
+	}
+	return rate, nil
+}
+
+// percentOf returns rate percent of amount
+func percentOf(rate *big.Rat, amount uint64) *big.Rat {
+	result := new(big.Rat).SetInt(new(big.Int).SetUint64(amount))
+	result.Mul(result, rate)
+	return result.Quo(result, big.NewRat(100, 1))
+}
+
+// roundHalfUp rounds a non-negative rational to the nearest integer, with
+// halves rounded up
+func roundHalfUp(r *big.Rat) *big.Int {
+	doubled := new(big.Int).Mul(r.Num(), big.NewInt(2))
+	doubled.Add(doubled, r.Denom())
+	denom := new(big.Int).Mul(r.Denom(), big.NewInt(2))
+	return doubled.Quo(doubled, denom)
+}
@@ -0,0 +1,84 @@
+package models_test
+
+import (
+	"testing"
+
+	"algopay/models"
+)
+
+// TestFormatAmount checks base units render in whole units without trailing
+// zeros
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   uint64
+		decimals uint64
+		want     string
+	}{
+		{0, 6, "0"},
+		{1, 6, "0.000001"},
+		{1500000, 6, "1.5"},
+		{12000000, 6, "12"},
+		{123456789, 6, "123.456789"},
+		{42, 0, "42"},
+		{18446744073709551615, 19, "1.8446744073709551615"},
+		{18446744073709551615, 0, "18446744073709551615"},
+	}
+	for _, test := range tests {
+		if got := models.FormatAmount(test.amount, test.decimals); got != test.want {
+			t.Errorf("FormatAmount(%d, %d) = %q, want %q", test.amount, test.decimals, got, test.want)
+		}
+	}
+}
+
+// TestParseAmount checks decimal strings convert to base units and reject
+// extra precision and amounts that overflow
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value    string
+		decimals uint64
+		want     uint64
+		err      bool
+	}{
+		{"1.5", 6, 1500000, false},
+		{"12", 6, 12000000, false},
+		{"0.000001", 6, 1, false},
+		{"1.500000000", 6, 1500000, false}, // trailing zeros add no precision
+		{"007", 2, 700, false},
+		{"42", 0, 42, false},
+		{"18446744073709551615", 0, 18446744073709551615, false},
+		{"18446744073709.551615", 6, 18446744073709551615, false},
+		{"0.0000001", 6, 0, true},
+		{"1.5", 0, 0, true},
+		{"18446744073709551616", 0, 0, true},
+		{"18446744073709.551616", 6, 0, true},
+		{"99999999999999999999999", 6, 0, true},
+		{"", 6, 0, true},
+		{"-1", 6, 0, true},
+		{"1.", 6, 0, true},
+		{".5", 6, 0, true},
+		{"1e6", 6, 0, true},
+		{" 1", 6, 0, true},
+	}
+	for _, test := range tests {
+		got, err := models.ParseAmount(test.value, test.decimals)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %d) = %d, want an error", test.value, test.decimals, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v, want %d", test.value, test.decimals, got, err, test.want)
+		}
+	}
+}
+
+// TestAmountRoundTrip checks formatted amounts parse back to the same units
+func TestAmountRoundTrip(t *testing.T) {
+	for _, amount := range []uint64{0, 1, 10, 999999, 1000000, 1234567890} {
+		got, err := models.ParseAmount(models.FormatAmount(amount, 6), 6)
+		if err != nil || got != amount {
+			t.Errorf("round trip of %d = %d, %v", amount, got, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// APIKeyType distinguishes keys that may be embedded in clients from server-side keys
+type APIKeyType string
+
+const (
+	APIKeyTypePublishable APIKeyType = "publishable"
+	APIKeyTypeSecret      APIKeyType = "secret"
+)
+
+// API key scopes
+const (
+	ScopeCheckoutRead  = "checkout:read"
+	ScopePaymentsRead  = "payments:read"
+	ScopePaymentsWrite = "payments:write"
+	ScopePayoutsRead   = "payouts:read"
+	ScopePayoutsWrite  = "payouts:write"
+	ScopeExportsRead   = "exports:read"
+	ScopeExportsWrite  = "exports:write"
+)
+
+// AllScopes lists every scope a secret key may be granted
+var AllScopes = []string{
+	ScopeCheckoutRead,
+	ScopePaymentsRead,
+	ScopePaymentsWrite,
+	ScopePayoutsRead,
+	ScopePayoutsWrite,
+	ScopeExportsRead,
+	ScopeExportsWrite,
+}
+
+// PublishableScopes lists the scopes a publishable key may be granted; they
+// only reach the status of a single payment, for checkout pages
+var PublishableScopes = []string{
+	ScopeCheckoutRead,
+}
+
+// impliedScopes lists the narrower scopes granted along with a scope
+var impliedScopes = map[string][]string{
+	ScopePaymentsRead: {ScopeCheckoutRead},
+}
+
+// APIKey represents a hashed API key belonging to a merchant
+type APIKey struct {
+	ID         string     `json:"id" db:"id"`
+	MerchantID string     `json:"merchant_id" db:"merchant_id"`
+	Name       string     `json:"name" db:"name"`
+	Type       APIKeyType `json:"type" db:"type"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted the given scope, directly or
+// through a broader scope that implies it
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || slices.Contains(impliedScopes[granted], scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRequest represents an API key creation request
+type APIKeyRequest struct {
+	MerchantID string     `json:"merchant_id" binding:"required"`
+	Name       string     `json:"name"`
+	Type       APIKeyType `json:"type" binding:"required"`
+	Scopes     []string   `json:"scopes"`
+}
+
+// APIKeyResponse represents an API key creation response; the plaintext key is only returned once
+type APIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	"testing"
+
+	"algopay/models"
+)
+
+// TestHasScope checks scopes are granted directly or through a broader scope
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{[]string{models.ScopePaymentsRead}, models.ScopePaymentsRead, true},
+		{[]string{models.ScopePaymentsRead}, models.ScopeCheckoutRead, true},
+		{[]string{models.ScopeCheckoutRead}, models.ScopePaymentsRead, false},
+		{[]string{models.ScopePaymentsWrite}, models.ScopePaymentsRead, false},
+		{[]string{models.ScopePaymentsWrite}, models.ScopeCheckoutRead, false},
+		{[]string{models.ScopePayoutsWrite}, models.ScopePayoutsRead, false},
+		{[]string{models.ScopeExportsWrite}, models.ScopeExportsRead, false},
+		{models.PublishableScopes, models.ScopeCheckoutRead, true},
+		{models.PublishableScopes, models.ScopePaymentsRead, false},
+		{nil, models.ScopeCheckoutRead, false},
+	}
+	for _, test := range tests {
+		key := &models.APIKey{Scopes: test.granted}
+		if got := key.HasScope(test.scope); got != test.want {
+			t.Errorf("HasScope(%q) with %v = %v, want %v", test.scope, test.granted, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ActorType identifies who made a change recorded in the audit log
+type ActorType string
+
+const (
+	ActorAPIKey ActorType = "api_key" // a merchant API key; the actor ID is the key's ID
+	ActorAdmin  ActorType = "admin"   // the admin API key
+	ActorSystem ActorType = "system"  // a background job; the actor ID names the job
+	ActorPublic ActorType = "public"  // an unauthenticated visitor, such as a payment link page
+)
+
+// Actor is who made a change and the API request it was made in
+type Actor struct {
+	Type      ActorType `json:"type"`
+	ID        string    `json:"id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"` // empty for background jobs
+}
+
+// SystemActor returns the actor of a background job
+func SystemActor(job string) Actor {
+	return Actor{Type: ActorSystem, ID: job}
+}
+
+// Audited resources
+const (
+	AuditResourcePayment        = "payment"
+	AuditResourceMerchant       = "merchant"
+	AuditResourceAPIKey         = "api_key"
+	AuditResourceReconciliation = "reconciliation"
+	AuditResourceExport         = "export"
+)
+
+// Audit actions
+const (
+	AuditPaymentCreated        = "payment.created"
+	AuditPaymentStatusChanged  = "payment.status_changed"
+	AuditPaymentCancelled      = "payment.cancelled"
+	AuditPaymentExtended       = "payment.extended"
+	AuditPaymentRefundStarted  = "payment.refund_started"
+	AuditPaymentRefunded       = "payment.refunded"
+	AuditMerchantCreated       = "merchant.created"
+	AuditMerchantUpdated       = "merchant.updated"
+	AuditMerchantSecretRotated = "merchant.webhook_secret_rotated"
+	AuditAPIKeyCreated         = "api_key.created"
+	AuditAPIKeyRevoked         = "api_key.revoked"
+	AuditReconciliationStarted = "reconciliation.started"
+	AuditExportCreated         = "export.created"
+)
+
+// AuditEntry is one record in the append-only audit log. Entries form a hash
+// chain: each hash covers the entry's fields and the previous entry's hash,
+// so changing, removing or reordering entries breaks every later hash.
+type AuditEntry struct {
+	ID         int64           `json:"id" db:"id"` // position in the chain, from 1
+	Action     string          `json:"action" db:"action"`
+	Resource   string          `json:"resource" db:"resource"`
+	ResourceID string          `json:"resource_id" db:"resource_id"`
+	MerchantID string          `json:"merchant_id,omitempty" db:"merchant_id"`
+	ActorType  ActorType       `json:"actor_type" db:"actor_type"`
+	ActorID    string          `json:"actor_id,omitempty" db:"actor_id"`
+	RequestID  string          `json:"request_id,omitempty" db:"request_id"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before_value"` // the resource before the change; empty on creation
+	After      json.RawMessage `json:"after,omitempty" db:"after_value"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+	PrevHash   string          `json:"prev_hash" db:"prev_hash"` // empty for the first entry
+	Hash       string          `json:"hash" db:"hash"`
+}
+
+// NewAuditEntry builds an entry recording a change to a resource. Before and
+// after are encoded as JSON; nil leaves them empty.
+func NewAuditEntry(action, resource, resourceID, merchantID string, before, after interface{}) (*AuditEntry, error) {
+	entry := &AuditEntry{Action: action, Resource: resource, ResourceID: resourceID, MerchantID: merchantID}
+	var err error
+	if entry.Before, err = auditValue(before); err != nil {
+		return nil, fmt.Errorf("failed to encode audit value: %w", err)
+	}
+	if entry.After, err = auditValue(after); err != nil {
+		return nil, fmt.Errorf("failed to encode audit value: %w", err)
+	}
+	return entry, nil
+}
+
+// auditValue encodes a before or after value
+func auditValue(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// ComputeHash returns the hex SHA-256 of the entry chained to PrevHash. Each
+// field is hashed as its length, a colon, the value and a newline, with the
+// time in UTC RFC 3339 with nanoseconds.
+func (e *AuditEntry) ComputeHash() string {
+	h := sha256.New()
+	for _, field := range []string{
+		e.PrevHash,
+		fmt.Sprint(e.ID),
+		e.Action,
+		e.Resource,
+		e.ResourceID,
+		e.MerchantID,
+		string(e.ActorType),
+		e.ActorID,
+		e.RequestID,
+		string(e.Before),
+		string(e.After),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	} {
+		fmt.Fprintf(h, "%d:%s\n", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditFilter selects a page of audit entries. Empty fields match every
+// entry; After is the ID of the last entry on the previous page.
+type AuditFilter struct {
+	MerchantID string
+	Resource   string
+	ResourceID string
+	After      int64
+	Limit      int
+}
+
+// AuditEntryList represents one page of audit entries
+type AuditEntryList struct {
+	Entries []*AuditEntry `json:"entries"`
+	HasMore bool          `json:"has_more"`
+}
+
+// AuditVerification reports the result of checking the audit log's hash chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`             // entries checked
+	LastHash string `json:"last_hash,omitempty"` // head of the chain when valid
+	BrokenAt int64  `json:"broken_at,omitempty"` // ID of the first entry that fails
+	Error    string `json:"error,omitempty"`
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExportDataset names the records an export contains
+type ExportDataset string
+
+const (
+	ExportPayments     ExportDataset = "payments"     // payments created in the range
+	ExportTransactions ExportDataset = "transactions" // on-chain transactions matched to payments, refunds and payouts
+	ExportRefunds      ExportDataset = "refunds"      // refund transactions only
+	ExportFees         ExportDataset = "fees"         // network fees paid by receiving addresses
+	ExportAudit        ExportDataset = "audit"        // audit log entries recorded in the range
+)
+
+// ExportFormat is the file format of an export
+type ExportFormat string
+
+const (
+	ExportCSV     ExportFormat = "csv"
+	ExportJSONL   ExportFormat = "jsonl"
+	ExportParquet ExportFormat = "parquet"
+)
+
+// ExportStatus represents the state of an export job
+type ExportStatus string
+
+const (
+	ExportPending   ExportStatus = "pending"
+	ExportRunning   ExportStatus = "running"
+	ExportCompleted ExportStatus = "completed"
+	ExportFailed    ExportStatus = "failed"
+	ExportExpired   ExportStatus = "expired" // the file has been deleted
+)
+
+// ExportRequest represents a request to export a dataset. From and To are
+// dates or RFC 3339 times; a date in To includes that whole day.
+type ExportRequest struct {
+	Dataset    ExportDataset `json:"dataset" binding:"required"`
+	Format     ExportFormat  `json:"format"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	MerchantID string        `json:"merchant_id"` // admin exports only; empty exports every merchant
+}
+
+// ExportJob is an export produced in the background into a downloadable
+// file. From is inclusive and To exclusive; either may be open.
+type ExportJob struct {
+	ID          string        `json:"id" db:"id"`
+	MerchantID  string        `json:"merchant_id,omitempty" db:"merchant_id"`
+	Dataset     ExportDataset `json:"dataset" db:"dataset"`
+	Format      ExportFormat  `json:"format" db:"format"`
+	From        *time.Time    `json:"from,omitempty" db:"range_start"`
+	To          *time.Time    `json:"to,omitempty" db:"range_end"`
+	Status      ExportStatus  `json:"status" db:"status"`
+	Rows        int64         `json:"rows" db:"rows"`
+	Size        int64         `json:"size" db:"size"` // file size in bytes
+	Error       string        `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// ExportFilter selects the records an export streams. An empty MerchantID
+// covers every merchant; From is inclusive and To exclusive.
+type ExportFilter struct {
+	MerchantID string
+	From       *time.Time
+	To         *time.Time
+}
+
+// ExportTransaction is one on-chain transaction in a transactions or refunds
+// export. Reference is the ID of the payment, refunded payment, split payout
+// or payout the transaction settled.
+type ExportTransaction struct {
+	Type         string    `json:"type"` // payment, refund, split_payout or payout
+	MerchantID   string    `json:"merchant_id"`
+	Reference    string    `json:"reference"`
+	PaymentID    string    `json:"payment_id,omitempty"`
+	TxnID        string    `json:"txn_id"`
+	AssetID      uint64    `json:"asset_id"`
+	Amount       uint64    `json:"amount"`
+	Counterparty string    `json:"counterparty"` // the payer, refund recipient or payout destination
+	Fee          uint64    `json:"fee"`          // network fee in microAlgos paid by the merchant
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// Transaction types in transaction exports
+const (
+	TransactionPayment     = "payment"
+	TransactionRefund      = "refund"
+	TransactionSplitPayout = "split_payout"
+	TransactionPayout      = "payout"
+)
+
+// ExportFee is one network fee in a fees export. Reference is the
+// transaction or split payout group the fee paid for.
+type ExportFee struct {
+	EntryID     int64     `json:"entry_id"`
+	MerchantID  string    `json:"merchant_id"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	Amount      uint64    `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Validate checks the dataset and format, defaulting the format to CSV
+func (r *ExportRequest) Validate() error {
+	switch r.Dataset {
+	case ExportPayments, ExportTransactions, ExportRefunds, ExportFees, ExportAudit:
+	default:
+		return fmt.Errorf("dataset must be one of %s, %s, %s, %s or %s", ExportPayments, ExportTransactions, ExportRefunds, ExportFees, ExportAudit)
+	}
+	if r.Format == "" {
+		r.Format = ExportCSV
+	}
+	switch r.Format {
+	case ExportCSV, ExportJSONL, ExportParquet:
+	default:
+		return fmt.Errorf("format must be one of %s, %s or %s", ExportCSV, ExportJSONL, ExportParquet)
+	}
+	return nil
+}
+
+// Range parses the request's time range
+func (r *ExportRequest) Range() (from, to *time.Time, err error) {
+	if from, err = ParseExportTime(r.From, false); err != nil {
+		return nil, nil, fmt.Errorf("invalid from: %w", err)
+	}
+	if to, err = ParseExportTime(r.To, true); err != nil {
+		return nil, nil, fmt.Errorf("invalid to: %w", err)
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, errors.New("from must be earlier than to")
+	}
+	return from, to, nil
+}
+
+// ParseExportTime parses a date or RFC 3339 time bounding an export; empty
+// values leave the bound open. Dates are midnight UTC, or the following
+// midnight when end is set so that the range includes the whole day.
+func ParseExportTime(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a date nor an RFC 3339 time", value)
+	}
+	return &t, nil
+}
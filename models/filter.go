@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// Payment list sort fields
+const (
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+	SortByExpiresAt = "expires_at"
+	SortByAmount    = "amount"
+)
+
+// Payment list page sizes
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// PaymentFilter selects, orders and paginates payments in list queries.
+// An empty MerchantID matches payments of every merchant.
+type PaymentFilter struct {
+	MerchantID      string
+	Statuses        []PaymentStatus
+	MerchantAddress string
+	AssetID         *uint64
+	TxnID           string
+	OrderReference  string
+	SubscriptionID  string
+	PaymentLinkID   string
+	InvoiceID       string
+	Metadata        map[string]string
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	UpdatedAfter    *time.Time
+	UpdatedBefore   *time.Time
+
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+// PaymentList represents one page of a payment list
+type PaymentList struct {
+	Payments   []*Payment `json:"payments"`
+	HasMore    bool       `json:"has_more"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
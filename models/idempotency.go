@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyRecord stores the outcome of a request made with an Idempotency-Key header.
+// A StatusCode of 0 means the original request is still in progress.
+type IdempotencyRecord struct {
+	MerchantID   string    `json:"merchant_id" db:"merchant_id"`
+	Key          string    `json:"idempotency_key" db:"idempotency_key"`
+	RequestHash  string    `json:"request_hash" db:"request_hash"`
+	StatusCode   int       `json:"status_code" db:"status_code"`
+	ResponseBody []byte    `json:"response_body" db:"response_body"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Invoice limits
+const (
+	MaxInvoiceLineItems   = 100
+	MaxInvoiceAdjustments = 10 // per list of discounts or tax lines
+
+	maxInvoiceDescriptionLength = 200
+)
+
+// quantityPattern matches positive decimal quantities with up to 6 fractional digits
+var quantityPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,6})?$`)
+
+// InvoiceLineItem is one billed item. UnitPrice is in base units of the
+// invoice asset; Amount is computed from the quantity and unit price.
+type InvoiceLineItem struct {
+	Description string `json:"description"`
+	Quantity    string `json:"quantity"` // decimal string, defaults to "1"
+	UnitPrice   uint64 `json:"unit_price"`
+	Amount      uint64 `json:"amount"`
+}
+
+// InvoiceAdjustment is a discount or tax line, given either as a percentage
+// Rate or as a fixed Amount in base units. Amount is computed for rates.
+type InvoiceAdjustment struct {
+	Description string `json:"description"`
+	Rate        string `json:"rate,omitempty"` // percent, e.g. "8.25"
+	Amount      uint64 `json:"amount"`
+}
+
+// Invoice is an itemized bill settled by a single payment for its Total.
+// Discounts apply to the subtotal and taxes to the subtotal after discounts.
+// Number is sequential per merchant.
+type Invoice struct {
+	ID              string                 `json:"id" db:"id"`
+	MerchantID      string                 `json:"merchant_id" db:"merchant_id"`
+	Number          string                 `json:"number" db:"number"`
+	Sequence        int64                  `json:"sequence" db:"sequence"`
+	PaymentID       string                 `json:"payment_id" db:"payment_id"`
+	AssetID         uint64                 `json:"asset_id" db:"asset_id"`
+	UnitName        string                 `json:"unit_name,omitempty" db:"unit_name"`
+	Decimals        uint64                 `json:"decimals" db:"decimals"`
+	CustomerName    string                 `json:"customer_name,omitempty" db:"customer_name"`
+	CustomerEmail   string                 `json:"customer_email,omitempty" db:"customer_email"`
+	CustomerAddress string                 `json:"customer_address,omitempty" db:"customer_address"`
+	Notes           string                 `json:"notes,omitempty" db:"notes"`
+	LineItems       []InvoiceLineItem      `json:"line_items" db:"line_items"`
+	Discounts       []InvoiceAdjustment    `json:"discounts" db:"discounts"`
+	TaxLines        []InvoiceAdjustment    `json:"tax_lines" db:"tax_lines"`
+	Subtotal        uint64                 `json:"subtotal" db:"subtotal"`
+	DiscountTotal   uint64                 `json:"discount_total" db:"discount_total"`
+	TaxTotal        uint64                 `json:"tax_total" db:"tax_total"`
+	Total           uint64                 `json:"total" db:"total"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Status          PaymentStatus          `json:"status" db:"-"` // status of the invoice's payment
+	ExpiresAt       time.Time              `json:"expires_at" db:"-"`
+	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+}
+
+// InvoiceRequest represents an invoice creation request. The computed total
+// is charged in AssetID; the remaining payment fields behave as they do for
+// /init-payment.
+type InvoiceRequest struct {
+	AssetID          uint64                 `json:"asset_id"`
+	CustomerName     string                 `json:"customer_name"`
+	CustomerEmail    string                 `json:"customer_email"`
+	CustomerAddress  string                 `json:"customer_address"`
+	Notes            string                 `json:"notes"`
+	LineItems        []InvoiceLineItem      `json:"line_items" binding:"required"`
+	Discounts        []InvoiceAdjustment    `json:"discounts"`
+	TaxLines         []InvoiceAdjustment    `json:"tax_lines"`
+	CallbackURL      string                 `json:"callback_url"`
+	OrderReference   string                 `json:"order_reference"`
+	Metadata         map[string]interface{} `json:"metadata"`
+	ExpiresInSeconds int                    `json:"expires_in_seconds"`
+}
+
+// InvoiceResponse is an invoice with the payment that settles it
+type InvoiceResponse struct {
+	*Invoice
+	Payment *PaymentResponse `json:"payment,omitempty"`
+}
+
+// ComputeTotals validates the line items and adjustments and fills in their
+// amounts and the invoice totals. Computed amounts are rounded half up to
+// whole base units.
+func (inv *Invoice) ComputeTotals() error {
+	if len(inv.LineItems) == 0 {
+		return errors.New("at least one line item is required")
+	}
+	if len(inv.LineItems) > MaxInvoiceLineItems {
+		return fmt.Errorf("at most %d line items are allowed", MaxInvoiceLineItems)
+	}
+	if len(inv.Discounts) > MaxInvoiceAdjustments || len(inv.TaxLines) > MaxInvoiceAdjustments {
+		return fmt.Errorf("at most %d discounts and %d tax lines are allowed", MaxInvoiceAdjustments, MaxInvoiceAdjustments)
+	}
+
+	subtotal := new(big.Int)
+	for i := range inv.LineItems {
+		item := &inv.LineItems[i]
+		if err := checkInvoiceDescription(item.Description); err != nil {
+			return fmt.Errorf("line item %d: %w", i+1, err)
+		}
+		if item.Quantity == "" {
+			item.Quantity = "1"
+		}
+		if !quantityPattern.MatchString(item.Quantity) {
+			return fmt.Errorf("line item %d: quantity must be a decimal with at most 6 decimal places", i+1)
+		}
+		quantity, _ := new(big.Rat).SetString(item.Quantity)
+		if quantity.Sign() == 0 {
+			return fmt.Errorf("line item %d: quantity must be greater than 0", i+1)
+		}
+		amount := roundHalfUp(quantity.Mul(quantity, new(big.Rat).SetInt(new(big.Int).SetUint64(item.UnitPrice))))
+		if !amount.IsUint64() {
+			return fmt.Errorf("line item %d: amount is too large", i+1)
+		}
+		item.Amount = amount.Uint64()
+		subtotal.Add(subtotal, amount)
+	}
+	if !subtotal.IsUint64() {
+		return errors.New("invoice subtotal is too large")
+	}
+
+	discounts, err := applyAdjustments("discount", inv.Discounts, subtotal)
+	if err != nil {
+		return err
+	}
+	if discounts.Cmp(subtotal) > 0 {
+		return errors.New("discounts exceed the subtotal")
+	}
+	taxable := new(big.Int).Sub(subtotal, discounts)
+	taxes, err := applyAdjustments("tax line", inv.TaxLines, taxable)
+	if err != nil {
+		return err
+	}
+
+	total := new(big.Int).Add(taxable, taxes)
+	if !total.IsUint64() {
+		return errors.New("invoice total is too large")
+	}
+	if total.Sign() == 0 {
+		return errors.New("invoice total must be greater than 0")
+	}
+
+	// Discounts are bounded by the subtotal and taxes by the total, so all fit
+	inv.Subtotal = subtotal.Uint64()
+	inv.DiscountTotal = discounts.Uint64()
+	inv.TaxTotal = taxes.Uint64()
+	inv.Total = total.Uint64()
+	return nil
+}
+
+// applyAdjustments fills in the amounts of rate-based adjustments against
+// base and returns their sum
+func applyAdjustments(kind string, adjustments []InvoiceAdjustment, base *big.Int) (*big.Int, error) {
+	sum := new(big.Int)
+	for i := range adjustments {
+		adj := &adjustments[i]
+		if err := checkInvoiceDescription(adj.Description); err != nil {
+			return nil, fmt.Errorf("%s %d: %w", kind, i+1, err)
+		}
+		if adj.Rate != "" {
+			if adj.Amount != 0 {
+				return nil, fmt.Errorf("%s %d: use either rate or amount", kind, i+1)
+			}
+			rate, err := parseRate(adj.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("%s %d: %w", kind, i+1, err)
+			}
+			amount := percentOf(rate, base.Uint64())
+			// The rate is at most 100%, so the amount fits whenever base does
+			adj.Amount = roundHalfUp(amount).Uint64()
+		} else if adj.Amount == 0 {
+			return nil, fmt.Errorf("%s %d: rate or amount is required", kind, i+1)
+		}
+		sum.Add(sum, new(big.Int).SetUint64(adj.Amount))
+	}
+	return sum, nil
+}
+
+// checkInvoiceDescription requires a non-blank description of bounded length
+func checkInvoiceDescription(description string) error {
+	if strings.TrimSpace(description) == "" {
+		return errors.New("description is required")
+	}
+	if len(description) > maxInvoiceDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxInvoiceDescriptionLength)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"algopay/models"
+)
+
+// TestComputeTotals checks discounts apply to the subtotal, taxes to the
+// subtotal after discounts, and computed amounts round half up
+func TestComputeTotals(t *testing.T) {
+	tests := []struct {
+		name      string
+		invoice   models.Invoice
+		items     []uint64 // line item amounts
+		discounts []uint64
+		taxes     []uint64
+		subtotal  uint64
+		discount  uint64
+		tax       uint64
+		total     uint64
+	}{
+		{
+			name: "quantities",
+			invoice: models.Invoice{LineItems: []models.InvoiceLineItem{
+				{Description: "Widget", UnitPrice: 1000000},
+				{Description: "Cable", Quantity: "2.5", UnitPrice: 400000},
+			}},
+			items:    []uint64{1000000, 1000000},
+			subtotal: 2000000, total: 2000000,
+		},
+		{
+			name: "fractional quantity rounds half up",
+			invoice: models.Invoice{LineItems: []models.InvoiceLineItem{
+				{Description: "Time", Quantity: "0.5", UnitPrice: 3},
+			}},
+			items:    []uint64{2},
+			subtotal: 2, total: 2,
+		},
+		{
+			name: "rate discount then tax on the discounted subtotal",
+			invoice: models.Invoice{
+				LineItems: []models.InvoiceLineItem{{Description: "Plan", UnitPrice: 1000000}},
+				Discounts: []models.InvoiceAdjustment{{Description: "Launch", Rate: "10"}},
+				TaxLines:  []models.InvoiceAdjustment{{Description: "VAT", Rate: "20"}},
+			},
+			items: []uint64{1000000}, discounts: []uint64{100000}, taxes: []uint64{180000},
+			subtotal: 1000000, discount: 100000, tax: 180000, total: 1080000,
+		},
+		{
+			name: "fixed and rate adjustments",
+			invoice: models.Invoice{
+				LineItems: []models.InvoiceLineItem{{Description: "Plan", UnitPrice: 1000}},
+				Discounts: []models.InvoiceAdjustment{{Description: "Coupon", Amount: 100}, {Description: "Loyalty", Rate: "5"}},
+				TaxLines:  []models.InvoiceAdjustment{{Description: "State", Rate: "6.25"}, {Description: "City", Rate: "2.625"}},
+			},
+			// 5% of 1000 is 50; taxes are 6.25% and 2.625% of 850, 53.125
+			// and 22.3125
+			items: []uint64{1000}, discounts: []uint64{100, 50}, taxes: []uint64{53, 22},
+			subtotal: 1000, discount: 150, tax: 75, total: 925,
+		},
+		{
+			name: "tax rounds half up",
+			invoice: models.Invoice{
+				LineItems: []models.InvoiceLineItem{{Description: "Sticker", UnitPrice: 10}},
+				TaxLines:  []models.InvoiceAdjustment{{Description: "Tax", Rate: "25"}},
+			},
+			items: []uint64{10}, taxes: []uint64{3},
+			subtotal: 10, tax: 3, total: 13,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inv := test.invoice
+			if err := inv.ComputeTotals(); err != nil {
+				t.Fatalf("ComputeTotals: %v", err)
+			}
+			if inv.Subtotal != test.subtotal || inv.DiscountTotal != test.discount || inv.TaxTotal != test.tax || inv.Total != test.total {
+				t.Fatalf("totals = %d - %d + %d = %d, want %d - %d + %d = %d",
+					inv.Subtotal, inv.DiscountTotal, inv.TaxTotal, inv.Total, test.subtotal, test.discount, test.tax, test.total)
+			}
+			for i, want := range test.items {
+				if inv.LineItems[i].Amount != want {
+					t.Errorf("line item %d amount = %d, want %d", i+1, inv.LineItems[i].Amount, want)
+				}
+			}
+			for i, want := range test.discounts {
+				if inv.Discounts[i].Amount != want {
+					t.Errorf("discount %d amount = %d, want %d", i+1, inv.Discounts[i].Amount, want)
+				}
+			}
+			for i, want := range test.taxes {
+				if inv.TaxLines[i].Amount != want {
+					t.Errorf("tax line %d amount = %d, want %d", i+1, inv.TaxLines[i].Amount, want)
+				}
+			}
+		})
+	}
+}
+
+// TestComputeTotalsRejectsBadInvoices checks invalid items, adjustments and
+// totals are refused
+func TestComputeTotalsRejectsBadInvoices(t *testing.T) {
+	item := models.InvoiceLineItem{Description: "Plan", UnitPrice: 1000}
+	tooManyItems := make([]models.InvoiceLineItem, models.MaxInvoiceLineItems+1)
+	for i := range tooManyItems {
+		tooManyItems[i] = item
+	}
+
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+		err     string
+	}{
+		{"no line items", models.Invoice{}, "at least one line item"},
+		{"too many line items", models.Invoice{LineItems: tooManyItems}, "at most"},
+		{"blank description", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: " ", UnitPrice: 1}}}, "description is required"},
+		{"long description", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: strings.Repeat("a", 201), UnitPrice: 1}}}, "at most 200 characters"},
+		{"zero quantity", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: "Plan", Quantity: "0", UnitPrice: 1}}}, "greater than 0"},
+		{"negative quantity", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: "Plan", Quantity: "-1", UnitPrice: 1}}}, "quantity must be"},
+		{"precise quantity", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: "Plan", Quantity: "1.0000001", UnitPrice: 1}}}, "quantity must be"},
+		{"item overflow", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: "Plan", Quantity: "2", UnitPrice: 1 << 63}}}, "amount is too large"},
+		{"subtotal overflow", models.Invoice{LineItems: []models.InvoiceLineItem{
+			{Description: "Plan", UnitPrice: 1 << 63}, {Description: "Plan", UnitPrice: 1 << 63},
+		}}, "subtotal is too large"},
+		{"total overflow", models.Invoice{
+			LineItems: []models.InvoiceLineItem{{Description: "Plan", UnitPrice: 1 << 63}},
+			TaxLines:  []models.InvoiceAdjustment{{Description: "Tax", Rate: "100"}},
+		}, "total is too large"},
+		{"zero total", models.Invoice{LineItems: []models.InvoiceLineItem{{Description: "Free", UnitPrice: 0}}}, "greater than 0"},
+		{"discount above the subtotal", models.Invoice{
+			LineItems: []models.InvoiceLineItem{item},
+			Discounts: []models.InvoiceAdjustment{{Description: "Coupon", Amount: 1001}},
+		}, "exceed the subtotal"},
+		{"rate and amount", models.Invoice{
+			LineItems: []models.InvoiceLineItem{item},
+			TaxLines:  []models.InvoiceAdjustment{{Description: "Tax", Rate: "5", Amount: 50}},
+		}, "either rate or amount"},
+		{"neither rate nor amount", models.Invoice{
+			LineItems: []models.InvoiceLineItem{item},
+			Discounts: []models.InvoiceAdjustment{{Description: "Coupon"}},
+		}, "rate or amount is required"},
+		{"rate above 100", models.Invoice{
+			LineItems: []models.InvoiceLineItem{item},
+			Discounts: []models.InvoiceAdjustment{{Description: "Coupon", Rate: "100.5"}},
+		}, "at most 100"},
+		{"precise rate", models.Invoice{
+			LineItems: []models.InvoiceLineItem{item},
+			TaxLines:  []models.InvoiceAdjustment{{Description: "Tax", Rate: "8.12345"}},
+		}, "at most 4 decimal places"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inv := test.invoice
+			err := inv.ComputeTotals()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("ComputeTotals = %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
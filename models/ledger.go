@@ -0,0 +1,167 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// LedgerAccount names an account in a merchant's ledger. Every account is kept
+// separately per asset. Payments is credited as funds arrive; every other
+// account is debited, so the accounts always sum to what was received.
+type LedgerAccount string
+
+const (
+	LedgerReceiving           LedgerAccount = "receiving"             // funds held at the receiving address
+	LedgerPayments            LedgerAccount = "payments"              // funds received from payers
+	LedgerRefunds             LedgerAccount = "refunds"               // funds returned to payers
+	LedgerNetworkFees         LedgerAccount = "network_fees"          // transaction fees paid by the receiving address
+	LedgerSplitPayoutsPending LedgerAccount = "split_payouts_pending" // split shares set aside for recipients
+	LedgerSplitPayouts        LedgerAccount = "split_payouts"         // split shares paid to recipients
+	LedgerPayoutsPending      LedgerAccount = "payouts_pending"       // payouts requested but not yet confirmed
+	LedgerPayouts             LedgerAccount = "payouts"               // funds paid out to the merchant
+)
+
+// JournalEntryKind identifies the event a journal entry records
+type JournalEntryKind string
+
+const (
+	EntryPaymentReceived JournalEntryKind = "payment_received"
+	EntrySplitsReserved  JournalEntryKind = "splits_reserved"
+	EntrySplitsPaid      JournalEntryKind = "splits_paid"
+	EntryRefund          JournalEntryKind = "refund"
+	EntryNetworkFee      JournalEntryKind = "network_fee"
+	EntryPayoutRequested JournalEntryKind = "payout_requested"
+	EntryPayoutPaid      JournalEntryKind = "payout_paid"
+	EntryPayoutReversed  JournalEntryKind = "payout_reversed"
+)
+
+// JournalLine debits or credits one ledger account
+type JournalLine struct {
+	Account LedgerAccount `json:"account" db:"account"`
+	Debit   uint64        `json:"debit,omitempty" db:"debit"`
+	Credit  uint64        `json:"credit,omitempty" db:"credit"`
+}
+
+// JournalEntry records one event in a merchant's ledger as balanced lines in a
+// single asset. Reference names the payment, payout or transaction the entry
+// records; an event is posted at most once per kind and reference.
+type JournalEntry struct {
+	ID          int64            `json:"id" db:"id"`
+	MerchantID  string           `json:"-" db:"merchant_id"`
+	AssetID     uint64           `json:"asset_id" db:"asset_id"`
+	Kind        JournalEntryKind `json:"kind" db:"kind"`
+	Reference   string           `json:"reference" db:"reference"`
+	Description string           `json:"description,omitempty" db:"description"`
+	Lines       []JournalLine    `json:"lines" db:"-"`
+	CreatedAt   time.Time        `json:"created_at" db:"created_at"`
+}
+
+// JournalEntryList represents one page of journal entries
+type JournalEntryList struct {
+	Entries []*JournalEntry `json:"entries"`
+	HasMore bool            `json:"has_more"`
+}
+
+// NewTransferEntry builds an entry moving amount from the credited account to
+// the debited one
+func NewTransferEntry(merchantID string, assetID uint64, kind JournalEntryKind, reference, description string, debit, credit LedgerAccount, amount uint64) *JournalEntry {
+	return &JournalEntry{
+		MerchantID:  merchantID,
+		AssetID:     assetID,
+		Kind:        kind,
+		Reference:   reference,
+		Description: description,
+		Lines: []JournalLine{
+			{Account: debit, Debit: amount},
+			{Account: credit, Credit: amount},
+		},
+		CreatedAt: time.Now(),
+	}
+}
+
+// Validate checks that the entry balances
+func (e *JournalEntry) Validate() error {
+	if e.Reference == "" {
+		return errors.New("journal entry has no reference")
+	}
+	if len(e.Lines) < 2 {
+		return errors.New("journal entry needs at least two lines")
+	}
+	var debits, credits uint64
+	for _, line := range e.Lines {
+		if (line.Debit == 0) == (line.Credit == 0) {
+			return errors.New("journal line must either debit or credit")
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	if debits != credits {
+		return errors.New("journal entry does not balance")
+	}
+	return nil
+}
+
+// AccountBalance sums the lines posted to one ledger account in one asset
+type AccountBalance struct {
+	Account LedgerAccount `json:"account"`
+	AssetID uint64        `json:"asset_id"`
+	Debits  uint64        `json:"debits"`
+	Credits uint64        `json:"credits"`
+}
+
+// Balance returns the account's balance on its normal side: credits less
+// debits for payments, debits less credits for every other account
+func (b AccountBalance) Balance() int64 {
+	if b.Account == LedgerPayments {
+		return int64(b.Credits) - int64(b.Debits)
+	}
+	return int64(b.Debits) - int64(b.Credits)
+}
+
+// Balance summarizes a merchant's ledger in one asset. Available is what may
+// be paid out; it goes negative when network fees exceed ALGO received.
+type Balance struct {
+	AssetID             uint64 `json:"asset_id"`
+	Available           int64  `json:"available"`
+	PendingPayouts      int64  `json:"pending_payouts"`
+	PendingSplitPayouts int64  `json:"pending_split_payouts"`
+	Received            int64  `json:"received"`
+	Refunded            int64  `json:"refunded"`
+	NetworkFees         int64  `json:"network_fees"`
+	SplitPayouts        int64  `json:"split_payouts"`
+	PaidOut             int64  `json:"paid_out"`
+}
+
+// BalancesFrom summarizes account balances per asset, in asset order
+func BalancesFrom(accounts []AccountBalance) []Balance {
+	balances := []Balance{}
+	index := map[uint64]int{}
+	for _, account := range accounts {
+		i, ok := index[account.AssetID]
+		if !ok {
+			i = len(balances)
+			index[account.AssetID] = i
+			balances = append(balances, Balance{AssetID: account.AssetID})
+		}
+		balance := &balances[i]
+		switch account.Account {
+		case LedgerReceiving:
+			balance.Available = account.Balance()
+		case LedgerPayoutsPending:
+			balance.PendingPayouts = account.Balance()
+		case LedgerSplitPayoutsPending:
+			balance.PendingSplitPayouts = account.Balance()
+		case LedgerPayments:
+			balance.Received = account.Balance()
+		case LedgerRefunds:
+			balance.Refunded = account.Balance()
+		case LedgerNetworkFees:
+			balance.NetworkFees = account.Balance()
+		case LedgerSplitPayouts:
+			balance.SplitPayouts = account.Balance()
+		case LedgerPayouts:
+			balance.PaidOut = account.Balance()
+		}
+	}
+	return balances
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Branding holds merchant presentation settings for hosted pages
+type Branding struct {
+	LogoURL      string `json:"logo_url,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	SupportEmail string `json:"support_email,omitempty"`
+}
+
+// AssetLimit bounds the payments a merchant accepts in one asset; amounts are
+// in base units and zero means unlimited
+type AssetLimit struct {
+	AssetID        uint64 `json:"asset_id"`
+	MinAmount      uint64 `json:"min_amount,omitempty"`
+	MaxAmount      uint64 `json:"max_amount,omitempty"`
+	DailyVolumeCap uint64 `json:"daily_volume_cap,omitempty"`
+}
+
+// Merchant represents a merchant account that receives payments
+type Merchant struct {
+	ID                string       `json:"id" db:"id"`
+	DisplayName       string       `json:"display_name" db:"display_name"`
+	ReceivingAddress  string       `json:"receiving_address" db:"receiving_address"`
+	PayoutAddress     string       `json:"payout_address,omitempty" db:"payout_address"`
+	AcceptedAssets    []uint64     `json:"accepted_assets" db:"accepted_assets"`
+	AssetLimits       []AssetLimit `json:"asset_limits" db:"asset_limits"`
+	DefaultTimeout    int          `json:"default_timeout" db:"default_timeout"`       // in minutes, 0 uses the server default
+	MinExpirySeconds  int          `json:"min_expiry_seconds" db:"min_expiry_seconds"` // 0 uses the server default
+	MaxExpirySeconds  int          `json:"max_expiry_seconds" db:"max_expiry_seconds"` // 0 uses the server default
+	WebhookURL        string       `json:"webhook_url,omitempty" db:"webhook_url"`
+	WebhookSecret     string       `json:"-" db:"webhook_secret"` // only returned when created or rotated
+	LatePaymentAction string       `json:"late_payment_action" db:"late_payment_action"`
+	Branding          Branding     `json:"branding" db:"branding"`
+	CreatedAt         time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// AcceptsAsset reports whether the merchant accepts payments in the given asset;
+// an empty list accepts every asset
+func (m *Merchant) AcceptsAsset(assetID uint64) bool {
+	return len(m.AcceptedAssets) == 0 || slices.Contains(m.AcceptedAssets, assetID)
+}
+
+// LimitFor returns the merchant's limits for an asset, or nil if it has none
+func (m *Merchant) LimitFor(assetID uint64) *AssetLimit {
+	for i := range m.AssetLimits {
+		if m.AssetLimits[i].AssetID == assetID {
+			return &m.AssetLimits[i]
+		}
+	}
+	return nil
+}
+
+// MerchantRequest represents a merchant creation or update request
+type MerchantRequest struct {
+	DisplayName       string       `json:"display_name" binding:"required"`
+	ReceivingAddress  string       `json:"receiving_address" binding:"required"`
+	PayoutAddress     string       `json:"payout_address"`
+	AcceptedAssets    []uint64     `json:"accepted_assets"`
+	AssetLimits       []AssetLimit `json:"asset_limits"`
+	DefaultTimeout    int          `json:"default_timeout"`
+	MinExpirySeconds  int          `json:"min_expiry_seconds"`
+	MaxExpirySeconds  int          `json:"max_expiry_seconds"`
+	WebhookURL        string       `json:"webhook_url"`
+	LatePaymentAction string       `json:"late_payment_action"`
+	Branding          Branding     `json:"branding"`
+}
+
+// MerchantSecretResponse represents a merchant creation or webhook secret
+// rotation response; the webhook secret is only returned then
+type MerchantSecretResponse struct {
+	*Merchant
+	WebhookSecret string `json:"webhook_secret"`
+}
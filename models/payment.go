@@ -12,39 +12,168 @@ const (
 	PaymentStatusCompleted PaymentStatus = "completed"
 	PaymentStatusFailed    PaymentStatus = "failed"
 	PaymentStatusExpired   PaymentStatus = "expired"
+	PaymentStatusCancelled PaymentStatus = "cancelled"
+	PaymentStatusRefunding PaymentStatus = "refunding"
+	PaymentStatusRefunded  PaymentStatus = "refunded"
+	// PaymentStatusLatePayment marks funds that arrived after the invoice was
+	// expired or cancelled; the merchant accepts or refunds them
+	PaymentStatusLatePayment PaymentStatus = "late_payment"
 )
 
+// Merchant actions for late payments
+const (
+	LatePaymentActionManual = "manual"
+	LatePaymentActionAccept = "accept"
+	LatePaymentActionRefund = "refund"
+)
+
+// Webhook event types
+const (
+	EventPaymentCompleted   = "payment.completed"
+	EventPaymentCancelled   = "payment.cancelled"
+	EventPaymentLatePayment = "payment.late_payment"
+	EventPaymentRefunded    = "payment.refunded"
+	EventPaymentExtended    = "payment.extended"
+
+	// EventPaymentStatus opens a payment event stream with the current state;
+	// it is never sent as a webhook
+	EventPaymentStatus = "payment.status"
+)
+
+// MaxPaymentOptions bounds the number of assets a single payment accepts
+const MaxPaymentOptions = 10
+
+// PaymentOption is one asset and amount that settles a payment. In requests,
+// DisplayAmount may be given in whole asset units instead of Amount.
+type PaymentOption struct {
+	AssetID       uint64 `json:"asset_id"`
+	Amount        uint64 `json:"amount"`
+	DisplayAmount string `json:"display_amount,omitempty"`
+	UnitName      string `json:"unit_name,omitempty"`
+	Decimals      uint64 `json:"decimals"`
+	ExchangeRate  string `json:"exchange_rate,omitempty"` // fiat per whole asset unit for fiat-priced payments
+}
+
 // Payment represents a payment request
 type Payment struct {
-	ID              string        `json:"id" db:"id"`
-	MerchantAddress string        `json:"merchant_address" db:"merchant_address"`
-	Amount          uint64        `json:"amount" db:"amount"`
-	AssetID         uint64        `json:"asset_id" db:"asset_id"`
-	CallbackURL     string        `json:"callback_url" db:"callback_url"`
-	Status          PaymentStatus `json:"status" db:"status"`
-	TxnID           string        `json:"txn_id,omitempty" db:"txn_id"`
-	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time     `json:"updated_at" db:"updated_at"`
-	ExpiresAt       time.Time     `json:"expires_at" db:"expires_at"`
+	ID              string                 `json:"id" db:"id"`
+	MerchantID      string                 `json:"merchant_id" db:"merchant_id"`
+	MerchantAddress string                 `json:"merchant_address" db:"merchant_address"`
+	SubscriptionID  string                 `json:"subscription_id,omitempty" db:"subscription_id"` // set on subscription invoices
+	PaymentLinkID   string                 `json:"payment_link_id,omitempty" db:"payment_link_id"` // set on payments created from a link
+	InvoiceID       string                 `json:"invoice_id,omitempty" db:"invoice_id"`           // set on payments that settle an invoice
+	Splits          *SplitRules            `json:"splits,omitempty" db:"split_rules"`
+	Amount          uint64                 `json:"amount" db:"amount"`
+	AssetID         uint64                 `json:"asset_id" db:"asset_id"`
+	DisplayAmount   string                 `json:"display_amount,omitempty" db:"-"` // from the primary option
+	UnitName        string                 `json:"unit_name,omitempty" db:"-"`
+	PaymentOptions  []PaymentOption        `json:"payment_options" db:"payment_options"`
+	CallbackURL     string                 `json:"callback_url" db:"callback_url"`
+	OrderReference  string                 `json:"order_reference,omitempty" db:"order_reference"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Status          PaymentStatus          `json:"status" db:"status"`
+	Version         int64                  `json:"version" db:"version"` // incremented by every update
+	TxnID           string                 `json:"txn_id,omitempty" db:"txn_id"`
+	SettledAssetID  *uint64                `json:"settled_asset_id,omitempty" db:"settled_asset_id"`
+	PayerAddress    string                 `json:"payer_address,omitempty" db:"payer_address"`
+	ReceivedAmount  uint64                 `json:"received_amount,omitempty" db:"received_amount"`
+	Late            bool                   `json:"late" db:"late"`
+	RefundTxnID     string                 `json:"refund_txn_id,omitempty" db:"refund_txn_id"`
+	RefundFee       uint64                 `json:"-" db:"refund_fee"`        // network fee of the refund in microAlgos
+	RefundLastValid uint64                 `json:"-" db:"refund_last_valid"` // last round the refund can be confirmed in
+	FiatAmount      string                 `json:"fiat_amount,omitempty" db:"fiat_amount"`
+	FiatCurrency    string                 `json:"fiat_currency,omitempty" db:"fiat_currency"`
+	ExchangeRate    string                 `json:"exchange_rate,omitempty" db:"exchange_rate"` // fiat per whole asset unit
+	RateSource      string                 `json:"rate_source,omitempty" db:"rate_source"`
+	RateTimestamp   *time.Time             `json:"rate_timestamp,omitempty" db:"rate_timestamp"`
+	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at" db:"updated_at"`
+	ExpiresAt       time.Time              `json:"expires_at" db:"expires_at"`
+}
+
+// Options returns the assets that settle the payment; payments created
+// before multi-asset support have only their primary asset
+func (p *Payment) Options() []PaymentOption {
+	if len(p.PaymentOptions) == 0 {
+		return []PaymentOption{{AssetID: p.AssetID, Amount: p.Amount, ExchangeRate: p.ExchangeRate}}
+	}
+	return p.PaymentOptions
+}
+
+// PaidAssetID returns the asset that settled the payment, or its primary
+// asset if it has not been settled
+func (p *Payment) PaidAssetID() uint64 {
+	if p.SettledAssetID != nil {
+		return *p.SettledAssetID
+	}
+	return p.AssetID
 }
 
 // PaymentRequest represents a payment initialization request
+// The merchant and its receiving address are taken from the API key. Either
+// Amount in asset base units or FiatAmount and FiatCurrency must be set.
+// PaymentOptions replaces AssetID and Amount to accept several assets; with a
+// fiat amount, option amounts are omitted and priced from it.
 type PaymentRequest struct {
-	MerchantAddress string `json:"merchant_address" binding:"required"`
-	Amount          uint64 `json:"amount" binding:"required"`
-	AssetID         uint64 `json:"asset_id"`
-	CallbackURL     string `json:"callback_url"`
+	Amount         uint64                 `json:"amount"`
+	DisplayAmount  string                 `json:"display_amount"`
+	FiatAmount     string                 `json:"fiat_amount"`
+	FiatCurrency   string                 `json:"fiat_currency"`
+	AssetID        uint64                 `json:"asset_id"`
+	PaymentOptions []PaymentOption        `json:"payment_options"`
+	CallbackURL    string                 `json:"callback_url"`
+	OrderReference string                 `json:"order_reference"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	// ExpiresInSeconds overrides the merchant's default timeout within its expiry bounds
+	ExpiresInSeconds int `json:"expires_in_seconds"`
+	// Splits forwards shares of the payment to other accounts once it completes
+	Splits *SplitRules `json:"splits"`
+
+	// Set by the gateway for payments created by a subscription, payment link or invoice
+	SubscriptionID string `json:"-"`
+	PaymentLinkID  string `json:"-"`
+	InvoiceID      string `json:"-"`
+	// LinkMaxPayments is the payment link's max_payments
+	LinkMaxPayments int `json:"-"`
+}
+
+// PaymentCaps are limits CreatePayment checks with the new payment counted,
+// while the merchant is locked, so concurrent creations cannot exceed them
+// together. Zero values are not checked.
+type PaymentCaps struct {
+	LinkMaxPayments int // pending and completed payments of the payment's link
+	// DailyVolume caps the merchant's volume per asset since DayStart, as
+	// summed by DailyVolume
+	DailyVolume map[uint64]uint64
+	DayStart    time.Time
+}
+
+// ExtendRequest represents a request to push back a pending payment's expiry;
+// the new expiry is ExpiresInSeconds from now
+type ExtendRequest struct {
+	ExpiresInSeconds int `json:"expires_in_seconds" binding:"required"`
 }
 
 // PaymentResponse represents a payment initialization response
 type PaymentResponse struct {
-	PaymentID       string `json:"payment_id"`
-	MerchantAddress string `json:"merchant_address"`
-	Amount          uint64 `json:"amount"`
-	AssetID         uint64 `json:"asset_id"`
-	QRCode          string `json:"qr_code,omitempty"`
-	ExpiresAt       string `json:"expires_at"`
-	Status          string `json:"status"`
+	PaymentID       string                 `json:"payment_id"`
+	MerchantAddress string                 `json:"merchant_address"`
+	Amount          uint64                 `json:"amount"`
+	AssetID         uint64                 `json:"asset_id"`
+	DisplayAmount   string                 `json:"display_amount,omitempty"`
+	UnitName        string                 `json:"unit_name,omitempty"`
+	PaymentOptions  []PaymentOption        `json:"payment_options"`
+	FiatAmount      string                 `json:"fiat_amount,omitempty"`
+	FiatCurrency    string                 `json:"fiat_currency,omitempty"`
+	ExchangeRate    string                 `json:"exchange_rate,omitempty"`
+	RateSource      string                 `json:"rate_source,omitempty"`
+	RateTimestamp   *time.Time             `json:"rate_timestamp,omitempty"`
+	OrderReference  string                 `json:"order_reference,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	Splits          *SplitRules            `json:"splits,omitempty"`
+	QRCode          string                 `json:"qr_code,omitempty"`
+	ExpiresAt       string                 `json:"expires_at"`
+	Status          string                 `json:"status"`
 }
 
 // PaymentStatusResponse represents a payment status check response
@@ -58,11 +187,34 @@ type PaymentStatusResponse struct {
 
 // WebhookPayload represents the payload sent to callback URLs
 type WebhookPayload struct {
-	PaymentID       string        `json:"payment_id"`
-	Status          PaymentStatus `json:"status"`
-	MerchantAddress string        `json:"merchant_address"`
-	Amount          uint64        `json:"amount"`
-	AssetID         uint64        `json:"asset_id"`
-	TxnID           string        `json:"txn_id"`
-	Timestamp       time.Time     `json:"timestamp"`
-}
\ No newline at end of file
+	Event           string                 `json:"event"`
+	PaymentID       string                 `json:"payment_id"`
+	Status          PaymentStatus          `json:"status"`
+	MerchantAddress string                 `json:"merchant_address"`
+	SubscriptionID  string                 `json:"subscription_id,omitempty"`
+	PaymentLinkID   string                 `json:"payment_link_id,omitempty"`
+	InvoiceID       string                 `json:"invoice_id,omitempty"`
+	Amount          uint64                 `json:"amount"`
+	AssetID         uint64                 `json:"asset_id"`
+	DisplayAmount   string                 `json:"display_amount,omitempty"`
+	UnitName        string                 `json:"unit_name,omitempty"`
+	PaymentOptions  []PaymentOption        `json:"payment_options"`
+	TxnID           string                 `json:"txn_id"`
+	SettledAssetID  *uint64                `json:"settled_asset_id,omitempty"`
+	Late            bool                   `json:"late"`
+	RefundTxnID     string                 `json:"refund_txn_id,omitempty"`
+	FiatAmount      string                 `json:"fiat_amount,omitempty"`
+	FiatCurrency    string                 `json:"fiat_currency,omitempty"`
+	ExchangeRate    string                 `json:"exchange_rate,omitempty"`
+	OrderReference  string                 `json:"order_reference,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	Splits          *SplitReport           `json:"splits,omitempty"`
+	ExpiresAt       time.Time              `json:"expires_at"`
+	Timestamp       time.Time              `json:"timestamp"`
+}
+
+// RefundRequest represents a late payment refund request; TxnID records a
+// refund already made outside the gateway
+type RefundRequest struct {
+	TxnID string `json:"txn_id"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+)
+
+// Payment link amount types
+const (
+	PaymentLinkAmountFixed  = "fixed"
+	PaymentLinkAmountCustom = "custom" // chosen by the customer within optional bounds
+)
+
+// PaymentLink is a reusable link that creates a fresh payment each time it is
+// used. Fixed links always charge Amount; custom links take the amount from
+// the customer, bounded by MinAmount and MaxAmount when they are set.
+type PaymentLink struct {
+	ID               string                 `json:"id" db:"id"`
+	MerchantID       string                 `json:"merchant_id" db:"merchant_id"`
+	Slug             string                 `json:"slug" db:"slug"`
+	Title            string                 `json:"title" db:"title"`
+	Description      string                 `json:"description,omitempty" db:"description"`
+	AmountType       string                 `json:"amount_type" db:"amount_type"`
+	Amount           uint64                 `json:"amount,omitempty" db:"amount"`
+	MinAmount        uint64                 `json:"min_amount,omitempty" db:"min_amount"`
+	MaxAmount        uint64                 `json:"max_amount,omitempty" db:"max_amount"`
+	AssetID          uint64                 `json:"asset_id" db:"asset_id"`
+	MaxPayments      int                    `json:"max_payments" db:"max_payments"` // pending and completed payments allowed, 0 for unlimited
+	Active           bool                   `json:"active" db:"active"`
+	ActiveFrom       *time.Time             `json:"active_from,omitempty" db:"active_from"`
+	ActiveUntil      *time.Time             `json:"active_until,omitempty" db:"active_until"`
+	ExpiresInSeconds int                    `json:"expires_in_seconds,omitempty" db:"expires_in_seconds"` // 0 uses the merchant's default timeout
+	CallbackURL      string                 `json:"callback_url,omitempty" db:"callback_url"`
+	OrderReference   string                 `json:"order_reference,omitempty" db:"order_reference"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Stats            *PaymentLinkStats      `json:"stats,omitempty" db:"-"`
+	CreatedAt        time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// PublicPaymentLink is what the public link URL shows of a link: what the
+// customer pays, without the merchant's settings
+type PublicPaymentLink struct {
+	Slug        string `json:"slug"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	AmountType  string `json:"amount_type"`
+	Amount      uint64 `json:"amount,omitempty"`
+	MinAmount   uint64 `json:"min_amount,omitempty"`
+	MaxAmount   uint64 `json:"max_amount,omitempty"`
+	AssetID     uint64 `json:"asset_id"`
+}
+
+// Public returns the customer-facing view of the link
+func (l *PaymentLink) Public() *PublicPaymentLink {
+	return &PublicPaymentLink{
+		Slug:        l.Slug,
+		Title:       l.Title,
+		Description: l.Description,
+		AmountType:  l.AmountType,
+		Amount:      l.Amount,
+		MinAmount:   l.MinAmount,
+		MaxAmount:   l.MaxAmount,
+		AssetID:     l.AssetID,
+	}
+}
+
+// PaymentLinkStats counts the payments a link has produced
+type PaymentLinkStats struct {
+	Payments        int    `json:"payments"`
+	Pending         int    `json:"pending"`
+	Completed       int    `json:"completed"`
+	AmountCollected uint64 `json:"amount_collected"` // base units received by completed payments
+}
+
+// PaymentLinkRequest represents a payment link creation or update request.
+// An empty Slug generates one; Active defaults to true.
+type PaymentLinkRequest struct {
+	Slug             string                 `json:"slug"`
+	Title            string                 `json:"title" binding:"required"`
+	Description      string                 `json:"description"`
+	AmountType       string                 `json:"amount_type" binding:"required"`
+	Amount           uint64                 `json:"amount"`
+	MinAmount        uint64                 `json:"min_amount"`
+	MaxAmount        uint64                 `json:"max_amount"`
+	AssetID          uint64                 `json:"asset_id"`
+	MaxPayments      int                    `json:"max_payments"`
+	Active           *bool                  `json:"active"`
+	ActiveFrom       *time.Time             `json:"active_from"`
+	ActiveUntil      *time.Time             `json:"active_until"`
+	ExpiresInSeconds int                    `json:"expires_in_seconds"`
+	CallbackURL      string                 `json:"callback_url"`
+	OrderReference   string                 `json:"order_reference"`
+	Metadata         map[string]interface{} `json:"metadata"`
+}
+
+// LinkPaymentRequest carries the customer's amount when paying a custom
+// amount link, in base units or as a display amount in whole units
+type LinkPaymentRequest struct {
+	Amount        uint64 `json:"amount" form:"amount"`
+	DisplayAmount string `json:"display_amount" form:"display_amount"`
+}
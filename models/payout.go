@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// PayoutStatus represents the status of a merchant payout
+type PayoutStatus string
+
+const (
+	PayoutPending   PayoutStatus = "pending"   // waiting to be submitted
+	PayoutSubmitted PayoutStatus = "submitted" // sent, waiting for confirmation
+	PayoutConfirmed PayoutStatus = "confirmed"
+	PayoutFailed    PayoutStatus = "failed" // gave up; the funds are available again
+)
+
+// Payout webhook event types
+const (
+	EventPayoutPaid   = "payout.paid"
+	EventPayoutFailed = "payout.failed"
+)
+
+// Payout transfers part of a merchant's available balance from the receiving
+// address to the merchant's payout address
+type Payout struct {
+	ID          string       `json:"id" db:"id"`
+	MerchantID  string       `json:"-" db:"merchant_id"`
+	AssetID     uint64       `json:"asset_id" db:"asset_id"`
+	Amount      uint64       `json:"amount" db:"amount"`
+	Source      string       `json:"source" db:"source"`
+	Destination string       `json:"destination" db:"destination"`
+	Status      PayoutStatus `json:"status" db:"status"`
+	TxnID       string       `json:"txn_id,omitempty" db:"txn_id"`
+	Fee         uint64       `json:"fee,omitempty" db:"fee"` // network fee in microAlgos
+	LastValid   uint64       `json:"-" db:"last_valid"`
+	Attempts    int          `json:"attempts" db:"attempts"`
+	Error       string       `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// PayoutRequest represents a payout request; a zero amount sweeps the whole
+// available balance of the asset
+type PayoutRequest struct {
+	AssetID uint64 `json:"asset_id"`
+	Amount  uint64 `json:"amount"`
+}
+
+// PayoutWebhookPayload represents the payload of payout events
+type PayoutWebhookPayload struct {
+	Event       string       `json:"event"`
+	PayoutID    string       `json:"payout_id"`
+	Status      PayoutStatus `json:"status"`
+	AssetID     uint64       `json:"asset_id"`
+	Amount      uint64       `json:"amount"`
+	Destination string       `json:"destination"`
+	TxnID       string       `json:"txn_id,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Timestamp   time.Time    `json:"timestamp"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// DiscrepancyKind identifies a mismatch between stored payments and the chain
+type DiscrepancyKind string
+
+const (
+	DiscrepancyUnmatchedTransfer    DiscrepancyKind = "unmatched_transfer"    // funds arrived that no payment claims
+	DiscrepancyMissingTransaction   DiscrepancyKind = "missing_transaction"   // a payment's transaction is not on chain
+	DiscrepancyAmountMismatch       DiscrepancyKind = "amount_mismatch"       // the transaction moved a different amount
+	DiscrepancyAssetMismatch        DiscrepancyKind = "asset_mismatch"        // the transaction moved a different asset
+	DiscrepancyReceiverMismatch     DiscrepancyKind = "receiver_mismatch"     // the transaction paid another address
+	DiscrepancyDuplicateTransaction DiscrepancyKind = "duplicate_transaction" // several payments claim one transaction
+)
+
+// Discrepancy describes one mismatch found by reconciliation. Expected and
+// Actual are amounts for amount mismatches, asset IDs for asset mismatches
+// and addresses for receiver mismatches.
+type Discrepancy struct {
+	Kind       DiscrepancyKind `json:"kind"`
+	MerchantID string          `json:"merchant_id,omitempty"`
+	PaymentIDs []string        `json:"payment_ids,omitempty"`
+	TxnID      string          `json:"txn_id"`
+	Address    string          `json:"address,omitempty"`
+	AssetID    uint64          `json:"asset_id"`
+	Amount     uint64          `json:"amount,omitempty"`
+	Round      uint64          `json:"round,omitempty"`
+	Expected   string          `json:"expected,omitempty"`
+	Actual     string          `json:"actual,omitempty"`
+}
+
+// ReconciliationWindow selects what a reconciliation run covers: inbound
+// transfers in a round range or time window, and the payments active in it.
+// An empty MerchantID covers every merchant.
+type ReconciliationWindow struct {
+	MerchantID string     `json:"merchant_id,omitempty"`
+	MinRound   uint64     `json:"min_round,omitempty"`
+	MaxRound   uint64     `json:"max_round,omitempty"`
+	After      *time.Time `json:"after,omitempty"`
+	Before     *time.Time `json:"before,omitempty"`
+}
+
+// ReconciliationReport is the outcome of one reconciliation run
+type ReconciliationReport struct {
+	ID               string               `json:"id" db:"id"`
+	Window           ReconciliationWindow `json:"window" db:"scope"`
+	Addresses        int                  `json:"addresses" db:"addresses"`
+	TransfersChecked int                  `json:"transfers_checked" db:"transfers_checked"`
+	PaymentsChecked  int                  `json:"payments_checked" db:"payments_checked"`
+	Matched          int                  `json:"matched" db:"matched"`
+	Discrepancies    []Discrepancy        `json:"discrepancies" db:"discrepancies"`
+	StartedAt        time.Time            `json:"started_at" db:"started_at"`
+	FinishedAt       time.Time            `json:"finished_at" db:"finished_at"`
+}
+
+// Validate checks that the window is bounded and its bounds are ordered
+func (w *ReconciliationWindow) Validate() error {
+	if w.MinRound == 0 && w.MaxRound == 0 && w.After == nil && w.Before == nil {
+		return errors.New("a round range or time window is required")
+	}
+	if w.MinRound != 0 && w.MaxRound != 0 && w.MinRound > w.MaxRound {
+		return errors.New("min_round must not exceed max_round")
+	}
+	if w.After != nil && w.Before != nil && !w.After.Before(*w.Before) {
+		return errors.New("after must be earlier than before")
+	}
+	return nil
+}
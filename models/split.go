@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// MaxSplitRecipients bounds split recipients so every payout fits in one
+// atomic transaction group
+const MaxSplitRecipients = 16
+
+// SplitPayoutStatus represents the status of a payout leg
+type SplitPayoutStatus string
+
+const (
+	SplitPayoutPending   SplitPayoutStatus = "pending"   // waiting to be submitted
+	SplitPayoutSubmitted SplitPayoutStatus = "submitted" // sent, waiting for confirmation
+	SplitPayoutConfirmed SplitPayoutStatus = "confirmed"
+	SplitPayoutFailed    SplitPayoutStatus = "failed" // gave up after repeated failures
+)
+
+// Split webhook event types
+const (
+	EventPaymentSplitsPaid   = "payment.splits_paid"
+	EventPaymentSplitsFailed = "payment.splits_failed"
+)
+
+// SplitRecipient receives a share of a completed payment, given either as a
+// percentage Rate of the amount left after the platform fee or as a fixed
+// Amount in base units
+type SplitRecipient struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+	Rate    string `json:"rate,omitempty"` // percent, e.g. "92.5"
+	Amount  uint64 `json:"amount,omitempty"`
+}
+
+// SplitRules forward shares of a payment to other accounts once it
+// completes. The platform fee, as a percentage FeeRate or fixed FeeAmount, is
+// taken off the payment first; whatever the recipients do not receive stays
+// with the merchant.
+type SplitRules struct {
+	Recipients []SplitRecipient `json:"recipients"`
+	FeeRate    string           `json:"fee_rate,omitempty"`
+	FeeAmount  uint64           `json:"fee_amount,omitempty"`
+}
+
+// SplitPayout is one recipient's payout of a completed payment. Payouts of a
+// payment are submitted together as an atomic group.
+type SplitPayout struct {
+	ID         string            `json:"id" db:"id"`
+	PaymentID  string            `json:"payment_id" db:"payment_id"`
+	MerchantID string            `json:"-" db:"merchant_id"`
+	Position   int               `json:"position" db:"position"` // index in the split rules
+	Address    string            `json:"address" db:"address"`
+	Label      string            `json:"label,omitempty" db:"label"`
+	AssetID    uint64            `json:"asset_id" db:"asset_id"`
+	Amount     uint64            `json:"amount" db:"amount"`
+	Status     SplitPayoutStatus `json:"status" db:"status"`
+	TxnID      string            `json:"txn_id,omitempty" db:"txn_id"`
+	GroupID    string            `json:"group_id,omitempty" db:"group_id"`
+	Fee        uint64            `json:"fee,omitempty" db:"fee"` // network fee in microAlgos
+	LastValid  uint64            `json:"-" db:"last_valid"`
+	Attempts   int               `json:"attempts" db:"attempts"`
+	Error      string            `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// SplitReport describes how a completed payment was split, for webhooks
+type SplitReport struct {
+	Fee     uint64        `json:"fee"`
+	Payouts []SplitPayout `json:"payouts"`
+}
+
+// Validate checks the rules' shape; amounts are checked by Allocate
+func (r *SplitRules) Validate() error {
+	if len(r.Recipients) == 0 {
+		return errors.New("splits require at least one recipient")
+	}
+	if len(r.Recipients) > MaxSplitRecipients {
+		return fmt.Errorf("splits allow at most %d recipients", MaxSplitRecipients)
+	}
+	if r.FeeRate != "" && r.FeeAmount != 0 {
+		return errors.New("use either fee_rate or fee_amount")
+	}
+	if r.FeeRate != "" {
+		if _, err := parseRate(r.FeeRate); err != nil {
+			return fmt.Errorf("fee_rate: %w", err)
+		}
+	}
+
+	totalRate := new(big.Rat)
+	for i, recipient := range r.Recipients {
+		if len(recipient.Label) > 100 {
+			return fmt.Errorf("split recipient %d: label must be at most 100 characters", i+1)
+		}
+		if (recipient.Rate == "") == (recipient.Amount == 0) {
+			return fmt.Errorf("split recipient %d: use either rate or amount", i+1)
+		}
+		if recipient.Rate != "" {
+			rate, err := parseRate(recipient.Rate)
+			if err != nil {
+				return fmt.Errorf("split recipient %d: %w", i+1, err)
+			}
+			totalRate.Add(totalRate, rate)
+		}
+	}
+	if totalRate.Cmp(big.NewRat(100, 1)) > 0 {
+		return errors.New("split rates add up to more than 100%")
+	}
+	return nil
+}
+
+// HasFixedAmounts reports whether any part of the rules is in base units,
+// which ties the rules to a single asset
+func (r *SplitRules) HasFixedAmounts() bool {
+	if r.FeeAmount != 0 {
+		return true
+	}
+	for _, recipient := range r.Recipients {
+		if recipient.Amount != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Allocate splits total base units into the platform fee and each recipient's
+// share. Rate-based fees round half up and rate-based shares round down, so
+// the shares never exceed what is left after the fee.
+func (r *SplitRules) Allocate(total uint64) (fee uint64, shares []uint64, err error) {
+	fee = r.FeeAmount
+	if r.FeeRate != "" {
+		rate, _ := parseRate(r.FeeRate)
+		fee = roundHalfUp(percentOf(rate, total)).Uint64()
+	}
+	if fee > total {
+		return 0, nil, errors.New("split fee exceeds the payment amount")
+	}
+
+	remaining := total - fee
+	shares = make([]uint64, len(r.Recipients))
+	var sum uint64
+	for i, recipient := range r.Recipients {
+		share := recipient.Amount
+		if recipient.Rate != "" {
+			rate, _ := parseRate(recipient.Rate)
+			portion := percentOf(rate, remaining)
+			share = new(big.Int).Quo(portion.Num(), portion.Denom()).Uint64()
+		}
+		if share > remaining-sum {
+			return 0, nil, errors.New("split shares exceed the payment amount after fees")
+		}
+		shares[i] = share
+		sum += share
+	}
+	return fee, shares, nil
+}
@@ -0,0 +1,135 @@
+package models_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"algopay/models"
+)
+
+// TestAllocate checks rate fees round half up, rate shares round down and the
+// remainder stays with the merchant
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  models.SplitRules
+		total  uint64
+		fee    uint64
+		shares []uint64
+	}{
+		{
+			name:   "rates without a fee",
+			rules:  models.SplitRules{Recipients: []models.SplitRecipient{{Rate: "90"}, {Rate: "10"}}},
+			total:  1000000,
+			shares: []uint64{900000, 100000},
+		},
+		{
+			name:   "thirds round down",
+			rules:  models.SplitRules{Recipients: []models.SplitRecipient{{Rate: "33.3333"}, {Rate: "33.3333"}, {Rate: "33.3333"}}},
+			total:  100,
+			shares: []uint64{33, 33, 33},
+		},
+		{
+			name:   "fee rate rounds half up",
+			rules:  models.SplitRules{FeeRate: "2.5", Recipients: []models.SplitRecipient{{Rate: "100"}}},
+			total:  100, // 2.5 rounds to 3
+			fee:    3,
+			shares: []uint64{97},
+		},
+		{
+			name:   "fee rate rounds down below a half",
+			rules:  models.SplitRules{FeeRate: "2.4", Recipients: []models.SplitRecipient{{Rate: "50"}}},
+			total:  100,
+			fee:    2,
+			shares: []uint64{49},
+		},
+		{
+			name:   "shares apply after the fee",
+			rules:  models.SplitRules{FeeAmount: 1000, Recipients: []models.SplitRecipient{{Rate: "50"}, {Amount: 2000}}},
+			total:  11000,
+			fee:    1000,
+			shares: []uint64{5000, 2000},
+		},
+		{
+			name:   "odd remainder after a half share",
+			rules:  models.SplitRules{Recipients: []models.SplitRecipient{{Rate: "50"}}},
+			total:  101,
+			shares: []uint64{50},
+		},
+		{
+			name:   "fixed amounts use the whole payment",
+			rules:  models.SplitRules{FeeAmount: 10, Recipients: []models.SplitRecipient{{Amount: 90}}},
+			total:  100,
+			fee:    10,
+			shares: []uint64{90},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.rules.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			fee, shares, err := test.rules.Allocate(test.total)
+			if err != nil {
+				t.Fatalf("Allocate: %v", err)
+			}
+			if fee != test.fee || !slices.Equal(shares, test.shares) {
+				t.Fatalf("Allocate(%d) = %d, %v, want %d, %v", test.total, fee, shares, test.fee, test.shares)
+			}
+		})
+	}
+}
+
+// TestAllocateRejectsOverdrafts checks fixed fees and shares cannot exceed
+// the payment
+func TestAllocateRejectsOverdrafts(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules models.SplitRules
+		total uint64
+	}{
+		{"fee above the payment", models.SplitRules{FeeAmount: 101, Recipients: []models.SplitRecipient{{Rate: "10"}}}, 100},
+		{"amounts above the payment", models.SplitRules{Recipients: []models.SplitRecipient{{Amount: 60}, {Amount: 50}}}, 100},
+		{"amounts above what the fee leaves", models.SplitRules{FeeRate: "10", Recipients: []models.SplitRecipient{{Amount: 95}}}, 100},
+		{"rates after an amount", models.SplitRules{Recipients: []models.SplitRecipient{{Amount: 80}, {Rate: "50"}}}, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if fee, shares, err := test.rules.Allocate(test.total); err == nil {
+				t.Fatalf("Allocate(%d) = %d, %v, want an error", test.total, fee, shares)
+			}
+		})
+	}
+}
+
+// TestSplitRulesValidate checks the rules' shape is checked before any amount
+func TestSplitRulesValidate(t *testing.T) {
+	tooMany := make([]models.SplitRecipient, models.MaxSplitRecipients+1)
+	for i := range tooMany {
+		tooMany[i] = models.SplitRecipient{Amount: 1}
+	}
+
+	tests := []struct {
+		name  string
+		rules models.SplitRules
+		err   string
+	}{
+		{"no recipients", models.SplitRules{}, "at least one recipient"},
+		{"too many recipients", models.SplitRules{Recipients: tooMany}, "at most"},
+		{"both fees", models.SplitRules{FeeRate: "1", FeeAmount: 1, Recipients: []models.SplitRecipient{{Amount: 1}}}, "either fee_rate or fee_amount"},
+		{"bad fee rate", models.SplitRules{FeeRate: "0", Recipients: []models.SplitRecipient{{Amount: 1}}}, "fee_rate"},
+		{"rate and amount", models.SplitRules{Recipients: []models.SplitRecipient{{Rate: "10", Amount: 1}}}, "either rate or amount"},
+		{"neither rate nor amount", models.SplitRules{Recipients: []models.SplitRecipient{{}}}, "either rate or amount"},
+		{"rates above 100", models.SplitRules{Recipients: []models.SplitRecipient{{Rate: "60"}, {Rate: "40.0001"}}}, "more than 100%"},
+		{"long label", models.SplitRules{Recipients: []models.SplitRecipient{{Amount: 1, Label: strings.Repeat("a", 101)}}}, "label"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.rules.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Validate = %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
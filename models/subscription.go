@@ -0,0 +1,126 @@
+package models
+
+import (
+	"time"
+)
+
+// SubscriptionStatus represents the billing state of a subscription
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive SubscriptionStatus = "active"
+	// SubscriptionStatusPastDue marks a subscription whose latest invoice
+	// went unpaid; it is being retried under the dunning schedule
+	SubscriptionStatusPastDue   SubscriptionStatus = "past_due"
+	SubscriptionStatusCancelled SubscriptionStatus = "cancelled"
+)
+
+// Subscription billing interval units
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// Subscription webhook event types
+const (
+	EventSubscriptionInvoiceCreated = "subscription.invoice_created"
+	EventSubscriptionPaid           = "subscription.paid"
+	EventSubscriptionPastDue        = "subscription.past_due"
+	EventSubscriptionCancelled      = "subscription.cancelled"
+)
+
+// Subscription bills a merchant's customer a fixed amount every interval.
+// Each billing period is invoiced as a payment linked to the subscription;
+// Period counts the periods invoiced so far and OpenPaymentID is the invoice
+// awaiting payment, if any.
+type Subscription struct {
+	ID                     string                 `json:"id" db:"id"`
+	MerchantID             string                 `json:"merchant_id" db:"merchant_id"`
+	Plan                   string                 `json:"plan" db:"plan"`
+	CustomerReference      string                 `json:"customer_reference,omitempty" db:"customer_reference"`
+	Amount                 uint64                 `json:"amount" db:"amount"`
+	AssetID                uint64                 `json:"asset_id" db:"asset_id"`
+	IntervalUnit           string                 `json:"interval_unit" db:"interval_unit"`
+	IntervalCount          int                    `json:"interval_count" db:"interval_count"`
+	AnchorDate             time.Time              `json:"anchor_date" db:"anchor_date"`
+	GracePeriodSeconds     int                    `json:"grace_period_seconds" db:"grace_period_seconds"`
+	DunningRetries         int                    `json:"dunning_retries" db:"dunning_retries"`
+	DunningIntervalSeconds int                    `json:"dunning_interval_seconds" db:"dunning_interval_seconds"`
+	CallbackURL            string                 `json:"callback_url,omitempty" db:"callback_url"`
+	Metadata               map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	Status                 SubscriptionStatus     `json:"status" db:"status"`
+	Period                 int                    `json:"period" db:"period"`
+	NextBillingAt          time.Time              `json:"next_billing_at" db:"next_billing_at"`
+	OpenPaymentID          string                 `json:"open_payment_id,omitempty" db:"open_payment_id"`
+	Attempt                int                    `json:"attempt" db:"attempt"` // invoices issued for the current period
+	NextRetryAt            *time.Time             `json:"next_retry_at,omitempty" db:"next_retry_at"`
+	LastPaidAt             *time.Time             `json:"last_paid_at,omitempty" db:"last_paid_at"`
+	CancelledAt            *time.Time             `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CreatedAt              time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// BillingDate returns the start of the given zero-based billing period.
+// Monthly and yearly periods keep the anchor's day of month, falling back to
+// the last day of shorter months.
+func (s *Subscription) BillingDate(period int) time.Time {
+	steps := period * s.IntervalCount
+	switch s.IntervalUnit {
+	case IntervalDay:
+		return s.AnchorDate.AddDate(0, 0, steps)
+	case IntervalWeek:
+		return s.AnchorDate.AddDate(0, 0, 7*steps)
+	case IntervalYear:
+		return addMonths(s.AnchorDate, 12*steps)
+	default:
+		return addMonths(s.AnchorDate, steps)
+	}
+}
+
+// addMonths adds months to t, clamping the day to the end of the target month
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	lastDay := time.Date(year, month+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month+time.Month(months), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// SubscriptionRequest represents a subscription creation request. AnchorDate
+// is the first billing date and defaults to now; the grace period and dunning
+// settings default to the server configuration.
+type SubscriptionRequest struct {
+	Plan                   string                 `json:"plan" binding:"required"`
+	CustomerReference      string                 `json:"customer_reference"`
+	Amount                 uint64                 `json:"amount" binding:"required"`
+	AssetID                uint64                 `json:"asset_id"`
+	IntervalUnit           string                 `json:"interval_unit" binding:"required"`
+	IntervalCount          int                    `json:"interval_count"`
+	AnchorDate             *time.Time             `json:"anchor_date"`
+	GracePeriodSeconds     int                    `json:"grace_period_seconds"`
+	DunningRetries         *int                   `json:"dunning_retries"`
+	DunningIntervalSeconds int                    `json:"dunning_interval_seconds"`
+	CallbackURL            string                 `json:"callback_url"`
+	Metadata               map[string]interface{} `json:"metadata"`
+}
+
+// SubscriptionWebhookPayload represents the payload of subscription events
+type SubscriptionWebhookPayload struct {
+	Event             string                 `json:"event"`
+	SubscriptionID    string                 `json:"subscription_id"`
+	Status            SubscriptionStatus     `json:"status"`
+	Plan              string                 `json:"plan"`
+	CustomerReference string                 `json:"customer_reference,omitempty"`
+	PaymentID         string                 `json:"payment_id,omitempty"`
+	Period            int                    `json:"period"`
+	Attempt           int                    `json:"attempt"`
+	Amount            uint64                 `json:"amount"`
+	AssetID           uint64                 `json:"asset_id"`
+	NextBillingAt     time.Time              `json:"next_billing_at"`
+	NextRetryAt       *time.Time             `json:"next_retry_at,omitempty"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp         time.Time              `json:"timestamp"`
+}
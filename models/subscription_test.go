@@ -0,0 +1,41 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"algopay/models"
+)
+
+// TestBillingDate checks billing periods step from the anchor date, keeping
+// its day of month where the month allows
+func TestBillingDate(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		unit   string
+		count  int
+		anchor time.Time
+		period int
+		want   time.Time
+	}{
+		{models.IntervalDay, 1, date(2024, 1, 30), 3, date(2024, 2, 2)},
+		{models.IntervalWeek, 2, date(2024, 1, 1), 2, date(2024, 1, 29)},
+		{models.IntervalMonth, 1, date(2024, 1, 15), 1, date(2024, 2, 15)},
+		{models.IntervalMonth, 1, date(2024, 1, 31), 1, date(2024, 2, 29)},
+		{models.IntervalMonth, 1, date(2023, 1, 31), 1, date(2023, 2, 28)},
+		{models.IntervalMonth, 1, date(2024, 1, 31), 2, date(2024, 3, 31)}, // from the anchor, not February
+		{models.IntervalMonth, 3, date(2024, 11, 30), 1, date(2025, 2, 28)},
+		{models.IntervalYear, 1, date(2024, 2, 29), 1, date(2025, 2, 28)},
+		{models.IntervalYear, 1, date(2024, 2, 29), 4, date(2028, 2, 29)},
+		{models.IntervalMonth, 1, date(2024, 5, 10), 0, date(2024, 5, 10)},
+	}
+	for _, test := range tests {
+		sub := &models.Subscription{IntervalUnit: test.unit, IntervalCount: test.count, AnchorDate: test.anchor}
+		if got := sub.BillingDate(test.period); !got.Equal(test.want) {
+			t.Errorf("%d %s from %s, period %d = %s, want %s",
+				test.count, test.unit, test.anchor.Format(time.DateOnly), test.period, got.Format(time.DateOnly), test.want.Format(time.DateOnly))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition matches every TransitionError
+var ErrInvalidTransition = errors.New("invalid payment status transition")
+
+// paymentTransitions lists the statuses each status may move to. Completed,
+// failed and refunded payments are final.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending: {
+		PaymentStatusCompleted,
+		PaymentStatusExpired,
+		PaymentStatusCancelled,
+		PaymentStatusFailed,
+		PaymentStatusLatePayment, // funds arrived after expiry, before the expiry job ran
+	},
+	PaymentStatusExpired:   {PaymentStatusLatePayment},
+	PaymentStatusCancelled: {PaymentStatusLatePayment},
+	PaymentStatusLatePayment: {
+		PaymentStatusCompleted, // accepted by the merchant
+		PaymentStatusRefunding,
+		PaymentStatusRefunded, // refunded by the merchant outside the gateway
+	},
+	PaymentStatusRefunding: {
+		PaymentStatusRefunded,
+		PaymentStatusLatePayment, // the refund transfer failed
+	},
+}
+
+// TransitionError reports a status change the payment state machine does not allow
+type TransitionError struct {
+	From PaymentStatus
+	To   PaymentStatus
+}
+
+// Error implements error
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("payment cannot move from %s to %s", e.From, e.To)
+}
+
+// Is makes errors.Is(err, ErrInvalidTransition) match any TransitionError
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// CanTransitionTo reports whether a payment may move from s to the given status
+func (s PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, next := range paymentTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransition returns a *TransitionError unless a payment may move from
+// one status to the other
+func CheckTransition(from, to PaymentStatus) error {
+	if !from.CanTransitionTo(to) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
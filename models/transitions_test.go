@@ -0,0 +1,55 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"algopay/models"
+)
+
+// TestCheckTransition checks the payment state machine allows exactly the
+// listed status changes
+func TestCheckTransition(t *testing.T) {
+	statuses := []models.PaymentStatus{
+		models.PaymentStatusPending,
+		models.PaymentStatusCompleted,
+		models.PaymentStatusExpired,
+		models.PaymentStatusCancelled,
+		models.PaymentStatusFailed,
+		models.PaymentStatusLatePayment,
+		models.PaymentStatusRefunding,
+		models.PaymentStatusRefunded,
+	}
+	allowed := map[[2]models.PaymentStatus]bool{
+		{models.PaymentStatusPending, models.PaymentStatusCompleted}:     true,
+		{models.PaymentStatusPending, models.PaymentStatusExpired}:       true,
+		{models.PaymentStatusPending, models.PaymentStatusCancelled}:     true,
+		{models.PaymentStatusPending, models.PaymentStatusFailed}:        true,
+		{models.PaymentStatusPending, models.PaymentStatusLatePayment}:   true,
+		{models.PaymentStatusExpired, models.PaymentStatusLatePayment}:   true,
+		{models.PaymentStatusCancelled, models.PaymentStatusLatePayment}: true,
+		{models.PaymentStatusLatePayment, models.PaymentStatusCompleted}: true,
+		{models.PaymentStatusLatePayment, models.PaymentStatusRefunding}: true,
+		{models.PaymentStatusLatePayment, models.PaymentStatusRefunded}:  true,
+		{models.PaymentStatusRefunding, models.PaymentStatusRefunded}:    true,
+		{models.PaymentStatusRefunding, models.PaymentStatusLatePayment}: true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			err := models.CheckTransition(from, to)
+			if want := allowed[[2]models.PaymentStatus{from, to}]; want != (err == nil) {
+				t.Errorf("CheckTransition(%s, %s) = %v, want allowed %v", from, to, err, want)
+				continue
+			}
+			if err == nil {
+				continue
+			}
+			var transitionErr *models.TransitionError
+			if !errors.Is(err, models.ErrInvalidTransition) || !errors.As(err, &transitionErr) ||
+				transitionErr.From != from || transitionErr.To != to {
+				t.Errorf("CheckTransition(%s, %s) = %#v, want a TransitionError", from, to, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package parquet writes Parquet files of flat, nullable columns using plain
+// encoding without compression, which every Parquet reader understands. Rows
+// are buffered in memory one row group at a time, so large files are written
+// as they are produced.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column's values
+type Type int
+
+const (
+	String    Type = iota // UTF-8 text
+	Int64                 // signed 64-bit integer; uint64 values must fit
+	Timestamp             // milliseconds since the Unix epoch, UTC
+	Boolean
+)
+
+// Column describes one column of a file
+type Column struct {
+	Name string
+	Type Type
+}
+
+// DefaultRowGroupSize is the number of rows buffered before a row group is written
+const DefaultRowGroupSize = 10000
+
+// magic opens and closes every Parquet file
+const magic = "PAR1"
+
+// Parquet physical types, repetition types, converted types and encodings
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalByteArray = 6
+
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+// Writer writes rows to a Parquet file
+type Writer struct {
+	w            io.Writer
+	columns      []Column
+	buffers      []columnBuffer
+	groups       []rowGroup
+	RowGroupSize int
+
+	offset    int64 // bytes written so far
+	groupRows int   // rows buffered for the current row group
+	numRows   int64
+	err       error
+}
+
+// columnBuffer holds a column's values for the current row group
+type columnBuffer struct {
+	values  bytes.Buffer // plain-encoded non-null values
+	bools   []bool       // non-null values of boolean columns
+	present []bool       // whether each row has a value
+}
+
+// rowGroup records where a written row group's column chunks are
+type rowGroup struct {
+	chunks   []columnChunk
+	numRows  int64
+	byteSize int64
+}
+
+// columnChunk records a written column chunk, which holds one data page
+type columnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// NewWriter starts a Parquet file with the given columns
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	writer := &Writer{
+		w:            w,
+		columns:      columns,
+		buffers:      make([]columnBuffer, len(columns)),
+		RowGroupSize: DefaultRowGroupSize,
+	}
+	if err := writer.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Write adds a row with one value per column. A nil value is null; other
+// values must be a string for String columns, an int, int64 or uint64 for
+// Int64 columns, a time.Time or *time.Time for Timestamp columns and a bool
+// for Boolean columns. A uint64 above math.MaxInt64 is an error rather than
+// wrapping to a negative value.
+func (w *Writer) Write(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.columns))
+	}
+
+	// A rejected value leaves the row half buffered, so the writer keeps the
+	// error rather than let later rows misalign the columns
+	for i, value := range row {
+		if err := w.buffers[i].add(w.columns[i], value); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	w.groupRows++
+	w.numRows++
+
+	if w.groupRows >= w.RowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes any buffered rows and the file footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.groupRows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+
+	footer := w.fileMetadata()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(length[:]); err != nil {
+		return err
+	}
+	return w.write([]byte(magic))
+}
+
+// add appends a value to the buffer
+func (b *columnBuffer) add(column Column, value interface{}) error {
+	if t, ok := value.(*time.Time); ok {
+		if t == nil {
+			value = nil
+		} else {
+			value = *t
+		}
+	}
+	if value == nil {
+		b.present = append(b.present, false)
+		return nil
+	}
+
+	var scratch [8]byte
+	switch column.Type {
+	case String:
+		s, ok := value.(string)
+		if !ok {
+			return typeError(column, value)
+		}
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(s)))
+		b.values.Write(scratch[:4])
+		b.values.WriteString(s)
+	case Int64, Timestamp:
+		var v int64
+		switch n := value.(type) {
+		case int:
+			v = int64(n)
+		case int64:
+			v = n
+		case uint64:
+			if n > math.MaxInt64 {
+				return fmt.Errorf("parquet: column %s cannot hold %d, which overflows int64", column.Name, n)
+			}
+			v = int64(n)
+		case time.Time:
+			if column.Type != Timestamp {
+				return typeError(column, value)
+			}
+			v = n.UnixMilli()
+		default:
+			return typeError(column, value)
+		}
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		b.values.Write(scratch[:])
+	case Boolean:
+		v, ok := value.(bool)
+		if !ok {
+			return typeError(column, value)
+		}
+		b.bools = append(b.bools, v)
+	}
+	b.present = append(b.present, true)
+	return nil
+}
+
+// typeError reports a value of the wrong type for its column
+func typeError(column Column, value interface{}) error {
+	return fmt.Errorf("parquet: column %s cannot hold a %T", column.Name, value)
+}
+
+// flush writes the buffered rows as a row group, one data page per column
+func (w *Writer) flush() error {
+	group := rowGroup{numRows: int64(w.groupRows)}
+	for i := range w.columns {
+		buffer := &w.buffers[i]
+		page := buffer.page()
+		header := pageHeader(len(buffer.present), len(page))
+
+		chunk := columnChunk{
+			offset:    w.offset,
+			size:      int64(len(header) + len(page)),
+			numValues: int64(len(buffer.present)),
+		}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.byteSize += chunk.size
+		*buffer = columnBuffer{}
+	}
+	w.groups = append(w.groups, group)
+	w.groupRows = 0
+	return nil
+}
+
+// page encodes the buffer as the body of a data page: definition levels
+// followed by the plain-encoded values
+func (b *columnBuffer) page() []byte {
+	levels := bitPack(b.present)
+	var page bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+
+	// Definition levels use the RLE/bit-packing hybrid with a bit width of 1,
+	// written as a single bit-packed run and prefixed with their length
+	header := scratch[:binary.PutUvarint(scratch[:], uint64(len(levels))<<1|1)]
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(header)+len(levels)))
+	page.Write(length[:])
+	page.Write(header)
+	page.Write(levels)
+
+	if b.bools != nil {
+		page.Write(bitPack(b.bools))
+	} else {
+		page.Write(b.values.Bytes())
+	}
+	return page.Bytes()
+}
+
+// bitPack packs booleans eight to a byte, least significant bit first
+func bitPack(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// pageHeader encodes the header of an uncompressed data page
+func pageHeader(numValues, size int) []byte {
+	var t thriftWriter
+	t.beginStruct()
+	t.i32Field(1, 0) // DATA_PAGE
+	t.i32Field(2, int32(size))
+	t.i32Field(3, int32(size))
+	t.structField(5)
+	t.i32Field(1, int32(numValues))
+	t.i32Field(2, encodingPlain)
+	t.i32Field(3, encodingRLE)
+	t.i32Field(4, encodingRLE)
+	t.endStruct()
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+// fileMetadata encodes the file footer describing the schema and row groups
+func (w *Writer) fileMetadata() []byte {
+	var t thriftWriter
+	t.beginStruct()
+	t.i32Field(1, 1)
+
+	t.listField(2, compactStruct, len(w.columns)+1)
+	t.beginStruct()
+	t.stringField(4, "schema")
+	t.i32Field(5, int32(len(w.columns)))
+	t.endStruct()
+	for _, column := range w.columns {
+		t.beginStruct()
+		t.i32Field(1, physicalType(column.Type))
+		t.i32Field(3, repetitionOptional)
+		t.stringField(4, column.Name)
+		switch column.Type {
+		case String:
+			t.i32Field(6, convertedUTF8)
+		case Timestamp:
+			t.i32Field(6, convertedTimestampMillis)
+		}
+		t.endStruct()
+	}
+
+	t.i64Field(3, w.numRows)
+
+	t.listField(4, compactStruct, len(w.groups))
+	for _, group := range w.groups {
+		t.beginStruct()
+		t.listField(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			t.beginStruct()
+			t.i64Field(2, chunk.offset)
+			t.structField(3)
+			t.i32Field(1, physicalType(w.columns[i].Type))
+			t.listField(2, compactI32, 2)
+			t.i32(encodingPlain)
+			t.i32(encodingRLE)
+			t.listField(3, compactBinary, 1)
+			t.binary(w.columns[i].Name)
+			t.i32Field(4, 0) // UNCOMPRESSED
+			t.i64Field(5, chunk.numValues)
+			t.i64Field(6, chunk.size)
+			t.i64Field(7, chunk.size)
+			t.i64Field(9, chunk.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64Field(2, group.byteSize)
+		t.i64Field(3, group.numRows)
+		t.endStruct()
+	}
+
+	t.stringField(6, "algopay")
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+// physicalType maps a column type to its Parquet physical type
+func physicalType(columnType Type) int32 {
+	switch columnType {
+	case String:
+		return physicalByteArray
+	case Boolean:
+		return physicalBoolean
+	default:
+		return physicalInt64
+	}
+}
+
+// write writes to the underlying writer, remembering the first error
+func (w *Writer) write(p []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
@@ -0,0 +1,258 @@
+package parquet_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"algopay/parquet"
+
+	parquetgo "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// columns exercises every column type
+var columns = []parquet.Column{
+	{Name: "id", Type: parquet.String},
+	{Name: "amount", Type: parquet.Int64},
+	{Name: "created_at", Type: parquet.Timestamp},
+	{Name: "late", Type: parquet.Boolean},
+}
+
+// readFile opens a file with parquet-go and returns it with all of its rows
+func readFile(t *testing.T, data []byte) (*parquetgo.File, []parquetgo.Row) {
+	t.Helper()
+	file, err := parquetgo.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	reader := parquetgo.NewReader(file)
+	defer reader.Close()
+
+	var rows []parquetgo.Row
+	for {
+		batch := make([]parquetgo.Row, 3)
+		n, err := reader.ReadRows(batch)
+		rows = append(rows, batch[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadRows: %v", err)
+		}
+	}
+	return file, rows
+}
+
+// value returns the value of the named column in a row
+func value(t *testing.T, file *parquetgo.File, row parquetgo.Row, name string) parquetgo.Value {
+	t.Helper()
+	leaf, ok := file.Schema().Lookup(name)
+	if !ok {
+		t.Fatalf("no column %s", name)
+	}
+	for _, v := range row {
+		if v.Column() == leaf.ColumnIndex {
+			return v
+		}
+	}
+	t.Fatalf("row has no value for column %s", name)
+	return parquetgo.Value{}
+}
+
+// TestWriterRoundTrip writes rows across several row groups and reads them
+// back with parquet-go
+func TestWriterRoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 14, 15, 9, 26, 535000000, time.UTC)
+	rows := [][]interface{}{
+		{"pay-1", 1500000, created, false},
+		{"pay-2", int64(-7), &created, true},
+		{nil, nil, nil, nil},
+		{"", uint64(math.MaxInt64), (*time.Time)(nil), false},
+		{"paiement-é", int64(0), created.Add(-time.Hour), true},
+	}
+
+	var out bytes.Buffer
+	writer, err := parquet.NewWriter(&out, columns)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	writer.RowGroupSize = 2
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			t.Fatalf("Write(%v): %v", row, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, read := readFile(t, out.Bytes())
+	if file.NumRows() != int64(len(rows)) {
+		t.Fatalf("NumRows = %d, want %d", file.NumRows(), len(rows))
+	}
+	if groups := len(file.RowGroups()); groups != 3 {
+		t.Fatalf("row groups = %d, want 3", groups)
+	}
+	if len(read) != len(rows) {
+		t.Fatalf("read %d rows, want %d", len(read), len(rows))
+	}
+
+	schema := file.Metadata().Schema
+	wantTypes := []struct {
+		physical  format.Type
+		converted *deprecated.ConvertedType
+	}{
+		{format.ByteArray, convertedType(deprecated.UTF8)},
+		{format.Int64, nil},
+		{format.Int64, convertedType(deprecated.TimestampMillis)},
+		{format.Boolean, nil},
+	}
+	for i, want := range wantTypes {
+		element := schema[i+1]
+		if element.Name != columns[i].Name || *element.Type != want.physical ||
+			*element.RepetitionType != format.Optional {
+			t.Fatalf("schema element %d = %s %v %v", i, element.Name, *element.Type, *element.RepetitionType)
+		}
+		if (element.ConvertedType == nil) != (want.converted == nil) ||
+			(want.converted != nil && *element.ConvertedType != *want.converted) {
+			t.Fatalf("column %s converted type = %v, want %v", element.Name, element.ConvertedType, want.converted)
+		}
+	}
+
+	check := func(row int, name string, want interface{}) {
+		t.Helper()
+		v := value(t, file, read[row], name)
+		var got interface{}
+		switch {
+		case v.IsNull():
+			got = nil
+		case name == "id":
+			got = string(v.ByteArray())
+		case name == "late":
+			got = v.Boolean()
+		default:
+			got = v.Int64()
+		}
+		if got != want {
+			t.Fatalf("row %d %s = %v, want %v", row, name, got, want)
+		}
+	}
+	check(0, "id", "pay-1")
+	check(0, "amount", int64(1500000))
+	check(0, "created_at", created.UnixMilli())
+	check(0, "late", false)
+	check(1, "amount", int64(-7))
+	check(1, "created_at", created.UnixMilli())
+	check(1, "late", true)
+	for _, name := range []string{"id", "amount", "created_at", "late"} {
+		check(2, name, nil)
+	}
+	check(3, "id", "")
+	check(3, "amount", int64(math.MaxInt64))
+	check(3, "created_at", nil)
+	check(4, "id", "paiement-é")
+	check(4, "amount", int64(0))
+	check(4, "created_at", created.Add(-time.Hour).UnixMilli())
+}
+
+// convertedType returns a pointer to a converted type
+func convertedType(t deprecated.ConvertedType) *deprecated.ConvertedType {
+	return &t
+}
+
+// TestWriterWideSchema checks the footer of a file with more columns than
+// fit in a short Thrift list header
+func TestWriterWideSchema(t *testing.T) {
+	var wide []parquet.Column
+	var row []interface{}
+	for i := 0; i < 20; i++ {
+		wide = append(wide, parquet.Column{Name: fmt.Sprintf("c%02d", i), Type: parquet.String})
+		row = append(row, fmt.Sprintf("v%02d", i))
+	}
+
+	var out bytes.Buffer
+	writer, err := parquet.NewWriter(&out, wide)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := writer.Write(row); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, read := readFile(t, out.Bytes())
+	if len(read) != 1 || len(file.Schema().Fields()) != len(wide) {
+		t.Fatalf("read %d rows with %d columns", len(read), len(file.Schema().Fields()))
+	}
+	for i, column := range wide {
+		if got := string(value(t, file, read[0], column.Name).ByteArray()); got != row[i] {
+			t.Fatalf("%s = %q, want %q", column.Name, got, row[i])
+		}
+	}
+}
+
+// TestWriterEmpty checks a file with no rows is still readable
+func TestWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	writer, err := parquet.NewWriter(&out, columns)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	file, read := readFile(t, out.Bytes())
+	if file.NumRows() != 0 || len(read) != 0 {
+		t.Fatalf("empty file has %d rows", file.NumRows())
+	}
+}
+
+// TestWriterRejectsValues checks values a column cannot hold are errors and
+// stop the writer
+func TestWriterRejectsValues(t *testing.T) {
+	tests := []struct {
+		name string
+		row  []interface{}
+	}{
+		{"uint64 overflow", []interface{}{"a", uint64(math.MaxInt64) + 1, nil, nil}},
+		{"max uint64", []interface{}{"a", uint64(math.MaxUint64), nil, nil}},
+		{"string in int column", []interface{}{"a", "12", nil, nil}},
+		{"int in string column", []interface{}{12, nil, nil, nil}},
+		{"time in int column", []interface{}{"a", time.Now(), nil, nil}},
+		{"int in boolean column", []interface{}{"a", nil, nil, 1}},
+		{"short row", []interface{}{"a", 1, nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer, err := parquet.NewWriter(io.Discard, columns)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			if err := writer.Write(test.row); err == nil {
+				t.Fatalf("Write(%v) succeeded", test.row)
+			}
+		})
+	}
+
+	// A rejected value fails the rest of the file rather than misaligning it
+	writer, err := parquet.NewWriter(io.Discard, columns)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := writer.Write([]interface{}{"a", uint64(math.MaxUint64), nil, nil}); err == nil {
+		t.Fatal("Write of an overflowing uint64 succeeded")
+	}
+	if err := writer.Write([]interface{}{"b", 1, nil, nil}); err == nil {
+		t.Fatal("Write after a rejected row succeeded")
+	}
+	if err := writer.Close(); err == nil {
+		t.Fatal("Close after a rejected row succeeded")
+	}
+}
@@ -0,0 +1,102 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, which
+// Parquet uses for page headers and file metadata
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID []int16 // last field ID written in each open struct
+}
+
+// beginStruct opens a struct, at the top level or as a field or list element
+func (t *thriftWriter) beginStruct() {
+	t.lastID = append(t.lastID, 0)
+}
+
+// endStruct writes the stop field and closes the innermost struct
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	t.lastID = t.lastID[:len(t.lastID)-1]
+}
+
+// fieldHeader writes the header of a field in the innermost struct
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := &t.lastID[len(t.lastID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+// i32Field writes a 32-bit integer field
+func (t *thriftWriter) i32Field(id int16, v int32) {
+	t.fieldHeader(id, compactI32)
+	t.varint(zigzag(int64(v)))
+}
+
+// i64Field writes a 64-bit integer field
+func (t *thriftWriter) i64Field(id int16, v int64) {
+	t.fieldHeader(id, compactI64)
+	t.varint(zigzag(v))
+}
+
+// stringField writes a string field
+func (t *thriftWriter) stringField(id int16, s string) {
+	t.fieldHeader(id, compactBinary)
+	t.binary(s)
+}
+
+// structField opens a struct-valued field; close it with endStruct
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, compactStruct)
+	t.beginStruct()
+}
+
+// listField writes the header of a list field whose size elements follow
+func (t *thriftWriter) listField(id int16, elemType byte, size int) {
+	t.fieldHeader(id, compactList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elemType)
+	t.varint(uint64(size))
+}
+
+// i32 writes a bare 32-bit integer, as a list element
+func (t *thriftWriter) i32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+// binary writes a bare string, as a list element
+func (t *thriftWriter) binary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// varint writes an unsigned LEB128 integer
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+// zigzag maps signed integers to unsigned ones so small magnitudes stay small
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
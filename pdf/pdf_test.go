@@ -0,0 +1,188 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// streamPattern matches the dictionary and keyword opening a content stream
+var streamPattern = regexp.MustCompile(`<< /Length (\d+) >>\nstream\n`)
+
+// checkStructure parses a document's cross-reference table and trailer and
+// checks every offset points at the object it names. It returns the number
+// of objects.
+func checkStructure(t *testing.T, data []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatalf("document starts %q", data[:min(len(data), 16)])
+	}
+	if !bytes.HasSuffix(data, []byte("\n%%EOF\n")) {
+		t.Fatalf("document does not end with %%%%EOF")
+	}
+
+	start := bytes.LastIndex(data, []byte("startxref\n"))
+	if start < 0 {
+		t.Fatal("no startxref")
+	}
+	line := strings.TrimSuffix(string(data[start+len("startxref\n"):]), "\n%%EOF\n")
+	xref, err := strconv.Atoi(line)
+	if err != nil {
+		t.Fatalf("startxref %q: %v", line, err)
+	}
+	if xref != bytes.LastIndex(data, []byte("xref\n0 ")) || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	table := data[xref+len("xref\n"):]
+	var first, size int
+	if _, err := fmt.Sscanf(string(table), "%d %d\n", &first, &size); err != nil {
+		t.Fatalf("xref subsection header: %v", err)
+	}
+	if first != 0 {
+		t.Fatalf("xref starts at object %d, want 0", first)
+	}
+	table = table[bytes.IndexByte(table, '\n')+1:]
+
+	// Entries are exactly 20 bytes, including the two-byte line ending
+	if len(table) < size*20 {
+		t.Fatalf("xref table has room for %d entries, want %d", len(table)/20, size)
+	}
+	if entry := string(table[:20]); entry != "0000000000 65535 f \n" {
+		t.Fatalf("xref entry 0 = %q", entry)
+	}
+	for i := 1; i < size; i++ {
+		entry := string(table[i*20 : (i+1)*20])
+		var offset, generation int
+		var kind string
+		if _, err := fmt.Sscanf(entry, "%010d %05d %s \n", &offset, &generation, &kind); err != nil || kind != "n" || generation != 0 {
+			t.Fatalf("xref entry %d = %q", i, entry)
+		}
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q, want %q", i, data[offset:min(len(data), offset+12)], want)
+		}
+	}
+
+	trailer := string(table[size*20:])
+	want := fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, xref)
+	if trailer != want {
+		t.Fatalf("trailer = %q, want %q", trailer, want)
+	}
+
+	for _, match := range streamPattern.FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		if end := data[match[1]+length:]; !bytes.HasPrefix(end, []byte("endstream\n")) {
+			t.Fatalf("stream at %d with /Length %d is followed by %q", match[0], length, end[:min(len(end), 12)])
+		}
+	}
+	return size - 1
+}
+
+// TestDocumentStructure checks the cross-reference table, trailer and page
+// tree of a multi-page document
+func TestDocumentStructure(t *testing.T) {
+	doc := New("Invoice (draft) \\ 2026")
+	for i := 0; i < 3; i++ {
+		page := doc.AddPage()
+		page.FillRect(0, PageHeight-8, PageWidth, 8, Color{R: 0.1, G: 0.45, B: 0.91})
+		page.Text(50, 780, 16, true, Black, fmt.Sprintf("Page (%d) – Zürich", i+1))
+		page.TextRight(545, 760, 10, false, Black, "right\\aligned")
+		page.Line(50, 700, 545, 700, 0.5, Black)
+	}
+	data := doc.Bytes()
+
+	if objects := checkStructure(t, data); objects != 5+2*3 {
+		t.Fatalf("document has %d objects, want %d", objects, 5+2*3)
+	}
+	if !bytes.Contains(data, []byte("/Kids [6 0 R 8 0 R 10 0 R] /Count 3")) {
+		t.Fatal("page tree does not list the three pages")
+	}
+	if !bytes.Contains(data, []byte(`/Title (Invoice \(draft\) \\ 2026)`)) {
+		t.Fatal("title is not escaped in the document information dictionary")
+	}
+}
+
+// TestEmptyDocument checks a document without pages gets one blank page
+func TestEmptyDocument(t *testing.T) {
+	data := New("").Bytes()
+	if objects := checkStructure(t, data); objects != 7 {
+		t.Fatalf("document has %d objects, want 7", objects)
+	}
+	if !bytes.Contains(data, []byte("/Kids [6 0 R] /Count 1")) {
+		t.Fatal("empty document has no page")
+	}
+}
+
+// TestTextEncoding checks how strings are encoded and escaped in content
+// streams
+func TestTextEncoding(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Plain text", "(Plain text)"},
+		{"Total (incl. tax)", `(Total \(incl. tax\))`},
+		{"unbalanced ) and (", `(unbalanced \) and \()`},
+		{`C:\path\`, `(C:\\path\\)`},
+		{`\(`, `(\\\()`},
+		{"Café Zürich", "(Caf\xe9 Z\xfcrich)"},
+		{"Ørsted A/S ©", "(\xd8rsted A/S \xa9)"},
+		{"東京商事", "(????)"},
+		{"Coffee ☕", "(Coffee ?)"},
+		{"tab\there", "(tab here)"},
+		{"line\nbreak\r", "(line?break?)"},
+		{"", "()"},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			page := &Page{}
+			page.Text(10, 20, 12, false, Black, test.text)
+			want := "0 0 0 rg BT /F1 12 Tf 10 20 Td " + test.want + " Tj ET\n"
+			if got := page.content.String(); got != want {
+				t.Fatalf("content = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestTextWidth checks widths come from the font metrics, one glyph per
+// character
+func TestTextWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		bold bool
+		want float64
+	}{
+		{"", false, 0},
+		{"A", false, 6.67},
+		{"A", true, 7.22},
+		{"(a)", false, 3.33 + 5.56 + 3.33},
+		{"é", false, 5.56},
+		{"東", false, 5.56},
+	}
+	for _, test := range tests {
+		got := TextWidth(test.text, 10, test.bold)
+		if diff := got - test.want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("TextWidth(%q, bold %v) = %v, want %v", test.text, test.bold, got, test.want)
+		}
+	}
+}
+
+// TestNum checks numbers are formatted without trailing zeros
+func TestNum(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0",
+		595:     "595",
+		0.5:     "0.5",
+		12.3456: "12.346",
+		-4.25:   "-4.25",
+	}
+	for f, want := range tests {
+		if got := num(f); got != want {
+			t.Errorf("num(%v) = %q, want %q", f, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HTTPSource fetches rates from a price service. It requests
+// GET <url>?asset_id=<id>&currency=<code> and expects a Quote as JSON; a 404
+// response means the service has no rate for the pair.
+type HTTPSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSource creates a source querying the given endpoint
+func NewHTTPSource(endpoint string, timeout time.Duration) (*HTTPSource, error) {
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid price URL: %w", err)
+	}
+	return &HTTPSource{
+		url:    endpoint,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Name identifies the source in stored quotes
+func (s *HTTPSource) Name() string {
+	return "http"
+}
+
+// Quote fetches the current rate for an asset in a currency
+func (s *HTTPSource) Quote(ctx context.Context, assetID uint64, currency string) (*Quote, error) {
+	query := url.Values{}
+	query.Set("asset_id", strconv.FormatUint(assetID, 10))
+	query.Set("currency", currency)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w for asset %d in %s", ErrRateUnavailable, assetID, currency)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("price service returned status %d", resp.StatusCode)
+	}
+
+	var quote Quote
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&quote); err != nil {
+		return nil, fmt.Errorf("failed to decode rate: %w", err)
+	}
+	if quote.AssetID != assetID || quote.Currency != currency {
+		return nil, fmt.Errorf("price service answered for asset %d in %s", quote.AssetID, quote.Currency)
+	}
+	if _, err := ParseDecimal(quote.Rate); err != nil {
+		return nil, fmt.Errorf("price service returned %w", err)
+	}
+	if quote.Timestamp.IsZero() {
+		quote.Timestamp = time.Now()
+	}
+
+	// Record this gateway's source name rather than whatever the service reports
+	quote.Source = s.Name()
+	return &quote, nil
+}
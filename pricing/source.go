@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"algopay/models"
+)
+
+// ErrRateUnavailable is returned when a source has no rate for an asset and currency
+var ErrRateUnavailable = errors.New("rate unavailable")
+
+// currencyPattern matches ISO 4217 style currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Quote is the price of one whole unit of an asset in a fiat currency
+type Quote struct {
+	AssetID   uint64    `json:"asset_id"`
+	Currency  string    `json:"currency"`
+	Rate      string    `json:"rate"` // decimal fiat amount per whole asset unit
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	// Fixed marks rates set by hand rather than quoted live, which stay in
+	// force until changed and are not held to a maximum age
+	Fixed bool `json:"-"`
+}
+
+// Source provides fiat exchange rates for assets
+type Source interface {
+	// Name identifies the source in stored quotes
+	Name() string
+	// Quote returns the current rate for an asset in a currency
+	Quote(ctx context.Context, assetID uint64, currency string) (*Quote, error)
+}
+
+// NewSource creates the source named by kind: "static" reads rates from path
+// and "http" queries endpoint. An empty kind returns a nil source, which
+// disables fiat pricing.
+func NewSource(kind, path, endpoint string, timeout time.Duration) (Source, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "static":
+		return NewStaticSource(path)
+	case "http":
+		return NewHTTPSource(endpoint, timeout)
+	default:
+		return nil, fmt.Errorf("unknown price source %q", kind)
+	}
+}
+
+// NormalizeCurrency upper-cases a currency code and checks its format
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !currencyPattern.MatchString(currency) {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+	return currency, nil
+}
+
+// ParseDecimal parses a positive decimal string into an exact rational
+func ParseDecimal(value string) (*big.Rat, error) {
+	if !models.DecimalPattern.MatchString(value) {
+		return nil, fmt.Errorf("invalid decimal %q", value)
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid decimal %q", value)
+	}
+	return r, nil
+}
+
+// ToBaseUnits converts a fiat amount to asset base units at the quoted rate,
+// rounding up so the merchant never receives less than the fiat amount
+func ToBaseUnits(fiatAmount string, quote *Quote, decimals uint64) (uint64, error) {
+	amount, err := ParseDecimal(fiatAmount)
+	if err != nil {
+		return 0, err
+	}
+	rate, err := ParseDecimal(quote.Rate)
+	if err != nil {
+		return 0, fmt.Errorf("bad rate from %s: %w", quote.Source, err)
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), new(big.Int).SetUint64(decimals), nil)
+	units := new(big.Rat).Quo(amount, rate)
+	units.Mul(units, new(big.Rat).SetInt(scale))
+
+	// Ceiling of the exact quotient
+	result, remainder := new(big.Int).QuoRem(units.Num(), units.Denom(), new(big.Int))
+	if remainder.Sign() > 0 {
+		result.Add(result, big.NewInt(1))
+	}
+
+	if !result.IsUint64() {
+		return 0, errors.New("converted amount is too large")
+	}
+	return result.Uint64(), nil
+}
@@ -0,0 +1,99 @@
+package pricing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"algopay/pricing"
+)
+
+// writePriceFile writes a static price file and returns its path
+func writePriceFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write price file: %v", err)
+	}
+	return path
+}
+
+// TestStaticSource checks rates and timestamps served from a price file
+func TestStaticSource(t *testing.T) {
+	path := writePriceFile(t, `{
+		"updated_at": "2024-01-15T10:00:00Z",
+		"rates": {"0": {"usd": "0.18", "EUR": "0.17"}, "31566704": {"USD": "1.00"}}
+	}`)
+	source, err := pricing.NewStaticSource(path)
+	if err != nil {
+		t.Fatalf("NewStaticSource: %v", err)
+	}
+	if source.Name() != "static" {
+		t.Fatalf("Name = %q, want static", source.Name())
+	}
+
+	quote, err := source.Quote(context.Background(), 0, "USD")
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	updatedAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	if quote.AssetID != 0 || quote.Currency != "USD" || quote.Rate != "0.18" ||
+		quote.Source != "static" || !quote.Timestamp.Equal(updatedAt) || !quote.Fixed {
+		t.Fatalf("quote = %+v", quote)
+	}
+	if quote, err := source.Quote(context.Background(), 31566704, "USD"); err != nil || quote.Rate != "1.00" {
+		t.Fatalf("USDC quote = %+v, %v", quote, err)
+	}
+
+	for _, pair := range []struct {
+		assetID  uint64
+		currency string
+	}{{0, "GBP"}, {31566704, "EUR"}, {42, "USD"}} {
+		if _, err := source.Quote(context.Background(), pair.assetID, pair.currency); !errors.Is(err, pricing.ErrRateUnavailable) {
+			t.Errorf("Quote(%d, %s): err = %v, want ErrRateUnavailable", pair.assetID, pair.currency, err)
+		}
+	}
+}
+
+// TestStaticSourceWithoutTimestamp checks rates without updated_at are
+// stamped with the time they are quoted
+func TestStaticSourceWithoutTimestamp(t *testing.T) {
+	source, err := pricing.NewStaticSource(writePriceFile(t, `{"rates": {"0": {"USD": "0.18"}}}`))
+	if err != nil {
+		t.Fatalf("NewStaticSource: %v", err)
+	}
+	before := time.Now()
+	quote, err := source.Quote(context.Background(), 0, "USD")
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if quote.Timestamp.Before(before) || quote.Timestamp.After(time.Now()) {
+		t.Fatalf("timestamp %s is not the time of the quote", quote.Timestamp)
+	}
+}
+
+// TestStaticSourceRejectsBadFiles checks invalid price files fail to load
+func TestStaticSourceRejectsBadFiles(t *testing.T) {
+	tests := map[string]string{
+		"malformed JSON":     `{"rates": `,
+		"bad currency":       `{"rates": {"0": {"US": "0.18"}}}`,
+		"negative rate":      `{"rates": {"0": {"USD": "-0.18"}}}`,
+		"zero rate":          `{"rates": {"0": {"USD": "0"}}}`,
+		"rate with exponent": `{"rates": {"0": {"USD": "1e3"}}}`,
+		"non-numeric asset":  `{"rates": {"algo": {"USD": "0.18"}}}`,
+	}
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := pricing.NewStaticSource(writePriceFile(t, contents)); err == nil {
+				t.Fatal("NewStaticSource succeeded")
+			}
+		})
+	}
+
+	if _, err := pricing.NewStaticSource(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("NewStaticSource of a missing file succeeded")
+	}
+}
@@ -0,0 +1,39 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// StubHandler serves quotes from a source in the format HTTPSource expects.
+// Backed by a StaticSource it acts as a local price service for development
+// and tests.
+func StubHandler(source Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assetID, err := strconv.ParseUint(r.URL.Query().Get("asset_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid asset_id", http.StatusBadRequest)
+			return
+		}
+		currency, err := NormalizeCurrency(r.URL.Query().Get("currency"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quote, err := source.Quote(r.Context(), assetID, currency)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, ErrRateUnavailable) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quote)
+	})
+}
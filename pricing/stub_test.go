@@ -0,0 +1,106 @@
+package pricing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"algopay/pricing"
+)
+
+// failingSource is a source whose lookups always fail
+type failingSource struct{}
+
+// Name identifies the source in stored quotes
+func (failingSource) Name() string {
+	return "failing"
+}
+
+// Quote returns an error
+func (failingSource) Quote(ctx context.Context, assetID uint64, currency string) (*pricing.Quote, error) {
+	return nil, errors.New("upstream down")
+}
+
+// newStubServer serves a static price file through StubHandler
+func newStubServer(t *testing.T, contents string) *httptest.Server {
+	t.Helper()
+	static, err := pricing.NewStaticSource(writePriceFile(t, contents))
+	if err != nil {
+		t.Fatalf("NewStaticSource: %v", err)
+	}
+	server := httptest.NewServer(pricing.StubHandler(static))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHTTPSourceFromStub fetches rates from a stub price service
+func TestHTTPSourceFromStub(t *testing.T) {
+	server := newStubServer(t, `{
+		"updated_at": "2024-01-15T10:00:00Z",
+		"rates": {"0": {"USD": "0.18"}}
+	}`)
+	source, err := pricing.NewHTTPSource(server.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewHTTPSource: %v", err)
+	}
+
+	quote, err := source.Quote(context.Background(), 0, "USD")
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	// The quote keeps the service's timestamp but records this gateway's source
+	if quote.AssetID != 0 || quote.Currency != "USD" || quote.Rate != "0.18" || quote.Source != "http" ||
+		!quote.Timestamp.Equal(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)) || quote.Fixed {
+		t.Fatalf("quote = %+v", quote)
+	}
+
+	if _, err := source.Quote(context.Background(), 0, "EUR"); !errors.Is(err, pricing.ErrRateUnavailable) {
+		t.Fatalf("Quote of a missing rate: err = %v, want ErrRateUnavailable", err)
+	}
+}
+
+// TestStubHandler checks the stub's responses to bad requests and failing
+// sources
+func TestStubHandler(t *testing.T) {
+	server := newStubServer(t, `{"rates": {"0": {"USD": "0.18"}}}`)
+	failing := httptest.NewServer(pricing.StubHandler(failingSource{}))
+	defer failing.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"rate", server.URL + "?asset_id=0&currency=usd", http.StatusOK},
+		{"missing rate", server.URL + "?asset_id=7&currency=USD", http.StatusNotFound},
+		{"missing asset", server.URL + "?currency=USD", http.StatusBadRequest},
+		{"bad asset", server.URL + "?asset_id=-1&currency=USD", http.StatusBadRequest},
+		{"bad currency", server.URL + "?asset_id=0&currency=dollars", http.StatusBadRequest},
+		{"failing source", failing.URL + "?asset_id=0&currency=USD", http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := http.Get(test.url)
+			if err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+
+	// An HTTP source reports a failing service as an error other than a
+	// missing rate
+	source, err := pricing.NewHTTPSource(failing.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewHTTPSource: %v", err)
+	}
+	if _, err := source.Quote(context.Background(), 0, "USD"); err == nil || errors.Is(err, pricing.ErrRateUnavailable) {
+		t.Fatalf("Quote from a failing service: err = %v", err)
+	}
+}
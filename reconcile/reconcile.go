@@ -0,0 +1,315 @@
+// Package reconcile compares stored payments with the transfers the chain
+// recorded to merchant addresses.
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"algopay/algorand"
+	"algopay/db"
+	"algopay/models"
+
+	"github.com/google/uuid"
+)
+
+// Reconciler runs reconciliation against the database and the indexer
+type Reconciler struct {
+	database db.Store
+	chain    *algorand.Client
+}
+
+// New creates a reconciler
+func New(database db.Store, chain *algorand.Client) *Reconciler {
+	return &Reconciler{database: database, chain: chain}
+}
+
+// run holds the state of one reconciliation run
+type run struct {
+	*Reconciler
+	report    *models.ReconciliationReport
+	addresses map[string]string // receiving address to merchant ID
+	transfers map[string]*algorand.Transaction
+	lookedUp  map[string]*algorand.Transaction // transfers outside the window, by ID
+}
+
+// Run reconciles the window and returns the report without storing it. It
+// reports inbound transfers no payment claims, payments whose transaction is
+// missing or does not match, and transactions claimed by several payments.
+func (r *Reconciler) Run(window models.ReconciliationWindow) (*models.ReconciliationReport, error) {
+	if err := window.Validate(); err != nil {
+		return nil, err
+	}
+
+	state := &run{
+		Reconciler: r,
+		report: &models.ReconciliationReport{
+			ID:            uuid.New().String(),
+			Window:        window,
+			Discrepancies: []models.Discrepancy{},
+			StartedAt:     time.Now(),
+		},
+		transfers: map[string]*algorand.Transaction{},
+		lookedUp:  map[string]*algorand.Transaction{},
+	}
+
+	var err error
+	state.addresses, err = r.database.ReconciliationAddresses(window.MerchantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load merchant addresses: %w", err)
+	}
+	state.report.Addresses = len(state.addresses)
+
+	transfers, err := state.loadTransfers()
+	if err != nil {
+		return nil, err
+	}
+	payments, err := state.loadPayments()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := state.checkPayments(payments); err != nil {
+		return nil, err
+	}
+	state.checkTransfers(transfers, payments)
+
+	state.report.FinishedAt = time.Now()
+	return state.report, nil
+}
+
+// loadTransfers pulls the inbound transfers of every address in the window
+func (s *run) loadTransfers() ([]*algorand.Transaction, error) {
+	window := algorand.TransferWindow{
+		MinRound: s.report.Window.MinRound,
+		MaxRound: s.report.Window.MaxRound,
+	}
+	if s.report.Window.After != nil {
+		window.After = *s.report.Window.After
+	}
+	if s.report.Window.Before != nil {
+		window.Before = *s.report.Window.Before
+	}
+
+	addresses := make([]string, 0, len(s.addresses))
+	for address := range s.addresses {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	var transfers []*algorand.Transaction
+	for _, address := range addresses {
+		found, err := s.chain.InboundTransfers(address, window)
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			transfer := &found[i]
+			s.transfers[transfer.ID] = transfer
+			transfers = append(transfers, transfer)
+		}
+	}
+	s.report.TransfersChecked = len(transfers)
+	return transfers, nil
+}
+
+// loadPayments loads the payments active in the window together with every
+// payment that claims one of its transfers
+func (s *run) loadPayments() ([]*models.Payment, error) {
+	from, to, err := s.timeBounds()
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.database.ReconciliationPayments(s.report.Window.MerchantID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments: %w", err)
+	}
+
+	txnIDs := make([]string, 0, len(s.transfers))
+	for id := range s.transfers {
+		txnIDs = append(txnIDs, id)
+	}
+	claiming, err := s.database.GetPaymentsByTxnIDs(txnIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments by transaction: %w", err)
+	}
+
+	seen := map[string]bool{}
+	var payments []*models.Payment
+	for _, payment := range append(active, claiming...) {
+		if !seen[payment.ID] {
+			seen[payment.ID] = true
+			payments = append(payments, payment)
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool {
+		return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+	})
+	s.report.PaymentsChecked = len(payments)
+	return payments, nil
+}
+
+// timeBounds converts the window to the times payments are selected by;
+// rounds are converted through their block times
+func (s *run) timeBounds() (from, to time.Time, err error) {
+	window := s.report.Window
+	if window.After != nil {
+		from = *window.After
+	} else if window.MinRound != 0 {
+		if from, err = s.chain.RoundTime(window.MinRound); err != nil {
+			return from, to, err
+		}
+	}
+	if window.Before != nil {
+		to = *window.Before
+	} else if window.MaxRound != 0 {
+		if to, err = s.chain.RoundTime(window.MaxRound); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
+
+// checkPayments compares each payment with the transaction it claims
+func (s *run) checkPayments(payments []*models.Payment) error {
+	byTxn := map[string][]*models.Payment{}
+	var txnIDs []string
+	for _, payment := range payments {
+		if len(byTxn[payment.TxnID]) == 0 {
+			txnIDs = append(txnIDs, payment.TxnID)
+		}
+		byTxn[payment.TxnID] = append(byTxn[payment.TxnID], payment)
+	}
+
+	for _, txnID := range txnIDs {
+		claims := byTxn[txnID]
+		transfer, err := s.transfer(txnID)
+		if err != nil {
+			return err
+		}
+
+		if len(claims) > 1 {
+			discrepancy := models.Discrepancy{
+				Kind:       models.DiscrepancyDuplicateTransaction,
+				MerchantID: claims[0].MerchantID,
+				TxnID:      txnID,
+				AssetID:    claims[0].PaidAssetID(),
+			}
+			for _, payment := range claims {
+				discrepancy.PaymentIDs = append(discrepancy.PaymentIDs, payment.ID)
+			}
+			if transfer != nil {
+				discrepancy.Address = transfer.Receiver
+				discrepancy.Amount = transfer.Amount
+				discrepancy.Round = transfer.Round
+			}
+			s.report.Discrepancies = append(s.report.Discrepancies, discrepancy)
+		}
+
+		for _, payment := range claims {
+			if s.checkPayment(payment, transfer) && len(claims) == 1 {
+				s.report.Matched++
+			}
+		}
+	}
+	return nil
+}
+
+// checkPayment compares a payment with its transfer, which is nil when the
+// transaction is missing, and reports whether they match
+func (s *run) checkPayment(payment *models.Payment, transfer *algorand.Transaction) bool {
+	discrepancy := func(kind models.DiscrepancyKind, expected, actual string) models.Discrepancy {
+		d := models.Discrepancy{
+			Kind:       kind,
+			MerchantID: payment.MerchantID,
+			PaymentIDs: []string{payment.ID},
+			TxnID:      payment.TxnID,
+			Address:    payment.MerchantAddress,
+			AssetID:    payment.PaidAssetID(),
+			Expected:   expected,
+			Actual:     actual,
+		}
+		if transfer != nil {
+			d.Amount = transfer.Amount
+			d.Round = transfer.Round
+		}
+		return d
+	}
+
+	if transfer == nil {
+		s.report.Discrepancies = append(s.report.Discrepancies, discrepancy(models.DiscrepancyMissingTransaction, "", ""))
+		return false
+	}
+
+	before := len(s.report.Discrepancies)
+	if transfer.Receiver != payment.MerchantAddress {
+		s.report.Discrepancies = append(s.report.Discrepancies,
+			discrepancy(models.DiscrepancyReceiverMismatch, payment.MerchantAddress, transfer.Receiver))
+	}
+	if transfer.AssetID != payment.PaidAssetID() {
+		s.report.Discrepancies = append(s.report.Discrepancies,
+			discrepancy(models.DiscrepancyAssetMismatch, strconv.FormatUint(payment.PaidAssetID(), 10), strconv.FormatUint(transfer.AssetID, 10)))
+	} else if expected, ok := expectedAmount(payment, transfer.Amount); !ok {
+		s.report.Discrepancies = append(s.report.Discrepancies,
+			discrepancy(models.DiscrepancyAmountMismatch, strconv.FormatUint(expected, 10), strconv.FormatUint(transfer.Amount, 10)))
+	}
+	return len(s.report.Discrepancies) == before
+}
+
+// expectedAmount returns the amount a payment's transfer should have moved
+// and whether amount matches it: the received amount when one was recorded,
+// otherwise at least the amount of the option that settled the payment
+func expectedAmount(payment *models.Payment, amount uint64) (uint64, bool) {
+	if payment.ReceivedAmount != 0 {
+		return payment.ReceivedAmount, amount == payment.ReceivedAmount
+	}
+	expected := payment.Amount
+	for _, option := range payment.Options() {
+		if option.AssetID == payment.PaidAssetID() {
+			expected = option.Amount
+		}
+	}
+	return expected, amount >= expected
+}
+
+// checkTransfers reports transfers in the window that no payment claims
+func (s *run) checkTransfers(transfers []*algorand.Transaction, payments []*models.Payment) {
+	claimed := map[string]bool{}
+	for _, payment := range payments {
+		claimed[payment.TxnID] = true
+	}
+
+	for _, transfer := range transfers {
+		if claimed[transfer.ID] {
+			continue
+		}
+		s.report.Discrepancies = append(s.report.Discrepancies, models.Discrepancy{
+			Kind:       models.DiscrepancyUnmatchedTransfer,
+			MerchantID: s.addresses[transfer.Receiver],
+			TxnID:      transfer.ID,
+			Address:    transfer.Receiver,
+			AssetID:    transfer.AssetID,
+			Amount:     transfer.Amount,
+			Round:      transfer.Round,
+		})
+	}
+}
+
+// transfer returns the transfer with the ID, looking up transfers outside the
+// window in the indexer; it returns nil when the transaction does not exist
+func (s *run) transfer(txnID string) (*algorand.Transaction, error) {
+	if transfer, ok := s.transfers[txnID]; ok {
+		return transfer, nil
+	}
+	if transfer, ok := s.lookedUp[txnID]; ok {
+		return transfer, nil
+	}
+	transfer, err := s.chain.LookupTransfer(txnID)
+	if err != nil {
+		return nil, err
+	}
+	s.lookedUp[txnID] = transfer
+	return transfer, nil
+}
@@ -0,0 +1,169 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"algopay/algorand"
+	"algopay/db"
+	"algopay/models"
+)
+
+// transfer builds an indexer transaction paying amount of the asset to receiver
+func transfer(id, receiver string, assetID, amount, round uint64) map[string]interface{} {
+	txn := map[string]interface{}{
+		"id":              id,
+		"sender":          "PAYER",
+		"confirmed-round": round,
+		"round-time":      time.Now().Unix(),
+	}
+	if assetID == 0 {
+		txn["tx-type"] = "pay"
+		txn["payment-transaction"] = map[string]interface{}{"receiver": receiver, "amount": amount}
+	} else {
+		txn["tx-type"] = "axfer"
+		txn["asset-transfer-transaction"] = map[string]interface{}{"receiver": receiver, "amount": amount, "asset-id": assetID}
+	}
+	return txn
+}
+
+// serveIndexer serves each address's inbound transfers, listed newest first
+// as the indexer lists them, and lookups of single transactions in the
+// indexer's JSON format
+func serveIndexer(t *testing.T, accounts map[string][]map[string]interface{}, lookups map[string]map[string]interface{}) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/accounts/{address}/transactions", func(w http.ResponseWriter, r *http.Request) {
+		transactions := accounts[r.PathValue("address")]
+		if transactions == nil {
+			transactions = []map[string]interface{}{}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"current-round": 100, "transactions": transactions})
+	})
+	mux.HandleFunc("GET /v2/transactions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		txn, ok := lookups[r.PathValue("id")]
+		if !ok {
+			http.Error(w, `{"message":"no transaction found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"current-round": 100, "transaction": txn})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// TestRun checks each kind of discrepancy is reported against the chain and
+// matching payments are counted
+func TestRun(t *testing.T) {
+	database, err := db.NewDatabase(filepath.Join(t.TempDir(), "algopay.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer database.Close()
+	if _, err := database.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	now := time.Now()
+	if err := database.CreateMerchant(&models.Merchant{
+		ID: "m1", DisplayName: "Shop", ReceivingAddress: "SHOP", AcceptedAssets: []uint64{0},
+		LatePaymentAction: "manual", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("CreateMerchant: %v", err)
+	}
+	paid := func(id, txnID string, amount, received uint64) {
+		t.Helper()
+		settled := uint64(0)
+		payment := &models.Payment{
+			ID: id, MerchantID: "m1", MerchantAddress: "SHOP", Amount: amount,
+			Status: models.PaymentStatusPending, CreatedAt: now, UpdatedAt: now, ExpiresAt: now.Add(time.Hour),
+		}
+		if err := database.CreatePayment(payment, models.PaymentCaps{}); err != nil {
+			t.Fatalf("CreatePayment: %v", err)
+		}
+		payment.Status = models.PaymentStatusCompleted
+		payment.TxnID = txnID
+		payment.SettledAssetID = &settled
+		payment.ReceivedAmount = received
+		if err := database.RecordPaymentMatch(payment); err != nil {
+			t.Fatalf("RecordPaymentMatch: %v", err)
+		}
+	}
+	paid("matched", "T-MATCHED", 1000, 1000)
+	paid("overpaid", "T-OVERPAID", 1000, 0) // no received amount: at least the amount matches
+	paid("short", "T-SHORT", 1000, 500)
+	paid("asset", "T-ASSET", 1000, 1000)
+	paid("missing", "T-MISSING", 1000, 1000)
+	paid("redirected", "T-REDIRECTED", 1000, 1000)
+	paid("first", "T-TWICE", 1000, 1000)
+	paid("second", "T-TWICE", 1000, 1000)
+
+	indexerURL := serveIndexer(t,
+		map[string][]map[string]interface{}{"SHOP": {
+			transfer("T-STRAY", "SHOP", 0, 42, 9),
+			transfer("T-TWICE", "SHOP", 0, 1000, 8),
+			transfer("T-ASSET", "SHOP", 31566704, 1000, 7),
+			transfer("T-SHORT", "SHOP", 0, 1000, 6),
+			transfer("T-OVERPAID", "SHOP", 0, 1500, 5),
+			transfer("T-MATCHED", "SHOP", 0, 1000, 4),
+		}},
+		// Transfers outside the window or to other addresses are looked up
+		map[string]map[string]interface{}{
+			"T-REDIRECTED": transfer("T-REDIRECTED", "ELSEWHERE", 0, 1000, 3),
+		},
+	)
+	chain, err := algorand.NewClient("http://127.0.0.1:1", indexerURL, "")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	after, before := now.Add(-time.Hour), now.Add(time.Hour)
+	if _, err := New(database, chain).Run(models.ReconciliationWindow{}); err == nil {
+		t.Error("Run without a window succeeded")
+	}
+	report, err := New(database, chain).Run(models.ReconciliationWindow{MerchantID: "m1", After: &after, Before: &before})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Addresses != 1 || report.TransfersChecked != 6 || report.PaymentsChecked != 8 || report.Matched != 2 {
+		t.Errorf("report = %d addresses, %d transfers, %d payments, %d matched, want 1, 6, 8 and 2",
+			report.Addresses, report.TransfersChecked, report.PaymentsChecked, report.Matched)
+	}
+
+	got := map[models.DiscrepancyKind]models.Discrepancy{}
+	var kinds []string
+	for _, d := range report.Discrepancies {
+		got[d.Kind] = d
+		kinds = append(kinds, string(d.Kind))
+	}
+	slices.Sort(kinds)
+	want := []string{"amount_mismatch", "asset_mismatch", "duplicate_transaction", "missing_transaction", "receiver_mismatch", "unmatched_transfer"}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("discrepancies = %v, want %v", kinds, want)
+	}
+
+	if d := got[models.DiscrepancyAmountMismatch]; d.PaymentIDs[0] != "short" || d.Expected != "500" || d.Actual != "1000" {
+		t.Errorf("amount mismatch = %+v", d)
+	}
+	if d := got[models.DiscrepancyAssetMismatch]; d.PaymentIDs[0] != "asset" || d.Expected != "0" || d.Actual != "31566704" {
+		t.Errorf("asset mismatch = %+v", d)
+	}
+	if d := got[models.DiscrepancyReceiverMismatch]; d.PaymentIDs[0] != "redirected" || d.Actual != "ELSEWHERE" || d.Round != 3 {
+		t.Errorf("receiver mismatch = %+v", d)
+	}
+	if d := got[models.DiscrepancyMissingTransaction]; d.PaymentIDs[0] != "missing" || d.TxnID != "T-MISSING" {
+		t.Errorf("missing transaction = %+v", d)
+	}
+	if d := got[models.DiscrepancyDuplicateTransaction]; len(d.PaymentIDs) != 2 || d.Amount != 1000 {
+		t.Errorf("duplicate transaction = %+v", d)
+	}
+	if d := got[models.DiscrepancyUnmatchedTransfer]; d.TxnID != "T-STRAY" || d.MerchantID != "m1" || d.Amount != 42 || d.Round != 9 {
+		t.Errorf("unmatched transfer = %+v", d)
+	}
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultTimeout is used when the policy does not set one
+const defaultTimeout = 10 * time.Second
+
+// SignatureHeader carries the HMAC signature of signed webhook requests
+const SignatureHeader = "X-AlgoPay-Signature"
+
+// Client delivers webhook requests according to a Policy
+type Client struct {
+	policy     Policy
+	httpClient *http.Client
+}
+
+// NewClient creates a webhook client that enforces the given policy at dial time
+func NewClient(policy Policy) *Client {
+	policy.Timeout = policy.timeout()
+
+	dialer := &net.Dialer{
+		Timeout: policy.Timeout,
+		Control: policy.dialControl,
+	}
+
+	transport := &http.Transport{
+		// Never route callbacks through an environment proxy, which would
+		// bypass the address checks in dialControl
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   policy.Timeout,
+		ResponseHeaderTimeout: policy.Timeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Client{
+		policy: policy,
+		httpClient: &http.Client{
+			Timeout:       policy.Timeout,
+			Transport:     transport,
+			CheckRedirect: policy.checkRedirect,
+		},
+	}
+}
+
+// Policy returns the policy enforced by the client
+func (c *Client) Policy() Policy {
+	return c.policy
+}
+
+// ValidateURL checks a callback URL against the client policy
+func (c *Client) ValidateURL(rawURL string) error {
+	return c.policy.ValidateURL(rawURL)
+}
+
+// Post sends a JSON body to the callback URL and returns the response status code;
+// the request is signed when a secret is given
+func (c *Client) Post(rawURL string, body []byte, secret string) (int, error) {
+	if _, err := c.policy.parseURL(rawURL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "AlgoPay-Webhook/1.0")
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, time.Now().Unix(), body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a bounded amount of the body so the connection can be reused
+	// without letting the receiver stream unbounded data at us
+	io.Copy(io.Discard, io.LimitReader(resp.Body, c.policy.MaxResponseBytes))
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a webhook body, in the form
+// t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// checkRedirect limits the number of redirects and re-applies the scheme allowlist
+func (p Policy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.MaxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > p.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", p.MaxRedirects)
+	}
+	return p.checkScheme(req.URL)
+}
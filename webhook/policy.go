@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrSchemeNotAllowed is returned for callback URLs outside the scheme allowlist
+	ErrSchemeNotAllowed = errors.New("callback URL scheme not allowed")
+	// ErrBlockedAddress is returned when a callback host resolves to a non-public address
+	ErrBlockedAddress = errors.New("callback URL resolves to a blocked address")
+)
+
+// blockedPrefixes lists special-purpose ranges not covered by the netip helpers
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, includes broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, may embed private IPv4
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// Policy controls which callback URLs are accepted and how they are called
+type Policy struct {
+	AllowedSchemes   []string
+	AllowPrivateIPs  bool
+	Timeout          time.Duration
+	MaxResponseBytes int64
+	MaxRedirects     int
+}
+
+// ValidateURL checks a callback URL against the policy, resolving its host
+func (p Policy) ValidateURL(rawURL string) error {
+	u, err := p.parseURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if p.AllowPrivateIPs {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve callback host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if err := checkAddr(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseURL parses a callback URL and applies the checks that need no network access
+func (p Policy) parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid callback URL: %w", err)
+	}
+	if err := p.checkScheme(u); err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("callback URL must include a host")
+	}
+	if u.User != nil {
+		return nil, errors.New("callback URL must not include credentials")
+	}
+	return u, nil
+}
+
+// checkScheme verifies the URL scheme is in the allowlist
+func (p Policy) checkScheme(u *url.URL) error {
+	for _, scheme := range p.AllowedSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+}
+
+// timeout returns the configured timeout or the default
+func (p Policy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return p.Timeout
+}
+
+// dialControl rejects connections to blocked addresses after DNS resolution,
+// so a host that re-resolves to an internal address is still refused
+func (p Policy) dialControl(network, address string, _ syscall.RawConn) error {
+	if p.AllowPrivateIPs {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid dial address %q: %w", address, err)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid dial address %q: %w", address, err)
+	}
+	return checkAddr(ip)
+}
+
+// checkAddr returns ErrBlockedAddress for loopback, private and reserved addresses
+func checkAddr(ip netip.Addr) error {
+	if isBlockedAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
+
+// isBlockedAddr reports whether an address is not publicly routable
+func isBlockedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}